@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Headers set by the authenticating gateway in front of the API. They are
+// only believed on requests that come from the gateway; see Options.
+const (
+	HeaderActorID   = "X-Actor-ID"
+	HeaderActorRole = "X-Actor-Role"
+	// HeaderGatewaySecret carries the secret shared with the gateway
+	HeaderGatewaySecret = "X-Gateway-Secret"
+)
+
+const (
+	RoleAdmin      = "admin"
+	RoleCompliance = "compliance"
+	// RoleSystem marks changes made by background jobs
+	RoleSystem = "system"
+)
+
+// ErrUnauthenticated is returned when a route needs an actor and none was given
+var ErrUnauthenticated = errors.New("authentication required")
+
+// ErrForbidden is returned when the actor's role may not use a route
+var ErrForbidden = errors.New("forbidden")
+
+// Actor is whoever made a request or ran a job
+type Actor struct {
+	ID   string `json:"id"`
+	Role string `json:"role,omitempty"`
+}
+
+// Anonymous is the actor for requests without identity headers
+var Anonymous = Actor{ID: "anonymous"}
+
+// System returns the actor for a background job
+func System(job string) Actor {
+	return Actor{ID: "system:" + job, Role: RoleSystem}
+}
+
+type actorKey struct{}
+
+// WithActor returns a context carrying actor
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor in ctx, or Anonymous
+func ActorFrom(ctx context.Context) Actor {
+	if actor, ok := ctx.Value(actorKey{}).(Actor); ok {
+		return actor
+	}
+	return Anonymous
+}
+
+// Options say which requests come from the gateway. A request does if it
+// arrives directly from one of TrustedProxies, or if GatewaySecret is set and
+// the request carries it in X-Gateway-Secret. With neither configured every
+// request is anonymous.
+type Options struct {
+	// TrustedProxies are the addresses or CIDRs of the gateway
+	TrustedProxies []string
+	// GatewaySecret is a secret only the gateway knows
+	GatewaySecret string
+}
+
+// Middleware reads the actor from the gateway headers into the request
+// context. Identity headers on requests that do not come from the gateway
+// are ignored and the request is anonymous.
+func Middleware(opts Options) (gin.HandlerFunc, error) {
+	var nets []*net.IPNet
+	for _, proxy := range opts.TrustedProxies {
+		if ip := net.ParseIP(proxy); ip != nil {
+			bits := 8 * len(ip.To4())
+			if bits == 0 {
+				bits = 8 * net.IPv6len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy must be an IP address or CIDR, got %q", proxy)
+		}
+		nets = append(nets, n)
+	}
+
+	fromGateway := func(c *gin.Context) bool {
+		if opts.GatewaySecret != "" {
+			secret := c.GetHeader(HeaderGatewaySecret)
+			if subtle.ConstantTimeCompare([]byte(secret), []byte(opts.GatewaySecret)) == 1 {
+				return true
+			}
+		}
+		// The connection's own address, never X-Forwarded-For
+		host, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+		if err != nil {
+			host = c.Request.RemoteAddr
+		}
+		ip := net.ParseIP(host)
+		if ip == nil {
+			return false
+		}
+		for _, n := range nets {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(c *gin.Context) {
+		actor := Anonymous
+		if id := c.GetHeader(HeaderActorID); id != "" && fromGateway(c) {
+			actor = Actor{ID: id, Role: c.GetHeader(HeaderActorRole)}
+		}
+		c.Request = c.Request.WithContext(WithActor(c.Request.Context(), actor))
+		c.Next()
+	}, nil
+}
+
+// RequireRole refuses requests unless the actor has one of roles
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actor := ActorFrom(c.Request.Context())
+		if actor == Anonymous {
+			c.Error(ErrUnauthenticated)
+			c.Abort()
+			return
+		}
+		for _, role := range roles {
+			if actor.Role == role {
+				c.Next()
+				return
+			}
+		}
+		c.Error(ErrForbidden)
+		c.Abort()
+	}
+}
@@ -0,0 +1,457 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/database"
+	"backend/ratelimit"
+	"backend/services"
+	"backend/telemetry"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Config is the complete runtime configuration. Each setting is resolved from,
+// in order of precedence: command-line flags, environment variables, the JSON
+// file named by -config (or CONFIG_FILE), then the defaults.
+type Config struct {
+	Port            string
+	ShutdownTimeout time.Duration
+	LogLevel        string
+	TraceExporter   string
+
+	Database database.Options
+
+	// CORSAllowOrigins lists the browser origins allowed to call the API
+	CORSAllowOrigins []string
+
+	// TrustedProxies lists proxy addresses or CIDRs whose X-Forwarded-For is
+	// believed when identifying clients, and whose actor headers are believed
+	// when identifying callers; empty uses the connection address
+	TrustedProxies []string
+	// GatewaySecret, when set, lets requests carrying it in X-Gateway-Secret
+	// set the actor headers from outside TrustedProxies
+	GatewaySecret string
+
+	// RateLimitEnabled turns the API rate limiter on
+	RateLimitEnabled bool
+	// RateLimitClient is the default per-client limit for API routes
+	RateLimitClient ratelimit.Limit
+	// RateLimitUser is the default limit per :userId for API routes
+	RateLimitUser ratelimit.Limit
+	// RateLimitReward is the per-client limit for POST /reward
+	RateLimitReward ratelimit.Limit
+
+	// PriceRefreshInterval is how often prices are refreshed while the market is open
+	PriceRefreshInterval time.Duration
+	// MarketHolidaysFile is the exchange holiday list; empty searches data/nse_holidays.txt
+	MarketHolidaysFile string
+	// FeeSchedulePath is a JSON fee schedule; empty uses the built-in rates
+	FeeSchedulePath string
+	// Services are the staleness, refresh, reward, order, depository,
+	// dividend and tax settings; the calendar and fees come from the files above
+	Services services.Options
+
+	settings []setting
+	flags    *flag.FlagSet
+}
+
+// setting ties a flag (whose name is also the config file key) to its environment variable
+type setting struct {
+	name   string
+	env    string
+	secret bool
+}
+
+// Default returns the configuration used when nothing is overridden
+func Default() *Config {
+	return &Config{
+		Port:                 "8080",
+		ShutdownTimeout:      30 * time.Second,
+		LogLevel:             logrus.InfoLevel.String(),
+		TraceExporter:        defaultTraceExporter(),
+		Database:             database.DefaultOptions(),
+		CORSAllowOrigins:     []string{"http://localhost:3000", "http://localhost:3001"},
+		RateLimitEnabled:     true,
+		RateLimitClient:      ratelimit.Limit{Requests: 120, Period: time.Minute},
+		RateLimitUser:        ratelimit.Limit{Requests: 60, Period: time.Minute},
+		RateLimitReward:      ratelimit.Limit{Requests: 20, Period: time.Minute},
+		PriceRefreshInterval: 1 * time.Hour,
+		Services:             services.DefaultOptions(),
+	}
+}
+
+// defaultTraceExporter exports over OTLP when a collector endpoint is configured
+func defaultTraceExporter() string {
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "" {
+		return telemetry.ExporterOTLP
+	}
+	return telemetry.ExporterNone
+}
+
+// Load resolves the configuration from args (usually os.Args[1:]), the
+// environment and the config file, then validates it
+func Load(args []string) (*Config, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("stocky", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a JSON config file (env CONFIG_FILE)")
+	cfg.bind(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	// Flags given on the command line win over the file and the environment
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	if *configFile != "" {
+		values, err := readFile(*configFile)
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range values {
+			if fs.Lookup(name) == nil || name == "config" {
+				return nil, fmt.Errorf("unknown setting %q in %s", name, *configFile)
+			}
+			if explicit[name] {
+				continue
+			}
+			if err := fs.Set(name, value); err != nil {
+				return nil, fmt.Errorf("invalid %s in %s: %w", name, *configFile, err)
+			}
+		}
+	}
+
+	for _, s := range cfg.settings {
+		if explicit[s.name] {
+			continue
+		}
+		if value := os.Getenv(s.env); value != "" {
+			if err := fs.Set(s.name, value); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", s.env, err)
+			}
+		}
+	}
+
+	// The rate limiter allows bursts of one second's worth of requests
+	cfg.Services.PriceRefresh.Burst = int(math.Max(1, math.Ceil(cfg.Services.PriceRefresh.RequestsPerSecond)))
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// bind registers a flag for every setting
+func (c *Config) bind(fs *flag.FlagSet) {
+	c.flags = fs
+
+	c.stringVar(&c.Port, "port", "PORT", "HTTP listen port")
+	c.durationVar(&c.ShutdownTimeout, "shutdown-timeout", "SHUTDOWN_TIMEOUT", "time allowed to drain requests and jobs on shutdown")
+	c.stringVar(&c.LogLevel, "log-level", "LOG_LEVEL", "log level: debug, info, warn or error")
+	c.stringVar(&c.TraceExporter, "trace-exporter", "OTEL_TRACES_EXPORTER", "trace exporter: otlp, stdout or none")
+
+	c.stringVar(&c.Database.Server, "database-server", "DATABASE_SERVER", "SQL Server host")
+	c.stringVar(&c.Database.Port, "database-port", "DATABASE_PORT", "SQL Server port")
+	c.stringVar(&c.Database.User, "database-user", "DATABASE_USER", "SQL Server user")
+	c.secretVar(&c.Database.Password, "database-password", "DATABASE_PASSWORD", "SQL Server password")
+	c.stringVar(&c.Database.Name, "database-name", "DATABASE_NAME", "database name")
+	c.stringVar(&c.Database.Encrypt, "database-encrypt", "DATABASE_ENCRYPT", "TLS mode: true, strict, false or disable")
+	c.boolVar(&c.Database.TrustServerCertificate, "database-trust-server-certificate", "DATABASE_TRUST_SERVER_CERTIFICATE", "skip server certificate verification (development only)")
+	c.stringVar(&c.Database.CertificateFile, "database-ca-file", "DATABASE_CA_FILE", "PEM CA bundle used to verify the server certificate")
+	c.stringVar(&c.Database.HostNameInCertificate, "database-hostname-in-certificate", "DATABASE_HOSTNAME_IN_CERTIFICATE", "host name expected in the server certificate")
+	c.durationVar(&c.Database.ConnectTimeout, "database-connect-timeout", "DATABASE_CONNECT_TIMEOUT", "timeout for opening a connection")
+	c.intVar(&c.Database.MaxOpenConns, "database-max-open-conns", "DATABASE_MAX_OPEN_CONNS", "maximum open connections (0 is unlimited)")
+	c.intVar(&c.Database.MaxIdleConns, "database-max-idle-conns", "DATABASE_MAX_IDLE_CONNS", "maximum idle connections")
+	c.durationVar(&c.Database.ConnMaxLifetime, "database-conn-max-lifetime", "DATABASE_CONN_MAX_LIFETIME", "maximum lifetime of a connection (0 is unlimited)")
+	c.durationVar(&c.Database.ConnMaxIdleTime, "database-conn-max-idle-time", "DATABASE_CONN_MAX_IDLE_TIME", "maximum idle time of a connection (0 is unlimited)")
+
+	c.listVar(&c.CORSAllowOrigins, "cors-allow-origins", "CORS_ALLOW_ORIGINS", "comma-separated origins allowed to call the API")
+
+	c.listVar(&c.TrustedProxies, "trusted-proxies", "TRUSTED_PROXIES", "comma-separated proxy addresses or CIDRs allowed to set X-Forwarded-For and the actor headers")
+	c.secretVar(&c.GatewaySecret, "gateway-secret", "GATEWAY_SECRET", "secret the gateway sends in X-Gateway-Secret to vouch for the actor headers")
+	c.boolVar(&c.RateLimitEnabled, "rate-limit-enabled", "RATE_LIMIT_ENABLED", "enforce API rate limits")
+	c.limitVar(&c.RateLimitClient, "rate-limit-client", "RATE_LIMIT_CLIENT", "requests per client per route, as 120/1m, or off")
+	c.limitVar(&c.RateLimitUser, "rate-limit-user", "RATE_LIMIT_USER", "requests per userId per route, as 60/1m, or off")
+	c.limitVar(&c.RateLimitReward, "rate-limit-reward", "RATE_LIMIT_REWARD", "POST /reward requests per client, as 20/1m, or off")
+
+	c.durationVar(&c.PriceRefreshInterval, "price-refresh-interval", "PRICE_REFRESH_INTERVAL", "how often prices are refreshed while the market is open")
+	c.durationVar(&c.Services.Staleness.StaleAfter, "price-stale-after", "PRICE_STALE_AFTER", "age after which a price is flagged stale")
+	c.durationVar(&c.Services.Staleness.MaxIssuanceAge, "price-max-issuance-age", "PRICE_MAX_ISSUANCE_AGE", "oldest price a reward may be issued against")
+	c.stringVar(&c.Services.Staleness.StaleIssuance, "stale-price-issuance", "STALE_PRICE_ISSUANCE", "what to do with rewards when the price is too old: queue or refuse")
+	c.boolVar(&c.Services.Staleness.FailReadiness, "price-stale-fails-readiness", "PRICE_STALE_FAILS_READINESS", "fail readiness while prices have not refreshed within PRICE_STALE_AFTER (false only warns)")
+	c.intVar(&c.Services.PriceRefresh.Workers, "price-refresh-workers", "PRICE_REFRESH_WORKERS", "concurrent price fetches per refresh run")
+	c.floatVar(&c.Services.PriceRefresh.RequestsPerSecond, "price-refresh-rate-limit", "PRICE_REFRESH_RATE_LIMIT", "price provider requests per second")
+	c.durationVar(&c.Services.PriceRefresh.Timeout, "price-refresh-timeout", "PRICE_REFRESH_TIMEOUT", "time limit for one refresh run")
+	c.stringVar(&c.MarketHolidaysFile, "market-holidays-file", "MARKET_HOLIDAYS_FILE", "exchange holiday list")
+	c.stringVar(&c.FeeSchedulePath, "fee-schedule-file", "FEE_SCHEDULE_FILE", "JSON fee schedule")
+	c.durationVar(&c.Services.Orders.FillTimeout, "order-fill-timeout", "ORDER_FILL_TIMEOUT", "how long a reward or redemption order may stay open before it is cancelled")
+	c.durationVar(&c.Services.Orders.AggregationWindow, "order-aggregation-window", "ORDER_AGGREGATION_WINDOW", "how long pending rewards are batched into one order per symbol (0 orders each at once)")
+
+	c.floatVar(&c.Services.RewardRules.MaxQuantity, "reward-max-quantity", "REWARD_MAX_QUANTITY", "most shares one reward may grant (0 is unlimited)")
+	c.floatVar(&c.Services.RewardRules.UserDailyINRCap, "reward-user-daily-inr-cap", "REWARD_USER_DAILY_INR_CAP", "most INR value rewarded to a user per IST day (0 is unlimited)")
+	c.floatMapVar(&c.Services.RewardRules.EventTypeDailyINRCaps, "reward-event-type-daily-inr-caps", "REWARD_EVENT_TYPE_DAILY_INR_CAPS", "per-user daily INR caps by event type, as referral=25000,onboarding=5000")
+	c.limitVar(&c.Services.RewardRules.ReferenceVelocity, "reward-reference-velocity", "REWARD_REFERENCE_VELOCITY", "rewards per reference_id source, as 100/1h, or off")
+	c.listVar(&c.Services.RewardRules.ApprovalEventTypes, "reward-approval-event-types", "REWARD_APPROVAL_EVENT_TYPES", "comma-separated event types entered by hand that may need a second approver")
+	c.floatVar(&c.Services.RewardRules.ApprovalINRThreshold, "reward-approval-inr-threshold", "REWARD_APPROVAL_INR_THRESHOLD", "INR value from which rewards of those event types need a second approver")
+	c.intVar(&c.Services.RewardRules.AnomalyRewardsPerMinute, "reward-anomaly-per-minute", "REWARD_ANOMALY_PER_MINUTE", "rewards per user per minute after which new ones are held for review (0 is off)")
+
+	c.stringVar(&c.Services.Depository.PoolDepository, "depository-pool-depository", "DEPOSITORY_POOL_DEPOSITORY", "depository of the pool demat account holding users' shares: NSDL or CDSL")
+	c.stringVar(&c.Services.Depository.PoolDPID, "depository-pool-dp-id", "DEPOSITORY_POOL_DP_ID", "DP ID of the pool demat account withdrawals are transferred out of")
+	c.stringVar(&c.Services.Depository.PoolClientID, "depository-pool-client-id", "DEPOSITORY_POOL_CLIENT_ID", "client ID of the pool demat account withdrawals are transferred out of")
+
+	c.floatVar(&c.Services.Dividends.TDSRate, "dividend-tds-rate", "DIVIDEND_TDS_RATE", "share of a dividend withheld as TDS once the threshold is passed")
+	c.floatVar(&c.Services.Dividends.TDSThreshold, "dividend-tds-threshold", "DIVIDEND_TDS_THRESHOLD", "INR of dividends from one stock a user may receive per financial year before TDS applies")
+
+	c.intVar(&c.Services.Tax.LongTermMonths, "tax-long-term-months", "TAX_LONG_TERM_MONTHS", "months shares must be held before a sale is a long-term capital gain")
+	c.stringVar(&c.Services.Tax.GrandfatherDate, "tax-grandfather-date", "TAX_GRANDFATHER_DATE", "shares acquired on or before this date (YYYY-MM-DD) have their cost stepped up to its closing price when sold long-term (empty is off)")
+}
+
+func (c *Config) add(name, env string, secret bool) {
+	c.settings = append(c.settings, setting{name: name, env: env, secret: secret})
+}
+
+func (c *Config) stringVar(p *string, name, env, usage string) {
+	c.flags.StringVar(p, name, *p, usage+" (env "+env+")")
+	c.add(name, env, false)
+}
+
+func (c *Config) secretVar(p *string, name, env, usage string) {
+	c.flags.StringVar(p, name, *p, usage+" (env "+env+")")
+	c.add(name, env, true)
+}
+
+func (c *Config) intVar(p *int, name, env, usage string) {
+	c.flags.IntVar(p, name, *p, usage+" (env "+env+")")
+	c.add(name, env, false)
+}
+
+func (c *Config) floatVar(p *float64, name, env, usage string) {
+	c.flags.Float64Var(p, name, *p, usage+" (env "+env+")")
+	c.add(name, env, false)
+}
+
+func (c *Config) boolVar(p *bool, name, env, usage string) {
+	c.flags.BoolVar(p, name, *p, usage+" (env "+env+")")
+	c.add(name, env, false)
+}
+
+func (c *Config) durationVar(p *time.Duration, name, env, usage string) {
+	c.flags.DurationVar(p, name, *p, usage+" (env "+env+")")
+	c.add(name, env, false)
+}
+
+func (c *Config) limitVar(p *ratelimit.Limit, name, env, usage string) {
+	c.flags.Var(p, name, usage+" (env "+env+")")
+	c.add(name, env, false)
+}
+
+func (c *Config) listVar(p *[]string, name, env, usage string) {
+	c.flags.Var((*stringList)(p), name, usage+" (env "+env+")")
+	c.add(name, env, false)
+}
+
+func (c *Config) floatMapVar(p *map[string]float64, name, env, usage string) {
+	c.flags.Var((*floatMap)(p), name, usage+" (env "+env+")")
+	c.add(name, env, false)
+}
+
+// floatMap is a comma-separated list of key=number pairs; setting it replaces the whole map
+type floatMap map[string]float64
+
+func (m *floatMap) String() string {
+	if m == nil || *m == nil {
+		return ""
+	}
+	keys := make([]string, 0, len(*m))
+	for k := range *m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+strconv.FormatFloat((*m)[k], 'f', -1, 64))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (m *floatMap) Set(value string) error {
+	items := map[string]float64{}
+	for _, pair := range strings.Split(value, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("expected key=value, got %q", pair)
+		}
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return fmt.Errorf("invalid number for %q: %w", k, err)
+		}
+		items[strings.TrimSpace(k)] = n
+	}
+	*m = items
+	return nil
+}
+
+// stringList is a comma-separated flag value; setting it replaces the whole list
+type stringList []string
+
+func (l *stringList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	*l = items
+	return nil
+}
+
+// readFile reads a flat JSON object keyed by flag name into flag-formatted strings
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string, len(raw))
+	for name, v := range raw {
+		switch v := v.(type) {
+		case string:
+			values[name] = v
+		case float64:
+			values[name] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			values[name] = strconv.FormatBool(v)
+		case []interface{}:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				s, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("%s in %s must be a list of strings", name, path)
+				}
+				items = append(items, s)
+			}
+			values[name] = strings.Join(items, ",")
+		case map[string]interface{}:
+			fm := floatMap{}
+			for k, item := range v {
+				n, ok := item.(float64)
+				if !ok {
+					return nil, fmt.Errorf("%s in %s must be an object of numbers", name, path)
+				}
+				fm[k] = n
+			}
+			values[name] = fm.String()
+		default:
+			return nil, fmt.Errorf("%s in %s has an unsupported type", name, path)
+		}
+	}
+	return values, nil
+}
+
+// Validate reports every invalid setting at once
+func (c *Config) Validate() error {
+	var errs []error
+
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		errs = append(errs, fmt.Errorf("port must be between 1 and 65535, got %q", c.Port))
+	}
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("shutdown timeout must be positive, got %s", c.ShutdownTimeout))
+	}
+	if _, err := logrus.ParseLevel(c.LogLevel); err != nil {
+		errs = append(errs, fmt.Errorf("log level: %w", err))
+	}
+	switch c.TraceExporter {
+	case telemetry.ExporterOTLP, telemetry.ExporterStdout, telemetry.ExporterNone:
+	default:
+		errs = append(errs, fmt.Errorf("trace exporter must be %q, %q or %q, got %q",
+			telemetry.ExporterOTLP, telemetry.ExporterStdout, telemetry.ExporterNone, c.TraceExporter))
+	}
+
+	if err := c.Database.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Database.TrustServerCertificate && c.Database.Encrypt == database.EncryptStrict {
+		errs = append(errs, fmt.Errorf("database trust server certificate cannot be combined with strict encryption"))
+	}
+	if c.Database.CertificateFile != "" {
+		if _, err := os.Stat(c.Database.CertificateFile); err != nil {
+			errs = append(errs, fmt.Errorf("database CA file: %w", err))
+		}
+	}
+
+	if len(c.CORSAllowOrigins) == 0 {
+		errs = append(errs, fmt.Errorf("at least one CORS origin is required"))
+	}
+	for _, origin := range c.CORSAllowOrigins {
+		// Credentials are allowed, so wildcards are not
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			errs = append(errs, fmt.Errorf("CORS origin must be an http(s) scheme and host, got %q", origin))
+		}
+	}
+
+	for _, proxy := range c.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				errs = append(errs, fmt.Errorf("trusted proxy must be an IP address or CIDR, got %q", proxy))
+			}
+		}
+	}
+
+	if c.PriceRefreshInterval <= 0 {
+		errs = append(errs, fmt.Errorf("price refresh interval must be positive, got %s", c.PriceRefreshInterval))
+	}
+	if err := c.Services.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	// Otherwise readiness fails every time a refresh is merely due
+	if c.Services.Staleness.FailReadiness && c.Services.Staleness.StaleAfter <= c.PriceRefreshInterval+c.Services.PriceRefresh.Timeout {
+		errs = append(errs, fmt.Errorf("price stale after (%s) must exceed the refresh interval plus the refresh timeout (%s) when stale prices fail readiness",
+			c.Services.Staleness.StaleAfter, c.PriceRefreshInterval+c.Services.PriceRefresh.Timeout))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Redacted returns every setting keyed by flag name, with secrets masked, for logging
+func (c *Config) Redacted() map[string]interface{} {
+	fields := make(map[string]interface{}, len(c.settings))
+	for _, s := range c.settings {
+		value := c.flags.Lookup(s.name).Value.String()
+		if s.secret && value != "" {
+			value = "[REDACTED]"
+		}
+		fields[s.name] = value
+	}
+	return fields
+}
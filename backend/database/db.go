@@ -3,39 +3,129 @@ package database
 import (
 	"database/sql"
 	"fmt"
-	"os"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
 
+	"github.com/XSAM/otelsql"
 	_ "github.com/microsoft/go-mssqldb"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 )
 
 var DB *sql.DB
 
-// Connect initializes the database connection
-func Connect() error {
-	server := os.Getenv("DATABASE_SERVER")
-	user := os.Getenv("DATABASE_USER")
-	password := os.Getenv("DATABASE_PASSWORD")
-	database := os.Getenv("DATABASE_NAME")
-	port := os.Getenv("DATABASE_PORT")
-	if port == "" {
-		port = "1433"
+const (
+	EncryptTrue    = "true"
+	EncryptStrict  = "strict"
+	EncryptFalse   = "false"
+	EncryptDisable = "disable"
+)
+
+// Options configures the SQL Server connection, its TLS settings and the pool
+type Options struct {
+	Server   string
+	Port     string
+	User     string
+	Password string
+	Name     string
+
+	// Encrypt is "true", "strict", "false" (login only) or "disable"
+	Encrypt string
+	// TrustServerCertificate skips certificate verification; only for local development
+	TrustServerCertificate bool
+	// CertificateFile is a PEM CA bundle used to verify the server certificate
+	CertificateFile string
+	// HostNameInCertificate overrides the host name the certificate is checked against
+	HostNameInCertificate string
+	ConnectTimeout        time.Duration
+
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// DefaultOptions verifies the server certificate and bounds the pool
+func DefaultOptions() Options {
+	return Options{
+		Port:            "1433",
+		Encrypt:         EncryptTrue,
+		ConnectTimeout:  30 * time.Second,
+		MaxOpenConns:    25,
+		MaxIdleConns:    5,
+		ConnMaxLifetime: 30 * time.Minute,
+		ConnMaxIdleTime: 5 * time.Minute,
+	}
+}
+
+// Validate checks for missing credentials and nonsensical pool settings
+func (o Options) Validate() error {
+	if o.Server == "" || o.User == "" || o.Password == "" || o.Name == "" {
+		return fmt.Errorf("database server, user, password and name are required")
+	}
+	if port, err := strconv.Atoi(o.Port); err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("database port must be between 1 and 65535, got %q", o.Port)
+	}
+	switch o.Encrypt {
+	case EncryptTrue, EncryptStrict, EncryptFalse, EncryptDisable:
+	default:
+		return fmt.Errorf("database encrypt must be %q, %q, %q or %q, got %q",
+			EncryptTrue, EncryptStrict, EncryptFalse, EncryptDisable, o.Encrypt)
 	}
+	if o.ConnectTimeout < 0 || o.ConnMaxLifetime < 0 || o.ConnMaxIdleTime < 0 {
+		return fmt.Errorf("database timeouts must not be negative")
+	}
+	if o.MaxOpenConns < 0 || o.MaxIdleConns < 0 {
+		return fmt.Errorf("database pool sizes must not be negative")
+	}
+	if o.MaxOpenConns > 0 && o.MaxIdleConns > o.MaxOpenConns {
+		return fmt.Errorf("database max idle connections (%d) exceeds max open connections (%d)", o.MaxIdleConns, o.MaxOpenConns)
+	}
+	return nil
+}
+
+// connString builds a sqlserver:// URL so credentials need no escaping rules of their own
+func (o Options) connString() string {
+	query := url.Values{}
+	query.Set("database", o.Name)
+	query.Set("encrypt", o.Encrypt)
+	query.Set("TrustServerCertificate", strconv.FormatBool(o.TrustServerCertificate))
+	if o.CertificateFile != "" {
+		query.Set("certificate", o.CertificateFile)
+	}
+	if o.HostNameInCertificate != "" {
+		query.Set("hostNameInCertificate", o.HostNameInCertificate)
+	}
+	query.Set("connection timeout", strconv.Itoa(int(o.ConnectTimeout.Seconds())))
 
-	// Validate required variables
-	if server == "" || user == "" || password == "" || database == "" {
-		return fmt.Errorf("missing required database environment variables")
+	u := &url.URL{
+		Scheme:   "sqlserver",
+		User:     url.UserPassword(o.User, o.Password),
+		Host:     net.JoinHostPort(o.Server, o.Port),
+		RawQuery: query.Encode(),
 	}
+	return u.String()
+}
 
-	// Construct connection string for Azure SQL Server
-	connString := fmt.Sprintf("server=tcp:%s,%s;user id=%s;password=%s;database=%s;encrypt=true;trust server certificate=true;connection timeout=30",
-		server, port, user, password, database)
+// Connect initializes the database connection
+func Connect(opts Options) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
 
 	var err error
-	DB, err = sql.Open("sqlserver", connString)
+	// otelsql wraps the driver so every query becomes a span under the caller's context
+	DB, err = otelsql.Open("sqlserver", opts.connString(), otelsql.WithAttributes(semconv.DBSystemMSSQL))
 	if err != nil {
 		return fmt.Errorf("error opening database connection: %w", err)
 	}
 
+	DB.SetMaxOpenConns(opts.MaxOpenConns)
+	DB.SetMaxIdleConns(opts.MaxIdleConns)
+	DB.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	DB.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
+
 	// Test the connection
 	if err = DB.Ping(); err != nil {
 		return fmt.Errorf("error connecting to database: %w", err)
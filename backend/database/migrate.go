@@ -1,6 +1,9 @@
 package database
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -8,7 +11,12 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-// Migrate runs the database schema migration
+// SchemaVersion is the version of schema.sql this binary expects.
+// Bump it whenever schema.sql changes.
+const SchemaVersion = 19
+
+// Migrate runs the database schema migration and records SchemaVersion in
+// schema_migrations once every batch has applied cleanly
 func Migrate() error {
 	schemaPath := filepath.Join("database", "schema.sql")
 
@@ -26,6 +34,7 @@ func Migrate() error {
 	// Split by GO statements (SQL Server batch separator)
 	batches := strings.Split(string(schemaSQL), "GO")
 
+	failed := 0
 	for _, batch := range batches {
 		batch = strings.TrimSpace(batch)
 		if batch == "" {
@@ -36,14 +45,38 @@ func Migrate() error {
 		if err != nil {
 			logrus.WithError(err).Errorf("Error executing batch: %s", batch[:min(100, len(batch))])
 			// Continue with other batches even if one fails (might already exist)
+			failed++
 			continue
 		}
 	}
 
-	logrus.Info("Database migration completed")
+	if failed > 0 {
+		return fmt.Errorf("%d schema batches failed, schema version %d not recorded", failed, SchemaVersion)
+	}
+
+	_, err = DB.Exec(`
+		IF NOT EXISTS (SELECT 1 FROM schema_migrations WHERE version = @p1)
+			INSERT INTO schema_migrations (version) VALUES (@p1)
+	`, SchemaVersion)
+	if err != nil {
+		return fmt.Errorf("error recording schema version: %w", err)
+	}
+
+	logrus.WithField("schema_version", SchemaVersion).Info("Database migration completed")
 	return nil
 }
 
+// AppliedSchemaVersion returns the highest schema version recorded in the
+// database, or 0 if no migration has completed
+func AppliedSchemaVersion(ctx context.Context) (int, error) {
+	var version sql.NullInt64
+	err := DB.QueryRowContext(ctx, `SELECT MAX(version) FROM schema_migrations`).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("error reading schema version: %w", err)
+	}
+	return int(version.Int64), nil
+}
+
 func min(a, b int) int {
 	if a < b {
 		return a
@@ -154,8 +154,624 @@ BEGIN
     LEFT JOIN stock_prices sp ON re.stock_symbol = sp.stock_symbol
     WHERE re.user_id = @user_id
         AND CAST(re.reward_timestamp AS DATE) <= @target_date
-        AND re.status = 'active'
+        AND re.status IN ('active', 'fulfilled', 'settled')
     GROUP BY re.stock_symbol, ISNULL(sph.price, sp.price);
 END;
 GO
 
+
+-- Price Refresh Runs table (summary of each UpdateAllPrices run)
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'[dbo].[price_refresh_runs]') AND type in (N'U'))
+BEGIN
+    CREATE TABLE price_refresh_runs (
+        id UNIQUEIDENTIFIER PRIMARY KEY DEFAULT NEWID(),
+        provider NVARCHAR(50) NOT NULL,
+        started_at DATETIME2 NOT NULL,
+        finished_at DATETIME2 NULL,
+        symbols_total INT NOT NULL DEFAULT 0,
+        fetched INT NOT NULL DEFAULT 0,
+        failed INT NOT NULL DEFAULT 0,
+        skipped INT NOT NULL DEFAULT 0,
+        status NVARCHAR(20) NOT NULL,
+        error_message NVARCHAR(1000) NULL
+    );
+    
+    CREATE INDEX idx_price_refresh_runs_started_at ON price_refresh_runs(started_at);
+    CREATE INDEX idx_price_refresh_runs_status ON price_refresh_runs(status, finished_at);
+END;
+GO
+
+
+-- Schema Migrations table (schema version recorded by each successful migration)
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'[dbo].[schema_migrations]') AND type in (N'U'))
+BEGIN
+    CREATE TABLE schema_migrations (
+        version INT PRIMARY KEY,
+        applied_at DATETIME2 NOT NULL DEFAULT GETUTCDATE()
+    );
+END;
+GO
+
+
+-- Audit Log table (who changed what, from where, with before/after state)
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'[dbo].[audit_log]') AND type in (N'U'))
+BEGIN
+    CREATE TABLE audit_log (
+        id UNIQUEIDENTIFIER PRIMARY KEY DEFAULT NEWID(),
+        actor_id NVARCHAR(255) NOT NULL,
+        actor_role NVARCHAR(50) NULL,
+        action NVARCHAR(100) NOT NULL,
+        entity_type NVARCHAR(50) NOT NULL,
+        entity_id NVARCHAR(255) NOT NULL,
+        request_id NVARCHAR(100) NULL,
+        source_ip NVARCHAR(45) NULL,
+        before_state NVARCHAR(MAX) NULL,
+        after_state NVARCHAR(MAX) NULL,
+        created_at DATETIME2 NOT NULL DEFAULT GETUTCDATE()
+    );
+    
+    CREATE INDEX idx_audit_log_created_at ON audit_log(created_at);
+    CREATE INDEX idx_audit_log_entity ON audit_log(entity_type, entity_id, created_at);
+    CREATE INDEX idx_audit_log_actor ON audit_log(actor_id, created_at);
+    CREATE INDEX idx_audit_log_request_id ON audit_log(request_id);
+END;
+GO
+
+
+-- Reward value at issuance, used by the reward limit rules
+IF COL_LENGTH('dbo.reward_events', 'inr_value') IS NULL
+BEGIN
+    ALTER TABLE reward_events ADD inr_value DECIMAL(18, 4) NULL;
+END;
+GO
+
+IF NOT EXISTS (SELECT * FROM sys.indexes WHERE name = 'idx_reward_events_user_created' AND object_id = OBJECT_ID(N'[dbo].[reward_events]'))
+BEGIN
+    CREATE INDEX idx_reward_events_user_created ON reward_events(user_id, created_at) INCLUDE (event_type, inr_value, status);
+END;
+GO
+
+
+-- Reward Reviews table (rewards held for manual review by the anomaly rules)
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'[dbo].[reward_reviews]') AND type in (N'U'))
+BEGIN
+    CREATE TABLE reward_reviews (
+        id UNIQUEIDENTIFIER PRIMARY KEY DEFAULT NEWID(),
+        reward_id UNIQUEIDENTIFIER NOT NULL,
+        reason NVARCHAR(100) NOT NULL,
+        details NVARCHAR(1000) NULL,
+        status NVARCHAR(20) NOT NULL DEFAULT 'pending',
+        decided_by NVARCHAR(255) NULL,
+        decision_note NVARCHAR(1000) NULL,
+        decided_at DATETIME2 NULL,
+        created_at DATETIME2 NOT NULL DEFAULT GETUTCDATE(),
+        FOREIGN KEY (reward_id) REFERENCES reward_events(id)
+    );
+    
+    CREATE INDEX idx_reward_reviews_status ON reward_reviews(status, created_at);
+    CREATE INDEX idx_reward_reviews_reward_id ON reward_reviews(reward_id);
+END;
+GO
+
+
+-- Actor who created each reward, so approval can require a different person
+IF COL_LENGTH('reward_events', 'created_by') IS NULL
+BEGIN
+    ALTER TABLE reward_events ADD created_by NVARCHAR(255) NULL;
+END;
+GO
+
+
+-- Broker Orders table (orders that buy or sell the shares behind rewards)
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'[dbo].[broker_orders]') AND type in (N'U'))
+BEGIN
+    CREATE TABLE broker_orders (
+        id UNIQUEIDENTIFIER PRIMARY KEY DEFAULT NEWID(),
+        reward_id UNIQUEIDENTIFIER NULL,
+        broker NVARCHAR(50) NOT NULL,
+        broker_order_id NVARCHAR(100) NULL,
+        stock_symbol NVARCHAR(50) NOT NULL,
+        side NVARCHAR(10) NOT NULL,
+        quantity DECIMAL(18, 6) NOT NULL,
+        status NVARCHAR(20) NOT NULL,
+        filled_quantity DECIMAL(18, 6) NOT NULL DEFAULT 0,
+        fill_price DECIMAL(18, 4) NULL,
+        brokerage DECIMAL(18, 4) NOT NULL DEFAULT 0,
+        stt DECIMAL(18, 4) NOT NULL DEFAULT 0,
+        gst DECIMAL(18, 4) NOT NULL DEFAULT 0,
+        error_message NVARCHAR(1000) NULL,
+        placed_at DATETIME2 NULL,
+        filled_at DATETIME2 NULL,
+        created_at DATETIME2 NOT NULL DEFAULT GETUTCDATE(),
+        updated_at DATETIME2 NOT NULL DEFAULT GETUTCDATE(),
+        FOREIGN KEY (reward_id) REFERENCES reward_events(id)
+    );
+    
+    CREATE UNIQUE INDEX idx_broker_orders_reward_side ON broker_orders(reward_id, side) WHERE reward_id IS NOT NULL;
+    CREATE INDEX idx_broker_orders_status ON broker_orders(status);
+    CREATE INDEX idx_broker_orders_broker_order_id ON broker_orders(broker, broker_order_id);
+END;
+GO
+
+-- Rewards bought through the broker are 'fulfilled', then 'settled', rather than 'active'
+IF NOT EXISTS (SELECT * FROM sys.indexes WHERE name = 'idx_reward_events_user_date_posted' AND object_id = OBJECT_ID(N'[dbo].[reward_events]'))
+BEGIN
+    CREATE INDEX idx_reward_events_user_date_posted ON reward_events(user_id, reward_timestamp) WHERE status IN ('active', 'fulfilled', 'settled');
+END;
+GO
+
+
+-- Broker Order Allocations table (each reward's part of a buy order, which may batch several rewards)
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'[dbo].[broker_order_allocations]') AND type in (N'U'))
+BEGIN
+    CREATE TABLE broker_order_allocations (
+        id UNIQUEIDENTIFIER PRIMARY KEY DEFAULT NEWID(),
+        order_id UNIQUEIDENTIFIER NOT NULL,
+        reward_id UNIQUEIDENTIFIER NOT NULL,
+        quantity DECIMAL(18, 6) NOT NULL,
+        filled_quantity DECIMAL(18, 6) NOT NULL DEFAULT 0,
+        fill_price DECIMAL(18, 4) NULL,
+        brokerage DECIMAL(18, 4) NOT NULL DEFAULT 0,
+        stt DECIMAL(18, 4) NOT NULL DEFAULT 0,
+        gst DECIMAL(18, 4) NOT NULL DEFAULT 0,
+        created_at DATETIME2 NOT NULL DEFAULT GETUTCDATE(),
+        FOREIGN KEY (order_id) REFERENCES broker_orders(id),
+        FOREIGN KEY (reward_id) REFERENCES reward_events(id)
+    );
+    
+    CREATE UNIQUE INDEX idx_broker_order_allocations_reward_id ON broker_order_allocations(reward_id);
+    CREATE INDEX idx_broker_order_allocations_order_id ON broker_order_allocations(order_id);
+END;
+GO
+
+-- Orders placed for a single reward before batching get an allocation for that reward
+INSERT INTO broker_order_allocations (order_id, reward_id, quantity, filled_quantity, fill_price, brokerage, stt, gst, created_at)
+SELECT bo.id, bo.reward_id, bo.quantity, bo.filled_quantity, bo.fill_price, bo.brokerage, bo.stt, bo.gst, bo.created_at
+FROM broker_orders bo
+WHERE bo.reward_id IS NOT NULL AND bo.side = 'buy'
+    AND NOT EXISTS (SELECT 1 FROM broker_order_allocations a WHERE a.reward_id = bo.reward_id);
+GO
+
+
+-- Posted rewards now include 'settled'; rebuild the filtered index if it predates that status
+IF EXISTS (SELECT * FROM sys.indexes WHERE name = 'idx_reward_events_user_date_posted' AND object_id = OBJECT_ID(N'[dbo].[reward_events]') AND filter_definition NOT LIKE '%settled%')
+BEGIN
+    DROP INDEX idx_reward_events_user_date_posted ON reward_events;
+    CREATE INDEX idx_reward_events_user_date_posted ON reward_events(user_id, reward_timestamp) WHERE status IN ('active', 'fulfilled', 'settled');
+END;
+GO
+
+-- T+1 settlement: the trading day each reward's fill belongs to, the day it settles, and when it did
+IF COL_LENGTH('reward_events', 'settlement_date') IS NULL
+BEGIN
+    ALTER TABLE reward_events ADD trade_date DATE NULL, settlement_date DATE NULL, settled_at DATETIME2 NULL;
+END;
+GO
+
+IF NOT EXISTS (SELECT * FROM sys.indexes WHERE name = 'idx_reward_events_settlement' AND object_id = OBJECT_ID(N'[dbo].[reward_events]'))
+BEGIN
+    CREATE INDEX idx_reward_events_settlement ON reward_events(settlement_date) WHERE status = 'fulfilled';
+END;
+GO
+
+-- Settled part of each holding. Everything held before settlement was tracked
+-- counts as settled, and rewards already fulfilled then are marked settled.
+IF COL_LENGTH('user_holdings', 'settled_quantity') IS NULL
+BEGIN
+    ALTER TABLE user_holdings ADD settled_quantity DECIMAL(18, 6) NOT NULL DEFAULT 0;
+    EXEC('UPDATE user_holdings SET settled_quantity = quantity');
+    EXEC('UPDATE reward_events SET status = ''settled'', settled_at = GETUTCDATE() WHERE status = ''fulfilled''');
+END;
+GO
+
+
+-- User each ledger entry belongs to, so per-user postings don't depend on reference_id
+IF COL_LENGTH('ledger_entries', 'user_id') IS NULL
+BEGIN
+    ALTER TABLE ledger_entries ADD user_id UNIQUEIDENTIFIER NULL;
+    EXEC('UPDATE le SET user_id = re.user_id FROM ledger_entries le JOIN reward_events re ON re.reference_id = le.reference_id WHERE le.user_id IS NULL');
+END;
+GO
+
+IF NOT EXISTS (SELECT * FROM sys.indexes WHERE name = 'idx_ledger_entries_user_id' AND object_id = OBJECT_ID(N'[dbo].[ledger_entries]'))
+BEGIN
+    CREATE INDEX idx_ledger_entries_user_id ON ledger_entries(user_id, account_type);
+END;
+GO
+
+-- Vesting schedule of a reward: tranches every interval over the duration, none before the cliff, locked until lock_in_until
+IF COL_LENGTH('reward_events', 'vesting_duration_months') IS NULL
+BEGIN
+    ALTER TABLE reward_events ADD
+        vesting_cliff_months INT NULL,
+        vesting_duration_months INT NULL,
+        vesting_interval_months INT NULL,
+        lock_in_until DATE NULL;
+END;
+GO
+
+-- Part of each holding that has not vested yet
+IF COL_LENGTH('user_holdings', 'unvested_quantity') IS NULL
+BEGIN
+    ALTER TABLE user_holdings ADD unvested_quantity DECIMAL(18, 6) NOT NULL DEFAULT 0;
+END;
+GO
+
+-- Vesting Tranches table (parts of a reward's filled quantity that vest on a date)
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'[dbo].[vesting_tranches]') AND type in (N'U'))
+BEGIN
+    CREATE TABLE vesting_tranches (
+        id UNIQUEIDENTIFIER PRIMARY KEY DEFAULT NEWID(),
+        reward_id UNIQUEIDENTIFIER NOT NULL,
+        user_id UNIQUEIDENTIFIER NOT NULL,
+        stock_symbol NVARCHAR(50) NOT NULL,
+        vest_date DATE NOT NULL,
+        quantity DECIMAL(18, 6) NOT NULL,
+        cost_price DECIMAL(18, 4) NOT NULL,
+        status NVARCHAR(20) NOT NULL DEFAULT 'scheduled',
+        vested_at DATETIME2 NULL,
+        forfeited_at DATETIME2 NULL,
+        created_at DATETIME2 NOT NULL DEFAULT GETUTCDATE(),
+        FOREIGN KEY (reward_id) REFERENCES reward_events(id),
+        FOREIGN KEY (user_id) REFERENCES users(id)
+    );
+    
+    CREATE INDEX idx_vesting_tranches_status_date ON vesting_tranches(status, vest_date);
+    CREATE INDEX idx_vesting_tranches_user ON vesting_tranches(user_id, stock_symbol, status);
+    CREATE INDEX idx_vesting_tranches_reward_id ON vesting_tranches(reward_id);
+END;
+GO
+
+-- Demat Accounts table (users' own demat accounts that shares are withdrawn to)
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'[dbo].[demat_accounts]') AND type in (N'U'))
+BEGIN
+    CREATE TABLE demat_accounts (
+        id UNIQUEIDENTIFIER PRIMARY KEY DEFAULT NEWID(),
+        user_id UNIQUEIDENTIFIER NOT NULL,
+        depository NVARCHAR(10) NOT NULL,
+        dp_id NVARCHAR(8) NOT NULL,
+        client_id NVARCHAR(8) NOT NULL,
+        verification_status NVARCHAR(20) NOT NULL DEFAULT 'pending',
+        verified_by NVARCHAR(255) NULL,
+        verification_note NVARCHAR(1000) NULL,
+        verified_at DATETIME2 NULL,
+        created_at DATETIME2 NOT NULL DEFAULT GETUTCDATE(),
+        updated_at DATETIME2 NOT NULL DEFAULT GETUTCDATE(),
+        FOREIGN KEY (user_id) REFERENCES users(id),
+        CONSTRAINT uq_demat_accounts_user_account UNIQUE (user_id, dp_id, client_id)
+    );
+END;
+GO
+
+-- Withdrawals table (transfers of shares out of a holding to a user's demat account)
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'[dbo].[withdrawals]') AND type in (N'U'))
+BEGIN
+    CREATE TABLE withdrawals (
+        id UNIQUEIDENTIFIER PRIMARY KEY DEFAULT NEWID(),
+        user_id UNIQUEIDENTIFIER NOT NULL,
+        demat_account_id UNIQUEIDENTIFIER NOT NULL,
+        stock_symbol NVARCHAR(50) NOT NULL,
+        quantity DECIMAL(18, 6) NOT NULL,
+        cost_value DECIMAL(18, 4) NOT NULL,
+        status NVARCHAR(20) NOT NULL DEFAULT 'requested',
+        batch_id UNIQUEIDENTIFIER NULL,
+        failure_reason NVARCHAR(1000) NULL,
+        submitted_at DATETIME2 NULL,
+        completed_at DATETIME2 NULL,
+        failed_at DATETIME2 NULL,
+        created_by NVARCHAR(255) NULL,
+        created_at DATETIME2 NOT NULL DEFAULT GETUTCDATE(),
+        updated_at DATETIME2 NOT NULL DEFAULT GETUTCDATE(),
+        FOREIGN KEY (user_id) REFERENCES users(id),
+        FOREIGN KEY (demat_account_id) REFERENCES demat_accounts(id)
+    );
+
+    CREATE INDEX idx_withdrawals_user_id ON withdrawals(user_id, created_at);
+    CREATE INDEX idx_withdrawals_status ON withdrawals(status);
+    CREATE INDEX idx_withdrawals_batch_id ON withdrawals(batch_id) WHERE batch_id IS NOT NULL;
+END;
+GO
+
+-- Redemptions table (shares sold from a holding for cash in the user's wallet)
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'[dbo].[redemptions]') AND type in (N'U'))
+BEGIN
+    CREATE TABLE redemptions (
+        id UNIQUEIDENTIFIER PRIMARY KEY DEFAULT NEWID(),
+        user_id UNIQUEIDENTIFIER NOT NULL,
+        stock_symbol NVARCHAR(50) NOT NULL,
+        quantity DECIMAL(18, 6) NOT NULL,
+        price DECIMAL(18, 4) NOT NULL,
+        price_as_of DATETIME2 NOT NULL,
+        gross_value DECIMAL(18, 4) NOT NULL,
+        brokerage DECIMAL(18, 4) NOT NULL,
+        stt DECIMAL(18, 4) NOT NULL,
+        gst DECIMAL(18, 4) NOT NULL,
+        net_proceeds DECIMAL(18, 4) NOT NULL,
+        cost_value DECIMAL(18, 4) NOT NULL,
+        realized_pnl DECIMAL(18, 4) NOT NULL,
+        created_by NVARCHAR(255) NULL,
+        created_at DATETIME2 NOT NULL DEFAULT GETUTCDATE(),
+        FOREIGN KEY (user_id) REFERENCES users(id)
+    );
+
+    CREATE INDEX idx_redemptions_user_id ON redemptions(user_id, created_at);
+END;
+GO
+
+-- Payouts table (wallet cash sent to users' bank accounts)
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'[dbo].[payouts]') AND type in (N'U'))
+BEGIN
+    CREATE TABLE payouts (
+        id UNIQUEIDENTIFIER PRIMARY KEY DEFAULT NEWID(),
+        user_id UNIQUEIDENTIFIER NOT NULL,
+        amount DECIMAL(18, 4) NOT NULL,
+        account_number NVARCHAR(18) NOT NULL,
+        ifsc NVARCHAR(11) NOT NULL,
+        status NVARCHAR(20) NOT NULL,
+        bank NVARCHAR(50) NOT NULL,
+        bank_reference NVARCHAR(100) NULL,
+        failure_reason NVARCHAR(1000) NULL,
+        sent_at DATETIME2 NULL,
+        settled_at DATETIME2 NULL,
+        failed_at DATETIME2 NULL,
+        created_by NVARCHAR(255) NULL,
+        created_at DATETIME2 NOT NULL DEFAULT GETUTCDATE(),
+        updated_at DATETIME2 NOT NULL DEFAULT GETUTCDATE(),
+        FOREIGN KEY (user_id) REFERENCES users(id)
+    );
+
+    CREATE INDEX idx_payouts_user_id ON payouts(user_id, created_at);
+    CREATE INDEX idx_payouts_status ON payouts(status);
+END;
+GO
+
+-- Whether a user's dividends are reinvested in the stock instead of credited to their wallet
+IF COL_LENGTH('users', 'dividend_reinvest') IS NULL
+BEGIN
+    ALTER TABLE users ADD dividend_reinvest BIT NOT NULL DEFAULT 0;
+END;
+GO
+
+-- Dividends table (cash dividends declared on stocks)
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'[dbo].[dividends]') AND type in (N'U'))
+BEGIN
+    CREATE TABLE dividends (
+        id UNIQUEIDENTIFIER PRIMARY KEY DEFAULT NEWID(),
+        stock_symbol NVARCHAR(50) NOT NULL,
+        amount_per_share DECIMAL(18, 4) NOT NULL,
+        record_date DATE NOT NULL,
+        pay_date DATE NOT NULL,
+        status NVARCHAR(20) NOT NULL,
+        paid_at DATETIME2 NULL,
+        created_by NVARCHAR(255) NULL,
+        created_at DATETIME2 NOT NULL DEFAULT GETUTCDATE(),
+        updated_at DATETIME2 NOT NULL DEFAULT GETUTCDATE()
+    );
+
+    CREATE UNIQUE INDEX idx_dividends_symbol_record_date ON dividends(stock_symbol, record_date);
+    CREATE INDEX idx_dividends_status ON dividends(status, pay_date);
+END;
+GO
+
+-- Dividend Payments table (each user's share of a dividend)
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'[dbo].[dividend_payments]') AND type in (N'U'))
+BEGIN
+    CREATE TABLE dividend_payments (
+        id UNIQUEIDENTIFIER PRIMARY KEY DEFAULT NEWID(),
+        dividend_id UNIQUEIDENTIFIER NOT NULL,
+        user_id UNIQUEIDENTIFIER NOT NULL,
+        stock_symbol NVARCHAR(50) NOT NULL,
+        entitled_quantity DECIMAL(18, 6) NOT NULL,
+        gross_amount DECIMAL(18, 4) NOT NULL,
+        tds_amount DECIMAL(18, 4) NOT NULL,
+        net_amount DECIMAL(18, 4) NOT NULL,
+        mode NVARCHAR(20) NOT NULL,
+        reinvest_price DECIMAL(18, 4) NULL,
+        reinvested_quantity DECIMAL(18, 6) NULL,
+        created_at DATETIME2 NOT NULL DEFAULT GETUTCDATE(),
+        FOREIGN KEY (dividend_id) REFERENCES dividends(id),
+        FOREIGN KEY (user_id) REFERENCES users(id)
+    );
+
+    CREATE UNIQUE INDEX idx_dividend_payments_dividend_user ON dividend_payments(dividend_id, user_id);
+    CREATE INDEX idx_dividend_payments_user_id ON dividend_payments(user_id, created_at);
+END;
+GO
+
+-- Tax Lots table (shares a user acquired together, consumed oldest first)
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'[dbo].[tax_lots]') AND type in (N'U'))
+BEGIN
+    CREATE TABLE tax_lots (
+        id UNIQUEIDENTIFIER PRIMARY KEY DEFAULT NEWID(),
+        user_id UNIQUEIDENTIFIER NOT NULL,
+        stock_symbol NVARCHAR(50) NOT NULL,
+        source NVARCHAR(20) NOT NULL,
+        source_id UNIQUEIDENTIFIER NOT NULL,
+        acquired_on DATE NOT NULL,
+        quantity DECIMAL(18, 6) NOT NULL,
+        remaining_quantity DECIMAL(18, 6) NOT NULL,
+        cost_per_share DECIMAL(18, 4) NOT NULL,
+        created_at DATETIME2 NOT NULL DEFAULT GETUTCDATE(),
+        updated_at DATETIME2 NOT NULL DEFAULT GETUTCDATE(),
+        FOREIGN KEY (user_id) REFERENCES users(id)
+    );
+
+    CREATE INDEX idx_tax_lots_user_symbol ON tax_lots(user_id, stock_symbol, acquired_on);
+END;
+GO
+
+-- Tax Lot Disposals table (shares taken out of a lot by a redemption or withdrawal)
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'[dbo].[tax_lot_disposals]') AND type in (N'U'))
+BEGIN
+    CREATE TABLE tax_lot_disposals (
+        id UNIQUEIDENTIFIER PRIMARY KEY DEFAULT NEWID(),
+        lot_id UNIQUEIDENTIFIER NOT NULL,
+        user_id UNIQUEIDENTIFIER NOT NULL,
+        stock_symbol NVARCHAR(50) NOT NULL,
+        kind NVARCHAR(20) NOT NULL,
+        reference_id UNIQUEIDENTIFIER NOT NULL,
+        quantity DECIMAL(18, 6) NOT NULL,
+        acquired_on DATE NOT NULL,
+        disposed_on DATE NOT NULL,
+        cost_basis DECIMAL(18, 4) NOT NULL,
+        proceeds DECIMAL(18, 4) NULL,
+        gain DECIMAL(18, 4) NULL,
+        term NVARCHAR(20) NULL,
+        grandfathered BIT NOT NULL DEFAULT 0,
+        reversed_at DATETIME2 NULL,
+        created_at DATETIME2 NOT NULL DEFAULT GETUTCDATE(),
+        FOREIGN KEY (lot_id) REFERENCES tax_lots(id),
+        FOREIGN KEY (user_id) REFERENCES users(id)
+    );
+
+    CREATE INDEX idx_tax_lot_disposals_user_id ON tax_lot_disposals(user_id, disposed_on);
+    CREATE INDEX idx_tax_lot_disposals_reference ON tax_lot_disposals(kind, reference_id);
+END;
+GO
+
+-- Opening tax lots for shares acquired before lots were tracked. Every share
+-- debited to stock inventory opens a lot at the reward's issuance price (or
+-- its ledger cost), except shares put back by failed withdrawals; then each
+-- holding's lots are used up oldest first until they match its vested shares.
+IF NOT EXISTS (SELECT 1 FROM tax_lots)
+BEGIN
+    INSERT INTO tax_lots (user_id, stock_symbol, source, source_id, acquired_on, quantity, remaining_quantity, cost_per_share, created_at)
+    SELECT le.user_id, le.account_symbol, 'opening', COALESCE(re.id, le.transaction_id),
+        CAST(DATEADD(minute, 330, le.created_at) AS DATE), le.stock_quantity, le.stock_quantity,
+        COALESCE(re.inr_value / NULLIF(re.quantity, 0), le.debit_amount / le.stock_quantity), le.created_at
+    FROM ledger_entries le
+    OUTER APPLY (
+        SELECT TOP 1 r.id, r.inr_value, r.quantity FROM reward_events r
+        WHERE r.reference_id = le.reference_id AND r.user_id = le.user_id
+        ORDER BY r.created_at DESC
+    ) re
+    WHERE le.account_type = 'stock_inventory' AND le.debit_amount > 0 AND le.stock_quantity > 0 AND le.user_id IS NOT NULL
+        AND NOT EXISTS (SELECT 1 FROM withdrawals w WHERE w.id = TRY_CAST(le.reference_id AS UNIQUEIDENTIFIER));
+
+    WITH excess AS (
+        SELECT l.user_id, l.stock_symbol, SUM(l.quantity) - ISNULL(MAX(h.quantity - h.unvested_quantity), 0) AS quantity
+        FROM tax_lots l
+        LEFT JOIN user_holdings h ON h.user_id = l.user_id AND h.stock_symbol = l.stock_symbol
+        GROUP BY l.user_id, l.stock_symbol
+    ), running AS (
+        SELECT l.id, l.quantity, e.quantity AS excess,
+            SUM(l.quantity) OVER (PARTITION BY l.user_id, l.stock_symbol ORDER BY l.acquired_on, l.created_at, l.id ROWS UNBOUNDED PRECEDING) AS total
+        FROM tax_lots l
+        JOIN excess e ON e.user_id = l.user_id AND e.stock_symbol = l.stock_symbol
+        WHERE e.quantity > 0
+    )
+    UPDATE l
+    SET remaining_quantity = CASE
+        WHEN r.total <= r.excess THEN 0
+        WHEN r.total - r.quantity < r.excess THEN r.total - r.excess
+        ELSE r.quantity END
+    FROM tax_lots l
+    JOIN running r ON r.id = l.id;
+END;
+GO
+
+-- Purchases used to debit cash for the shares and fees instead of crediting it
+-- for the shares, leaving each transaction unbalanced; repost those entries
+UPDATE le
+SET credit_amount = le.debit_amount - ISNULL(fees.amount, 0), debit_amount = 0
+FROM ledger_entries le
+OUTER APPLY (
+    SELECT SUM(f.debit_amount) AS amount
+    FROM ledger_entries f
+    WHERE f.transaction_id = le.transaction_id AND f.account_type = 'fees_expense'
+) fees
+WHERE le.account_type = 'cash' AND le.debit_amount > 0 AND le.credit_amount = 0
+    AND le.description LIKE 'Cash outflow for stock purchase:%';
+GO
+
+-- Redemptions sell through a broker order and are pending until it fills
+IF COL_LENGTH('redemptions', 'status') IS NULL
+BEGIN
+    ALTER TABLE redemptions ADD
+        status NVARCHAR(20) NOT NULL DEFAULT 'completed',
+        order_id UNIQUEIDENTIFIER NULL REFERENCES broker_orders(id),
+        failure_reason NVARCHAR(1000) NULL,
+        updated_at DATETIME2 NOT NULL DEFAULT GETUTCDATE();
+END;
+GO
+
+IF NOT EXISTS (SELECT * FROM sys.indexes WHERE name = 'idx_redemptions_status' AND object_id = OBJECT_ID(N'[dbo].[redemptions]'))
+BEGIN
+    CREATE INDEX idx_redemptions_status ON redemptions(status);
+    CREATE UNIQUE INDEX idx_redemptions_order_id ON redemptions(order_id) WHERE order_id IS NOT NULL;
+END;
+GO
+
+-- Reinvested dividend shares settle on their settlement date like bought
+-- shares. Earlier reinvestments were booked as settled straight away.
+IF COL_LENGTH('dividend_payments', 'settlement_date') IS NULL
+BEGIN
+    ALTER TABLE dividend_payments ADD
+        trade_date DATE NULL,
+        settlement_date DATE NULL,
+        settled_at DATETIME2 NULL;
+    EXEC('UPDATE dividend_payments SET settled_at = created_at WHERE mode = ''reinvest''');
+END;
+GO
+
+IF NOT EXISTS (SELECT * FROM sys.indexes WHERE name = 'idx_dividend_payments_unsettled' AND object_id = OBJECT_ID(N'[dbo].[dividend_payments]'))
+BEGIN
+    CREATE INDEX idx_dividend_payments_unsettled ON dividend_payments(settlement_date)
+        WHERE mode = 'reinvest' AND settled_at IS NULL;
+END;
+GO
+
+-- Bank Accounts table (users' own bank accounts that wallet cash is paid out to)
+IF NOT EXISTS (SELECT * FROM sys.objects WHERE object_id = OBJECT_ID(N'[dbo].[bank_accounts]') AND type in (N'U'))
+BEGIN
+    CREATE TABLE bank_accounts (
+        id UNIQUEIDENTIFIER PRIMARY KEY DEFAULT NEWID(),
+        user_id UNIQUEIDENTIFIER NOT NULL,
+        account_number NVARCHAR(18) NOT NULL,
+        ifsc NVARCHAR(11) NOT NULL,
+        verification_status NVARCHAR(20) NOT NULL DEFAULT 'pending',
+        verified_by NVARCHAR(255) NULL,
+        verification_note NVARCHAR(1000) NULL,
+        verified_at DATETIME2 NULL,
+        created_at DATETIME2 NOT NULL DEFAULT GETUTCDATE(),
+        updated_at DATETIME2 NOT NULL DEFAULT GETUTCDATE(),
+        FOREIGN KEY (user_id) REFERENCES users(id),
+        CONSTRAINT uq_bank_accounts_user_account UNIQUE (user_id, account_number, ifsc)
+    );
+END;
+GO
+
+-- Payouts name the verified bank account they are paid to. Earlier payouts
+-- named only an account number and IFSC and have no bank account.
+IF COL_LENGTH('payouts', 'bank_account_id') IS NULL
+BEGIN
+    ALTER TABLE payouts ADD bank_account_id UNIQUEIDENTIFIER NULL REFERENCES bank_accounts(id);
+END;
+GO
+
+-- Reinvested dividends buy their shares with a broker order. Earlier
+-- reinvestments were booked at the stored price and have no order.
+IF COL_LENGTH('dividend_payments', 'order_id') IS NULL
+BEGIN
+    ALTER TABLE dividend_payments ADD order_id UNIQUEIDENTIFIER NULL REFERENCES broker_orders(id);
+END;
+GO
+
+IF NOT EXISTS (SELECT * FROM sys.indexes WHERE name = 'idx_dividend_payments_order' AND object_id = OBJECT_ID(N'[dbo].[dividend_payments]'))
+BEGIN
+    CREATE INDEX idx_dividend_payments_order ON dividend_payments(order_id) WHERE order_id IS NOT NULL;
+END;
+GO
+
+-- A vested tranche records the fair market value it was taxed at as a
+-- perquisite, which is also its tax lot's cost. Tranches vested earlier take
+-- the cost of the lot they opened.
+IF COL_LENGTH('vesting_tranches', 'fair_market_value') IS NULL
+BEGIN
+    ALTER TABLE vesting_tranches ADD fair_market_value DECIMAL(18, 4) NULL;
+    EXEC('UPDATE t SET fair_market_value = l.cost_per_share
+        FROM vesting_tranches t
+        JOIN tax_lots l ON l.source = ''vesting_tranche'' AND l.source_id = t.id
+        WHERE t.status = ''vested''');
+END;
+GO
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"backend/models"
+	"backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuditHandler struct {
+	auditService *services.AuditService
+}
+
+func NewAuditHandler() *AuditHandler {
+	return &AuditHandler{
+		auditService: services.NewAuditService(),
+	}
+}
+
+// ListAuditLog handles GET /admin/audit
+// Filters: actor_id, action, entity_type, entity_id, request_id, from and to
+// (RFC3339), limit and offset.
+func (h *AuditHandler) ListAuditLog(c *gin.Context) {
+	filter := models.AuditLogFilter{
+		ActorID:    c.Query("actor_id"),
+		Action:     c.Query("action"),
+		EntityType: c.Query("entity_type"),
+		EntityID:   c.Query("entity_id"),
+		RequestID:  c.Query("request_id"),
+	}
+
+	var err error
+	if filter.From, err = queryTime(c, "from"); err != nil {
+		c.Error(err)
+		return
+	}
+	if filter.To, err = queryTime(c, "to"); err != nil {
+		c.Error(err)
+		return
+	}
+	if filter.Limit, err = queryInt(c, "limit"); err != nil {
+		c.Error(err)
+		return
+	}
+	if filter.Offset, err = queryInt(c, "offset"); err != nil {
+		c.Error(err)
+		return
+	}
+
+	entries, err := h.auditService.ListAuditLog(c.Request.Context(), filter)
+	if err != nil {
+		c.Error(fmt.Errorf("error listing audit log: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entries": entries,
+		"limit":   filter.Limit,
+		"offset":  filter.Offset,
+	})
+}
+
+// queryTime parses an optional RFC3339 query parameter
+func queryTime(c *gin.Context, name string) (*time.Time, error) {
+	v := c.Query(name)
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, invalidQuery(name, "rfc3339", err)
+	}
+	return &t, nil
+}
+
+// queryInt parses an optional integer query parameter
+func queryInt(c *gin.Context, name string) (int, error) {
+	v := c.Query(name)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, invalidQuery(name, "numeric", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"backend/models"
+	"backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type BankAccountHandler struct {
+	bankAccountService *services.BankAccountService
+}
+
+func NewBankAccountHandler() *BankAccountHandler {
+	return &BankAccountHandler{
+		bankAccountService: services.NewBankAccountService(),
+	}
+}
+
+// errInvalidBankAccountID is returned for a malformed :id path parameter
+var errInvalidBankAccountID = &requestError{
+	status:   http.StatusBadRequest,
+	response: ErrorResponse{Error: "Invalid bank account ID", Code: CodeInvalidRequest},
+}
+
+// RegisterBankAccount handles POST /api/v1/bank-accounts
+func (h *BankAccountHandler) RegisterBankAccount(c *gin.Context) {
+	var req models.BankAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidPayload(err))
+		return
+	}
+
+	account, err := h.bankAccountService.RegisterBankAccount(c.Request.Context(), req)
+	if err != nil {
+		c.Error(fmt.Errorf("error registering bank account: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":      "Bank account registered, waiting for verification",
+		"bank_account": account,
+	})
+}
+
+// ListBankAccounts handles GET /api/v1/bank-accounts/:userId
+func (h *BankAccountHandler) ListBankAccounts(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.Error(errInvalidUserID)
+		return
+	}
+
+	accounts, err := h.bankAccountService.ListBankAccounts(c.Request.Context(), userID)
+	if err != nil {
+		c.Error(fmt.Errorf("error listing bank accounts: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id":       userID,
+		"bank_accounts": accounts,
+	})
+}
+
+// VerifyBankAccount handles POST /admin/bank-accounts/:id/verify
+func (h *BankAccountHandler) VerifyBankAccount(c *gin.Context) {
+	accountID, decision, err := bindDecision(c, errInvalidBankAccountID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	account, err := h.bankAccountService.VerifyBankAccount(c.Request.Context(), accountID, decision.Note)
+	if err != nil {
+		c.Error(fmt.Errorf("error verifying bank account: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Bank account verified",
+		"bank_account": account,
+	})
+}
+
+// RejectBankAccount handles POST /admin/bank-accounts/:id/reject
+func (h *BankAccountHandler) RejectBankAccount(c *gin.Context) {
+	accountID, decision, err := bindDecision(c, errInvalidBankAccountID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	account, err := h.bankAccountService.RejectBankAccount(c.Request.Context(), accountID, decision.Note)
+	if err != nil {
+		c.Error(fmt.Errorf("error rejecting bank account: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Bank account rejected",
+		"bank_account": account,
+	})
+}
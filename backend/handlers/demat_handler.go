@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"backend/models"
+	"backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type DematHandler struct {
+	dematService *services.DematService
+}
+
+func NewDematHandler() *DematHandler {
+	return &DematHandler{
+		dematService: services.NewDematService(),
+	}
+}
+
+// errInvalidDematAccountID is returned for a malformed :id path parameter
+var errInvalidDematAccountID = &requestError{
+	status:   http.StatusBadRequest,
+	response: ErrorResponse{Error: "Invalid demat account ID", Code: CodeInvalidRequest},
+}
+
+// RegisterDematAccount handles POST /api/v1/demat-accounts
+func (h *DematHandler) RegisterDematAccount(c *gin.Context) {
+	var req models.DematAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidPayload(err))
+		return
+	}
+
+	account, err := h.dematService.RegisterDematAccount(c.Request.Context(), req)
+	if err != nil {
+		c.Error(fmt.Errorf("error registering demat account: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":       "Demat account registered, waiting for verification",
+		"demat_account": account,
+	})
+}
+
+// ListDematAccounts handles GET /api/v1/demat-accounts/:userId
+func (h *DematHandler) ListDematAccounts(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.Error(errInvalidUserID)
+		return
+	}
+
+	accounts, err := h.dematService.ListDematAccounts(c.Request.Context(), userID)
+	if err != nil {
+		c.Error(fmt.Errorf("error listing demat accounts: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id":        userID,
+		"demat_accounts": accounts,
+	})
+}
+
+// VerifyDematAccount handles POST /admin/demat-accounts/:id/verify
+func (h *DematHandler) VerifyDematAccount(c *gin.Context) {
+	accountID, decision, err := bindDecision(c, errInvalidDematAccountID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	account, err := h.dematService.VerifyDematAccount(c.Request.Context(), accountID, decision.Note)
+	if err != nil {
+		c.Error(fmt.Errorf("error verifying demat account: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Demat account verified",
+		"demat_account": account,
+	})
+}
+
+// RejectDematAccount handles POST /admin/demat-accounts/:id/reject
+func (h *DematHandler) RejectDematAccount(c *gin.Context) {
+	accountID, decision, err := bindDecision(c, errInvalidDematAccountID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	account, err := h.dematService.RejectDematAccount(c.Request.Context(), accountID, decision.Note)
+	if err != nil {
+		c.Error(fmt.Errorf("error rejecting demat account: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Demat account rejected",
+		"demat_account": account,
+	})
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"backend/models"
+	"backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type DividendHandler struct {
+	dividendService *services.DividendService
+}
+
+func NewDividendHandler() *DividendHandler {
+	return &DividendHandler{
+		dividendService: services.NewDividendService(),
+	}
+}
+
+// CreateDividend handles POST /admin/dividends
+func (h *DividendHandler) CreateDividend(c *gin.Context) {
+	var req models.DividendRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidPayload(err))
+		return
+	}
+
+	dividend, err := h.dividendService.CreateDividend(c.Request.Context(), req)
+	if err != nil {
+		c.Error(fmt.Errorf("error declaring dividend: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "Dividend declared, it will be paid on the pay date",
+		"dividend": dividend,
+	})
+}
+
+// ListDividends handles GET /admin/dividends
+func (h *DividendHandler) ListDividends(c *gin.Context) {
+	dividends, err := h.dividendService.ListDividends(c.Request.Context())
+	if err != nil {
+		c.Error(fmt.Errorf("error listing dividends: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"dividends": dividends,
+	})
+}
+
+// ListDividendPayments handles GET /api/v1/dividends/:userId
+func (h *DividendHandler) ListDividendPayments(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.Error(errInvalidUserID)
+		return
+	}
+
+	reinvest, payments, err := h.dividendService.ListDividendPayments(c.Request.Context(), userID)
+	if err != nil {
+		c.Error(fmt.Errorf("error listing dividend payments: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id":  userID,
+		"reinvest": reinvest,
+		"payments": payments,
+	})
+}
+
+// SetDividendPreference handles PUT /api/v1/dividend-preferences/:userId
+func (h *DividendHandler) SetDividendPreference(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.Error(errInvalidUserID)
+		return
+	}
+
+	var req models.DividendPreference
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidPayload(err))
+		return
+	}
+
+	if err := h.dividendService.SetDividendPreference(c.Request.Context(), userID, *req.Reinvest); err != nil {
+		c.Error(fmt.Errorf("error setting dividend preference: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id":  userID,
+		"reinvest": *req.Reinvest,
+	})
+}
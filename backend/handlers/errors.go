@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"backend/auth"
+	"backend/ratelimit"
+	"backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/sirupsen/logrus"
+)
+
+// Error codes returned in the "code" field of error responses.
+// Clients may match on them; they do not change between releases.
+const (
+	CodeInvalidRequest   = "invalid_request"
+	CodeInvalidUserID    = "invalid_user_id"
+	CodeUserNotFound     = "user_not_found"
+	CodeDuplicateRef     = "duplicate_reference"
+	CodeUnknownSymbol    = "unknown_symbol"
+	CodeStalePrice       = "stale_price"
+	CodePriceUnavailable = "price_unavailable"
+	CodeRewardLimit      = "reward_limit_exceeded"
+	CodeReviewNotFound   = "review_not_found"
+	CodeReviewDecided    = "review_already_decided"
+	CodeRewardNotFound   = "reward_not_found"
+	CodeNotPending       = "reward_not_pending_approval"
+	CodeSelfApproval     = "self_approval"
+	CodeUnknownMaker     = "unknown_maker"
+	CodeDematNotFound    = "demat_account_not_found"
+	CodeDematDuplicate   = "demat_account_exists"
+	CodeDematDecided     = "demat_account_already_decided"
+	CodeDematUnverified  = "demat_account_not_verified"
+	CodeInsufficient     = "insufficient_shares"
+	CodeNoWithdrawal     = "withdrawal_not_found"
+	CodeWithdrawalState  = "withdrawal_status_conflict"
+	CodeSaleFailed       = "sale_failed"
+	CodeBankNotFound     = "bank_account_not_found"
+	CodeBankDuplicate    = "bank_account_exists"
+	CodeBankDecided      = "bank_account_already_decided"
+	CodeBankUnverified   = "bank_account_not_verified"
+	CodeLowBalance       = "insufficient_balance"
+	CodeDividendExists   = "dividend_exists"
+	CodeRateLimited      = "rate_limited"
+	CodeUnauthenticated  = "unauthenticated"
+	CodeForbidden        = "forbidden"
+	CodeInternal         = "internal_error"
+)
+
+// ErrorResponse is the body of every error response
+type ErrorResponse struct {
+	Error   string       `json:"error"`
+	Code    string       `json:"code"`
+	Details []FieldError `json:"details,omitempty"`
+}
+
+// FieldError names a request field that failed validation and the rule it broke
+type FieldError struct {
+	Field string `json:"field"`
+	Rule  string `json:"rule"`
+}
+
+// domainErrors maps service errors to the response sent for them
+var domainErrors = []struct {
+	err     error
+	status  int
+	code    string
+	message string
+}{
+	{services.ErrInvalidRequest, http.StatusBadRequest, CodeInvalidRequest, "Invalid request"},
+	{services.ErrUserNotFound, http.StatusNotFound, CodeUserNotFound, "User not found"},
+	{services.ErrDuplicateReference, http.StatusConflict, CodeDuplicateRef, "A reward with this reference_id already exists"},
+	{services.ErrUnknownSymbol, http.StatusUnprocessableEntity, CodeUnknownSymbol, "Unknown stock symbol"},
+	{services.ErrStalePrice, http.StatusServiceUnavailable, CodeStalePrice, "Stock price is stale, try again after the next price refresh"},
+	{services.ErrPriceUnavailable, http.StatusServiceUnavailable, CodePriceUnavailable, "Stock price is temporarily unavailable"},
+	{services.ErrRewardLimitExceeded, http.StatusUnprocessableEntity, CodeRewardLimit, "Reward exceeds an issuance limit"},
+	{services.ErrReviewNotFound, http.StatusNotFound, CodeReviewNotFound, "Review not found"},
+	{services.ErrReviewDecided, http.StatusConflict, CodeReviewDecided, "Review has already been decided"},
+	{services.ErrRewardNotFound, http.StatusNotFound, CodeRewardNotFound, "Reward not found"},
+	{services.ErrRewardNotPendingApproval, http.StatusConflict, CodeNotPending, "Reward is not waiting for approval"},
+	{services.ErrSelfApproval, http.StatusForbidden, CodeSelfApproval, "Rewards must be approved or rejected by someone other than their creator"},
+	{services.ErrUnknownMaker, http.StatusForbidden, CodeUnknownMaker, "Rewards entered by hand can only be decided when their creator is known"},
+	{services.ErrDematAccountNotFound, http.StatusNotFound, CodeDematNotFound, "Demat account not found"},
+	{services.ErrDuplicateDematAccount, http.StatusConflict, CodeDematDuplicate, "This demat account is already registered"},
+	{services.ErrDematAccountDecided, http.StatusConflict, CodeDematDecided, "Demat account has already been verified or rejected"},
+	{services.ErrDematAccountNotVerified, http.StatusUnprocessableEntity, CodeDematUnverified, "Demat account must be verified before shares can be withdrawn to it"},
+	{services.ErrInsufficientShares, http.StatusUnprocessableEntity, CodeInsufficient, "Not enough settled, vested and unlocked shares"},
+	{services.ErrWithdrawalNotFound, http.StatusNotFound, CodeNoWithdrawal, "Withdrawal not found"},
+	{services.ErrWithdrawalStatus, http.StatusConflict, CodeWithdrawalState, "Withdrawal is not in a status that allows this"},
+	{services.ErrSaleFailed, http.StatusBadGateway, CodeSaleFailed, "The broker did not sell the shares; they are back in the holding"},
+	{services.ErrBankAccountNotFound, http.StatusNotFound, CodeBankNotFound, "Bank account not found"},
+	{services.ErrDuplicateBankAccount, http.StatusConflict, CodeBankDuplicate, "This bank account is already registered"},
+	{services.ErrBankAccountDecided, http.StatusConflict, CodeBankDecided, "Bank account has already been verified or rejected"},
+	{services.ErrBankAccountNotVerified, http.StatusUnprocessableEntity, CodeBankUnverified, "Bank account must be verified before money can be paid out to it"},
+	{services.ErrInsufficientBalance, http.StatusUnprocessableEntity, CodeLowBalance, "Not enough balance in the wallet"},
+	{services.ErrDuplicateDividend, http.StatusConflict, CodeDividendExists, "A dividend on this stock with this record date is already declared"},
+	{auth.ErrUnauthenticated, http.StatusUnauthorized, CodeUnauthenticated, "Authentication required"},
+	{auth.ErrForbidden, http.StatusForbidden, CodeForbidden, "Not allowed for this role"},
+	{ratelimit.ErrRateLimited, http.StatusTooManyRequests, CodeRateLimited, "Too many requests, retry after the time in the Retry-After header"},
+}
+
+// requestError is raised by a handler for a request it rejects before calling a service
+type requestError struct {
+	status   int
+	response ErrorResponse
+	cause    error
+}
+
+func (e *requestError) Error() string {
+	if e.cause != nil {
+		return e.response.Error + ": " + e.cause.Error()
+	}
+	return e.response.Error
+}
+
+func (e *requestError) Unwrap() error {
+	return e.cause
+}
+
+// errInvalidUserID is returned for a malformed :userId path parameter
+var errInvalidUserID = &requestError{
+	status:   http.StatusBadRequest,
+	response: ErrorResponse{Error: "Invalid user ID", Code: CodeInvalidUserID},
+}
+
+// Report validation failures by JSON field name rather than Go field name
+func init() {
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(f reflect.StructField) string {
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+	}
+}
+
+// invalidPayload reports a request body that failed to bind. Only the names of
+// failing fields and rules are returned, never the decoder's message.
+func invalidPayload(err error) error {
+	resp := ErrorResponse{Error: "Invalid request payload", Code: CodeInvalidRequest}
+
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		for _, fe := range validationErrs {
+			resp.Details = append(resp.Details, FieldError{Field: fe.Field(), Rule: fe.Tag()})
+		}
+	}
+
+	return &requestError{status: http.StatusBadRequest, response: resp, cause: err}
+}
+
+// invalidQuery reports a query parameter that failed to parse
+func invalidQuery(name, rule string, err error) error {
+	return &requestError{
+		status: http.StatusBadRequest,
+		response: ErrorResponse{
+			Error:   "Invalid query parameter",
+			Code:    CodeInvalidRequest,
+			Details: []FieldError{{Field: name, Rule: rule}},
+		},
+		cause: err,
+	}
+}
+
+// ErrorMiddleware turns the last error a handler attached with c.Error into a
+// JSON response with a stable code. Unrecognised errors become a generic 500,
+// so internal details only reach the logs.
+func ErrorMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+
+		err := c.Errors.Last().Err
+		status, resp := errorResponse(err)
+
+		entry := logrus.WithContext(c.Request.Context()).WithError(err).WithFields(logrus.Fields{
+			"code":   resp.Code,
+			"status": status,
+			"route":  c.FullPath(),
+		})
+		if status >= http.StatusInternalServerError {
+			entry.Error("Request failed")
+		} else {
+			entry.Warn("Request rejected")
+		}
+
+		c.JSON(status, resp)
+	}
+}
+
+// errorResponse picks the status and body for err
+func errorResponse(err error) (int, ErrorResponse) {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		return reqErr.status, reqErr.response
+	}
+
+	for _, d := range domainErrors {
+		if errors.Is(err, d.err) {
+			resp := ErrorResponse{Error: d.message, Code: d.code}
+			// Name the broken rule so callers can tell caps from velocity limits
+			var violation *services.RuleViolation
+			if errors.As(err, &violation) {
+				resp.Details = []FieldError{{Field: violation.Field, Rule: violation.Rule}}
+			}
+			return d.status, resp
+		}
+	}
+
+	return http.StatusInternalServerError, ErrorResponse{Error: "Internal server error", Code: CodeInternal}
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http"
+
+	"backend/models"
+	"backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type HealthHandler struct {
+	healthService *services.HealthService
+}
+
+func NewHealthHandler() *HealthHandler {
+	return &HealthHandler{
+		healthService: services.NewHealthService(),
+	}
+}
+
+// Livez handles GET /livez. It only reports that the process is serving
+// requests and never touches dependencies, so a database outage does not
+// get the process restarted.
+func (h *HealthHandler) Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": models.HealthPass})
+}
+
+// Readyz handles GET /readyz, returning 503 when a critical check fails
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	report := h.healthService.CheckReadiness(c.Request.Context())
+
+	if report.Status == models.HealthFail {
+		logrus.WithContext(c.Request.Context()).WithField("checks", report.Checks).Warn("Readiness check failed")
+		c.JSON(http.StatusServiceUnavailable, report)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -1,13 +1,13 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
 
 	"backend/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"github.com/sirupsen/logrus"
 )
 
 type PortfolioHandler struct {
@@ -25,14 +25,13 @@ func (h *PortfolioHandler) GetHistoricalINR(c *gin.Context) {
 	userIDStr := c.Param("userId")
 	userID, err := uuid.Parse(userIDStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		c.Error(errInvalidUserID)
 		return
 	}
 
-	historicalData, err := h.portfolioService.GetHistoricalINR(userID)
+	historicalData, err := h.portfolioService.GetHistoricalINR(c.Request.Context(), userID)
 	if err != nil {
-		logrus.WithError(err).Error("Error fetching historical INR data")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch historical data", "details": err.Error()})
+		c.Error(fmt.Errorf("error fetching historical INR data: %w", err))
 		return
 	}
 
@@ -47,14 +46,13 @@ func (h *PortfolioHandler) GetStats(c *gin.Context) {
 	userIDStr := c.Param("userId")
 	userID, err := uuid.Parse(userIDStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		c.Error(errInvalidUserID)
 		return
 	}
 
-	stats, err := h.portfolioService.GetStats(userID)
+	stats, err := h.portfolioService.GetStats(c.Request.Context(), userID)
 	if err != nil {
-		logrus.WithError(err).Error("Error fetching stats")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stats", "details": err.Error()})
+		c.Error(fmt.Errorf("error fetching stats: %w", err))
 		return
 	}
 
@@ -69,14 +67,13 @@ func (h *PortfolioHandler) GetPortfolio(c *gin.Context) {
 	userIDStr := c.Param("userId")
 	userID, err := uuid.Parse(userIDStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		c.Error(errInvalidUserID)
 		return
 	}
 
-	portfolio, err := h.portfolioService.GetPortfolio(userID)
+	portfolio, err := h.portfolioService.GetPortfolio(c.Request.Context(), userID)
 	if err != nil {
-		logrus.WithError(err).Error("Error fetching portfolio")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch portfolio", "details": err.Error()})
+		c.Error(fmt.Errorf("error fetching portfolio: %w", err))
 		return
 	}
 
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"backend/models"
+	"backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type RedemptionHandler struct {
+	redemptionService *services.RedemptionService
+}
+
+func NewRedemptionHandler() *RedemptionHandler {
+	return &RedemptionHandler{
+		redemptionService: services.NewRedemptionService(),
+	}
+}
+
+// CreateRedemption handles POST /api/v1/redemptions
+func (h *RedemptionHandler) CreateRedemption(c *gin.Context) {
+	var req models.RedemptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidPayload(err))
+		return
+	}
+
+	redemption, err := h.redemptionService.Redeem(c.Request.Context(), req)
+	if err != nil {
+		c.Error(fmt.Errorf("error redeeming shares: %w", err))
+		return
+	}
+
+	if redemption.Status == models.RedemptionStatusPending {
+		c.JSON(http.StatusAccepted, gin.H{
+			"message":    "Sell order placed, proceeds will be credited to the wallet when it fills",
+			"redemption": redemption,
+		})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"message":    "Shares sold, proceeds credited to the wallet",
+		"redemption": redemption,
+	})
+}
+
+// ListRedemptions handles GET /api/v1/redemptions/:userId
+func (h *RedemptionHandler) ListRedemptions(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.Error(errInvalidUserID)
+		return
+	}
+
+	redemptions, err := h.redemptionService.ListRedemptions(c.Request.Context(), userID)
+	if err != nil {
+		c.Error(fmt.Errorf("error listing redemptions: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id":     userID,
+		"redemptions": redemptions,
+	})
+}
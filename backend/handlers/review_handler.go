@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"backend/models"
+	"backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type ReviewHandler struct {
+	reviewService *services.ReviewService
+}
+
+func NewReviewHandler() *ReviewHandler {
+	return &ReviewHandler{
+		reviewService: services.NewReviewService(),
+	}
+}
+
+// errInvalidReviewID is returned for a malformed :id path parameter
+var errInvalidReviewID = &requestError{
+	status:   http.StatusBadRequest,
+	response: ErrorResponse{Error: "Invalid review ID", Code: CodeInvalidRequest},
+}
+
+// ListReviews handles GET /admin/reviews
+// Filters: status (defaults to pending; "all" lists every review) and limit.
+func (h *ReviewHandler) ListReviews(c *gin.Context) {
+	status := c.DefaultQuery("status", models.ReviewStatusPending)
+	if status == "all" {
+		status = ""
+	}
+	limit, err := queryInt(c, "limit")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	reviews, err := h.reviewService.ListReviews(c.Request.Context(), status, limit)
+	if err != nil {
+		c.Error(fmt.Errorf("error listing reward reviews: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reviews": reviews,
+	})
+}
+
+// ApproveReview handles POST /admin/reviews/:id/approve
+func (h *ReviewHandler) ApproveReview(c *gin.Context) {
+	reviewID, decision, err := bindDecision(c, errInvalidReviewID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	review, err := h.reviewService.ApproveReview(c.Request.Context(), reviewID, decision.Note)
+	if err != nil {
+		c.Error(fmt.Errorf("error approving reward review: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Reward approved",
+		"review":  review,
+	})
+}
+
+// RejectReview handles POST /admin/reviews/:id/reject
+func (h *ReviewHandler) RejectReview(c *gin.Context) {
+	reviewID, decision, err := bindDecision(c, errInvalidReviewID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	review, err := h.reviewService.RejectReview(c.Request.Context(), reviewID, decision.Note)
+	if err != nil {
+		c.Error(fmt.Errorf("error rejecting reward review: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Reward rejected",
+		"review":  review,
+	})
+}
+
+// bindDecision reads the :id path parameter and the optional decision body
+// of an approve or reject request
+func bindDecision(c *gin.Context, errInvalidID error) (uuid.UUID, models.ReviewDecision, error) {
+	var decision models.ReviewDecision
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return uuid.Nil, decision, errInvalidID
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&decision); err != nil {
+			return uuid.Nil, decision, invalidPayload(err)
+		}
+	}
+	return id, decision, nil
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
 
 	"backend/models"
@@ -8,7 +9,6 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"github.com/sirupsen/logrus"
 )
 
 type RewardHandler struct {
@@ -25,24 +25,53 @@ func NewRewardHandler() *RewardHandler {
 func (h *RewardHandler) CreateReward(c *gin.Context) {
 	var req models.RewardRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		logrus.WithError(err).Error("Invalid request payload")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload", "details": err.Error()})
+		c.Error(invalidPayload(err))
 		return
 	}
 
-	reward, err := h.rewardService.CreateReward(req)
+	reward, err := h.rewardService.CreateReward(c.Request.Context(), req)
 	if err != nil {
-		logrus.WithError(err).Error("Error creating reward")
-		errMsg := err.Error()
-		if errMsg == "duplicate reward event: reference_id already exists" {
-			c.JSON(http.StatusConflict, gin.H{"error": errMsg})
-			return
-		}
-		if errMsg == "user not found" {
-			c.JSON(http.StatusNotFound, gin.H{"error": errMsg})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reward", "details": errMsg})
+		c.Error(fmt.Errorf("error creating reward: %w", err))
+		return
+	}
+
+	if reward.Status == models.RewardStatusQueued {
+		c.JSON(http.StatusAccepted, gin.H{
+			"message": "Reward queued until a fresh stock price is available",
+			"reward":  reward,
+		})
+		return
+	}
+
+	if reward.Status == models.RewardStatusPending {
+		c.JSON(http.StatusAccepted, gin.H{
+			"message": "Reward recorded, waiting for its buy order to fill",
+			"reward":  reward,
+		})
+		return
+	}
+
+	if reward.Status == models.RewardStatusFailed {
+		c.JSON(http.StatusCreated, gin.H{
+			"message": "Reward recorded but its buy order failed",
+			"reward":  reward,
+		})
+		return
+	}
+
+	if reward.Status == models.RewardStatusPendingApproval {
+		c.JSON(http.StatusAccepted, gin.H{
+			"message": "Reward waiting for approval by a second person",
+			"reward":  reward,
+		})
+		return
+	}
+
+	if reward.Status == models.RewardStatusUnderReview {
+		c.JSON(http.StatusAccepted, gin.H{
+			"message": "Reward held for review",
+			"reward":  reward,
+		})
 		return
 	}
 
@@ -52,19 +81,64 @@ func (h *RewardHandler) CreateReward(c *gin.Context) {
 	})
 }
 
+// errInvalidRewardID is returned for a malformed :id path parameter
+var errInvalidRewardID = &requestError{
+	status:   http.StatusBadRequest,
+	response: ErrorResponse{Error: "Invalid reward ID", Code: CodeInvalidRequest},
+}
+
+// ApproveReward handles POST /admin/rewards/:id/approve
+func (h *RewardHandler) ApproveReward(c *gin.Context) {
+	rewardID, decision, err := bindDecision(c, errInvalidRewardID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	reward, err := h.rewardService.ApproveReward(c.Request.Context(), rewardID, decision.Note)
+	if err != nil {
+		c.Error(fmt.Errorf("error approving reward: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Reward approved",
+		"reward":  reward,
+	})
+}
+
+// RejectReward handles POST /admin/rewards/:id/reject
+func (h *RewardHandler) RejectReward(c *gin.Context) {
+	rewardID, decision, err := bindDecision(c, errInvalidRewardID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	reward, err := h.rewardService.RejectReward(c.Request.Context(), rewardID, decision.Note)
+	if err != nil {
+		c.Error(fmt.Errorf("error rejecting reward: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Reward rejected",
+		"reward":  reward,
+	})
+}
+
 // GetTodayStocks handles GET /today-stocks/:userId
 func (h *RewardHandler) GetTodayStocks(c *gin.Context) {
 	userIDStr := c.Param("userId")
 	userID, err := uuid.Parse(userIDStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		c.Error(errInvalidUserID)
 		return
 	}
 
-	rewards, err := h.rewardService.GetTodayStocks(userID)
+	rewards, err := h.rewardService.GetTodayStocks(c.Request.Context(), userID)
 	if err != nil {
-		logrus.WithError(err).Error("Error fetching today's stocks")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch today's stocks", "details": err.Error()})
+		c.Error(fmt.Errorf("error fetching today's stocks: %w", err))
 		return
 	}
 
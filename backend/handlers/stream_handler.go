@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"backend/services"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	streamHeartbeatInterval = 15 * time.Second
+	streamRetryMillis       = 3000
+)
+
+type StreamHandler struct {
+	portfolioService *services.PortfolioService
+}
+
+func NewStreamHandler() *StreamHandler {
+	return &StreamHandler{
+		portfolioService: services.NewPortfolioService(),
+	}
+}
+
+// StreamPortfolio handles GET /stream/portfolio/:userId
+// It pushes the user's holdings and total value as Server-Sent Events whenever
+// prices are refreshed or a new reward is recorded for the user.
+func (h *StreamHandler) StreamPortfolio(c *gin.Context) {
+	userIDStr := c.Param("userId")
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		c.Error(errInvalidUserID)
+		return
+	}
+
+	events := services.PortfolioEvents()
+	sub := events.Subscribe(userID)
+	defer events.Unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	// A reconnecting client that has already seen the latest change only gets heartbeats
+	// until something new happens; everyone else starts with a fresh snapshot.
+	if !events.IsCurrent(userID, c.GetHeader("Last-Event-ID")) {
+		if err := h.sendPortfolio(c, userID); err != nil {
+			logrus.WithContext(c.Request.Context()).WithError(err).WithField("user_id", userID).Error("Error sending portfolio snapshot")
+			return
+		}
+	} else {
+		fmt.Fprintf(c.Writer, "retry: %d\n\n", streamRetryMillis)
+		c.Writer.Flush()
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-events.Done():
+			// Server is shutting down; the client will reconnect with Last-Event-ID
+			return false
+		case <-sub.C:
+			if err := h.sendPortfolio(c, userID); err != nil {
+				logrus.WithContext(c.Request.Context()).WithError(err).WithField("user_id", userID).Error("Error sending portfolio update")
+				return false
+			}
+		case <-heartbeat.C:
+			// SSE comment lines keep proxies from closing an idle connection
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func (h *StreamHandler) sendPortfolio(c *gin.Context, userID uuid.UUID) error {
+	// Take the event ID before reading so a change racing with the read is re-sent
+	eventID := services.PortfolioEvents().EventID(userID)
+
+	portfolio, err := h.portfolioService.GetPortfolio(c.Request.Context(), userID)
+	if err != nil {
+		return err
+	}
+
+	totalValue := 0.0
+	for _, item := range portfolio {
+		totalValue += item.CurrentValue
+	}
+
+	c.Render(-1, sse.Event{
+		Id:    eventID,
+		Event: "portfolio",
+		Retry: streamRetryMillis,
+		Data: gin.H{
+			"user_id":     userID,
+			"holdings":    portfolio,
+			"total_value": totalValue,
+		},
+	})
+	c.Writer.Flush()
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type TaxHandler struct {
+	taxService *services.TaxService
+}
+
+func NewTaxHandler() *TaxHandler {
+	return &TaxHandler{
+		taxService: services.NewTaxService(),
+	}
+}
+
+// ListTaxLots handles GET /api/v1/tax-lots/:userId
+func (h *TaxHandler) ListTaxLots(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.Error(errInvalidUserID)
+		return
+	}
+
+	lots, err := h.taxService.ListTaxLots(c.Request.Context(), userID)
+	if err != nil {
+		c.Error(fmt.Errorf("error listing tax lots: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id": userID,
+		"lots":    lots,
+	})
+}
+
+// GetCapitalGains handles GET /api/v1/capital-gains/:userId
+func (h *TaxHandler) GetCapitalGains(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.Error(errInvalidUserID)
+		return
+	}
+
+	gains, err := h.taxService.GetCapitalGains(c.Request.Context(), userID)
+	if err != nil {
+		c.Error(fmt.Errorf("error fetching capital gains: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gains)
+}
+
+// GetTaxStatement handles GET /api/v1/tax-statements/:userId/:fy. The
+// statement is JSON unless format=csv asks for a CSV download.
+func (h *TaxHandler) GetTaxStatement(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.Error(errInvalidUserID)
+		return
+	}
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		c.Error(invalidQuery("format", "oneof", nil))
+		return
+	}
+
+	statement, err := h.taxService.GetTaxStatement(c.Request.Context(), userID, c.Param("fy"))
+	if err != nil {
+		c.Error(fmt.Errorf("error building tax statement: %w", err))
+		return
+	}
+
+	if format == "json" {
+		c.JSON(http.StatusOK, statement)
+		return
+	}
+
+	content, err := services.TaxStatementCSV(statement)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	filename := "tax-statement-" + userID.String() + "-" + statement.FinancialYear + ".csv"
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Data(http.StatusOK, "text/csv", content)
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"backend/models"
+	"backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type VestingHandler struct {
+	vestingService *services.VestingService
+}
+
+func NewVestingHandler() *VestingHandler {
+	return &VestingHandler{
+		vestingService: services.NewVestingService(),
+	}
+}
+
+// ForfeitVesting handles POST /admin/users/:userId/forfeit-vesting
+// It is used when a user leaves before their rewards vest.
+func (h *VestingHandler) ForfeitVesting(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.Error(errInvalidUserID)
+		return
+	}
+
+	var req models.ForfeitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidPayload(err))
+		return
+	}
+
+	forfeited, err := h.vestingService.ForfeitUnvested(c.Request.Context(), userID, req.Reason)
+	if err != nil {
+		c.Error(fmt.Errorf("error forfeiting unvested shares: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":            "Unvested shares forfeited",
+		"user_id":            userID,
+		"tranches_forfeited": forfeited,
+	})
+}
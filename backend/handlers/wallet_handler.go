@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"backend/models"
+	"backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type WalletHandler struct {
+	walletService *services.WalletService
+}
+
+func NewWalletHandler() *WalletHandler {
+	return &WalletHandler{
+		walletService: services.NewWalletService(),
+	}
+}
+
+// GetWallet handles GET /api/v1/wallet/:userId
+// Query parameters limit and offset page through the transaction history.
+func (h *WalletHandler) GetWallet(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.Error(errInvalidUserID)
+		return
+	}
+
+	limit, err := queryInt(c, "limit")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	offset, err := queryInt(c, "offset")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	wallet, err := h.walletService.GetWallet(c.Request.Context(), userID, limit, offset)
+	if err != nil {
+		c.Error(fmt.Errorf("error fetching wallet: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, wallet)
+}
+
+// RequestPayout handles POST /api/v1/payouts
+func (h *WalletHandler) RequestPayout(c *gin.Context) {
+	var req models.PayoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidPayload(err))
+		return
+	}
+
+	payout, err := h.walletService.RequestPayout(c.Request.Context(), req)
+	if err != nil {
+		c.Error(fmt.Errorf("error requesting payout: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Payout requested, waiting for the bank to settle it",
+		"payout":  payout,
+	})
+}
+
+// ListPayouts handles GET /api/v1/payouts/:userId
+func (h *WalletHandler) ListPayouts(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.Error(errInvalidUserID)
+		return
+	}
+
+	payouts, err := h.walletService.ListPayouts(c.Request.Context(), userID)
+	if err != nil {
+		c.Error(fmt.Errorf("error listing payouts: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id": userID,
+		"payouts": payouts,
+	})
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"backend/models"
+	"backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type WithdrawalHandler struct {
+	withdrawalService *services.WithdrawalService
+}
+
+func NewWithdrawalHandler() *WithdrawalHandler {
+	return &WithdrawalHandler{
+		withdrawalService: services.NewWithdrawalService(),
+	}
+}
+
+// errInvalidWithdrawalID is returned for a malformed :id path parameter
+var errInvalidWithdrawalID = &requestError{
+	status:   http.StatusBadRequest,
+	response: ErrorResponse{Error: "Invalid withdrawal ID", Code: CodeInvalidRequest},
+}
+
+// errInvalidBatchID is returned for a malformed :batchId path parameter
+var errInvalidBatchID = &requestError{
+	status:   http.StatusBadRequest,
+	response: ErrorResponse{Error: "Invalid batch ID", Code: CodeInvalidRequest},
+}
+
+// RequestWithdrawal handles POST /api/v1/withdrawals
+func (h *WithdrawalHandler) RequestWithdrawal(c *gin.Context) {
+	var req models.WithdrawalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidPayload(err))
+		return
+	}
+
+	withdrawal, err := h.withdrawalService.RequestWithdrawal(c.Request.Context(), req)
+	if err != nil {
+		c.Error(fmt.Errorf("error requesting withdrawal: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":    "Withdrawal requested, waiting to be sent to the depository",
+		"withdrawal": withdrawal,
+	})
+}
+
+// ListWithdrawals handles GET /api/v1/withdrawals/:userId
+func (h *WithdrawalHandler) ListWithdrawals(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.Error(errInvalidUserID)
+		return
+	}
+
+	withdrawals, err := h.withdrawalService.ListWithdrawals(c.Request.Context(), userID)
+	if err != nil {
+		c.Error(fmt.Errorf("error listing withdrawals: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id":     userID,
+		"withdrawals": withdrawals,
+	})
+}
+
+// SubmitWithdrawals handles POST /admin/withdrawals/submit
+// It responds with the batch's instruction file, or 204 when nothing was waiting.
+func (h *WithdrawalHandler) SubmitWithdrawals(c *gin.Context) {
+	file, err := h.withdrawalService.SubmitWithdrawals(c.Request.Context())
+	if err != nil {
+		c.Error(fmt.Errorf("error submitting withdrawals: %w", err))
+		return
+	}
+	if file == nil {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	sendInstructionFile(c, file)
+}
+
+// GetInstructionFile handles GET /admin/withdrawals/batches/:batchId/instructions
+// It downloads a submitted batch's instruction file again.
+func (h *WithdrawalHandler) GetInstructionFile(c *gin.Context) {
+	batchID, err := uuid.Parse(c.Param("batchId"))
+	if err != nil {
+		c.Error(errInvalidBatchID)
+		return
+	}
+
+	file, err := h.withdrawalService.InstructionFile(c.Request.Context(), batchID)
+	if err != nil {
+		c.Error(fmt.Errorf("error building instruction file: %w", err))
+		return
+	}
+
+	sendInstructionFile(c, file)
+}
+
+// CompleteWithdrawal handles POST /admin/withdrawals/:id/complete
+func (h *WithdrawalHandler) CompleteWithdrawal(c *gin.Context) {
+	withdrawalID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.Error(errInvalidWithdrawalID)
+		return
+	}
+
+	withdrawal, err := h.withdrawalService.CompleteWithdrawal(c.Request.Context(), withdrawalID)
+	if err != nil {
+		c.Error(fmt.Errorf("error completing withdrawal: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Withdrawal completed",
+		"withdrawal": withdrawal,
+	})
+}
+
+// FailWithdrawal handles POST /admin/withdrawals/:id/fail
+func (h *WithdrawalHandler) FailWithdrawal(c *gin.Context) {
+	withdrawalID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.Error(errInvalidWithdrawalID)
+		return
+	}
+
+	var req models.WithdrawalFailure
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(invalidPayload(err))
+		return
+	}
+
+	withdrawal, err := h.withdrawalService.FailWithdrawal(c.Request.Context(), withdrawalID, req.Reason)
+	if err != nil {
+		c.Error(fmt.Errorf("error failing withdrawal: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Withdrawal failed, shares returned to the holding",
+		"withdrawal": withdrawal,
+	})
+}
+
+// sendInstructionFile responds with an instruction file as a CSV download
+func sendInstructionFile(c *gin.Context, file *services.InstructionFile) {
+	c.Header("Content-Disposition", `attachment; filename="`+file.Name()+`"`)
+	c.Header("X-Batch-ID", file.BatchID.String())
+	c.Header("X-Withdrawal-Count", strconv.Itoa(file.Withdrawals))
+	c.Data(http.StatusOK, "text/csv", file.Content)
+}
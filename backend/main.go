@@ -2,17 +2,32 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"io/fs"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
 	"time"
 
+	"backend/auth"
+	"backend/config"
 	"backend/database"
 	"backend/handlers"
+	"backend/metrics"
+	"backend/ratelimit"
 	"backend/services"
+	"backend/telemetry"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 func main() {
@@ -25,95 +40,561 @@ func main() {
 	logrus.SetFormatter(&logrus.JSONFormatter{})
 	logrus.SetLevel(logrus.InfoLevel)
 
+	// Resolve configuration from flags, environment and config file
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).Fatal("Invalid configuration")
+	}
+	level, _ := logrus.ParseLevel(cfg.LogLevel)
+	logrus.SetLevel(level)
+	logrus.WithFields(logrus.Fields(cfg.Redacted())).Info("Loaded configuration")
+
+	// Initialize tracing before the database so SQL spans use the real provider
+	shutdownTracing, err := telemetry.Init(context.Background(), cfg.TraceExporter)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to initialize tracing")
+	}
+
 	// Connect to database
-	if err := database.Connect(); err != nil {
+	if err := database.Connect(cfg.Database); err != nil {
 		logrus.WithError(err).Fatal("Failed to connect to database")
 	}
-	defer database.Close()
 	logrus.Info("Connected to the database")
+	registerMetrics()
 
 	// Run database migration
 	if err := database.Migrate(); err != nil {
 		logrus.WithError(err).Warn("Database migration had errors, continuing anyway")
 	}
 
-	// Start background job for hourly price updates
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	go startPriceUpdateJob(ctx)
+	// Install the service settings, with the exchange calendar and the fees
+	// charged on rewards and redemptions loaded from their files
+	opts := cfg.Services
+	opts.Calendar = loadMarketCalendar(cfg.MarketHolidaysFile)
+	opts.Fees = loadFeeSchedule(cfg.FeeSchedulePath)
+	if err := services.Configure(opts); err != nil {
+		logrus.WithError(err).Fatal("Invalid service options")
+	}
+
+	// Background jobs get their own context so they stop only after the server has drained
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	var jobs sync.WaitGroup
+
+	// Start background job for price updates during market hours
+	jobs.Add(1)
+	go func() {
+		defer jobs.Done()
+		startPriceUpdateJob(jobsCtx, cfg.PriceRefreshInterval, cfg.ShutdownTimeout)
+	}()
+
+	// Start background job that follows reward orders until they fill
+	jobs.Add(1)
+	go func() {
+		defer jobs.Done()
+		startOrderFulfilmentJob(jobsCtx, cfg.ShutdownTimeout)
+	}()
+
+	// Start background job that settles fulfilled rewards on T+1
+	jobs.Add(1)
+	go func() {
+		defer jobs.Done()
+		startSettlementJob(jobsCtx, cfg.ShutdownTimeout)
+	}()
+
+	// Start background job that vests reward tranches
+	jobs.Add(1)
+	go func() {
+		defer jobs.Done()
+		startVestingJob(jobsCtx, cfg.ShutdownTimeout)
+	}()
+
+	// Start background job that follows wallet payouts until the bank settles them
+	jobs.Add(1)
+	go func() {
+		defer jobs.Done()
+		startPayoutJob(jobsCtx, cfg.ShutdownTimeout)
+	}()
+
+	// Start background job that pays dividends on their pay date
+	jobs.Add(1)
+	go func() {
+		defer jobs.Done()
+		startDividendJob(jobsCtx, cfg.ShutdownTimeout)
+	}()
 
 	// Setup Gin router
-	router := setupRouter()
+	router := setupRouter(cfg)
 
 	// Start server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	port := cfg.Port
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           router,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	// Portfolio streams never finish on their own, so end them when shutdown starts
+	server.RegisterOnShutdown(services.PortfolioEvents().Close)
+
+	serverErr := make(chan error, 1)
+	go func() {
+		logrus.Infof("Starting server on port %s", port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+		close(serverErr)
+	}()
+
+	signals, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stopSignals()
+
+	select {
+	case <-signals.Done():
+		logrus.Info("Shutdown signal received")
+	case err := <-serverErr:
+		if err != nil {
+			logrus.WithError(err).Error("Server failed")
+		}
 	}
 
-	logrus.Infof("Starting server on port %s", port)
-	if err := router.Run(":" + port); err != nil {
-		logrus.WithError(err).Fatal("Failed to start server")
+	shutdown(server, cfg.ShutdownTimeout, stopJobs, &jobs, shutdownTracing)
+}
+
+// shutdown stops the process in dependency order: stop accepting requests and
+// drain in-flight ones, wait for background jobs, flush traces, then close the
+// DB that all of them use.
+func shutdown(server *http.Server, timeout time.Duration, stopJobs context.CancelFunc, jobs *sync.WaitGroup, shutdownTracing func(context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// Jobs stop between runs. A run in progress keeps going until it finishes
+	// or its grace, the same timeout, runs out, so it is cut off no earlier
+	// than the deadline below.
+	stopJobs()
+
+	logrus.WithField("timeout", timeout.String()).Info("Draining in-flight requests")
+	if err := server.Shutdown(ctx); err != nil {
+		logrus.WithError(err).Warn("Server did not drain before the deadline")
 	}
+
+	jobsDone := make(chan struct{})
+	go func() {
+		jobs.Wait()
+		close(jobsDone)
+	}()
+	select {
+	case <-jobsDone:
+		logrus.Info("Background jobs stopped")
+	case <-ctx.Done():
+		logrus.Warn("Background jobs did not stop before the deadline")
+	}
+
+	if err := shutdownTracing(ctx); err != nil {
+		logrus.WithError(err).Warn("Error flushing traces")
+	}
+
+	if err := database.Close(); err != nil {
+		logrus.WithError(err).Error("Error closing database")
+	}
+	logrus.Info("Shutdown complete")
 }
 
-func setupRouter() *gin.Engine {
+func setupRouter(cfg *config.Config) *gin.Engine {
 	router := gin.Default()
 
+	// Only trust X-Forwarded-For from known proxies, so clients cannot pick
+	// their own address for rate limiting
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		logrus.WithError(err).Fatal("Invalid trusted proxies")
+	}
+
 	// CORS middleware
-	config := cors.DefaultConfig()
-	config.AllowOrigins = []string{"http://localhost:3000", "http://localhost:3001"}
-	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
-	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization"}
-	config.AllowCredentials = true
-	router.Use(cors.New(config))
+	corsConfig := cors.DefaultConfig()
+	corsConfig.AllowOrigins = cfg.CORSAllowOrigins
+	corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+	corsConfig.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", telemetry.HeaderRequestID}
+	corsConfig.AllowCredentials = true
+	corsConfig.ExposeHeaders = []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After", telemetry.HeaderRequestID}
+	router.Use(cors.New(corsConfig))
+	router.Use(telemetry.RequestMiddleware())
+	router.Use(otelgin.Middleware(telemetry.ServiceName))
+	router.Use(metrics.Middleware())
+	// Registered after metrics so the recorded status includes mapped errors
+	router.Use(handlers.ErrorMiddleware())
+	authMiddleware, err := auth.Middleware(auth.Options{
+		TrustedProxies: cfg.TrustedProxies,
+		GatewaySecret:  cfg.GatewaySecret,
+	})
+	if err != nil {
+		logrus.WithError(err).Fatal("Invalid authentication options")
+	}
+	router.Use(authMiddleware)
+
+	// Prometheus scrape endpoint
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
 	// Health check endpoint
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "healthy"})
 	})
 
+	// Liveness and readiness probes
+	healthHandler := handlers.NewHealthHandler()
+	router.GET("/livez", healthHandler.Livez)
+	router.GET("/readyz", healthHandler.Readyz)
+
 	// API routes
 	api := router.Group("/api/v1")
+	if cfg.RateLimitEnabled {
+		api.Use(newRateLimiter(cfg).Middleware())
+	}
 	{
 		rewardHandler := handlers.NewRewardHandler()
 		portfolioHandler := handlers.NewPortfolioHandler()
+		streamHandler := handlers.NewStreamHandler()
 
 		api.POST("/reward", rewardHandler.CreateReward)
 		api.GET("/today-stocks/:userId", rewardHandler.GetTodayStocks)
 		api.GET("/historical-inr/:userId", portfolioHandler.GetHistoricalINR)
 		api.GET("/stats/:userId", portfolioHandler.GetStats)
 		api.GET("/portfolio/:userId", portfolioHandler.GetPortfolio)
+		api.GET("/stream/portfolio/:userId", streamHandler.StreamPortfolio)
+
+		dematHandler := handlers.NewDematHandler()
+		withdrawalHandler := handlers.NewWithdrawalHandler()
+		api.POST("/demat-accounts", dematHandler.RegisterDematAccount)
+		api.GET("/demat-accounts/:userId", dematHandler.ListDematAccounts)
+		api.POST("/withdrawals", withdrawalHandler.RequestWithdrawal)
+		api.GET("/withdrawals/:userId", withdrawalHandler.ListWithdrawals)
+
+		redemptionHandler := handlers.NewRedemptionHandler()
+		api.POST("/redemptions", redemptionHandler.CreateRedemption)
+		api.GET("/redemptions/:userId", redemptionHandler.ListRedemptions)
+
+		bankAccountHandler := handlers.NewBankAccountHandler()
+		walletHandler := handlers.NewWalletHandler()
+		api.POST("/bank-accounts", bankAccountHandler.RegisterBankAccount)
+		api.GET("/bank-accounts/:userId", bankAccountHandler.ListBankAccounts)
+		api.GET("/wallet/:userId", walletHandler.GetWallet)
+		api.POST("/payouts", walletHandler.RequestPayout)
+		api.GET("/payouts/:userId", walletHandler.ListPayouts)
+
+		dividendHandler := handlers.NewDividendHandler()
+		api.GET("/dividends/:userId", dividendHandler.ListDividendPayments)
+		api.PUT("/dividend-preferences/:userId", dividendHandler.SetDividendPreference)
+
+		taxHandler := handlers.NewTaxHandler()
+		api.GET("/tax-lots/:userId", taxHandler.ListTaxLots)
+		api.GET("/capital-gains/:userId", taxHandler.GetCapitalGains)
+		api.GET("/tax-statements/:userId/:fy", taxHandler.GetTaxStatement)
+
+		admin := api.Group("/admin", auth.RequireRole(auth.RoleAdmin, auth.RoleCompliance))
+		auditHandler := handlers.NewAuditHandler()
+		admin.GET("/audit", auditHandler.ListAuditLog)
+
+		admin.POST("/rewards/:id/approve", rewardHandler.ApproveReward)
+		admin.POST("/rewards/:id/reject", rewardHandler.RejectReward)
+
+		reviewHandler := handlers.NewReviewHandler()
+		admin.GET("/reviews", reviewHandler.ListReviews)
+		admin.POST("/reviews/:id/approve", reviewHandler.ApproveReview)
+		admin.POST("/reviews/:id/reject", reviewHandler.RejectReview)
+
+		vestingHandler := handlers.NewVestingHandler()
+		admin.POST("/users/:userId/forfeit-vesting", vestingHandler.ForfeitVesting)
+
+		admin.POST("/demat-accounts/:id/verify", dematHandler.VerifyDematAccount)
+		admin.POST("/demat-accounts/:id/reject", dematHandler.RejectDematAccount)
+		admin.POST("/withdrawals/submit", withdrawalHandler.SubmitWithdrawals)
+		admin.GET("/withdrawals/batches/:batchId/instructions", withdrawalHandler.GetInstructionFile)
+		admin.POST("/withdrawals/:id/complete", withdrawalHandler.CompleteWithdrawal)
+		admin.POST("/withdrawals/:id/fail", withdrawalHandler.FailWithdrawal)
+
+		admin.POST("/bank-accounts/:id/verify", bankAccountHandler.VerifyBankAccount)
+		admin.POST("/bank-accounts/:id/reject", bankAccountHandler.RejectBankAccount)
+
+		admin.POST("/dividends", dividendHandler.CreateDividend)
+		admin.GET("/dividends", dividendHandler.ListDividends)
 	}
 
 	return router
 }
 
-func startPriceUpdateJob(ctx context.Context) {
-	ticker := time.NewTicker(1 * time.Hour)
+// newRateLimiter applies the per-client and per-user limits to every API route,
+// with a stricter per-client limit on reward creation
+func newRateLimiter(cfg *config.Config) *ratelimit.Limiter {
+	rules := ratelimit.Rules{
+		Default: ratelimit.RouteLimits{Client: cfg.RateLimitClient, User: cfg.RateLimitUser},
+		Routes: map[string]ratelimit.RouteLimits{
+			"POST /api/v1/reward": {Client: cfg.RateLimitReward},
+		},
+	}
+	return ratelimit.NewLimiter(ratelimit.NewMemoryStore(), rules, ratelimit.ClientIP)
+}
+
+// registerMetrics exposes DB pool and price cache statistics alongside the
+// counters the services record directly
+func registerMetrics() {
+	metrics.RegisterDBStats(database.DB)
+	metrics.RegisterCounterFunc("price_cache_hits_total", "Stored price lookups served from the in-process cache.", func() float64 {
+		return float64(services.GetPriceCacheStats().Hits)
+	})
+	metrics.RegisterCounterFunc("price_cache_misses_total", "Stored price lookups that went to the database.", func() float64 {
+		return float64(services.GetPriceCacheStats().Misses)
+	})
+}
+
+// loadMarketCalendar reads the exchange holiday list from path, or from
+// data/nse_holidays.txt when path is empty
+func loadMarketCalendar(path string) *services.MarketCalendar {
+	paths := []string{filepath.Join("data", "nse_holidays.txt"), filepath.Join("backend", "data", "nse_holidays.txt")}
+	if path != "" {
+		paths = []string{path}
+	}
+
+	for _, path := range paths {
+		calendar, err := services.LoadMarketCalendar(path)
+		if err == nil {
+			logrus.WithFields(logrus.Fields{
+				"path":     path,
+				"holidays": calendar.HolidayCount(),
+			}).Info("Loaded market calendar")
+			return calendar
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			logrus.WithError(err).Fatal("Failed to load market holiday file")
+		}
+	}
+
+	logrus.Warn("Market holiday file not found, only weekends will be treated as closed")
+	return services.NewMarketCalendar(nil)
+}
+
+// loadFeeSchedule reads the fee schedule from path, or returns the built-in
+// rates when path is empty
+func loadFeeSchedule(path string) services.FeeSchedule {
+	if path == "" {
+		return services.DefaultFeeSchedule()
+	}
+
+	schedule, err := services.LoadFeeSchedule(path)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to load fee schedule")
+	}
+	logrus.WithFields(logrus.Fields{
+		"path":           path,
+		"brokerage_rate": schedule.BrokerageRate,
+		"stt_rate":       schedule.STTRate,
+		"gst_rate":       schedule.GSTRate,
+	}).Info("Loaded fee schedule")
+	return schedule
+}
+
+// priceJobCheckInterval is how often the price job checks whether a run is due
+const priceJobCheckInterval = 1 * time.Minute
+
+// startPriceUpdateJob refreshes prices every refreshInterval while the market is
+// open and takes an end-of-day snapshot once the session has closed on each trading day
+func startPriceUpdateJob(ctx context.Context, refreshInterval, grace time.Duration) {
+	ticker := time.NewTicker(priceJobCheckInterval)
 	defer ticker.Stop()
 
+	// Postings made by the job are audited under the job's own actor
+	ctx = auth.WithActor(ctx, auth.System("price-job"))
+
+	calendar := services.CurrentMarketCalendar()
 	priceService := services.NewStockPriceService()
+	rewardService := services.NewRewardService()
 
-	// Run immediately on startup
-	logrus.Info("Running initial stock price update")
-	if err := priceService.UpdateAllPrices(); err != nil {
-		logrus.WithError(err).Error("Error updating stock prices")
+	var lastRefresh time.Time
+	var lastSnapshotDay time.Time
+
+	refreshPrices := func(ctx context.Context) {
+		if _, err := priceService.UpdateAllPrices(ctx); err != nil {
+			logrus.WithContext(ctx).WithError(err).Error("Error updating stock prices")
+		}
+		if err := priceService.MarkStalePrices(ctx); err != nil {
+			logrus.WithContext(ctx).WithError(err).Error("Error marking stale prices")
+		}
+		if _, err := rewardService.ProcessQueuedRewards(ctx); err != nil {
+			logrus.WithContext(ctx).WithError(err).Error("Error processing queued rewards")
+		}
+	}
+
+	runDue := func(now time.Time) {
+		if calendar.IsSessionOpen(now) {
+			if now.Sub(lastRefresh) >= refreshInterval {
+				// Each run is its own trace
+				runCtx, cancel := jobRunContext(ctx, grace)
+				runCtx, span := telemetry.StartSpan(telemetry.NewJobRequest(runCtx), "PriceJob.hourlyRefresh")
+				logrus.WithContext(runCtx).Info("Running intraday stock price update")
+				refreshPrices(runCtx)
+				span.End()
+				cancel()
+				lastRefresh = now
+			}
+			return
+		}
+
+		// After the close on a trading day: fetch closing prices once and snapshot them
+		tradingDay := calendar.TradingDayOnOrBefore(now)
+		if calendar.IsTradingDay(now) && !now.Before(calendar.SessionClose(now)) && !lastSnapshotDay.Equal(tradingDay) {
+			runCtx, cancel := jobRunContext(ctx, grace)
+			runCtx, span := telemetry.StartSpan(telemetry.NewJobRequest(runCtx), "PriceJob.endOfDay")
+			logrus.WithContext(runCtx).Info("Running end-of-day stock price update")
+			refreshPrices(runCtx)
+			if err := priceService.SnapshotClosingPrices(runCtx, tradingDay); err != nil {
+				logrus.WithContext(runCtx).WithError(err).Error("Error saving end-of-day price snapshot")
+			}
+			span.End()
+			cancel()
+			lastRefresh = now
+			lastSnapshotDay = tradingDay
+		}
 	}
-	priceService.MarkStalePrices()
 
-	// Run every hour
+	// Run immediately on startup
+	runDue(time.Now())
+
 	for {
 		select {
 		case <-ctx.Done():
 			logrus.Info("Price update job stopped")
 			return
+		case now := <-ticker.C:
+			runDue(now)
+		}
+	}
+}
+
+// runJob calls fn every interval until ctx is cancelled. Each run is its own
+// trace, under a span called name. Cancellation is only checked between runs;
+// a run in progress is given grace to finish, see jobRunContext.
+func runJob(ctx context.Context, name string, interval, grace time.Duration, fn func(ctx context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logrus.WithField("job", name).Info("Background job stopped")
+			return
 		case <-ticker.C:
-			logrus.Info("Running hourly stock price update")
-			if err := priceService.UpdateAllPrices(); err != nil {
-				logrus.WithError(err).Error("Error updating stock prices")
-			}
-			priceService.MarkStalePrices()
+			runCtx, cancel := jobRunContext(ctx, grace)
+			runCtx, span := telemetry.StartSpan(telemetry.NewJobRequest(runCtx), name)
+			fn(runCtx)
+			span.End()
+			cancel()
 		}
 	}
 }
+
+// jobRunContext returns the context for one job run. It outlives ctx by up to
+// grace, so a shutdown does not cut a run off between placing a broker order
+// or bank transfer and recording it.
+func jobRunContext(ctx context.Context, grace time.Duration) (context.Context, context.CancelFunc) {
+	runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() {
+		time.AfterFunc(grace, cancel)
+	})
+	return runCtx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// orderJobInterval is how often pending reward and redemption orders are checked with the broker
+const orderJobInterval = 30 * time.Second
+
+// startOrderFulfilmentJob places orders for pending rewards that have none yet
+// and posts or fails those whose orders have finished, and books redemptions
+// and dividend reinvestments whose orders have finished
+func startOrderFulfilmentJob(ctx context.Context, grace time.Duration) {
+	ctx = auth.WithActor(ctx, auth.System("order-job"))
+	rewardService := services.NewRewardService()
+	redemptionService := services.NewRedemptionService()
+	dividendService := services.NewDividendService()
+
+	runJob(ctx, "OrderJob.processPending", orderJobInterval, grace, func(ctx context.Context) {
+		if _, err := rewardService.ProcessPendingRewards(ctx); err != nil {
+			logrus.WithContext(ctx).WithError(err).Error("Error processing pending rewards")
+		}
+		if _, err := redemptionService.ProcessPendingRedemptions(ctx); err != nil {
+			logrus.WithContext(ctx).WithError(err).Error("Error processing pending redemptions")
+		}
+		if _, err := dividendService.ProcessPendingReinvestments(ctx); err != nil {
+			logrus.WithContext(ctx).WithError(err).Error("Error processing pending dividend reinvestments")
+		}
+	})
+}
+
+// settlementJobInterval is how often fulfilled rewards and reinvested
+// dividends are checked for settlement
+const settlementJobInterval = 15 * time.Minute
+
+// startSettlementJob moves fulfilled rewards and reinvested dividends to
+// settled once their settlement date arrives, making their shares withdrawable
+func startSettlementJob(ctx context.Context, grace time.Duration) {
+	ctx = auth.WithActor(ctx, auth.System("settlement-job"))
+	rewardService := services.NewRewardService()
+	dividendService := services.NewDividendService()
+
+	runJob(ctx, "SettlementJob.settle", settlementJobInterval, grace, func(ctx context.Context) {
+		if _, err := rewardService.SettleRewards(ctx); err != nil {
+			logrus.WithContext(ctx).WithError(err).Error("Error settling rewards")
+		}
+		if _, err := dividendService.SettleReinvestments(ctx); err != nil {
+			logrus.WithContext(ctx).WithError(err).Error("Error settling dividend reinvestments")
+		}
+	})
+}
+
+// vestingJobInterval is how often vesting tranches are checked
+const vestingJobInterval = time.Hour
+
+// startVestingJob vests reward tranches once their vest date arrives and
+// forfeits the unvested tranches of users who have left
+func startVestingJob(ctx context.Context, grace time.Duration) {
+	ctx = auth.WithActor(ctx, auth.System("vesting-job"))
+	vestingService := services.NewVestingService()
+
+	runJob(ctx, "VestingJob.vest", vestingJobInterval, grace, func(ctx context.Context) {
+		if _, err := vestingService.VestDueTranches(ctx); err != nil {
+			logrus.WithContext(ctx).WithError(err).Error("Error vesting reward tranches")
+		}
+	})
+}
+
+// payoutJobInterval is how often pending payouts are checked with the bank
+const payoutJobInterval = time.Minute
+
+// startPayoutJob sends pending wallet payouts to the bank and records their
+// settlement or failure
+func startPayoutJob(ctx context.Context, grace time.Duration) {
+	ctx = auth.WithActor(ctx, auth.System("payout-job"))
+	walletService := services.NewWalletService()
+
+	runJob(ctx, "PayoutJob.process", payoutJobInterval, grace, func(ctx context.Context) {
+		if _, err := walletService.ProcessPayouts(ctx); err != nil {
+			logrus.WithContext(ctx).WithError(err).Error("Error processing payouts")
+		}
+	})
+}
+
+// dividendJobInterval is how often dividends are checked for their pay date
+const dividendJobInterval = time.Hour
+
+// startDividendJob pays announced dividends once their pay date arrives
+func startDividendJob(ctx context.Context, grace time.Duration) {
+	ctx = auth.WithActor(ctx, auth.System("dividend-job"))
+	dividendService := services.NewDividendService()
+
+	runJob(ctx, "DividendJob.pay", dividendJobInterval, grace, func(ctx context.Context) {
+		if _, err := dividendService.PayDueDividends(ctx); err != nil {
+			logrus.WithContext(ctx).WithError(err).Error("Error paying dividends")
+		}
+	})
+}
@@ -0,0 +1,168 @@
+package metrics
+
+import (
+	"database/sql"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "stocky"
+
+// maxSymbolLabels and maxEventTypeLabels bound the stock symbols and reward
+// event types that get their own label value; values seen after that, or
+// longer than maxLabelLength, are counted as otherLabel
+const (
+	maxSymbolLabels    = 200
+	maxEventTypeLabels = 50
+	maxLabelLength     = 64
+	otherLabel         = "other"
+)
+
+var (
+	HTTPRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	RewardsCreatedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rewards_created_total",
+		Help:      "Rewards recorded, by event type, stock symbol and resulting status.",
+	}, []string{"event_type", "stock_symbol", "status"})
+
+	RewardFailuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reward_failures_total",
+		Help:      "Rewards that could not be recorded, by reason.",
+	}, []string{"reason"})
+
+	PriceRefreshDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "price_refresh_duration_seconds",
+		Help:      "Duration of UpdateAllPrices runs.",
+		Buckets:   []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	})
+
+	PriceRefreshRunsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "price_refresh_runs_total",
+		Help:      "Price refresh runs by final status.",
+	}, []string{"status"})
+
+	PriceRefreshSymbolFailuresTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "price_refresh_symbol_failures_total",
+		Help:      "Symbols the price provider failed to return during refresh runs.",
+	})
+
+	BrokerOrdersTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "broker_orders_total",
+		Help:      "Reward orders placed with the broker and their final outcomes, by broker and status.",
+	}, []string{"broker", "status"})
+
+	RateLimitedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "Requests refused by the rate limiter, by route and bucket scope.",
+	}, []string{"route", "scope"})
+
+	StalePrices = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "stale_prices",
+		Help:      "Number of stored stock prices currently flagged stale.",
+	})
+)
+
+// RegisterDBStats exposes database/sql connection pool statistics
+func RegisterDBStats(db *sql.DB) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, namespace))
+}
+
+// RegisterCounterFunc exposes a monotonically increasing value read at scrape time
+func RegisterCounterFunc(name, help string, fn func() float64) {
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      name,
+		Help:      help,
+	}, fn)
+}
+
+// boundedLabel hands out label values from client input: the first max
+// distinct values keep their own value and any later ones share otherLabel,
+// so the label's cardinality stays bounded whatever requests carry
+type boundedLabel struct {
+	mu   sync.Mutex
+	max  int
+	seen map[string]bool
+}
+
+func newBoundedLabel(max int) *boundedLabel {
+	return &boundedLabel{max: max, seen: make(map[string]bool)}
+}
+
+func (l *boundedLabel) value(v string) string {
+	if len(v) > maxLabelLength {
+		return otherLabel
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.seen[v] {
+		return v
+	}
+	if len(l.seen) >= l.max {
+		return otherLabel
+	}
+	l.seen[v] = true
+	return v
+}
+
+var (
+	symbolLabels    = newBoundedLabel(maxSymbolLabels)
+	eventTypeLabels = newBoundedLabel(maxEventTypeLabels)
+)
+
+// SymbolLabel returns the label value for a stock symbol the caller has
+// already validated against the price provider
+func SymbolLabel(symbol string) string {
+	return symbolLabels.value(symbol)
+}
+
+// EventTypeLabel returns the label value for a reward's event type, which is
+// whatever the client sent
+func EventTypeLabel(eventType string) string {
+	return eventTypeLabels.value(eventType)
+}
+
+// Middleware records request counts and latency per route template.
+// Unmatched paths share a single label to keep cardinality bounded.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		HTTPRequestsTotal.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		HTTPRequestDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,111 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Audit actions
+const (
+	AuditRewardCreate = "reward.create"
+	AuditRewardPost   = "reward.post"
+	AuditHoldingAdd   = "holding.add"
+	// AuditRewardReviewed is a reward leaving review, approved or rejected
+	AuditRewardReviewed = "reward.reviewed"
+	// AuditRewardRelease is a queued reward sent to the broker once its price is fresh
+	AuditRewardRelease = "reward.release"
+	AuditRewardFail    = "reward.fail"
+	// AuditRewardSettle is a fulfilled reward whose trade settled
+	AuditRewardSettle  = "reward.settle"
+	AuditHoldingSettle = "holding.settle"
+	AuditRewardApprove = "reward.approve"
+	AuditRewardReject  = "reward.reject"
+	AuditReviewCreate  = "review.create"
+	AuditReviewApprove = "review.approve"
+	AuditReviewReject  = "review.reject"
+	// AuditTrancheVest is a vesting tranche reaching its vest date
+	AuditTrancheVest    = "tranche.vest"
+	AuditTrancheForfeit = "tranche.forfeit"
+	AuditHoldingForfeit = "holding.forfeit"
+
+	// AuditDematRegister is a user adding a demat account; verify and reject record the check against the depository
+	AuditDematRegister = "demat.register"
+	AuditDematVerify   = "demat.verify"
+	AuditDematReject   = "demat.reject"
+	// AuditWithdrawalRequest is shares leaving a holding for the user's demat account
+	AuditWithdrawalRequest  = "withdrawal.request"
+	AuditWithdrawalSubmit   = "withdrawal.submit"
+	AuditWithdrawalComplete = "withdrawal.complete"
+	AuditWithdrawalFail     = "withdrawal.fail"
+	AuditHoldingWithdraw    = "holding.withdraw"
+	AuditHoldingRestore     = "holding.restore"
+
+	// AuditRedemptionCreate is shares sold from a holding for cash in the user's wallet
+	AuditRedemptionCreate   = "redemption.create"
+	AuditRedemptionComplete = "redemption.complete"
+	AuditRedemptionFail     = "redemption.fail"
+	AuditHoldingRedeem      = "holding.redeem"
+
+	// AuditBankAccountRegister is a user adding a bank account; verify and reject record the check with the bank
+	AuditBankAccountRegister = "bank_account.register"
+	AuditBankAccountVerify   = "bank_account.verify"
+	AuditBankAccountReject   = "bank_account.reject"
+	// AuditPayoutRequest is cash leaving a user's wallet for their bank account
+	AuditPayoutRequest = "payout.request"
+	AuditPayoutSettle  = "payout.settle"
+	AuditPayoutFail    = "payout.fail"
+
+	// AuditDividendCreate is a dividend declared on a stock; pay records one user's share of it
+	// and reinvest the shares a reinvested share bought once its order is final
+	AuditDividendCreate     = "dividend.create"
+	AuditDividendPay        = "dividend.pay"
+	AuditDividendReinvest   = "dividend.reinvest"
+	AuditDividendSettle     = "dividend.settle"
+	AuditDividendComplete   = "dividend.complete"
+	AuditDividendPreference = "dividend.preference"
+	AuditHoldingReinvest    = "holding.reinvest"
+)
+
+// Audited entity types
+const (
+	AuditEntityRewardEvent  = "reward_event"
+	AuditEntityHolding      = "user_holding"
+	AuditEntityRewardReview = "reward_review"
+	AuditEntityTranche      = "vesting_tranche"
+	AuditEntityDematAccount = "demat_account"
+	AuditEntityWithdrawal   = "withdrawal"
+	AuditEntityRedemption   = "redemption"
+	AuditEntityBankAccount  = "bank_account"
+	AuditEntityPayout       = "payout"
+	AuditEntityDividend     = "dividend"
+	AuditEntityUser         = "user"
+)
+
+type AuditLogEntry struct {
+	ID          uuid.UUID       `json:"id" db:"id"`
+	ActorID     string          `json:"actor_id" db:"actor_id"`
+	ActorRole   string          `json:"actor_role,omitempty" db:"actor_role"`
+	Action      string          `json:"action" db:"action"`
+	EntityType  string          `json:"entity_type" db:"entity_type"`
+	EntityID    string          `json:"entity_id" db:"entity_id"`
+	RequestID   string          `json:"request_id,omitempty" db:"request_id"`
+	SourceIP    string          `json:"source_ip,omitempty" db:"source_ip"`
+	BeforeState json.RawMessage `json:"before,omitempty" db:"before_state"`
+	AfterState  json.RawMessage `json:"after,omitempty" db:"after_state"`
+	CreatedAt   time.Time       `json:"created_at" db:"created_at"`
+}
+
+// AuditLogFilter narrows an audit log query. Zero fields match everything.
+type AuditLogFilter struct {
+	ActorID    string
+	Action     string
+	EntityType string
+	EntityID   string
+	RequestID  string
+	From       *time.Time
+	To         *time.Time
+	Limit      int
+	Offset     int
+}
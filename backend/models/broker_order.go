@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	OrderSideBuy  = "buy"
+	OrderSideSell = "sell"
+)
+
+const (
+	// OrderStatusNew orders are recorded but not yet acknowledged by the broker
+	OrderStatusNew       = "new"
+	OrderStatusOpen      = "open"
+	OrderStatusFilled    = "filled"
+	OrderStatusRejected  = "rejected"
+	OrderStatusCancelled = "cancelled"
+)
+
+// BrokerOrder is an order placed with the broker to buy or sell the shares behind a reward
+type BrokerOrder struct {
+	ID             uuid.UUID  `json:"id" db:"id"`
+	RewardID       *uuid.UUID `json:"reward_id,omitempty" db:"reward_id"`
+	Broker         string     `json:"broker" db:"broker"`
+	BrokerOrderID  *string    `json:"broker_order_id,omitempty" db:"broker_order_id"`
+	StockSymbol    string     `json:"stock_symbol" db:"stock_symbol"`
+	Side           string     `json:"side" db:"side"`
+	Quantity       float64    `json:"quantity" db:"quantity"`
+	Status         string     `json:"status" db:"status"`
+	FilledQuantity float64    `json:"filled_quantity" db:"filled_quantity"`
+	FillPrice      *float64   `json:"fill_price,omitempty" db:"fill_price"`
+	Brokerage      float64    `json:"brokerage" db:"brokerage"`
+	STT            float64    `json:"stt" db:"stt"`
+	GST            float64    `json:"gst" db:"gst"`
+	ErrorMessage   *string    `json:"error_message,omitempty" db:"error_message"`
+	PlacedAt       *time.Time `json:"placed_at,omitempty" db:"placed_at"`
+	FilledAt       *time.Time `json:"filled_at,omitempty" db:"filled_at"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// BrokerOrderAllocation is one reward's part of a buy order. An order batches
+// every reward for its symbol collected over the aggregation window, and its
+// fill and fees are split across them in proportion to Quantity.
+type BrokerOrderAllocation struct {
+	ID             uuid.UUID `json:"id" db:"id"`
+	OrderID        uuid.UUID `json:"order_id" db:"order_id"`
+	RewardID       uuid.UUID `json:"reward_id" db:"reward_id"`
+	Quantity       float64   `json:"quantity" db:"quantity"`
+	FilledQuantity float64   `json:"filled_quantity" db:"filled_quantity"`
+	FillPrice      *float64  `json:"fill_price,omitempty" db:"fill_price"`
+	Brokerage      float64   `json:"brokerage" db:"brokerage"`
+	STT            float64   `json:"stt" db:"stt"`
+	GST            float64   `json:"gst" db:"gst"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DividendStatusAnnounced dividends wait for their pay date
+	DividendStatusAnnounced = "announced"
+	// DividendStatusPaid dividends have been paid to every entitled user
+	DividendStatusPaid = "paid"
+)
+
+// Dividend is a cash dividend declared on a stock. Users holding shares at
+// the start of the record date are entitled to AmountPerShare on each.
+type Dividend struct {
+	ID             uuid.UUID  `json:"id" db:"id"`
+	StockSymbol    string     `json:"stock_symbol" db:"stock_symbol"`
+	AmountPerShare float64    `json:"amount_per_share" db:"amount_per_share"`
+	RecordDate     time.Time  `json:"record_date" db:"record_date"`
+	PayDate        time.Time  `json:"pay_date" db:"pay_date"`
+	Status         string     `json:"status" db:"status"`
+	PaidAt         *time.Time `json:"paid_at,omitempty" db:"paid_at"`
+	CreatedBy      *string    `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// DividendRequest declares a dividend
+type DividendRequest struct {
+	StockSymbol    string    `json:"stock_symbol" binding:"required,max=50"`
+	AmountPerShare float64   `json:"amount_per_share" binding:"required,gt=0"`
+	RecordDate     time.Time `json:"record_date" binding:"required"`
+	PayDate        time.Time `json:"pay_date" binding:"required"`
+}
+
+// Ways a user's dividend is paid
+const (
+	DividendModeWallet   = "wallet"
+	DividendModeReinvest = "reinvest"
+)
+
+// DividendPayment is one user's share of a dividend. TDS is withheld from the
+// gross amount; the rest is credited to the wallet or reinvested in the stock.
+// A reinvestment buys its shares with the broker order OrderID; the price,
+// quantity and dates are filled in when the order fills, and the shares
+// settle like bought shares, on SettlementDate.
+type DividendPayment struct {
+	ID                 uuid.UUID  `json:"id" db:"id"`
+	DividendID         uuid.UUID  `json:"dividend_id" db:"dividend_id"`
+	UserID             uuid.UUID  `json:"user_id" db:"user_id"`
+	StockSymbol        string     `json:"stock_symbol" db:"stock_symbol"`
+	EntitledQuantity   float64    `json:"entitled_quantity" db:"entitled_quantity"`
+	GrossAmount        float64    `json:"gross_amount" db:"gross_amount"`
+	TDSAmount          float64    `json:"tds_amount" db:"tds_amount"`
+	NetAmount          float64    `json:"net_amount" db:"net_amount"`
+	Mode               string     `json:"mode" db:"mode"`
+	OrderID            *uuid.UUID `json:"order_id,omitempty" db:"order_id"`
+	ReinvestPrice      *float64   `json:"reinvest_price,omitempty" db:"reinvest_price"`
+	ReinvestedQuantity *float64   `json:"reinvested_quantity,omitempty" db:"reinvested_quantity"`
+	TradeDate          *time.Time `json:"trade_date,omitempty" db:"trade_date"`
+	SettlementDate     *time.Time `json:"settlement_date,omitempty" db:"settlement_date"`
+	SettledAt          *time.Time `json:"settled_at,omitempty" db:"settled_at"`
+	CreatedAt          time.Time  `json:"created_at" db:"created_at"`
+}
+
+// DividendPreference sets whether a user's dividends are reinvested instead
+// of credited to their wallet
+type DividendPreference struct {
+	Reinvest *bool `json:"reinvest" binding:"required"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+const (
+	HealthPass = "pass"
+	HealthWarn = "warn"
+	HealthFail = "fail"
+)
+
+// HealthCheck is the result of probing one dependency
+type HealthCheck struct {
+	Name      string                 `json:"name"`
+	Status    string                 `json:"status"`
+	Critical  bool                   `json:"critical"`
+	LatencyMs float64                `json:"latency_ms"`
+	Message   string                 `json:"message,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// ReadinessReport collects every readiness check. Status is "fail" when a
+// critical check failed, "warn" when any other check did not pass.
+type ReadinessReport struct {
+	Status    string        `json:"status"`
+	CheckedAt time.Time     `json:"checked_at"`
+	Checks    []HealthCheck `json:"checks"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	PriceRefreshRunning   = "running"
+	PriceRefreshSucceeded = "succeeded"
+	PriceRefreshPartial   = "partial"
+	PriceRefreshFailed    = "failed"
+)
+
+type PriceRefreshRun struct {
+	ID           uuid.UUID      `json:"id" db:"id"`
+	Provider     string         `json:"provider" db:"provider"`
+	StartedAt    time.Time      `json:"started_at" db:"started_at"`
+	FinishedAt   sql.NullTime   `json:"finished_at" db:"finished_at"`
+	SymbolsTotal int            `json:"symbols_total" db:"symbols_total"`
+	Fetched      int            `json:"fetched" db:"fetched"`
+	Failed       int            `json:"failed" db:"failed"`
+	Skipped      int            `json:"skipped" db:"skipped"`
+	Status       string         `json:"status" db:"status"`
+	ErrorMessage sql.NullString `json:"error_message,omitempty" db:"error_message"`
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// RedemptionStatusPending redemptions have taken their shares out of the
+	// holding and wait for the sell order to fill
+	RedemptionStatusPending   = "pending"
+	RedemptionStatusCompleted = "completed"
+	// RedemptionStatusFailed redemptions sold nothing and returned their shares
+	RedemptionStatusFailed = "failed"
+)
+
+// Redemption is a sale of shares from a user's holding for cash paid into
+// their wallet, through a sell order with the broker. Until the order fills,
+// Price is the stored price the sale was checked against and the amounts
+// are zero; once it fills they are the broker's. RealizedPnL is the capital
+// gain of the sale, the total of its tax lot disposals' gains: the gross
+// value less brokerage, GST and CostValue. STT is not deducted from it.
+type Redemption struct {
+	ID            uuid.UUID  `json:"id" db:"id"`
+	UserID        uuid.UUID  `json:"user_id" db:"user_id"`
+	StockSymbol   string     `json:"stock_symbol" db:"stock_symbol"`
+	Quantity      float64    `json:"quantity" db:"quantity"`
+	Status        string     `json:"status" db:"status"`
+	OrderID       *uuid.UUID `json:"order_id,omitempty" db:"order_id"`
+	Price         float64    `json:"price" db:"price"`
+	PriceAsOf     time.Time  `json:"price_as_of" db:"price_as_of"`
+	GrossValue    float64    `json:"gross_value" db:"gross_value"`
+	Brokerage     float64    `json:"brokerage" db:"brokerage"`
+	STT           float64    `json:"stt" db:"stt"`
+	GST           float64    `json:"gst" db:"gst"`
+	NetProceeds   float64    `json:"net_proceeds" db:"net_proceeds"`
+	CostValue     float64    `json:"cost_value" db:"cost_value"`
+	RealizedPnL   float64    `json:"realized_pnl" db:"realized_pnl"`
+	FailureReason *string    `json:"failure_reason,omitempty" db:"failure_reason"`
+	CreatedBy     *string    `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// RedemptionRequest asks to sell shares of one holding for cash
+type RedemptionRequest struct {
+	UserID      string  `json:"user_id" binding:"required"`
+	StockSymbol string  `json:"stock_symbol" binding:"required,max=50"`
+	Quantity    float64 `json:"quantity" binding:"required,gt=0"`
+}
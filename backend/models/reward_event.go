@@ -7,25 +7,55 @@ import (
 	"github.com/google/uuid"
 )
 
+const (
+	// RewardStatusActive rewards were posted to the ledger and holdings before
+	// shares were bought through the broker
+	RewardStatusActive = "active"
+	// RewardStatusPending rewards have a buy order placed or about to be placed
+	RewardStatusPending = "pending"
+	// RewardStatusFulfilled rewards were bought and their fill posted to the ledger and
+	// holdings, but the trade has not settled and the shares cannot be withdrawn yet
+	RewardStatusFulfilled = "fulfilled"
+	// RewardStatusSettled rewards' trades settled; their shares are the user's to withdraw
+	RewardStatusSettled = "settled"
+	// RewardStatusFailed rewards could not be bought; nothing was posted
+	RewardStatusFailed = "failed"
+	// RewardStatusQueued rewards wait for a fresh stock price before being posted
+	RewardStatusQueued = "queued"
+	// RewardStatusUnderReview rewards were flagged by the anomaly rules and wait for a reviewer
+	RewardStatusUnderReview = "under_review"
+	// RewardStatusPendingApproval rewards need a second person to approve them before they are posted
+	RewardStatusPendingApproval = "pending_approval"
+	// RewardStatusRejected rewards were turned down by a reviewer or approver and are never posted
+	RewardStatusRejected = "rejected"
+)
+
 type RewardEvent struct {
-	ID              uuid.UUID    `json:"id" db:"id"`
-	UserID          uuid.UUID    `json:"user_id" db:"user_id"`
-	StockSymbol     string       `json:"stock_symbol" db:"stock_symbol"`
-	Quantity        float64      `json:"quantity" db:"quantity"`
-	RewardTimestamp time.Time    `json:"reward_timestamp" db:"reward_timestamp"`
-	EventType       string       `json:"event_type" db:"event_type"`
-	ReferenceID     string       `json:"reference_id" db:"reference_id"`
-	Status          string       `json:"status" db:"status"`
-	CreatedAt       time.Time    `json:"created_at" db:"created_at"`
-	UpdatedAt       time.Time    `json:"updated_at" db:"updated_at"`
-	DeletedAt       sql.NullTime `json:"deleted_at,omitempty" db:"deleted_at"`
+	ID              uuid.UUID        `json:"id" db:"id"`
+	UserID          uuid.UUID        `json:"user_id" db:"user_id"`
+	StockSymbol     string           `json:"stock_symbol" db:"stock_symbol"`
+	Quantity        float64          `json:"quantity" db:"quantity"`
+	RewardTimestamp time.Time        `json:"reward_timestamp" db:"reward_timestamp"`
+	EventType       string           `json:"event_type" db:"event_type"`
+	ReferenceID     string           `json:"reference_id" db:"reference_id"`
+	Status          string           `json:"status" db:"status"`
+	InrValue        *float64         `json:"inr_value,omitempty" db:"inr_value"`
+	CreatedBy       *string          `json:"created_by,omitempty" db:"created_by"`
+	TradeDate       *time.Time       `json:"trade_date,omitempty" db:"trade_date"`
+	SettlementDate  *time.Time       `json:"settlement_date,omitempty" db:"settlement_date"`
+	SettledAt       *time.Time       `json:"settled_at,omitempty" db:"settled_at"`
+	Vesting         *VestingSchedule `json:"vesting,omitempty"`
+	CreatedAt       time.Time        `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time        `json:"updated_at" db:"updated_at"`
+	DeletedAt       sql.NullTime     `json:"deleted_at,omitempty" db:"deleted_at"`
 }
 
 type RewardRequest struct {
-	UserID          string    `json:"user_id" binding:"required"`
-	StockSymbol     string    `json:"stock_symbol" binding:"required"`
-	Quantity        float64   `json:"quantity" binding:"required,gt=0"`
-	RewardTimestamp time.Time `json:"reward_timestamp" binding:"required"`
-	EventType       string    `json:"event_type" binding:"required"`
-	ReferenceID     string    `json:"reference_id" binding:"required"`
+	UserID          string           `json:"user_id" binding:"required"`
+	StockSymbol     string           `json:"stock_symbol" binding:"required"`
+	Quantity        float64          `json:"quantity" binding:"required,gt=0"`
+	RewardTimestamp time.Time        `json:"reward_timestamp" binding:"required"`
+	EventType       string           `json:"event_type" binding:"required"`
+	ReferenceID     string           `json:"reference_id" binding:"required"`
+	Vesting         *VestingSchedule `json:"vesting"`
 }
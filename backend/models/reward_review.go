@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ReviewStatusPending  = "pending"
+	ReviewStatusApproved = "approved"
+	ReviewStatusRejected = "rejected"
+)
+
+// RewardReview is a reward held back by the anomaly rules until someone decides on it
+type RewardReview struct {
+	ID           uuid.UUID    `json:"id" db:"id"`
+	RewardID     uuid.UUID    `json:"reward_id" db:"reward_id"`
+	Reason       string       `json:"reason" db:"reason"`
+	Details      *string      `json:"details,omitempty" db:"details"`
+	Status       string       `json:"status" db:"status"`
+	DecidedBy    *string      `json:"decided_by,omitempty" db:"decided_by"`
+	DecisionNote *string      `json:"decision_note,omitempty" db:"decision_note"`
+	DecidedAt    *time.Time   `json:"decided_at,omitempty" db:"decided_at"`
+	CreatedAt    time.Time    `json:"created_at" db:"created_at"`
+	Reward       *RewardEvent `json:"reward,omitempty"`
+}
+
+// ReviewDecision is the body of an approve or reject request
+type ReviewDecision struct {
+	Note string `json:"note" binding:"max=1000"`
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Where a tax lot's shares came from
+const (
+	// LotSourceReward lots are the shares of a reward that did not vest
+	LotSourceReward = "reward"
+	// LotSourceTranche lots are the shares of a vesting tranche
+	LotSourceTranche = "vesting_tranche"
+	// LotSourceDividend lots are shares bought by reinvesting a dividend
+	LotSourceDividend = "dividend"
+	// LotSourceOpening lots were rebuilt from the ledger for shares acquired
+	// before lots were tracked
+	LotSourceOpening = "opening"
+)
+
+// TaxLot is shares a user acquired together, on one date and at one cost.
+// Shares leave lots oldest first as they are redeemed or withdrawn.
+type TaxLot struct {
+	ID                uuid.UUID `json:"id" db:"id"`
+	UserID            uuid.UUID `json:"user_id" db:"user_id"`
+	StockSymbol       string    `json:"stock_symbol" db:"stock_symbol"`
+	Source            string    `json:"source" db:"source"`
+	SourceID          uuid.UUID `json:"source_id" db:"source_id"`
+	AcquiredOn        time.Time `json:"acquired_on" db:"acquired_on"`
+	Quantity          float64   `json:"quantity" db:"quantity"`
+	RemainingQuantity float64   `json:"remaining_quantity" db:"remaining_quantity"`
+	CostPerShare      float64   `json:"cost_per_share" db:"cost_per_share"`
+	CreatedAt         time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Ways shares leave a tax lot
+const (
+	DisposalRedemption = "redemption"
+	DisposalWithdrawal = "withdrawal"
+)
+
+// Capital gain terms
+const (
+	GainShortTerm = "short_term"
+	GainLongTerm  = "long_term"
+)
+
+// LotDisposal is shares taken out of one tax lot by a redemption or
+// withdrawal. Redemptions are sales, so they carry the proceeds, gain and
+// term; withdrawals only move the shares to the user's demat account.
+type LotDisposal struct {
+	ID            uuid.UUID  `json:"id" db:"id"`
+	LotID         uuid.UUID  `json:"lot_id" db:"lot_id"`
+	UserID        uuid.UUID  `json:"user_id" db:"user_id"`
+	StockSymbol   string     `json:"stock_symbol" db:"stock_symbol"`
+	Kind          string     `json:"kind" db:"kind"`
+	ReferenceID   uuid.UUID  `json:"reference_id" db:"reference_id"`
+	Quantity      float64    `json:"quantity" db:"quantity"`
+	AcquiredOn    time.Time  `json:"acquired_on" db:"acquired_on"`
+	DisposedOn    time.Time  `json:"disposed_on" db:"disposed_on"`
+	CostBasis     float64    `json:"cost_basis" db:"cost_basis"`
+	Proceeds      *float64   `json:"proceeds,omitempty" db:"proceeds"`
+	Gain          *float64   `json:"gain,omitempty" db:"gain"`
+	Term          *string    `json:"term,omitempty" db:"term"`
+	Grandfathered bool       `json:"grandfathered" db:"grandfathered"`
+	ReversedAt    *time.Time `json:"reversed_at,omitempty" db:"reversed_at"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+}
+
+// CapitalGains is a user's realized gains from redemptions, split by term
+type CapitalGains struct {
+	UserID        uuid.UUID     `json:"user_id"`
+	ShortTermGain float64       `json:"short_term_gain"`
+	LongTermGain  float64       `json:"long_term_gain"`
+	Disposals     []LotDisposal `json:"disposals"`
+}
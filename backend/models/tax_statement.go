@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TaxStatement is what a user needs to file their taxes for one financial
+// year (April to March): the perquisite value of the shares rewarded to
+// them, their dividends, the capital gains realized by redemptions, and the
+// TDS withheld.
+type TaxStatement struct {
+	UserID          uuid.UUID             `json:"user_id"`
+	FinancialYear   string                `json:"financial_year"`
+	From            time.Time             `json:"from"`
+	To              time.Time             `json:"to"`
+	Rewards         []PerquisiteReward    `json:"rewards"`
+	PerquisiteValue float64               `json:"perquisite_value"`
+	Dividends       []StatementDividend   `json:"dividends"`
+	DividendIncome  float64               `json:"dividend_income"`
+	CapitalGains    StatementCapitalGains `json:"capital_gains"`
+	TDSDeducted     float64               `json:"tds_deducted"`
+	GeneratedAt     time.Time             `json:"generated_at"`
+}
+
+// PerquisiteReward is shares that became the user's in the year, valued at
+// the stock's fair market value on that day: the grant date for a reward
+// without vesting, or the vest date for a tranche of one that vests, when
+// TrancheID and VestDate are set. FMVDate is the date of the closing price
+// used; without a stored price the reward's issuance price is used and
+// FMVDate is nil.
+type PerquisiteReward struct {
+	RewardID        uuid.UUID  `json:"reward_id"`
+	TrancheID       *uuid.UUID `json:"tranche_id,omitempty"`
+	StockSymbol     string     `json:"stock_symbol"`
+	EventType       string     `json:"event_type"`
+	GrantDate       time.Time  `json:"grant_date"`
+	VestDate        *time.Time `json:"vest_date,omitempty"`
+	Quantity        float64    `json:"quantity"`
+	FairMarketValue float64    `json:"fair_market_value"`
+	FMVDate         *time.Time `json:"fmv_date,omitempty"`
+	PerquisiteValue float64    `json:"perquisite_value"`
+}
+
+// StatementDividend is a dividend paid to the user in the year
+type StatementDividend struct {
+	PaymentID        uuid.UUID `json:"payment_id"`
+	DividendID       uuid.UUID `json:"dividend_id"`
+	StockSymbol      string    `json:"stock_symbol"`
+	PayDate          time.Time `json:"pay_date"`
+	EntitledQuantity float64   `json:"entitled_quantity"`
+	AmountPerShare   float64   `json:"amount_per_share"`
+	GrossAmount      float64   `json:"gross_amount"`
+	TDSAmount        float64   `json:"tds_amount"`
+	NetAmount        float64   `json:"net_amount"`
+	Mode             string    `json:"mode"`
+}
+
+// StatementCapitalGains is the year's realized gains by category, with the
+// lots sold
+type StatementCapitalGains struct {
+	ShortTermGain float64       `json:"short_term_gain"`
+	LongTermGain  float64       `json:"long_term_gain"`
+	Disposals     []LotDisposal `json:"disposals"`
+}
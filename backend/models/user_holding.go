@@ -6,20 +6,31 @@ import (
 	"github.com/google/uuid"
 )
 
+// UserHolding is a user's position in one stock. Quantity includes shares whose
+// trades have not settled yet and shares that have not vested; only settled,
+// vested shares past any lock-in can be withdrawn.
 type UserHolding struct {
-	ID          uuid.UUID `json:"id" db:"id"`
-	UserID      uuid.UUID `json:"user_id" db:"user_id"`
-	StockSymbol string    `json:"stock_symbol" db:"stock_symbol"`
-	Quantity    float64   `json:"quantity" db:"quantity"`
-	LastUpdated time.Time `json:"last_updated" db:"last_updated"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+	ID               uuid.UUID `json:"id" db:"id"`
+	UserID           uuid.UUID `json:"user_id" db:"user_id"`
+	StockSymbol      string    `json:"stock_symbol" db:"stock_symbol"`
+	Quantity         float64   `json:"quantity" db:"quantity"`
+	SettledQuantity  float64   `json:"settled_quantity" db:"settled_quantity"`
+	UnvestedQuantity float64   `json:"unvested_quantity" db:"unvested_quantity"`
+	LastUpdated      time.Time `json:"last_updated" db:"last_updated"`
+	CreatedAt        time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at" db:"updated_at"`
 }
 
 type PortfolioItem struct {
-	StockSymbol  string    `json:"stock_symbol" db:"stock_symbol"`
-	Quantity     float64   `json:"quantity" db:"quantity"`
-	Price        float64   `json:"price" db:"price"`
-	CurrentValue float64   `json:"current_value" db:"current_value"`
-	LastUpdated  time.Time `json:"last_updated" db:"last_updated"`
+	StockSymbol       string     `json:"stock_symbol" db:"stock_symbol"`
+	Quantity          float64    `json:"quantity" db:"quantity"`
+	SettledQuantity   float64    `json:"settled_quantity" db:"settled_quantity"`
+	UnsettledQuantity float64    `json:"unsettled_quantity" db:"unsettled_quantity"`
+	VestedQuantity    float64    `json:"vested_quantity" db:"vested_quantity"`
+	LockedQuantity    float64    `json:"locked_quantity" db:"locked_quantity"`
+	Price             float64    `json:"price" db:"price"`
+	CurrentValue      float64    `json:"current_value" db:"current_value"`
+	IsStale           bool       `json:"is_stale" db:"is_stale"`
+	PriceAsOf         *time.Time `json:"price_as_of" db:"price_as_of"`
+	LastUpdated       time.Time  `json:"last_updated" db:"last_updated"`
 }
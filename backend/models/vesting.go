@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// TrancheStatusScheduled tranches have not reached their vest date
+	TrancheStatusScheduled = "scheduled"
+	// TrancheStatusVested tranches belong to the user, subject to any lock-in
+	TrancheStatusVested = "vested"
+	// TrancheStatusForfeited tranches were taken back because the user left before they vested
+	TrancheStatusForfeited = "forfeited"
+)
+
+// VestingSchedule describes how a reward's shares vest, counted from the
+// reward date: equal tranches every IntervalMonths over DurationMonths, none
+// before CliffMonths. Vested shares stay locked until LockInUntil. A schedule
+// with no duration is a plain lock-in: everything vests at once.
+type VestingSchedule struct {
+	CliffMonths    int        `json:"cliff_months" binding:"min=0,max=120"`
+	DurationMonths int        `json:"duration_months" binding:"min=0,max=120"`
+	IntervalMonths int        `json:"interval_months" binding:"min=0,max=120"`
+	LockInUntil    *time.Time `json:"lock_in_until,omitempty"`
+}
+
+// VestingTranche is one part of a reward's filled quantity that vests on VestDate
+type VestingTranche struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	RewardID    uuid.UUID  `json:"reward_id" db:"reward_id"`
+	UserID      uuid.UUID  `json:"user_id" db:"user_id"`
+	StockSymbol string     `json:"stock_symbol" db:"stock_symbol"`
+	VestDate    time.Time  `json:"vest_date" db:"vest_date"`
+	Quantity    float64    `json:"quantity" db:"quantity"`
+	CostPrice   float64    `json:"cost_price" db:"cost_price"`
+	Status      string     `json:"status" db:"status"`
+	VestedAt    *time.Time `json:"vested_at,omitempty" db:"vested_at"`
+	ForfeitedAt *time.Time `json:"forfeited_at,omitempty" db:"forfeited_at"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+}
+
+// ForfeitRequest records why a user's unvested shares are being forfeited
+type ForfeitRequest struct {
+	Reason string `json:"reason" binding:"required,max=1000"`
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Wallet is a user's INR balance, fed by redemptions and dividends and paid out to their bank
+type Wallet struct {
+	UserID  uuid.UUID `json:"user_id"`
+	Balance float64   `json:"balance"`
+	// PendingPayouts is the amount already taken from the balance for payouts the bank has not settled
+	PendingPayouts float64             `json:"pending_payouts"`
+	Transactions   []WalletTransaction `json:"transactions"`
+}
+
+// WalletTransaction is one posting to a user's wallet. Amount is positive for
+// money in and negative for money out.
+type WalletTransaction struct {
+	TransactionID uuid.UUID `json:"transaction_id"`
+	Amount        float64   `json:"amount"`
+	Description   string    `json:"description,omitempty"`
+	ReferenceID   string    `json:"reference_id,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+const (
+	// PayoutStatusPending payouts have left the wallet and wait for the bank to settle them
+	PayoutStatusPending = "pending"
+	PayoutStatusSettled = "settled"
+	// PayoutStatusFailed payouts were refused by the bank; their amount is back in the wallet
+	PayoutStatusFailed = "failed"
+)
+
+// Payout is a transfer of wallet cash to a user's bank account. The account
+// number is only ever shown masked.
+type Payout struct {
+	ID            uuid.UUID  `json:"id" db:"id"`
+	UserID        uuid.UUID  `json:"user_id" db:"user_id"`
+	Amount        float64    `json:"amount" db:"amount"`
+	BankAccountID *uuid.UUID `json:"bank_account_id,omitempty" db:"bank_account_id"`
+	AccountNumber string     `json:"-" db:"account_number"`
+	// MaskedAccountNumber is AccountNumber with all but its last 4 digits hidden
+	MaskedAccountNumber string     `json:"masked_account_number" db:"-"`
+	IFSC                string     `json:"ifsc" db:"ifsc"`
+	Status              string     `json:"status" db:"status"`
+	Bank                string     `json:"bank" db:"bank"`
+	BankReference       *string    `json:"bank_reference,omitempty" db:"bank_reference"`
+	FailureReason       *string    `json:"failure_reason,omitempty" db:"failure_reason"`
+	SentAt              *time.Time `json:"sent_at,omitempty" db:"sent_at"`
+	SettledAt           *time.Time `json:"settled_at,omitempty" db:"settled_at"`
+	FailedAt            *time.Time `json:"failed_at,omitempty" db:"failed_at"`
+	CreatedBy           *string    `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt           time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// PayoutRequest asks for an amount of a user's wallet to be paid to one of
+// their verified bank accounts
+type PayoutRequest struct {
+	UserID        string  `json:"user_id" binding:"required"`
+	Amount        float64 `json:"amount" binding:"required,gt=0"`
+	BankAccountID string  `json:"bank_account_id" binding:"required"`
+}
+
+const (
+	// BankAccountStatusPending accounts are waiting for someone to check them with the bank
+	BankAccountStatusPending  = "pending"
+	BankAccountStatusVerified = "verified"
+	BankAccountStatusRejected = "rejected"
+)
+
+// BankAccount is a user's own bank account that wallet cash can be paid out
+// to. The account number is only ever shown masked.
+type BankAccount struct {
+	ID            uuid.UUID `json:"id" db:"id"`
+	UserID        uuid.UUID `json:"user_id" db:"user_id"`
+	AccountNumber string    `json:"-" db:"account_number"`
+	// MaskedAccountNumber is AccountNumber with all but its last 4 digits hidden
+	MaskedAccountNumber string     `json:"masked_account_number" db:"-"`
+	IFSC                string     `json:"ifsc" db:"ifsc"`
+	VerificationStatus  string     `json:"verification_status" db:"verification_status"`
+	VerifiedBy          *string    `json:"verified_by,omitempty" db:"verified_by"`
+	VerificationNote    *string    `json:"verification_note,omitempty" db:"verification_note"`
+	VerifiedAt          *time.Time `json:"verified_at,omitempty" db:"verified_at"`
+	CreatedAt           time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// BankAccountRequest registers a bank account for a user
+type BankAccountRequest struct {
+	UserID        string `json:"user_id" binding:"required"`
+	AccountNumber string `json:"account_number" binding:"required,max=18"`
+	IFSC          string `json:"ifsc" binding:"required,len=11"`
+}
+
+// MaskAccountNumber hides all but the last 4 digits of a bank account number
+func MaskAccountNumber(accountNumber string) string {
+	if len(accountNumber) <= 4 {
+		return strings.Repeat("X", len(accountNumber))
+	}
+	return strings.Repeat("X", len(accountNumber)-4) + accountNumber[len(accountNumber)-4:]
+}
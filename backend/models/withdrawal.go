@@ -0,0 +1,86 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Depositories a demat account can be held with
+const (
+	DepositoryNSDL = "NSDL"
+	DepositoryCDSL = "CDSL"
+)
+
+const (
+	// DematStatusPending accounts are waiting for someone to check them against the depository
+	DematStatusPending  = "pending"
+	DematStatusVerified = "verified"
+	DematStatusRejected = "rejected"
+)
+
+// DematAccount is a user's own demat account that shares can be withdrawn to
+type DematAccount struct {
+	ID                 uuid.UUID  `json:"id" db:"id"`
+	UserID             uuid.UUID  `json:"user_id" db:"user_id"`
+	Depository         string     `json:"depository" db:"depository"`
+	DPID               string     `json:"dp_id" db:"dp_id"`
+	ClientID           string     `json:"client_id" db:"client_id"`
+	VerificationStatus string     `json:"verification_status" db:"verification_status"`
+	VerifiedBy         *string    `json:"verified_by,omitempty" db:"verified_by"`
+	VerificationNote   *string    `json:"verification_note,omitempty" db:"verification_note"`
+	VerifiedAt         *time.Time `json:"verified_at,omitempty" db:"verified_at"`
+	CreatedAt          time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// DematAccountRequest registers a demat account for a user
+type DematAccountRequest struct {
+	UserID     string `json:"user_id" binding:"required"`
+	Depository string `json:"depository" binding:"required,oneof=NSDL CDSL"`
+	DPID       string `json:"dp_id" binding:"required,max=8"`
+	ClientID   string `json:"client_id" binding:"required,max=8"`
+}
+
+const (
+	// WithdrawalStatusRequested withdrawals have left the holding and wait for the next instruction file
+	WithdrawalStatusRequested = "requested"
+	// WithdrawalStatusSubmitted withdrawals are in an instruction file sent to the depository
+	WithdrawalStatusSubmitted = "submitted"
+	WithdrawalStatusCompleted = "completed"
+	// WithdrawalStatusFailed withdrawals were refused by the depository; their shares are back in the holding
+	WithdrawalStatusFailed = "failed"
+)
+
+// Withdrawal is a transfer of shares out of a user's holding to their demat account
+type Withdrawal struct {
+	ID             uuid.UUID  `json:"id" db:"id"`
+	UserID         uuid.UUID  `json:"user_id" db:"user_id"`
+	DematAccountID uuid.UUID  `json:"demat_account_id" db:"demat_account_id"`
+	StockSymbol    string     `json:"stock_symbol" db:"stock_symbol"`
+	Quantity       float64    `json:"quantity" db:"quantity"`
+	CostValue      float64    `json:"cost_value" db:"cost_value"`
+	Status         string     `json:"status" db:"status"`
+	BatchID        *uuid.UUID `json:"batch_id,omitempty" db:"batch_id"`
+	FailureReason  *string    `json:"failure_reason,omitempty" db:"failure_reason"`
+	SubmittedAt    *time.Time `json:"submitted_at,omitempty" db:"submitted_at"`
+	CompletedAt    *time.Time `json:"completed_at,omitempty" db:"completed_at"`
+	FailedAt       *time.Time `json:"failed_at,omitempty" db:"failed_at"`
+	CreatedBy      *string    `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// WithdrawalRequest asks for shares of one holding to be transferred out.
+// Without a quantity every whole share that can be withdrawn is.
+type WithdrawalRequest struct {
+	UserID         string   `json:"user_id" binding:"required"`
+	DematAccountID string   `json:"demat_account_id" binding:"required"`
+	StockSymbol    string   `json:"stock_symbol" binding:"required,max=50"`
+	Quantity       *float64 `json:"quantity" binding:"omitempty,gt=0"`
+}
+
+// WithdrawalFailure records why the depository refused a withdrawal
+type WithdrawalFailure struct {
+	Reason string `json:"reason" binding:"required,max=1000"`
+}
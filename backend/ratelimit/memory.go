@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often idle buckets are dropped from a MemoryStore
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  Limit
+}
+
+// MemoryStore keeps buckets in process memory. Buckets that have refilled
+// completely are dropped, since a new full bucket behaves the same.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		s.sweep(now)
+	}
+
+	b, ok := s.buckets[key]
+	if !ok || b.limit != limit {
+		b = &bucket{tokens: float64(limit.Requests), last: now, limit: limit}
+		s.buckets[key] = b
+	}
+
+	rate := limit.rate()
+	capacity := float64(limit.Requests)
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	result := Result{Limit: limit}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsToDuration((1 - b.tokens) / rate)
+	}
+	result.Remaining = int(b.tokens)
+	result.ResetAfter = secondsToDuration((capacity - b.tokens) / rate)
+
+	return result, nil
+}
+
+func (s *MemoryStore) Refund(ctx context.Context, key string, limit Limit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// A bucket that was swept or reconfigured is already full
+	if b, ok := s.buckets[key]; ok && b.limit == limit {
+		b.tokens = math.Min(float64(limit.Requests), b.tokens+1)
+	}
+	return nil
+}
+
+// sweep drops buckets that are full again. Must be called with mu held.
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		refill := secondsToDuration((float64(b.limit.Requests) - b.tokens) / b.limit.rate())
+		if now.Sub(b.last) >= refill {
+			delete(s.buckets, key)
+		}
+	}
+	s.lastSweep = now
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,178 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// testClock is a MemoryStore clock the test moves by hand
+type testClock struct {
+	t time.Time
+}
+
+func (c *testClock) now() time.Time {
+	return c.t
+}
+
+func (c *testClock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func newTestStore() (*MemoryStore, *testClock) {
+	clock := &testClock{t: time.Date(2024, time.January, 1, 9, 0, 0, 0, time.UTC)}
+	s := NewMemoryStore()
+	s.now = clock.now
+	return s, clock
+}
+
+func take(t *testing.T, s *MemoryStore, key string, limit Limit) Result {
+	t.Helper()
+	result, err := s.Take(context.Background(), key, limit)
+	if err != nil {
+		t.Fatalf("Take(%q) error: %v", key, err)
+	}
+	return result
+}
+
+func TestMemoryStoreTake(t *testing.T) {
+	// One token a second
+	limit := Limit{Requests: 3, Period: 3 * time.Second}
+
+	tests := []struct {
+		name string
+		// advance is how long passes before each Take
+		advance []time.Duration
+		want    Result
+	}{
+		{
+			name:    "a new bucket starts full",
+			advance: []time.Duration{0},
+			want:    Result{Allowed: true, Limit: limit, Remaining: 2, ResetAfter: time.Second},
+		},
+		{
+			name:    "the last token empties the bucket",
+			advance: []time.Duration{0, 0, 0},
+			want:    Result{Allowed: true, Limit: limit, Remaining: 0, ResetAfter: 3 * time.Second},
+		},
+		{
+			name:    "an empty bucket refuses until the next token",
+			advance: []time.Duration{0, 0, 0, 250 * time.Millisecond},
+			want:    Result{Allowed: false, Limit: limit, Remaining: 0, RetryAfter: 750 * time.Millisecond, ResetAfter: 2750 * time.Millisecond},
+		},
+		{
+			name:    "a token refills after its share of the period",
+			advance: []time.Duration{0, 0, 0, time.Second},
+			want:    Result{Allowed: true, Limit: limit, Remaining: 0, ResetAfter: 3 * time.Second},
+		},
+		{
+			name:    "refills stop at capacity",
+			advance: []time.Duration{0, 0, 0, time.Hour},
+			want:    Result{Allowed: true, Limit: limit, Remaining: 2, ResetAfter: time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, clock := newTestStore()
+			var got Result
+			for _, d := range tt.advance {
+				clock.advance(d)
+				got = take(t, s, "key", limit)
+			}
+			if got != tt.want {
+				t.Errorf("Take = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreTakeNewLimit(t *testing.T) {
+	s, _ := newTestStore()
+	take(t, s, "key", Limit{Requests: 1, Period: time.Minute})
+
+	// A reconfigured limit starts a new full bucket
+	limit := Limit{Requests: 2, Period: time.Minute}
+	if got := take(t, s, "key", limit); !got.Allowed || got.Remaining != 1 {
+		t.Errorf("Take with a new limit = %+v, want allowed with 1 remaining", got)
+	}
+}
+
+func TestMemoryStoreRefund(t *testing.T) {
+	limit := Limit{Requests: 2, Period: time.Minute}
+	ctx := context.Background()
+
+	t.Run("puts back a taken token", func(t *testing.T) {
+		s, _ := newTestStore()
+		take(t, s, "key", limit)
+		take(t, s, "key", limit)
+		if err := s.Refund(ctx, "key", limit); err != nil {
+			t.Fatalf("Refund error: %v", err)
+		}
+		if got := take(t, s, "key", limit); !got.Allowed {
+			t.Errorf("Take after Refund = %+v, want allowed", got)
+		}
+	})
+
+	t.Run("never beyond capacity", func(t *testing.T) {
+		s, _ := newTestStore()
+		take(t, s, "key", limit)
+		for i := 0; i < 3; i++ {
+			if err := s.Refund(ctx, "key", limit); err != nil {
+				t.Fatalf("Refund error: %v", err)
+			}
+		}
+		if tokens := s.buckets["key"].tokens; tokens != 2 {
+			t.Errorf("tokens after refunds = %v, want 2", tokens)
+		}
+	})
+
+	t.Run("ignores a bucket with another limit", func(t *testing.T) {
+		s, _ := newTestStore()
+		take(t, s, "key", limit)
+		if err := s.Refund(ctx, "key", Limit{Requests: 5, Period: time.Minute}); err != nil {
+			t.Fatalf("Refund error: %v", err)
+		}
+		if tokens := s.buckets["key"].tokens; tokens != 1 {
+			t.Errorf("tokens after refund = %v, want 1", tokens)
+		}
+	})
+
+	t.Run("ignores a missing bucket", func(t *testing.T) {
+		s, _ := newTestStore()
+		if err := s.Refund(ctx, "key", limit); err != nil {
+			t.Fatalf("Refund error: %v", err)
+		}
+		if _, ok := s.buckets["key"]; ok {
+			t.Error("Refund created a bucket")
+		}
+	})
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	s, clock := newTestStore()
+	slow := Limit{Requests: 1, Period: time.Hour}
+	fast := Limit{Requests: 1, Period: 30 * time.Second}
+
+	take(t, s, "slow", slow)
+	take(t, s, "fast", fast)
+
+	// The next Take after sweepInterval drops the buckets that are full again
+	clock.advance(sweepInterval)
+	take(t, s, "other", fast)
+
+	if _, ok := s.buckets["fast"]; ok {
+		t.Error("refilled bucket was not swept")
+	}
+	if _, ok := s.buckets["slow"]; !ok {
+		t.Error("bucket still refilling was swept")
+	}
+	if !s.lastSweep.Equal(clock.t) {
+		t.Errorf("lastSweep = %s, want %s", s.lastSweep, clock.t)
+	}
+
+	// A swept key gets a full bucket again
+	if got := take(t, s, "fast", fast); !got.Allowed {
+		t.Errorf("Take after sweep = %+v, want allowed", got)
+	}
+}
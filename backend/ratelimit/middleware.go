@@ -0,0 +1,130 @@
+package ratelimit
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"backend/metrics"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// RouteLimits are the buckets a request to one route draws from
+type RouteLimits struct {
+	// Client limits each API client
+	Client Limit
+	// User limits each value of the :userId route parameter
+	User Limit
+}
+
+// Rules picks the limits for a request. Routes are keyed by method and route
+// template, e.g. "POST /api/v1/reward"; unlisted routes use Default.
+type Rules struct {
+	Default RouteLimits
+	Routes  map[string]RouteLimits
+}
+
+// ClientKeyFunc identifies the API client making a request
+type ClientKeyFunc func(c *gin.Context) string
+
+// ClientIP identifies clients by address, honouring the router's trusted proxies
+func ClientIP(c *gin.Context) string {
+	return c.ClientIP()
+}
+
+type Limiter struct {
+	store     Store
+	rules     Rules
+	clientKey ClientKeyFunc
+}
+
+func NewLimiter(store Store, rules Rules, clientKey ClientKeyFunc) *Limiter {
+	return &Limiter{
+		store:     store,
+		rules:     rules,
+		clientKey: clientKey,
+	}
+}
+
+type bucketRef struct {
+	scope string
+	key   string
+	limit Limit
+}
+
+// Middleware takes a token from every bucket that applies to the request and
+// refuses it with ErrRateLimited once any is empty, refunding the tokens it
+// already took so a refused request costs nothing. Responses carry the
+// RateLimit-* headers of the tightest bucket. If the store fails the request
+// is let through, so an outage of a shared store does not take the API down.
+func (l *Limiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.Request.Method + " " + c.FullPath()
+		limits, ok := l.rules.Routes[route]
+		if !ok {
+			limits = l.rules.Default
+		}
+
+		var buckets []bucketRef
+		if limits.Client.Enabled() {
+			buckets = append(buckets, bucketRef{"client", route + "|client|" + l.clientKey(c), limits.Client})
+		}
+		if userID := c.Param("userId"); userID != "" && limits.User.Enabled() {
+			buckets = append(buckets, bucketRef{"user", route + "|user|" + userID, limits.User})
+		}
+
+		var tightest *Result
+		var taken []bucketRef
+		for _, b := range buckets {
+			result, err := l.store.Take(c.Request.Context(), b.key, b.limit)
+			if err != nil {
+				logrus.WithContext(c.Request.Context()).WithError(err).WithField("scope", b.scope).Warn("Rate limit store unavailable, allowing request")
+				continue
+			}
+
+			if !result.Allowed {
+				l.refund(c, taken)
+				metrics.RateLimitedTotal.WithLabelValues(c.FullPath(), b.scope).Inc()
+				setHeaders(c, result)
+				c.Header("Retry-After", ceilSeconds(result.RetryAfter))
+				c.Error(ErrRateLimited)
+				c.Abort()
+				return
+			}
+			taken = append(taken, b)
+
+			if tightest == nil || result.Remaining < tightest.Remaining {
+				r := result
+				tightest = &r
+			}
+		}
+
+		if tightest != nil {
+			setHeaders(c, *tightest)
+		}
+		c.Next()
+	}
+}
+
+// refund puts back the tokens a refused request took from earlier buckets
+func (l *Limiter) refund(c *gin.Context, taken []bucketRef) {
+	for _, b := range taken {
+		if err := l.store.Refund(c.Request.Context(), b.key, b.limit); err != nil {
+			logrus.WithContext(c.Request.Context()).WithError(err).WithField("scope", b.scope).Warn("Rate limit token not refunded")
+		}
+	}
+}
+
+// setHeaders writes the IETF draft RateLimit header fields
+func setHeaders(c *gin.Context, r Result) {
+	c.Header("RateLimit-Limit", strconv.Itoa(r.Limit.Requests))
+	c.Header("RateLimit-Remaining", strconv.Itoa(r.Remaining))
+	c.Header("RateLimit-Reset", ceilSeconds(r.ResetAfter))
+	c.Header("RateLimit-Policy", strconv.Itoa(r.Limit.Requests)+";w="+ceilSeconds(r.Limit.Period))
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,51 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMiddlewareRefundsWhenLaterBucketRefuses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store, _ := newTestStore()
+	client := Limit{Requests: 5, Period: time.Minute}
+	user := Limit{Requests: 1, Period: time.Minute}
+	limiter := NewLimiter(store, Rules{Default: RouteLimits{Client: client, User: user}}, func(*gin.Context) string {
+		return "client-1"
+	})
+
+	handled := 0
+	router := gin.New()
+	router.GET("/users/:userId", limiter.Middleware(), func(c *gin.Context) {
+		handled++
+		c.Status(http.StatusOK)
+	})
+
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/u1", nil))
+		return w
+	}
+
+	if w := get(); w.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("first request RateLimit-Remaining = %q, want the user bucket's 0", w.Header().Get("RateLimit-Remaining"))
+	}
+	w := get()
+	if handled != 1 {
+		t.Fatalf("handler ran %d times, want 1", handled)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("refused request has no Retry-After header")
+	}
+
+	// The refused request's client token is refunded
+	clientKey := "GET /users/:userId|client|client-1"
+	if tokens := store.buckets[clientKey].tokens; tokens != 4 {
+		t.Errorf("client bucket tokens = %v, want 4", tokens)
+	}
+}
@@ -0,0 +1,91 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrRateLimited is attached to the request when a bucket is empty
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// Limit is a token bucket that holds Requests tokens and refills them evenly
+// over Period. The zero Limit means unlimited.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// ParseLimit parses "<requests>/<period>", e.g. "120/1m". "0" or "off" disables the limit.
+func ParseLimit(s string) (Limit, error) {
+	s = strings.TrimSpace(s)
+	if s == "0" || s == "off" {
+		return Limit{}, nil
+	}
+
+	requests, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("rate limit must look like 120/1m, got %q", s)
+	}
+	n, err := strconv.Atoi(requests)
+	if err != nil || n < 1 {
+		return Limit{}, fmt.Errorf("rate limit requests must be a positive integer, got %q", requests)
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("rate limit period must be a positive duration, got %q", period)
+	}
+
+	return Limit{Requests: n, Period: d}, nil
+}
+
+// Enabled reports whether the limit restricts anything
+func (l Limit) Enabled() bool {
+	return l.Requests > 0 && l.Period > 0
+}
+
+// rate is the refill rate in tokens per second
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+func (l Limit) String() string {
+	if !l.Enabled() {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%s", l.Requests, l.Period)
+}
+
+// Set implements flag.Value so limits can be configured as "120/1m"
+func (l *Limit) Set(s string) error {
+	parsed, err := ParseLimit(s)
+	if err != nil {
+		return err
+	}
+	*l = parsed
+	return nil
+}
+
+// Result is the state of a bucket after a Take
+type Result struct {
+	Allowed   bool
+	Limit     Limit
+	Remaining int
+	// RetryAfter is how long until the next token, when the request was refused
+	RetryAfter time.Duration
+	// ResetAfter is how long until the bucket is full again
+	ResetAfter time.Duration
+}
+
+// Store holds token buckets. The in-memory store is per process; a shared
+// implementation (e.g. Redis) lets several instances enforce one limit.
+type Store interface {
+	// Take removes one token from the bucket named key, creating it full if needed
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+	// Refund puts back a token taken from the bucket named key, never beyond
+	// its capacity
+	Refund(ctx context.Context, key string, limit Limit) error
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"backend/auth"
+	"backend/database"
+	"backend/models"
+	"backend/telemetry"
+)
+
+const (
+	defaultAuditLogLimit = 100
+	maxAuditLogLimit     = 1000
+)
+
+type AuditService struct{}
+
+func NewAuditService() *AuditService {
+	return &AuditService{}
+}
+
+// recordAudit writes an audit_log row in the caller's transaction, so the
+// record commits or rolls back with the change it describes. The actor,
+// request ID and source IP come from ctx.
+func recordAudit(ctx context.Context, tx *sql.Tx, action, entityType, entityID string, before, after interface{}) error {
+	beforeJSON, err := auditState(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := auditState(after)
+	if err != nil {
+		return err
+	}
+
+	actor := auth.ActorFrom(ctx)
+	request, _ := telemetry.RequestFrom(ctx)
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO audit_log (actor_id, actor_role, action, entity_type, entity_id, request_id, source_ip, before_state, after_state)
+		VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8, @p9)
+	`, actor.ID, nullString(actor.Role), action, entityType, entityID,
+		nullString(request.ID), nullString(request.SourceIP), beforeJSON, afterJSON)
+	if err != nil {
+		return fmt.Errorf("error writing audit log: %w", err)
+	}
+
+	return nil
+}
+
+// auditState serialises a before/after state, keeping nil as SQL NULL
+func auditState(state interface{}) (sql.NullString, error) {
+	if state == nil {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("error encoding audit state: %w", err)
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// ListAuditLog returns audit entries matching filter, newest first
+func (s *AuditService) ListAuditLog(ctx context.Context, filter models.AuditLogFilter) (entries []models.AuditLogEntry, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "AuditService.ListAuditLog")
+	defer telemetry.EndSpan(span, &err)
+
+	if filter.Limit <= 0 {
+		filter.Limit = defaultAuditLogLimit
+	}
+	if filter.Limit > maxAuditLogLimit {
+		return nil, fmt.Errorf("%w: limit must be at most %d", ErrInvalidRequest, maxAuditLogLimit)
+	}
+	if filter.Offset < 0 {
+		return nil, fmt.Errorf("%w: offset must not be negative", ErrInvalidRequest)
+	}
+	if filter.From != nil && filter.To != nil && filter.To.Before(*filter.From) {
+		return nil, fmt.Errorf("%w: to must not be before from", ErrInvalidRequest)
+	}
+
+	var conditions []string
+	var args []interface{}
+	where := func(clause string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(clause, fmt.Sprintf("@p%d", len(args))))
+	}
+	if filter.ActorID != "" {
+		where("actor_id = %s", filter.ActorID)
+	}
+	if filter.Action != "" {
+		where("action = %s", filter.Action)
+	}
+	if filter.EntityType != "" {
+		where("entity_type = %s", filter.EntityType)
+	}
+	if filter.EntityID != "" {
+		where("entity_id = %s", filter.EntityID)
+	}
+	if filter.RequestID != "" {
+		where("request_id = %s", filter.RequestID)
+	}
+	if filter.From != nil {
+		where("created_at >= %s", filter.From.UTC())
+	}
+	if filter.To != nil {
+		where("created_at < %s", filter.To.UTC())
+	}
+
+	query := `
+		SELECT id, actor_id, actor_role, action, entity_type, entity_id, request_id, source_ip, before_state, after_state, created_at
+		FROM audit_log`
+	if len(conditions) > 0 {
+		query += "\n\t\tWHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Offset, filter.Limit)
+	query += fmt.Sprintf("\n\t\tORDER BY created_at DESC, id\n\t\tOFFSET @p%d ROWS FETCH NEXT @p%d ROWS ONLY", len(args)-1, len(args))
+
+	rows, err := database.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying audit log: %w", err)
+	}
+	defer rows.Close()
+
+	entries = []models.AuditLogEntry{}
+	for rows.Next() {
+		var entry models.AuditLogEntry
+		var role, requestID, sourceIP, before, after sql.NullString
+		if err := rows.Scan(
+			&entry.ID, &entry.ActorID, &role, &entry.Action, &entry.EntityType, &entry.EntityID,
+			&requestID, &sourceIP, &before, &after, &entry.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("error scanning audit log entry: %w", err)
+		}
+		entry.ActorRole = role.String
+		entry.RequestID = requestID.String
+		entry.SourceIP = sourceIP.String
+		if before.Valid {
+			entry.BeforeState = json.RawMessage(before.String)
+		}
+		if after.Valid {
+			entry.AfterState = json.RawMessage(after.String)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading audit log: %w", err)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"backend/models"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// IFSCs are a 4 letter bank code, a zero and a 6 character branch code.
+	// Account numbers are 9 to 18 digits depending on the bank.
+	ifscPattern          = regexp.MustCompile(`^[A-Z]{4}0[A-Z0-9]{6}$`)
+	accountNumberPattern = regexp.MustCompile(`^[0-9]{9,18}$`)
+	zeroAccountPattern   = regexp.MustCompile(`^0+$`)
+)
+
+// validateBankAccount checks an account number and IFSC against their formats
+func validateBankAccount(accountNumber, ifsc string) error {
+	if !accountNumberPattern.MatchString(accountNumber) {
+		return fmt.Errorf("%w: account_number must be 9 to 18 digits", ErrInvalidRequest)
+	}
+	if !ifscPattern.MatchString(ifsc) {
+		return fmt.Errorf("%w: ifsc must be 4 letters, 0 and 6 letters or digits", ErrInvalidRequest)
+	}
+	return nil
+}
+
+// Bank sends payouts from the company's account to users' bank accounts
+type Bank interface {
+	// Name identifies the bank in stored payouts and logs
+	Name() string
+	// Transfer sends a transfer. Sending the same ClientReference again
+	// returns the existing transfer instead of paying twice.
+	Transfer(ctx context.Context, req TransferRequest) (TransferState, error)
+	// QueryTransfer returns the current state of a transfer, or
+	// ErrUnknownTransfer if the bank has no record of it
+	QueryTransfer(ctx context.Context, bankReference string) (TransferState, error)
+}
+
+// TransferRequest pays Amount INR to an account
+type TransferRequest struct {
+	ClientReference string
+	AccountNumber   string
+	IFSC            string
+	Amount          float64
+}
+
+// TransferState is the bank's view of a transfer. Status is one of the
+// models.PayoutStatus values.
+type TransferState struct {
+	BankReference string
+	Status        string
+	// Reason explains a failure
+	Reason string
+}
+
+// Final reports whether the transfer can no longer change
+func (s TransferState) Final() bool {
+	return s.Status == models.PayoutStatusSettled || s.Status == models.PayoutStatusFailed
+}
+
+// simulatedBank accepts every transfer and settles it the first time its
+// status is checked. Transfers to account numbers of all zeros fail, so the
+// failure path can be exercised. Its state lives in memory, so a reference it
+// issued before a restart, or that another replica issued, is settled when
+// queried rather than reported unknown.
+type simulatedBank struct {
+	mu        sync.Mutex
+	transfers map[string]TransferState
+	byClient  map[string]string
+}
+
+// simulatedBankPrefix starts every reference the simulated bank issues
+const simulatedBankPrefix = "SIMBANK-"
+
+var defaultBank Bank = newSimulatedBank()
+
+func newSimulatedBank() *simulatedBank {
+	return &simulatedBank{
+		transfers: make(map[string]TransferState),
+		byClient:  make(map[string]string),
+	}
+}
+
+func (b *simulatedBank) Name() string {
+	return "simulated"
+}
+
+func (b *simulatedBank) Transfer(ctx context.Context, req TransferRequest) (TransferState, error) {
+	if err := ctx.Err(); err != nil {
+		return TransferState{}, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ref, ok := b.byClient[req.ClientReference]; ok {
+		return b.transfers[ref], nil
+	}
+
+	state := TransferState{BankReference: simulatedBankPrefix + uuid.NewString(), Status: models.PayoutStatusPending}
+	if zeroAccountPattern.MatchString(req.AccountNumber) {
+		state.Status = models.PayoutStatusFailed
+		state.Reason = "beneficiary account does not exist"
+	}
+
+	b.transfers[state.BankReference] = state
+	b.byClient[req.ClientReference] = state.BankReference
+	return state, nil
+}
+
+func (b *simulatedBank) QueryTransfer(ctx context.Context, bankReference string) (TransferState, error) {
+	if err := ctx.Err(); err != nil {
+		return TransferState{}, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state, ok := b.transfers[bankReference]
+	if !ok {
+		if !strings.HasPrefix(bankReference, simulatedBankPrefix) {
+			return TransferState{}, fmt.Errorf("%w: %s", ErrUnknownTransfer, bankReference)
+		}
+		state = TransferState{BankReference: bankReference, Status: models.PayoutStatusPending}
+	}
+	if !state.Final() {
+		state.Status = models.PayoutStatusSettled
+		b.transfers[bankReference] = state
+	}
+	return state, nil
+}
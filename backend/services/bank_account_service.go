@@ -0,0 +1,217 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"backend/auth"
+	"backend/database"
+	"backend/models"
+	"backend/telemetry"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// BankAccountService keeps the bank accounts users are paid out to
+type BankAccountService struct{}
+
+func NewBankAccountService() *BankAccountService {
+	return &BankAccountService{}
+}
+
+// RegisterBankAccount records a user's bank account. It cannot be paid out to
+// until it has been verified.
+func (s *BankAccountService) RegisterBankAccount(ctx context.Context, req models.BankAccountRequest) (account *models.BankAccount, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "BankAccountService.RegisterBankAccount")
+	defer telemetry.EndSpan(span, &err)
+
+	userID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid user_id: %v", ErrInvalidRequest, err)
+	}
+	if err := validateBankAccount(req.AccountNumber, req.IFSC); err != nil {
+		return nil, err
+	}
+
+	var userExists, registered bool
+	err = database.DB.QueryRowContext(ctx, `
+		SELECT
+			CASE WHEN EXISTS(SELECT 1 FROM users WHERE id = @p1 AND deleted_at IS NULL) THEN 1 ELSE 0 END,
+			CASE WHEN EXISTS(SELECT 1 FROM bank_accounts WHERE user_id = @p1 AND account_number = @p2 AND ifsc = @p3) THEN 1 ELSE 0 END
+	`, userID, req.AccountNumber, req.IFSC).Scan(&userExists, &registered)
+	if err != nil {
+		return nil, fmt.Errorf("error checking bank account: %w", err)
+	}
+	if !userExists {
+		return nil, ErrUserNotFound
+	}
+	if registered {
+		return nil, ErrDuplicateBankAccount
+	}
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	accountID := uuid.New()
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO bank_accounts (id, user_id, account_number, ifsc, verification_status)
+		VALUES (@p1, @p2, @p3, @p4, @p5)
+	`, accountID, userID, req.AccountNumber, req.IFSC, models.BankAccountStatusPending)
+	if err != nil {
+		return nil, fmt.Errorf("error creating bank account: %w", err)
+	}
+
+	err = recordAudit(ctx, tx, models.AuditBankAccountRegister, models.AuditEntityBankAccount, accountID.String(), nil, map[string]interface{}{
+		"user_id":               userID,
+		"masked_account_number": models.MaskAccountNumber(req.AccountNumber),
+		"ifsc":                  req.IFSC,
+		"verification_status":   models.BankAccountStatusPending,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"user_id":         userID,
+		"bank_account_id": accountID,
+	}).Info("Bank account registered")
+
+	return getBankAccount(ctx, accountID)
+}
+
+// ListBankAccounts returns a user's bank accounts, newest first
+func (s *BankAccountService) ListBankAccounts(ctx context.Context, userID uuid.UUID) (accounts []models.BankAccount, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "BankAccountService.ListBankAccounts")
+	defer telemetry.EndSpan(span, &err)
+
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT `+bankAccountColumnList+`
+		FROM bank_accounts
+		WHERE user_id = @p1
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying bank accounts: %w", err)
+	}
+	defer rows.Close()
+
+	accounts = []models.BankAccount{}
+	for rows.Next() {
+		account, err := scanBankAccount(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning bank account: %w", err)
+		}
+		accounts = append(accounts, *account)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading bank accounts: %w", err)
+	}
+
+	return accounts, nil
+}
+
+// VerifyBankAccount accepts a bank account once it has been checked with the
+// bank, so payouts can be sent to it
+func (s *BankAccountService) VerifyBankAccount(ctx context.Context, accountID uuid.UUID, note string) (account *models.BankAccount, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "BankAccountService.VerifyBankAccount")
+	defer telemetry.EndSpan(span, &err)
+
+	return s.decide(ctx, accountID, models.BankAccountStatusVerified, note)
+}
+
+// RejectBankAccount turns down a bank account that does not belong to the user
+func (s *BankAccountService) RejectBankAccount(ctx context.Context, accountID uuid.UUID, note string) (account *models.BankAccount, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "BankAccountService.RejectBankAccount")
+	defer telemetry.EndSpan(span, &err)
+
+	return s.decide(ctx, accountID, models.BankAccountStatusRejected, note)
+}
+
+func (s *BankAccountService) decide(ctx context.Context, accountID uuid.UUID, status, note string) (*models.BankAccount, error) {
+	actor := auth.ActorFrom(ctx)
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Guard on the status so an account is decided only once
+	result, err := tx.ExecContext(ctx, `
+		UPDATE bank_accounts
+		SET verification_status = @p1, verified_by = @p2, verification_note = @p3, verified_at = GETUTCDATE(), updated_at = GETUTCDATE()
+		WHERE id = @p4 AND verification_status = @p5
+	`, status, actor.ID, nullString(note), accountID, models.BankAccountStatusPending)
+	if err != nil {
+		return nil, fmt.Errorf("error updating bank account: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		if _, err := getBankAccount(ctx, accountID); err != nil {
+			return nil, err
+		}
+		return nil, ErrBankAccountDecided
+	}
+
+	action := models.AuditBankAccountVerify
+	if status == models.BankAccountStatusRejected {
+		action = models.AuditBankAccountReject
+	}
+	err = recordAudit(ctx, tx, action, models.AuditEntityBankAccount, accountID.String(),
+		map[string]interface{}{"verification_status": models.BankAccountStatusPending},
+		map[string]interface{}{"verification_status": status, "verified_by": actor.ID, "note": note},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"bank_account_id": accountID,
+		"status":          status,
+	}).Info("Bank account decided")
+
+	return getBankAccount(ctx, accountID)
+}
+
+// bankAccountColumnList selects a bank_accounts row for scanBankAccount
+const bankAccountColumnList = "id, user_id, account_number, ifsc, verification_status, verified_by, verification_note, verified_at, created_at, updated_at"
+
+// scanBankAccount reads a row selected with bankAccountColumnList and masks
+// its account number
+func scanBankAccount(row interface{ Scan(...interface{}) error }) (*models.BankAccount, error) {
+	var a models.BankAccount
+	err := row.Scan(&a.ID, &a.UserID, &a.AccountNumber, &a.IFSC, &a.VerificationStatus,
+		&a.VerifiedBy, &a.VerificationNote, &a.VerifiedAt, &a.CreatedAt, &a.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	a.MaskedAccountNumber = models.MaskAccountNumber(a.AccountNumber)
+	return &a, nil
+}
+
+// getBankAccount loads a bank account by ID
+func getBankAccount(ctx context.Context, accountID uuid.UUID) (*models.BankAccount, error) {
+	account, err := scanBankAccount(database.DB.QueryRowContext(ctx,
+		"SELECT "+bankAccountColumnList+" FROM bank_accounts WHERE id = @p1", accountID,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrBankAccountNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching bank account: %w", err)
+	}
+	return account, nil
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"backend/models"
+
+	"github.com/google/uuid"
+)
+
+// Broker places and tracks the orders that buy the shares behind rewards and
+// sell the shares users redeem
+type Broker interface {
+	// Name identifies the broker in stored orders and logs
+	Name() string
+	// PlaceOrder submits a market order. Placing the same ClientOrderID
+	// again returns the existing order instead of a new one.
+	PlaceOrder(ctx context.Context, req OrderRequest) (OrderState, error)
+	// QueryOrder returns the current state of an order, or ErrUnknownOrder
+	// if the broker has no record of it
+	QueryOrder(ctx context.Context, brokerOrderID string) (OrderState, error)
+	// CancelOrder cancels whatever part of an order has not filled yet. Like
+	// QueryOrder it returns ErrUnknownOrder for an order it has no record of.
+	CancelOrder(ctx context.Context, brokerOrderID string) (OrderState, error)
+}
+
+// OrderRequest is a market order for Quantity shares of Symbol
+type OrderRequest struct {
+	ClientOrderID string
+	Symbol        string
+	Side          string
+	Quantity      float64
+}
+
+// OrderState is the broker's view of an order. Status is one of the
+// models.OrderStatus values other than new.
+type OrderState struct {
+	BrokerOrderID  string
+	Status         string
+	FilledQuantity float64
+	// AveragePrice is the volume-weighted price of the filled quantity in INR
+	AveragePrice float64
+	Fees         OrderFees
+	// Reason explains a rejection or cancellation
+	Reason string
+}
+
+// Final reports whether the order can no longer change
+func (s OrderState) Final() bool {
+	switch s.Status {
+	case models.OrderStatusFilled, models.OrderStatusRejected, models.OrderStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// OrderFees are the charges the broker booked on a fill
+type OrderFees struct {
+	Brokerage float64
+	STT       float64
+	GST       float64
+}
+
+// Total returns the sum of all fees
+func (f OrderFees) Total() float64 {
+	return f.Brokerage + f.STT + f.GST
+}
+
+// OrderOptions control how long reward orders may stay open
+type OrderOptions struct {
+	// FillTimeout is how long an order may stay open before it is cancelled
+	// and the reward fails, keeping whatever part already filled
+	FillTimeout time.Duration
+	// AggregationWindow is how long pending rewards for a symbol are collected
+	// into one order; 0 orders each reward on its own as soon as it is pending
+	AggregationWindow time.Duration
+}
+
+// DefaultOrderOptions gives orders a full trading day to fill
+func DefaultOrderOptions() OrderOptions {
+	return OrderOptions{FillTimeout: 24 * time.Hour, AggregationWindow: 15 * time.Minute}
+}
+
+// Validate checks that the fill timeout is positive
+func (o OrderOptions) Validate() error {
+	if o.FillTimeout <= 0 {
+		return fmt.Errorf("fill_timeout must be positive, got %s", o.FillTimeout)
+	}
+	if o.AggregationWindow < 0 {
+		return fmt.Errorf("aggregation_window must not be negative, got %s", o.AggregationWindow)
+	}
+	return nil
+}
+
+// simulatedBroker fills every order for a listed symbol immediately, near
+// the simulated price, and charges the configured fee schedule. Its orders
+// live in memory, so after a restart every earlier order is unknown to it.
+type simulatedBroker struct {
+	mu       sync.Mutex
+	rnd      *rand.Rand
+	orders   map[string]OrderState
+	byClient map[string]string
+}
+
+var defaultBroker Broker = newSimulatedBroker()
+
+func newSimulatedBroker() *simulatedBroker {
+	return &simulatedBroker{
+		rnd:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		orders:   make(map[string]OrderState),
+		byClient: make(map[string]string),
+	}
+}
+
+func (b *simulatedBroker) Name() string {
+	return "simulated"
+}
+
+func (b *simulatedBroker) PlaceOrder(ctx context.Context, req OrderRequest) (OrderState, error) {
+	if err := ctx.Err(); err != nil {
+		return OrderState{}, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if id, ok := b.byClient[req.ClientOrderID]; ok {
+		return b.orders[id], nil
+	}
+
+	state := OrderState{BrokerOrderID: "SIM-" + uuid.NewString()}
+	basePrice, listed := simulatedBasePrices[req.Symbol]
+	switch {
+	case !listed:
+		state.Status = models.OrderStatusRejected
+		state.Reason = fmt.Sprintf("symbol %s is not tradable", req.Symbol)
+	case req.Quantity <= 0:
+		state.Status = models.OrderStatusRejected
+		state.Reason = "quantity must be positive"
+	default:
+		// Market orders fill within ±0.5% of the simulated price
+		slippage := (b.rnd.Float64() - 0.5) * 0.01
+		price := float64(int(basePrice*(1+slippage)*100+0.5)) / 100
+
+		state.Status = models.OrderStatusFilled
+		state.FilledQuantity = req.Quantity
+		state.AveragePrice = price
+		if req.Side == models.OrderSideSell {
+			state.Fees = CurrentFeeSchedule().CalculateSell(price * req.Quantity)
+		} else {
+			brokerage, stt, gst := CurrentFeeSchedule().Calculate(price * req.Quantity)
+			state.Fees = OrderFees{Brokerage: brokerage, STT: stt, GST: gst}
+		}
+	}
+
+	b.orders[state.BrokerOrderID] = state
+	b.byClient[req.ClientOrderID] = state.BrokerOrderID
+	return state, nil
+}
+
+func (b *simulatedBroker) QueryOrder(ctx context.Context, brokerOrderID string) (OrderState, error) {
+	if err := ctx.Err(); err != nil {
+		return OrderState{}, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state, ok := b.orders[brokerOrderID]
+	if !ok {
+		return OrderState{}, fmt.Errorf("%w: %s", ErrUnknownOrder, brokerOrderID)
+	}
+	return state, nil
+}
+
+func (b *simulatedBroker) CancelOrder(ctx context.Context, brokerOrderID string) (OrderState, error) {
+	if err := ctx.Err(); err != nil {
+		return OrderState{}, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state, ok := b.orders[brokerOrderID]
+	if !ok {
+		return OrderState{}, fmt.Errorf("%w: %s", ErrUnknownOrder, brokerOrderID)
+	}
+	if !state.Final() {
+		state.Status = models.OrderStatusCancelled
+		state.Reason = "cancelled on request"
+		b.orders[brokerOrderID] = state
+	}
+	return state, nil
+}
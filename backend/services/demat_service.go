@@ -0,0 +1,219 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"backend/auth"
+	"backend/database"
+	"backend/models"
+	"backend/telemetry"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// DematService keeps the demat accounts users withdraw their shares to
+type DematService struct{}
+
+func NewDematService() *DematService {
+	return &DematService{}
+}
+
+// RegisterDematAccount records a user's demat account. It cannot be withdrawn
+// to until it has been verified.
+func (s *DematService) RegisterDematAccount(ctx context.Context, req models.DematAccountRequest) (account *models.DematAccount, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "DematService.RegisterDematAccount", attribute.String("depository", req.Depository))
+	defer telemetry.EndSpan(span, &err)
+
+	userID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid user_id: %v", ErrInvalidRequest, err)
+	}
+	if err := validateDematIDs(req.Depository, req.DPID, req.ClientID); err != nil {
+		return nil, err
+	}
+
+	var userExists, registered bool
+	err = database.DB.QueryRowContext(ctx, `
+		SELECT
+			CASE WHEN EXISTS(SELECT 1 FROM users WHERE id = @p1 AND deleted_at IS NULL) THEN 1 ELSE 0 END,
+			CASE WHEN EXISTS(SELECT 1 FROM demat_accounts WHERE user_id = @p1 AND dp_id = @p2 AND client_id = @p3) THEN 1 ELSE 0 END
+	`, userID, req.DPID, req.ClientID).Scan(&userExists, &registered)
+	if err != nil {
+		return nil, fmt.Errorf("error checking demat account: %w", err)
+	}
+	if !userExists {
+		return nil, ErrUserNotFound
+	}
+	if registered {
+		return nil, ErrDuplicateDematAccount
+	}
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	accountID := uuid.New()
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO demat_accounts (id, user_id, depository, dp_id, client_id, verification_status)
+		VALUES (@p1, @p2, @p3, @p4, @p5, @p6)
+	`, accountID, userID, req.Depository, req.DPID, req.ClientID, models.DematStatusPending)
+	if err != nil {
+		return nil, fmt.Errorf("error creating demat account: %w", err)
+	}
+
+	err = recordAudit(ctx, tx, models.AuditDematRegister, models.AuditEntityDematAccount, accountID.String(), nil, map[string]interface{}{
+		"user_id":             userID,
+		"depository":          req.Depository,
+		"dp_id":               req.DPID,
+		"client_id":           req.ClientID,
+		"verification_status": models.DematStatusPending,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"user_id":          userID,
+		"demat_account_id": accountID,
+		"depository":       req.Depository,
+	}).Info("Demat account registered")
+
+	return getDematAccount(ctx, accountID)
+}
+
+// ListDematAccounts returns a user's demat accounts, newest first
+func (s *DematService) ListDematAccounts(ctx context.Context, userID uuid.UUID) (accounts []models.DematAccount, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "DematService.ListDematAccounts")
+	defer telemetry.EndSpan(span, &err)
+
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT `+dematColumnList+`
+		FROM demat_accounts
+		WHERE user_id = @p1
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying demat accounts: %w", err)
+	}
+	defer rows.Close()
+
+	accounts = []models.DematAccount{}
+	for rows.Next() {
+		account, err := scanDematAccount(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning demat account: %w", err)
+		}
+		accounts = append(accounts, *account)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading demat accounts: %w", err)
+	}
+
+	return accounts, nil
+}
+
+// VerifyDematAccount accepts a demat account once it has been checked against
+// the depository, so shares can be withdrawn to it
+func (s *DematService) VerifyDematAccount(ctx context.Context, accountID uuid.UUID, note string) (account *models.DematAccount, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "DematService.VerifyDematAccount")
+	defer telemetry.EndSpan(span, &err)
+
+	return s.decide(ctx, accountID, models.DematStatusVerified, note)
+}
+
+// RejectDematAccount turns down a demat account that does not match the
+// depository's records
+func (s *DematService) RejectDematAccount(ctx context.Context, accountID uuid.UUID, note string) (account *models.DematAccount, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "DematService.RejectDematAccount")
+	defer telemetry.EndSpan(span, &err)
+
+	return s.decide(ctx, accountID, models.DematStatusRejected, note)
+}
+
+func (s *DematService) decide(ctx context.Context, accountID uuid.UUID, status, note string) (*models.DematAccount, error) {
+	actor := auth.ActorFrom(ctx)
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Guard on the status so an account is decided only once
+	result, err := tx.ExecContext(ctx, `
+		UPDATE demat_accounts
+		SET verification_status = @p1, verified_by = @p2, verification_note = @p3, verified_at = GETUTCDATE(), updated_at = GETUTCDATE()
+		WHERE id = @p4 AND verification_status = @p5
+	`, status, actor.ID, nullString(note), accountID, models.DematStatusPending)
+	if err != nil {
+		return nil, fmt.Errorf("error updating demat account: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		if _, err := getDematAccount(ctx, accountID); err != nil {
+			return nil, err
+		}
+		return nil, ErrDematAccountDecided
+	}
+
+	action := models.AuditDematVerify
+	if status == models.DematStatusRejected {
+		action = models.AuditDematReject
+	}
+	err = recordAudit(ctx, tx, action, models.AuditEntityDematAccount, accountID.String(),
+		map[string]interface{}{"verification_status": models.DematStatusPending},
+		map[string]interface{}{"verification_status": status, "verified_by": actor.ID, "note": note},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"demat_account_id": accountID,
+		"status":           status,
+	}).Info("Demat account decided")
+
+	return getDematAccount(ctx, accountID)
+}
+
+// dematColumnList selects a demat_accounts row for scanDematAccount
+const dematColumnList = "id, user_id, depository, dp_id, client_id, verification_status, verified_by, verification_note, verified_at, created_at, updated_at"
+
+// scanDematAccount reads a row selected with dematColumnList
+func scanDematAccount(row interface{ Scan(...interface{}) error }) (*models.DematAccount, error) {
+	var a models.DematAccount
+	err := row.Scan(&a.ID, &a.UserID, &a.Depository, &a.DPID, &a.ClientID, &a.VerificationStatus,
+		&a.VerifiedBy, &a.VerificationNote, &a.VerifiedAt, &a.CreatedAt, &a.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// getDematAccount loads a demat account by ID
+func getDematAccount(ctx context.Context, accountID uuid.UUID) (*models.DematAccount, error) {
+	account, err := scanDematAccount(database.DB.QueryRowContext(ctx,
+		"SELECT "+dematColumnList+" FROM demat_accounts WHERE id = @p1", accountID,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDematAccountNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching demat account: %w", err)
+	}
+	return account, nil
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"backend/models"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// NSDL DP IDs are IN followed by six digits; CDSL DP IDs are eight digits.
+	// Client IDs are eight digits at both depositories.
+	nsdlDPIDPattern   = regexp.MustCompile(`^IN[0-9]{6}$`)
+	cdslDPIDPattern   = regexp.MustCompile(`^[0-9]{8}$`)
+	clientIDPattern   = regexp.MustCompile(`^[0-9]{8}$`)
+	instructionHeader = []string{
+		"batch_id", "line_no", "withdrawal_id", "execution_date", "stock_symbol", "quantity", "transfer_type",
+		"source_depository", "source_dp_id", "source_client_id",
+		"target_depository", "target_dp_id", "target_client_id",
+	}
+)
+
+// validateDematIDs checks a DP ID and client ID against the depository's format
+func validateDematIDs(depository, dpID, clientID string) error {
+	switch depository {
+	case models.DepositoryNSDL:
+		if !nsdlDPIDPattern.MatchString(dpID) {
+			return fmt.Errorf("%w: NSDL dp_id must be IN followed by 6 digits", ErrInvalidRequest)
+		}
+	case models.DepositoryCDSL:
+		if !cdslDPIDPattern.MatchString(dpID) {
+			return fmt.Errorf("%w: CDSL dp_id must be 8 digits", ErrInvalidRequest)
+		}
+	default:
+		return fmt.Errorf("%w: unknown depository %q", ErrInvalidRequest, depository)
+	}
+	if !clientIDPattern.MatchString(clientID) {
+		return fmt.Errorf("%w: client_id must be 8 digits", ErrInvalidRequest)
+	}
+	return nil
+}
+
+// DepositoryOptions name the pool demat account that holds every user's
+// shares and that withdrawals are transferred out of
+type DepositoryOptions struct {
+	PoolDepository string
+	PoolDPID       string
+	PoolClientID   string
+}
+
+// DefaultDepositoryOptions leave the pool account unset, so withdrawals can be
+// requested but no instruction file can be generated
+func DefaultDepositoryOptions() DepositoryOptions {
+	return DepositoryOptions{PoolDepository: models.DepositoryNSDL}
+}
+
+// Validate checks the pool account, if one is set, against its depository's format
+func (o DepositoryOptions) Validate() error {
+	if o.PoolDepository != models.DepositoryNSDL && o.PoolDepository != models.DepositoryCDSL {
+		return fmt.Errorf("pool depository must be %s or %s, got %q", models.DepositoryNSDL, models.DepositoryCDSL, o.PoolDepository)
+	}
+	if o.PoolDPID == "" && o.PoolClientID == "" {
+		return nil
+	}
+	if err := validateDematIDs(o.PoolDepository, o.PoolDPID, o.PoolClientID); err != nil {
+		return fmt.Errorf("pool account: %w", err)
+	}
+	return nil
+}
+
+// configured reports whether a pool account is set
+func (o DepositoryOptions) configured() bool {
+	return o.PoolDPID != "" && o.PoolClientID != ""
+}
+
+// InstructionFile is a batch of delivery instructions for the depository, one
+// line per withdrawal, transferring shares from the pool account to users'
+// demat accounts
+type InstructionFile struct {
+	BatchID     uuid.UUID
+	Withdrawals int
+	Content     []byte
+}
+
+// instructionLine is one submitted withdrawal and the account it goes to
+type instructionLine struct {
+	withdrawal models.Withdrawal
+	account    models.DematAccount
+}
+
+// Name is the file name the instruction file is downloaded as
+func (f *InstructionFile) Name() string {
+	return "withdrawal-instructions-" + f.BatchID.String() + ".csv"
+}
+
+// buildInstructionFile writes the instruction file for a batch. Transfers to
+// the pool's own depository are intra-depository, others inter-depository.
+func buildInstructionFile(batchID uuid.UUID, executionDate time.Time, pool DepositoryOptions, lines []instructionLine) (*InstructionFile, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(instructionHeader); err != nil {
+		return nil, fmt.Errorf("error writing instruction header: %w", err)
+	}
+
+	for i, line := range lines {
+		transferType := "INTER"
+		if line.account.Depository == pool.PoolDepository {
+			transferType = "INTRA"
+		}
+		record := []string{
+			batchID.String(),
+			strconv.Itoa(i + 1),
+			line.withdrawal.ID.String(),
+			executionDate.Format("2006-01-02"),
+			line.withdrawal.StockSymbol,
+			strconv.FormatFloat(line.withdrawal.Quantity, 'f', 0, 64),
+			transferType,
+			pool.PoolDepository,
+			pool.PoolDPID,
+			pool.PoolClientID,
+			line.account.Depository,
+			line.account.DPID,
+			line.account.ClientID,
+		}
+		if err := w.Write(record); err != nil {
+			return nil, fmt.Errorf("error writing instruction line: %w", err)
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("error writing instruction file: %w", err)
+	}
+
+	return &InstructionFile{BatchID: batchID, Withdrawals: len(lines), Content: buf.Bytes()}, nil
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"backend/database"
+
+	"github.com/google/uuid"
+)
+
+// DividendOptions control the TDS withheld from dividends
+type DividendOptions struct {
+	// TDSRate is the share of a dividend withheld as tax
+	TDSRate float64
+	// TDSThreshold is the INR a user may receive from one stock in a financial
+	// year before TDS applies. A payment that takes the year's total above it
+	// has TDS withheld on its whole amount, as does every later payment.
+	TDSThreshold float64
+}
+
+// DefaultDividendOptions withhold 10% once a user's dividends from a stock
+// exceed ₹10,000 in the financial year (section 194)
+func DefaultDividendOptions() DividendOptions {
+	return DividendOptions{TDSRate: 0.10, TDSThreshold: 10000}
+}
+
+// Validate checks that the rate is a fraction and the threshold not negative
+func (o DividendOptions) Validate() error {
+	if o.TDSRate < 0 || o.TDSRate >= 1 {
+		return fmt.Errorf("tds_rate must be at least 0 and below 1, got %v", o.TDSRate)
+	}
+	if o.TDSThreshold < 0 {
+		return fmt.Errorf("tds_threshold must not be negative, got %v", o.TDSThreshold)
+	}
+	return nil
+}
+
+// tds returns the tax to withhold from a gross dividend, given what the user
+// already received from the same stock earlier in the financial year
+func (o DividendOptions) tds(gross, paidThisYear float64) float64 {
+	if paidThisYear+gross <= o.TDSThreshold {
+		return 0
+	}
+	return roundTo(gross*o.TDSRate, amountPlaces)
+}
+
+// reinvestPriceMargin is how far above the stored price a reinvestment's buy
+// order is allowed to fill before it costs more than the dividend
+const reinvestPriceMargin = 0.01
+
+// reinvestQuantity sizes the buy order for a reinvested dividend of net INR.
+// The order fills at the market price, not the stored one, and its fees come
+// out of the same amount, so it is sized to leave room for both. Whatever is
+// left over after the fill goes to the wallet.
+func reinvestQuantity(net, price float64, fees FeeSchedule) float64 {
+	feeRate := fees.BrokerageRate*(1+fees.GSTRate) + fees.STTRate
+	quantity := net / (price * (1 + reinvestPriceMargin) * (1 + feeRate))
+	// Round down, so rounding can't take the order over the amount
+	scale := math.Pow(10, float64(quantityPlaces))
+	return math.Floor(quantity*scale) / scale
+}
+
+// financialYearStart returns 1 April of the Indian financial year (April to
+// March) that a calendar date falls in
+func financialYearStart(date time.Time) time.Time {
+	year := date.Year()
+	if date.Month() < time.April {
+		year--
+	}
+	return time.Date(year, time.April, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// quantitiesHeldAt returns every user's vested holding of a symbol at an
+// instant, rebuilt from the ledger. Unvested shares are not the user's until
+// they vest, so they earn no dividend. Shares reserved for a sale still
+// belong to the user until the sale fills. Debits to those accounts brought
+// shares in and credits took them out. Users holding nothing are left out.
+func quantitiesHeldAt(ctx context.Context, symbol string, at time.Time) (map[uuid.UUID]float64, error) {
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT user_id, SUM(CASE
+			WHEN debit_amount > 0 AND credit_amount = 0 THEN stock_quantity
+			WHEN credit_amount > 0 AND debit_amount = 0 THEN -stock_quantity
+			ELSE 0 END)
+		FROM ledger_entries
+		WHERE account_type IN ('stock_inventory', 'stock_pending_sale') AND account_symbol = @p1
+			AND user_id IS NOT NULL AND created_at < @p2
+		GROUP BY user_id
+	`, symbol, at.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("error querying holdings at %s: %w", at.Format(time.RFC3339), err)
+	}
+	defer rows.Close()
+
+	held := make(map[uuid.UUID]float64)
+	for rows.Next() {
+		var userID uuid.UUID
+		var quantity float64
+		if err := rows.Scan(&userID, &quantity); err != nil {
+			return nil, fmt.Errorf("error scanning holding: %w", err)
+		}
+		if quantity = roundTo(quantity, quantityPlaces); quantity > 0 {
+			held[userID] = quantity
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading holdings: %w", err)
+	}
+	return held, nil
+}
@@ -0,0 +1,305 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"backend/database"
+	"backend/metrics"
+	"backend/models"
+	"backend/telemetry"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ProcessPendingReinvestments follows the buy orders of reinvested dividend
+// payments until they are final and books the shares each one bought. It
+// returns the number of reinvestments booked.
+func (s *DividendService) ProcessPendingReinvestments(ctx context.Context) (booked int, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "DividendService.ProcessPendingReinvestments")
+	defer telemetry.EndSpan(span, &err)
+
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT p.id
+		FROM dividend_payments p
+		JOIN broker_orders o ON o.id = p.order_id
+		WHERE o.status IN (@p1, @p2)
+		ORDER BY p.created_at
+	`, models.OrderStatusNew, models.OrderStatusOpen)
+	if err != nil {
+		return 0, fmt.Errorf("error querying pending reinvestments: %w", err)
+	}
+
+	var pending []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("error scanning pending reinvestment: %w", err)
+		}
+		pending = append(pending, id)
+	}
+	rows.Close()
+
+	for _, paymentID := range pending {
+		if err := s.advanceReinvestment(ctx, paymentID); err != nil {
+			logrus.WithContext(ctx).WithError(err).WithField("dividend_payment_id", paymentID).Error("Error advancing reinvestment order")
+			continue
+		}
+		var status string
+		err := database.DB.QueryRowContext(ctx, `
+			SELECT o.status FROM dividend_payments p JOIN broker_orders o ON o.id = p.order_id WHERE p.id = @p1
+		`, paymentID).Scan(&status)
+		if err != nil {
+			return booked, fmt.Errorf("error fetching reinvestment order: %w", err)
+		}
+		if status != models.OrderStatusNew && status != models.OrderStatusOpen {
+			booked++
+		}
+	}
+
+	if booked > 0 {
+		logrus.WithContext(ctx).WithField("count", booked).Info("Booked dividend reinvestments")
+	}
+	return booked, nil
+}
+
+// advanceReinvestment takes one step on a reinvested payment's buy order: it
+// places the order if needed, cancels it once it has been open too long, and
+// books the shares when it is final
+func (s *DividendService) advanceReinvestment(ctx context.Context, paymentID uuid.UUID) (err error) {
+	ctx, span := telemetry.StartSpan(ctx, "DividendService.advanceReinvestment",
+		attribute.String("dividend_payment_id", paymentID.String()),
+		attribute.String("broker", s.broker.Name()),
+	)
+	defer telemetry.EndSpan(span, &err)
+
+	order := &models.BrokerOrder{}
+	err = database.DB.QueryRowContext(ctx, `
+		SELECT o.id, o.broker_order_id, o.stock_symbol, o.side, o.quantity, o.status, o.placed_at
+		FROM dividend_payments p
+		JOIN broker_orders o ON o.id = p.order_id
+		WHERE p.id = @p1
+	`, paymentID).Scan(&order.ID, &order.BrokerOrderID, &order.StockSymbol, &order.Side, &order.Quantity, &order.Status, &order.PlacedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error loading reinvestment order: %w", err)
+	}
+	if order.Status != models.OrderStatusNew && order.Status != models.OrderStatusOpen {
+		return nil
+	}
+
+	var state OrderState
+	if order.BrokerOrderID == nil {
+		// The order row's ID is the client order ID, so a retry after a lost
+		// response finds the order already placed instead of buying twice
+		state, err = s.broker.PlaceOrder(ctx, OrderRequest{
+			ClientOrderID: order.ID.String(),
+			Symbol:        order.StockSymbol,
+			Side:          models.OrderSideBuy,
+			Quantity:      order.Quantity,
+		})
+		if err != nil {
+			return fmt.Errorf("error placing reinvestment order with %s: %w", s.broker.Name(), err)
+		}
+		now := time.Now().UTC()
+		order.PlacedAt = &now
+		_, err = database.DB.ExecContext(ctx, `
+			UPDATE broker_orders SET broker_order_id = @p1, status = @p2, placed_at = @p3, updated_at = GETUTCDATE()
+			WHERE id = @p4
+		`, state.BrokerOrderID, models.OrderStatusOpen, now, order.ID)
+		if err != nil {
+			return fmt.Errorf("error recording placed reinvestment order: %w", err)
+		}
+		metrics.BrokerOrdersTotal.WithLabelValues(s.broker.Name(), models.OrderStatusOpen).Inc()
+	} else {
+		state, err = queryOrder(ctx, s.broker, order)
+		if err != nil {
+			return fmt.Errorf("error querying reinvestment order with %s: %w", s.broker.Name(), err)
+		}
+	}
+
+	if !state.Final() && order.PlacedAt != nil && time.Since(*order.PlacedAt) > CurrentOrderOptions().FillTimeout {
+		state, err = s.broker.CancelOrder(ctx, state.BrokerOrderID)
+		if err != nil {
+			return fmt.Errorf("error cancelling reinvestment order with %s: %w", s.broker.Name(), err)
+		}
+	}
+
+	if !state.Final() {
+		return nil
+	}
+
+	metrics.BrokerOrdersTotal.WithLabelValues(s.broker.Name(), state.Status).Inc()
+	return bookReinvestment(ctx, paymentID, order.ID, state)
+}
+
+// bookReinvestment books a reinvested payment whose buy order is final. The
+// shares the order bought are added to the holding, unsettled until their
+// settlement date, at the fill price and quantity; the fees are part of their
+// cost. Whatever the fill did not spend, or the whole amount when nothing
+// filled, is credited to the wallet.
+func bookReinvestment(ctx context.Context, paymentID, orderID uuid.UUID, state OrderState) error {
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Guard on the order status so two workers can't book the same fill
+	finished, err := finishOrder(ctx, tx, orderID, state)
+	if err != nil || !finished {
+		return err
+	}
+
+	p := &models.DividendPayment{}
+	err = tx.QueryRowContext(ctx, `
+		SELECT `+dividendPaymentColumnList+` FROM dividend_payments WITH (UPDLOCK, ROWLOCK) WHERE id = @p1
+	`, paymentID).Scan(dividendPaymentFields(p)...)
+	if err != nil {
+		return fmt.Errorf("error loading dividend payment: %w", err)
+	}
+
+	quantity := roundTo(state.FilledQuantity, quantityPlaces)
+	var cost float64
+	if quantity > 0 {
+		cost = roundTo(state.AveragePrice*quantity+state.Fees.Total(), amountPlaces)
+		tradeDate, settlementDate := settlementDates(time.Now())
+		p.ReinvestPrice = &state.AveragePrice
+		p.ReinvestedQuantity = &quantity
+		p.TradeDate, p.SettlementDate = &tradeDate, &settlementDate
+	} else {
+		p.Mode = models.DividendModeWallet
+	}
+	// A fill above the order's price margin is paid for by the company
+	refund := roundTo(p.NetAmount-cost, amountPlaces)
+	if refund < 0 {
+		refund = 0
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE dividend_payments
+		SET mode = @p1, reinvest_price = @p2, reinvested_quantity = @p3, trade_date = @p4, settlement_date = @p5
+		WHERE id = @p6
+	`, p.Mode, p.ReinvestPrice, p.ReinvestedQuantity, p.TradeDate, p.SettlementDate, p.ID)
+	if err != nil {
+		return fmt.Errorf("error updating dividend payment: %w", err)
+	}
+
+	transactionID, err := postReinvestment(ctx, tx, p, cost, refund)
+	if err != nil {
+		return err
+	}
+
+	if quantity > 0 {
+		var before sql.NullFloat64
+		var after float64
+		err = tx.QueryRowContext(ctx, `
+			MERGE user_holdings AS target
+			USING (SELECT @p1 AS user_id, @p2 AS stock_symbol, @p3 AS quantity) AS source
+			ON target.user_id = source.user_id AND target.stock_symbol = source.stock_symbol
+			WHEN MATCHED THEN
+				UPDATE SET quantity = target.quantity + source.quantity, updated_at = GETUTCDATE(), last_updated = GETUTCDATE()
+			WHEN NOT MATCHED THEN
+				INSERT (user_id, stock_symbol, quantity, last_updated)
+				VALUES (source.user_id, source.stock_symbol, source.quantity, GETUTCDATE())
+			OUTPUT deleted.quantity, inserted.quantity;
+		`, p.UserID, p.StockSymbol, quantity).Scan(&before, &after)
+		if err != nil {
+			return fmt.Errorf("error updating user holdings: %w", err)
+		}
+
+		err = recordAudit(ctx, tx, models.AuditHoldingReinvest, models.AuditEntityHolding, holdingEntityID(p.UserID, p.StockSymbol),
+			map[string]interface{}{"quantity": before.Float64},
+			map[string]interface{}{"quantity": after, "dividend_payment_id": p.ID, "transaction_id": transactionID},
+		)
+		if err != nil {
+			return err
+		}
+
+		err = createLot(ctx, tx, models.TaxLot{
+			UserID:       p.UserID,
+			StockSymbol:  p.StockSymbol,
+			Source:       models.LotSourceDividend,
+			SourceID:     p.ID,
+			AcquiredOn:   *p.TradeDate,
+			Quantity:     quantity,
+			CostPerShare: roundTo(cost/quantity, amountPlaces),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	err = recordAudit(ctx, tx, models.AuditDividendReinvest, models.AuditEntityDividend, p.DividendID.String(), nil, map[string]interface{}{
+		"dividend_payment_id": p.ID,
+		"user_id":             p.UserID,
+		"broker_order_id":     state.BrokerOrderID,
+		"order_status":        state.Status,
+		"reinvested_quantity": quantity,
+		"price":               state.AveragePrice,
+		"fees":                roundTo(state.Fees.Total(), amountPlaces),
+		"cost":                cost,
+		"refund":              refund,
+		"reason":              state.Reason,
+		"transaction_id":      transactionID,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	PortfolioEvents().PublishUser(p.UserID)
+	return nil
+}
+
+// postReinvestment writes the ledger entries for a reinvestment's final buy
+// order and returns their transaction ID. The shares bought come into stock
+// inventory at their cost, fees included, paid from cash; the part of the
+// amount held in dividends_reinvested that was not spent goes to the wallet.
+func postReinvestment(ctx context.Context, tx *sql.Tx, p *models.DividendPayment, cost, refund float64) (uuid.UUID, error) {
+	transactionID := uuid.New()
+	type entry struct {
+		account, symbol string
+		debit, credit   float64
+		quantity        float64
+		description     string
+	}
+	var entries []entry
+	if p.ReinvestedQuantity != nil {
+		entries = append(entries,
+			entry{"stock_inventory", p.StockSymbol, cost, 0, *p.ReinvestedQuantity, fmt.Sprintf("Dividend reinvestment: %s x %.6f @ %.4f", p.StockSymbol, *p.ReinvestedQuantity, *p.ReinvestPrice)},
+			entry{"cash", "", 0, cost, 0, fmt.Sprintf("Cash paid for reinvested %s", p.StockSymbol)},
+		)
+	}
+	if refund > 0 {
+		entries = append(entries,
+			entry{"dividends_reinvested", "", refund, 0, 0, fmt.Sprintf("Dividend from %s not reinvested", p.StockSymbol)},
+			entry{"user_wallet", "", 0, refund, 0, fmt.Sprintf("Dividend from %s", p.StockSymbol)},
+		)
+	}
+
+	for _, e := range entries {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO ledger_entries (transaction_id, user_id, account_type, account_symbol, debit_amount, credit_amount, stock_quantity, description, reference_id)
+			VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8, @p9)
+		`, transactionID, p.UserID, e.account, e.symbol, e.debit, e.credit, e.quantity, e.description, p.ID.String())
+		if err != nil {
+			return uuid.Nil, fmt.Errorf("error creating reinvestment ledger entry: %w", err)
+		}
+	}
+	if err := checkBalanced(ctx, tx, transactionID); err != nil {
+		return uuid.Nil, err
+	}
+	return transactionID, nil
+}
@@ -0,0 +1,518 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"backend/auth"
+	"backend/database"
+	"backend/models"
+	"backend/telemetry"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// DividendService records dividends declared on stocks and pays users their
+// share of them
+type DividendService struct {
+	stockPriceService *StockPriceService
+	broker            Broker
+}
+
+func NewDividendService() *DividendService {
+	return &DividendService{
+		stockPriceService: NewStockPriceService(),
+		broker:            defaultBroker,
+	}
+}
+
+// CreateDividend declares a dividend. It is paid by the dividend job on its
+// pay date to everyone holding the stock at the start of the record date.
+func (s *DividendService) CreateDividend(ctx context.Context, req models.DividendRequest) (dividend *models.Dividend, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "DividendService.CreateDividend", attribute.String("stock_symbol", req.StockSymbol))
+	defer telemetry.EndSpan(span, &err)
+
+	recordDate, payDate := calendarDate(req.RecordDate), calendarDate(req.PayDate)
+	if payDate.Before(recordDate) {
+		return nil, fmt.Errorf("%w: pay_date must not be before record_date", ErrInvalidRequest)
+	}
+	if roundTo(req.AmountPerShare, amountPlaces) != req.AmountPerShare {
+		return nil, fmt.Errorf("%w: amount_per_share has more than %d decimal places", ErrInvalidRequest, amountPlaces)
+	}
+
+	var declared bool
+	err = database.DB.QueryRowContext(ctx,
+		"SELECT CASE WHEN EXISTS(SELECT 1 FROM dividends WHERE stock_symbol = @p1 AND record_date = @p2) THEN 1 ELSE 0 END",
+		req.StockSymbol, recordDate,
+	).Scan(&declared)
+	if err != nil {
+		return nil, fmt.Errorf("error checking dividend: %w", err)
+	}
+	if declared {
+		return nil, ErrDuplicateDividend
+	}
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	dividendID := uuid.New()
+	createdBy := auth.ActorFrom(ctx).ID
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO dividends (id, stock_symbol, amount_per_share, record_date, pay_date, status, created_by)
+		VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7)
+	`, dividendID, req.StockSymbol, req.AmountPerShare, recordDate, payDate, models.DividendStatusAnnounced, createdBy)
+	if err != nil {
+		return nil, fmt.Errorf("error creating dividend: %w", err)
+	}
+
+	err = recordAudit(ctx, tx, models.AuditDividendCreate, models.AuditEntityDividend, dividendID.String(), nil, map[string]interface{}{
+		"stock_symbol":     req.StockSymbol,
+		"amount_per_share": req.AmountPerShare,
+		"record_date":      recordDate.Format("2006-01-02"),
+		"pay_date":         payDate.Format("2006-01-02"),
+		"created_by":       createdBy,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"dividend_id":  dividendID,
+		"stock_symbol": req.StockSymbol,
+		"record_date":  recordDate.Format("2006-01-02"),
+	}).Info("Dividend declared")
+
+	return getDividend(ctx, dividendID)
+}
+
+// ListDividends returns every declared dividend, latest record date first
+func (s *DividendService) ListDividends(ctx context.Context) (dividends []models.Dividend, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "DividendService.ListDividends")
+	defer telemetry.EndSpan(span, &err)
+
+	rows, err := database.DB.QueryContext(ctx,
+		"SELECT "+dividendColumnList+" FROM dividends ORDER BY record_date DESC, created_at DESC",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying dividends: %w", err)
+	}
+	defer rows.Close()
+
+	dividends = []models.Dividend{}
+	for rows.Next() {
+		var d models.Dividend
+		if err := rows.Scan(dividendFields(&d)...); err != nil {
+			return nil, fmt.Errorf("error scanning dividend: %w", err)
+		}
+		dividends = append(dividends, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading dividends: %w", err)
+	}
+
+	return dividends, nil
+}
+
+// ListDividendPayments returns whether a user reinvests dividends and the
+// dividends paid to them, newest first
+func (s *DividendService) ListDividendPayments(ctx context.Context, userID uuid.UUID) (reinvest bool, payments []models.DividendPayment, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "DividendService.ListDividendPayments")
+	defer telemetry.EndSpan(span, &err)
+
+	err = database.DB.QueryRowContext(ctx, "SELECT dividend_reinvest FROM users WHERE id = @p1", userID).Scan(&reinvest)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil, ErrUserNotFound
+	}
+	if err != nil {
+		return false, nil, fmt.Errorf("error fetching dividend preference: %w", err)
+	}
+
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT `+dividendPaymentColumnList+`
+		FROM dividend_payments
+		WHERE user_id = @p1
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return false, nil, fmt.Errorf("error querying dividend payments: %w", err)
+	}
+	defer rows.Close()
+
+	payments = []models.DividendPayment{}
+	for rows.Next() {
+		var p models.DividendPayment
+		if err := rows.Scan(dividendPaymentFields(&p)...); err != nil {
+			return false, nil, fmt.Errorf("error scanning dividend payment: %w", err)
+		}
+		payments = append(payments, p)
+	}
+	if err := rows.Err(); err != nil {
+		return false, nil, fmt.Errorf("error reading dividend payments: %w", err)
+	}
+
+	return reinvest, payments, nil
+}
+
+// SetDividendPreference chooses whether a user's future dividends are
+// reinvested in the stock or credited to their wallet
+func (s *DividendService) SetDividendPreference(ctx context.Context, userID uuid.UUID, reinvest bool) (err error) {
+	ctx, span := telemetry.StartSpan(ctx, "DividendService.SetDividendPreference")
+	defer telemetry.EndSpan(span, &err)
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var before bool
+	err = tx.QueryRowContext(ctx, `
+		UPDATE users SET dividend_reinvest = @p1, updated_at = GETUTCDATE()
+		OUTPUT deleted.dividend_reinvest
+		WHERE id = @p2 AND deleted_at IS NULL
+	`, reinvest, userID).Scan(&before)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error updating dividend preference: %w", err)
+	}
+
+	err = recordAudit(ctx, tx, models.AuditDividendPreference, models.AuditEntityUser, userID.String(),
+		map[string]interface{}{"dividend_reinvest": before},
+		map[string]interface{}{"dividend_reinvest": reinvest},
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// PayDueDividends pays every announced dividend whose pay date has arrived.
+// A dividend is marked paid once every entitled user has been paid; users
+// that could not be paid are retried on the next run. It returns the number
+// of users paid.
+func (s *DividendService) PayDueDividends(ctx context.Context) (paid int, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "DividendService.PayDueDividends")
+	defer telemetry.EndSpan(span, &err)
+
+	today := calendarDate(startOfDayIST(time.Now()))
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT `+dividendColumnList+`
+		FROM dividends
+		WHERE status = @p1 AND pay_date <= @p2
+		ORDER BY pay_date, created_at
+	`, models.DividendStatusAnnounced, today)
+	if err != nil {
+		return 0, fmt.Errorf("error querying dividends due: %w", err)
+	}
+
+	var due []models.Dividend
+	for rows.Next() {
+		var d models.Dividend
+		if err := rows.Scan(dividendFields(&d)...); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("error scanning dividend due: %w", err)
+		}
+		due = append(due, d)
+	}
+	rows.Close()
+
+	for _, d := range due {
+		n, err := s.payDividend(ctx, d)
+		paid += n
+		if err != nil {
+			logrus.WithContext(ctx).WithError(err).WithField("dividend_id", d.ID).Error("Error paying dividend")
+		}
+	}
+
+	if paid > 0 {
+		logrus.WithContext(ctx).WithField("count", paid).Info("Paid dividends")
+	}
+
+	return paid, nil
+}
+
+// payDividend pays each user holding the stock at the start of the record
+// date who has not been paid yet, then marks the dividend paid if nobody is
+// left. With T+1 settlement the record date is also the ex-date, so shares
+// bought on it are not entitled and shares sold on it still are.
+func (s *DividendService) payDividend(ctx context.Context, d models.Dividend) (paid int, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "DividendService.payDividend", attribute.String("dividend_id", d.ID.String()))
+	defer telemetry.EndSpan(span, &err)
+
+	cutoff := time.Date(d.RecordDate.Year(), d.RecordDate.Month(), d.RecordDate.Day(), 0, 0, 0, 0, IST)
+	held, err := quantitiesHeldAt(ctx, d.StockSymbol, cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := database.DB.QueryContext(ctx, "SELECT user_id FROM dividend_payments WHERE dividend_id = @p1", d.ID)
+	if err != nil {
+		return 0, fmt.Errorf("error querying dividend payments: %w", err)
+	}
+	for rows.Next() {
+		var userID uuid.UUID
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("error scanning dividend payment: %w", err)
+		}
+		delete(held, userID)
+	}
+	rows.Close()
+
+	var failed int
+	for userID, quantity := range held {
+		if err := s.payUser(ctx, d, userID, quantity); err != nil {
+			logrus.WithContext(ctx).WithError(err).WithFields(logrus.Fields{
+				"dividend_id": d.ID,
+				"user_id":     userID,
+			}).Warn("Dividend not paid to user, will retry")
+			failed++
+			continue
+		}
+		paid++
+	}
+	if failed > 0 {
+		return paid, fmt.Errorf("%d of %d users not paid", failed, len(held))
+	}
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return paid, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Guard on the status so a dividend is completed only once
+	result, err := tx.ExecContext(ctx, `
+		UPDATE dividends SET status = @p1, paid_at = GETUTCDATE(), updated_at = GETUTCDATE()
+		WHERE id = @p2 AND status = @p3
+	`, models.DividendStatusPaid, d.ID, models.DividendStatusAnnounced)
+	if err != nil {
+		return paid, fmt.Errorf("error completing dividend: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return paid, nil
+	}
+
+	err = recordAudit(ctx, tx, models.AuditDividendComplete, models.AuditEntityDividend, d.ID.String(),
+		map[string]interface{}{"status": models.DividendStatusAnnounced},
+		map[string]interface{}{"status": models.DividendStatusPaid},
+	)
+	if err != nil {
+		return paid, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return paid, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return paid, nil
+}
+
+// payUser pays one user's share of a dividend. TDS is withheld once the
+// user's dividends from the stock this financial year pass the threshold.
+// The rest is credited to the wallet, or, if the user reinvests, held for a
+// buy order sized from the stored price, which must not be stale. The order
+// is followed by ProcessPendingReinvestments, which books the shares it buys.
+func (s *DividendService) payUser(ctx context.Context, d models.Dividend, userID uuid.UUID, quantity float64) (err error) {
+	ctx, span := telemetry.StartSpan(ctx, "DividendService.payUser")
+	defer telemetry.EndSpan(span, &err)
+
+	var price *models.StockPrice
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the user so the year's TDS total can't be read by two payments at once
+	var reinvest bool
+	err = tx.QueryRowContext(ctx,
+		"SELECT dividend_reinvest FROM users WITH (UPDLOCK, ROWLOCK) WHERE id = @p1", userID,
+	).Scan(&reinvest)
+	if err != nil {
+		return fmt.Errorf("error locking user: %w", err)
+	}
+	if reinvest {
+		price, err = s.stockPriceService.GetLastKnownPrice(ctx, d.StockSymbol)
+		if err != nil {
+			return err
+		}
+		if price.IsStale {
+			return ErrStalePrice
+		}
+	}
+
+	fyStart := financialYearStart(d.PayDate)
+	var paidThisYear float64
+	err = tx.QueryRowContext(ctx, `
+		SELECT ISNULL(SUM(p.gross_amount), 0)
+		FROM dividend_payments p
+		JOIN dividends d ON d.id = p.dividend_id
+		WHERE p.user_id = @p1 AND p.stock_symbol = @p2 AND d.pay_date >= @p3 AND d.pay_date < @p4
+	`, userID, d.StockSymbol, fyStart, fyStart.AddDate(1, 0, 0)).Scan(&paidThisYear)
+	if err != nil {
+		return fmt.Errorf("error fetching dividends paid this year: %w", err)
+	}
+
+	gross := roundTo(quantity*d.AmountPerShare, amountPlaces)
+	tds := CurrentDividendOptions().tds(gross, paidThisYear)
+	p := &models.DividendPayment{
+		ID:               uuid.New(),
+		DividendID:       d.ID,
+		UserID:           userID,
+		StockSymbol:      d.StockSymbol,
+		EntitledQuantity: quantity,
+		GrossAmount:      gross,
+		TDSAmount:        tds,
+		NetAmount:        roundTo(gross-tds, amountPlaces),
+		Mode:             models.DividendModeWallet,
+	}
+	var orderQuantity float64
+	if price != nil {
+		orderQuantity = reinvestQuantity(p.NetAmount, price.Price, CurrentFeeSchedule())
+	}
+	// Amounts too small to buy a millionth of a share go to the wallet instead
+	if orderQuantity > 0 {
+		orderID := uuid.New()
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO broker_orders (id, broker, stock_symbol, side, quantity, status)
+			VALUES (@p1, @p2, @p3, @p4, @p5, @p6)
+		`, orderID, s.broker.Name(), d.StockSymbol, models.OrderSideBuy, orderQuantity, models.OrderStatusNew)
+		if err != nil {
+			return fmt.Errorf("error recording reinvestment order: %w", err)
+		}
+		p.Mode = models.DividendModeReinvest
+		p.OrderID = &orderID
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO dividend_payments (id, dividend_id, user_id, stock_symbol, entitled_quantity, gross_amount, tds_amount,
+			net_amount, mode, order_id)
+		VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8, @p9, @p10)
+	`, p.ID, d.ID, userID, d.StockSymbol, p.EntitledQuantity, p.GrossAmount, p.TDSAmount,
+		p.NetAmount, p.Mode, p.OrderID)
+	if err != nil {
+		return fmt.Errorf("error creating dividend payment: %w", err)
+	}
+
+	transactionID, err := postDividend(ctx, tx, p, d.AmountPerShare)
+	if err != nil {
+		return err
+	}
+
+	err = recordAudit(ctx, tx, models.AuditDividendPay, models.AuditEntityDividend, d.ID.String(), nil, map[string]interface{}{
+		"dividend_payment_id": p.ID,
+		"user_id":             userID,
+		"entitled_quantity":   p.EntitledQuantity,
+		"gross_amount":        p.GrossAmount,
+		"tds_amount":          p.TDSAmount,
+		"net_amount":          p.NetAmount,
+		"mode":                p.Mode,
+		"order_id":            p.OrderID,
+		"transaction_id":      transactionID,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	// The job retries the order if it can't be placed now
+	if p.Mode == models.DividendModeReinvest {
+		if err := s.advanceReinvestment(ctx, p.ID); err != nil {
+			logrus.WithContext(ctx).WithError(err).WithField("dividend_payment_id", p.ID).Warn("Reinvestment order not completed, will retry")
+		}
+	}
+	return nil
+}
+
+// postDividend writes a dividend payment's ledger entries and returns their
+// transaction ID. The gross dividend comes into cash and the TDS withheld is
+// owed to the tax department. The rest is owed to the user in their wallet,
+// or, when reinvested, held in dividends_reinvested until the buy order is
+// final, see postReinvestment.
+func postDividend(ctx context.Context, tx *sql.Tx, p *models.DividendPayment, amountPerShare float64) (uuid.UUID, error) {
+	transactionID := uuid.New()
+	type entry struct {
+		account, symbol string
+		debit, credit   float64
+		quantity        float64
+		description     string
+	}
+	entries := []entry{
+		{"cash", "", p.GrossAmount, 0, 0, fmt.Sprintf("Dividend received: %s x %.6f @ %.4f", p.StockSymbol, p.EntitledQuantity, amountPerShare)},
+	}
+	if p.TDSAmount > 0 {
+		entries = append(entries, entry{"tds_payable", "", 0, p.TDSAmount, 0, fmt.Sprintf("TDS on dividend from %s", p.StockSymbol)})
+	}
+	if p.Mode == models.DividendModeReinvest {
+		entries = append(entries, entry{"dividends_reinvested", "", 0, p.NetAmount, 0, fmt.Sprintf("Dividend from %s held for reinvestment", p.StockSymbol)})
+	} else {
+		entries = append(entries, entry{"user_wallet", "", 0, p.NetAmount, 0, fmt.Sprintf("Dividend from %s", p.StockSymbol)})
+	}
+
+	for _, e := range entries {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO ledger_entries (transaction_id, user_id, account_type, account_symbol, debit_amount, credit_amount, stock_quantity, description, reference_id)
+			VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8, @p9)
+		`, transactionID, p.UserID, e.account, e.symbol, e.debit, e.credit, e.quantity, e.description, p.ID.String())
+		if err != nil {
+			return uuid.Nil, fmt.Errorf("error creating dividend ledger entry: %w", err)
+		}
+	}
+	return transactionID, nil
+}
+
+// dividendColumnList selects a dividends row, scanned with dividendFields
+const dividendColumnList = "id, stock_symbol, amount_per_share, record_date, pay_date, status, paid_at, created_by, created_at, updated_at"
+
+// dividendFields returns scan destinations matching dividendColumnList
+func dividendFields(d *models.Dividend) []interface{} {
+	return []interface{}{
+		&d.ID, &d.StockSymbol, &d.AmountPerShare, &d.RecordDate, &d.PayDate, &d.Status, &d.PaidAt, &d.CreatedBy, &d.CreatedAt, &d.UpdatedAt,
+	}
+}
+
+// getDividend loads a dividend by ID
+func getDividend(ctx context.Context, dividendID uuid.UUID) (*models.Dividend, error) {
+	var d models.Dividend
+	err := database.DB.QueryRowContext(ctx,
+		"SELECT "+dividendColumnList+" FROM dividends WHERE id = @p1", dividendID,
+	).Scan(dividendFields(&d)...)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching dividend: %w", err)
+	}
+	return &d, nil
+}
+
+// dividendPaymentColumnList selects a dividend_payments row, scanned with dividendPaymentFields
+const dividendPaymentColumnList = `id, dividend_id, user_id, stock_symbol, entitled_quantity, gross_amount, tds_amount,
+	net_amount, mode, order_id, reinvest_price, reinvested_quantity, trade_date, settlement_date, settled_at, created_at`
+
+// dividendPaymentFields returns scan destinations matching dividendPaymentColumnList
+func dividendPaymentFields(p *models.DividendPayment) []interface{} {
+	return []interface{}{
+		&p.ID, &p.DividendID, &p.UserID, &p.StockSymbol, &p.EntitledQuantity, &p.GrossAmount, &p.TDSAmount,
+		&p.NetAmount, &p.Mode, &p.OrderID, &p.ReinvestPrice, &p.ReinvestedQuantity, &p.TradeDate, &p.SettlementDate, &p.SettledAt, &p.CreatedAt,
+	}
+}
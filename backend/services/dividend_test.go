@@ -0,0 +1,81 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDividendOptionsTDS(t *testing.T) {
+	o := DividendOptions{TDSRate: 0.10, TDSThreshold: 10000}
+
+	tests := []struct {
+		name         string
+		gross        float64
+		paidThisYear float64
+		want         float64
+	}{
+		{"well below the threshold", 500, 0, 0},
+		{"reaching the threshold exactly", 100, 9900, 0},
+		{"crossing the threshold withholds on the whole payment", 500, 9800, 50},
+		{"a paisa over the threshold", 100.01, 9900, 10.001},
+		{"already above the threshold", 100, 12000, 10},
+		{"rounded to 4 places", 123.45678, 10000, 12.3457},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := o.tds(tt.gross, tt.paidThisYear); got != tt.want {
+				t.Errorf("tds(%v, %v) = %v, want %v", tt.gross, tt.paidThisYear, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFinancialYearStart(t *testing.T) {
+	tests := []struct {
+		date time.Time
+		want time.Time
+	}{
+		{date(2024, time.March, 31), date(2023, time.April, 1)},
+		{date(2024, time.April, 1), date(2024, time.April, 1)},
+		{date(2024, time.January, 1), date(2023, time.April, 1)},
+		{date(2024, time.December, 31), date(2024, time.April, 1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.date.Format("2006-01-02"), func(t *testing.T) {
+			if got := financialYearStart(tt.date); !got.Equal(tt.want) {
+				t.Errorf("financialYearStart = %s, want %s", got.Format("2006-01-02"), tt.want.Format("2006-01-02"))
+			}
+		})
+	}
+}
+
+func TestReinvestQuantity(t *testing.T) {
+	tests := []struct {
+		name  string
+		net   float64
+		price float64
+		fees  FeeSchedule
+		want  float64
+	}{
+		{"leaves room for the margin and fees", 1000, 100, DefaultFeeSchedule(), 9.886851},
+		{"no fees leaves room for the margin only", 1000, 100, FeeSchedule{}, 9.90099},
+		{"rounds down to a millionth", 10, 2500, DefaultFeeSchedule(), 0.003954},
+		{"too little for a millionth of a share", 0.001, 3500, DefaultFeeSchedule(), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := reinvestQuantity(tt.net, tt.price, tt.fees)
+			if got != tt.want {
+				t.Errorf("reinvestQuantity(%v, %v) = %v, want %v", tt.net, tt.price, got, tt.want)
+			}
+			gross := got * tt.price * (1 + reinvestPriceMargin)
+			brokerage, stt, gst := tt.fees.Calculate(gross)
+			if cost := gross + brokerage + stt + gst; cost > tt.net {
+				t.Errorf("filling at the margin costs %v, more than %v", cost, tt.net)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package services
+
+import "errors"
+
+// Domain errors returned by the services. Callers match them with errors.Is;
+// the wrapped messages around them are for logs only.
+var (
+	// ErrInvalidRequest is returned when request fields fail validation
+	ErrInvalidRequest = errors.New("invalid request")
+	// ErrUserNotFound is returned when the user does not exist or was deleted
+	ErrUserNotFound = errors.New("user not found")
+	// ErrDuplicateReference is returned when a reward already uses the reference_id
+	ErrDuplicateReference = errors.New("duplicate reward event: reference_id already exists")
+	// ErrUnknownSymbol is returned when the price provider does not list a stock symbol
+	ErrUnknownSymbol = errors.New("unknown stock symbol")
+	// ErrPriceNotFound is returned when no price has ever been stored for a symbol
+	ErrPriceNotFound = errors.New("no stored price for stock symbol")
+	// ErrStalePrice is returned when the stored price is too old for the requested use
+	ErrStalePrice = errors.New("stock price is stale")
+	// ErrPriceUnavailable is returned when the price provider could not be reached
+	ErrPriceUnavailable = errors.New("stock price unavailable")
+	// ErrRewardLimitExceeded is matched by every *RuleViolation
+	ErrRewardLimitExceeded = errors.New("reward limit exceeded")
+	// ErrReviewNotFound is returned when no reward review has the given ID
+	ErrReviewNotFound = errors.New("reward review not found")
+	// ErrReviewDecided is returned when a review has already been approved or rejected
+	ErrReviewDecided = errors.New("reward review already decided")
+	// ErrRewardNotFound is returned when no reward has the given ID
+	ErrRewardNotFound = errors.New("reward not found")
+	// ErrRewardNotPendingApproval is returned when approving or rejecting a reward that is not waiting for approval
+	ErrRewardNotPendingApproval = errors.New("reward is not pending approval")
+	// ErrSelfApproval is returned when the actor who created a reward tries to approve or reject it
+	ErrSelfApproval = errors.New("reward must be decided by someone other than its creator")
+	// ErrUnknownMaker is returned when deciding a reward entered by hand whose creator is unknown or anonymous
+	ErrUnknownMaker = errors.New("reward has no authenticated creator")
+	// ErrDematAccountNotFound is returned when the user has no demat account with the given ID
+	ErrDematAccountNotFound = errors.New("demat account not found")
+	// ErrDuplicateDematAccount is returned when the user already registered the same DP ID and client ID
+	ErrDuplicateDematAccount = errors.New("demat account already registered")
+	// ErrDematAccountDecided is returned when a demat account has already been verified or rejected
+	ErrDematAccountDecided = errors.New("demat account already verified or rejected")
+	// ErrDematAccountNotVerified is returned when withdrawing to a demat account that is not verified
+	ErrDematAccountNotVerified = errors.New("demat account not verified")
+	// ErrInsufficientShares is returned when a withdrawal or redemption asks for more shares than are free
+	ErrInsufficientShares = errors.New("not enough free shares")
+	// ErrWithdrawalNotFound is returned when no withdrawal has the given ID
+	ErrWithdrawalNotFound = errors.New("withdrawal not found")
+	// ErrWithdrawalStatus is returned when a withdrawal is not in the status the change needs
+	ErrWithdrawalStatus = errors.New("withdrawal status does not allow this change")
+	// ErrUnknownOrder is returned by a Broker that has no record of a broker order ID
+	ErrUnknownOrder = errors.New("unknown broker order")
+	// ErrSaleFailed is returned when a redemption's sell order ended without selling any shares
+	ErrSaleFailed = errors.New("sell order did not fill")
+	// ErrBankAccountNotFound is returned when the user has no bank account with the given ID
+	ErrBankAccountNotFound = errors.New("bank account not found")
+	// ErrDuplicateBankAccount is returned when the user already registered the same account number and IFSC
+	ErrDuplicateBankAccount = errors.New("bank account already registered")
+	// ErrBankAccountDecided is returned when a bank account has already been verified or rejected
+	ErrBankAccountDecided = errors.New("bank account already verified or rejected")
+	// ErrBankAccountNotVerified is returned when paying out to a bank account that is not verified
+	ErrBankAccountNotVerified = errors.New("bank account not verified")
+	// ErrUnknownTransfer is returned by a Bank that has no record of a transfer reference
+	ErrUnknownTransfer = errors.New("unknown bank transfer")
+	// ErrInsufficientBalance is returned when a payout asks for more than the wallet holds
+	ErrInsufficientBalance = errors.New("not enough wallet balance")
+	// ErrDuplicateDividend is returned when a dividend on the stock with the same record date exists
+	ErrDuplicateDividend = errors.New("dividend already declared")
+)
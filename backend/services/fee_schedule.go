@@ -0,0 +1,83 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// FeeSchedule holds the charges booked against each reward and redemption, as fractions
+type FeeSchedule struct {
+	// BrokerageRate is charged on the gross value of the shares
+	BrokerageRate float64 `json:"brokerage_rate"`
+	// STTRate (securities transaction tax) is charged on the gross value
+	STTRate float64 `json:"stt_rate"`
+	// GSTRate is charged on the brokerage
+	GSTRate float64 `json:"gst_rate"`
+	// SellSTTRate is the STT charged instead of STTRate on the gross value of shares sold
+	SellSTTRate float64 `json:"sell_stt_rate"`
+}
+
+// DefaultFeeSchedule is 0.1% brokerage, 0.025% STT and 18% GST on brokerage,
+// with 0.1% STT on sales
+func DefaultFeeSchedule() FeeSchedule {
+	return FeeSchedule{
+		BrokerageRate: 0.001,
+		STTRate:       0.00025,
+		GSTRate:       0.18,
+		SellSTTRate:   0.001,
+	}
+}
+
+// LoadFeeSchedule reads a fee schedule from a JSON file. Rates missing from
+// the file keep their default values.
+func LoadFeeSchedule(path string) (FeeSchedule, error) {
+	schedule := DefaultFeeSchedule()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return schedule, fmt.Errorf("error reading fee schedule: %w", err)
+	}
+	if err := json.Unmarshal(data, &schedule); err != nil {
+		return schedule, fmt.Errorf("error parsing fee schedule %s: %w", path, err)
+	}
+
+	return schedule, nil
+}
+
+// Validate checks that every rate is a fraction between 0 and 1
+func (f FeeSchedule) Validate() error {
+	rates := []struct {
+		name string
+		rate float64
+	}{
+		{"brokerage_rate", f.BrokerageRate},
+		{"stt_rate", f.STTRate},
+		{"gst_rate", f.GSTRate},
+		{"sell_stt_rate", f.SellSTTRate},
+	}
+	for _, r := range rates {
+		if r.rate < 0 || r.rate >= 1 {
+			return fmt.Errorf("%s must be in [0, 1), got %v", r.name, r.rate)
+		}
+	}
+	return nil
+}
+
+// Calculate returns the fees on shares worth grossValue
+func (f FeeSchedule) Calculate(grossValue float64) (brokerage, stt, gst float64) {
+	brokerage = grossValue * f.BrokerageRate
+	stt = grossValue * f.STTRate
+	gst = brokerage * f.GSTRate
+	return brokerage, stt, gst
+}
+
+// CalculateSell returns the fees on selling shares worth grossValue
+func (f FeeSchedule) CalculateSell(grossValue float64) OrderFees {
+	brokerage := grossValue * f.BrokerageRate
+	return OrderFees{
+		Brokerage: brokerage,
+		STT:       grossValue * f.SellSTTRate,
+		GST:       brokerage * f.GSTRate,
+	}
+}
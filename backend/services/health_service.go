@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"backend/database"
+	"backend/models"
+)
+
+const (
+	// healthCheckTimeout bounds each dependency probe so a hung database
+	// cannot stall the readiness endpoint
+	healthCheckTimeout = 2 * time.Second
+	// dbLatencyWarn is the ping latency above which the database check warns
+	dbLatencyWarn = 500 * time.Millisecond
+)
+
+type HealthService struct{}
+
+func NewHealthService() *HealthService {
+	return &HealthService{}
+}
+
+// CheckReadiness runs every readiness check and summarises them.
+// The database and schema version are critical; a stale price refresh is
+// reported but does not fail readiness, since every instance shares the same
+// price feed and taking them all out of rotation would not help. The
+// staleness policy's FailReadiness makes it critical for deployments that
+// would rather serve nothing than stale prices.
+func (s *HealthService) CheckReadiness(ctx context.Context) *models.ReadinessReport {
+	report := &models.ReadinessReport{
+		Status:    models.HealthPass,
+		CheckedAt: time.Now().UTC(),
+		Checks: []models.HealthCheck{
+			s.checkDatabase(ctx),
+			s.checkSchemaVersion(ctx),
+			s.checkPriceRefresh(ctx),
+		},
+	}
+
+	for _, check := range report.Checks {
+		switch {
+		case check.Status == models.HealthFail && check.Critical:
+			report.Status = models.HealthFail
+		case check.Status != models.HealthPass && report.Status == models.HealthPass:
+			report.Status = models.HealthWarn
+		}
+	}
+
+	return report
+}
+
+// checkDatabase pings the database and reports the round trip
+func (s *HealthService) checkDatabase(ctx context.Context) models.HealthCheck {
+	check := models.HealthCheck{Name: "database", Critical: true}
+
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := database.DB.PingContext(ctx)
+	latency := time.Since(start)
+	check.LatencyMs = durationMs(latency)
+
+	switch {
+	case err != nil:
+		check.Status = models.HealthFail
+		check.Message = "database unreachable"
+	case latency > dbLatencyWarn:
+		check.Status = models.HealthWarn
+		check.Message = fmt.Sprintf("ping slower than %s", dbLatencyWarn)
+	default:
+		check.Status = models.HealthPass
+	}
+
+	stats := database.DB.Stats()
+	check.Details = map[string]interface{}{
+		"open_connections": stats.OpenConnections,
+		"in_use":           stats.InUse,
+		"idle":             stats.Idle,
+	}
+	return check
+}
+
+// checkSchemaVersion compares the recorded schema version with the one this
+// binary was built against
+func (s *HealthService) checkSchemaVersion(ctx context.Context) models.HealthCheck {
+	check := models.HealthCheck{Name: "migrations", Critical: true}
+
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	applied, err := database.AppliedSchemaVersion(ctx)
+	check.LatencyMs = durationMs(time.Since(start))
+	if err != nil {
+		check.Status = models.HealthFail
+		check.Message = "schema version unavailable"
+		return check
+	}
+
+	check.Details = map[string]interface{}{
+		"applied_version":  applied,
+		"expected_version": database.SchemaVersion,
+	}
+	if applied < database.SchemaVersion {
+		check.Status = models.HealthFail
+		check.Message = "database schema is behind this release"
+		return check
+	}
+
+	check.Status = models.HealthPass
+	return check
+}
+
+// checkPriceRefresh reports the age of the last refresh that stored prices.
+// Age is judged by the staleness policy, so a refresh at Friday's close still
+// passes over the weekend.
+func (s *HealthService) checkPriceRefresh(ctx context.Context) models.HealthCheck {
+	check := models.HealthCheck{Name: "price_refresh", Critical: CurrentStalenessPolicy().FailReadiness}
+
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	var finishedAt sql.NullTime
+	// Partial runs still stored prices for the symbols that did fetch
+	err := database.DB.QueryRowContext(ctx, `
+		SELECT MAX(finished_at) FROM price_refresh_runs
+		WHERE status IN (@p1, @p2)
+	`, models.PriceRefreshSucceeded, models.PriceRefreshPartial).Scan(&finishedAt)
+	check.LatencyMs = durationMs(time.Since(start))
+	if err != nil {
+		check.Status = models.HealthFail
+		check.Message = "price refresh history unavailable"
+		return check
+	}
+	// A fresh database has no history until the first run, which may not come
+	// until the market opens
+	if !finishedAt.Valid {
+		check.Status = models.HealthWarn
+		check.Message = "no successful price refresh recorded"
+		return check
+	}
+
+	now := time.Now().UTC()
+	check.Details = map[string]interface{}{
+		"last_success": finishedAt.Time.UTC(),
+		"age_seconds":  int64(now.Sub(finishedAt.Time).Seconds()),
+	}
+	if CurrentStalenessPolicy().IsStale(finishedAt.Time, now) {
+		check.Status = models.HealthFail
+		check.Message = "prices have not refreshed within the staleness threshold"
+		return check
+	}
+
+	check.Status = models.HealthPass
+	return check
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/google/uuid"
+)
+
+// lockedHolding is a user's holding of one stock, read under an update lock
+// so shares can be taken out of it without racing another request
+type lockedHolding struct {
+	userID   uuid.UUID
+	symbol   string
+	quantity float64
+	settled  float64
+	unvested float64
+}
+
+// lockHolding reads and locks a holding in tx. A missing holding has no
+// shares to take, so it is reported as ErrInsufficientShares.
+func lockHolding(ctx context.Context, tx *sql.Tx, userID uuid.UUID, symbol string) (*lockedHolding, error) {
+	h := &lockedHolding{userID: userID, symbol: symbol}
+	err := tx.QueryRowContext(ctx, `
+		SELECT quantity, settled_quantity, unvested_quantity
+		FROM user_holdings WITH (UPDLOCK, ROWLOCK)
+		WHERE user_id = @p1 AND stock_symbol = @p2
+	`, userID, symbol).Scan(&h.quantity, &h.settled, &h.unvested)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: no holding of %s", ErrInsufficientShares, symbol)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading holding: %w", err)
+	}
+	return h, nil
+}
+
+// free returns the shares that have settled, vested and passed any lock-in,
+// given the vested shares still locked in
+func (h *lockedHolding) free(lockedIn float64) float64 {
+	free := math.Min(h.settled, h.quantity-h.unvested-lockedIn)
+	if free <= 0 {
+		return 0
+	}
+	return roundTo(free, quantityPlaces)
+}
+
+// inventoryCost returns the stock inventory cost of quantity shares: their
+// share of the cost posted for the holding's vested shares
+func (h *lockedHolding) inventoryCost(ctx context.Context, tx *sql.Tx, quantity float64) (float64, error) {
+	var inventoryValue sql.NullFloat64
+	err := tx.QueryRowContext(ctx, `
+		SELECT SUM(debit_amount - credit_amount)
+		FROM ledger_entries
+		WHERE user_id = @p1 AND account_type = 'stock_inventory' AND account_symbol = @p2
+	`, h.userID, h.symbol).Scan(&inventoryValue)
+	if err != nil {
+		return 0, fmt.Errorf("error reading stock inventory value: %w", err)
+	}
+	return roundTo(inventoryValue.Float64*quantity/(h.quantity-h.unvested), amountPlaces), nil
+}
+
+// take removes quantity settled shares from the holding and returns the
+// quantity held before and after
+func (h *lockedHolding) take(ctx context.Context, tx *sql.Tx, quantity float64) (before, after float64, err error) {
+	err = tx.QueryRowContext(ctx, `
+		UPDATE user_holdings
+		SET quantity = quantity - @p1, settled_quantity = settled_quantity - @p1, updated_at = GETUTCDATE(), last_updated = GETUTCDATE()
+		OUTPUT deleted.quantity, inserted.quantity
+		WHERE user_id = @p2 AND stock_symbol = @p3
+	`, quantity, h.userID, h.symbol).Scan(&before, &after)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error taking shares from holding: %w", err)
+	}
+	return before, after, nil
+}
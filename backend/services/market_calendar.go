@@ -0,0 +1,169 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// IST is Indian Standard Time. India has no daylight saving, so a fixed zone
+// avoids depending on the host's tzdata.
+var IST = time.FixedZone("IST", 5*60*60+30*60)
+
+const (
+	// NSE equity normal market session, in minutes after midnight IST
+	defaultSessionOpen  = 9*60 + 15
+	defaultSessionClose = 15*60 + 30
+)
+
+// MarketCalendar knows which days the exchange trades and when the session runs
+type MarketCalendar struct {
+	holidays     map[string]string // "2006-01-02" -> holiday name
+	sessionOpen  time.Duration
+	sessionClose time.Duration
+}
+
+// NewMarketCalendar returns a calendar with NSE session times and the given holidays
+func NewMarketCalendar(holidays map[string]string) *MarketCalendar {
+	if holidays == nil {
+		holidays = make(map[string]string)
+	}
+	return &MarketCalendar{
+		holidays:     holidays,
+		sessionOpen:  defaultSessionOpen * time.Minute,
+		sessionClose: defaultSessionClose * time.Minute,
+	}
+}
+
+// LoadMarketCalendar reads a holiday file with one "YYYY-MM-DD Name" per line.
+// Blank lines and lines starting with # are ignored.
+func LoadMarketCalendar(path string) (*MarketCalendar, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening holiday file: %w", err)
+	}
+	defer file.Close()
+
+	holidays := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		dateStr, name, _ := strings.Cut(line, " ")
+		if _, err := time.Parse("2006-01-02", dateStr); err != nil {
+			return nil, fmt.Errorf("invalid date on line %d of %s: %w", lineNo, path, err)
+		}
+		holidays[dateStr] = strings.TrimSpace(name)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading holiday file: %w", err)
+	}
+
+	return NewMarketCalendar(holidays), nil
+}
+
+// HolidayCount returns the number of holidays loaded
+func (c *MarketCalendar) HolidayCount() int {
+	return len(c.holidays)
+}
+
+// IsTradingDay reports whether the IST calendar day containing t is a trading day
+func (c *MarketCalendar) IsTradingDay(t time.Time) bool {
+	local := t.In(IST)
+	if local.Weekday() == time.Saturday || local.Weekday() == time.Sunday {
+		return false
+	}
+	_, holiday := c.holidays[local.Format("2006-01-02")]
+	return !holiday
+}
+
+// IsSessionOpen reports whether the market is trading at t
+func (c *MarketCalendar) IsSessionOpen(t time.Time) bool {
+	if !c.IsTradingDay(t) {
+		return false
+	}
+	return !t.Before(c.SessionOpen(t)) && t.Before(c.SessionClose(t))
+}
+
+// SessionOpen returns the session start on the IST day containing t
+func (c *MarketCalendar) SessionOpen(t time.Time) time.Time {
+	return startOfDayIST(t).Add(c.sessionOpen)
+}
+
+// SessionClose returns the session end on the IST day containing t
+func (c *MarketCalendar) SessionClose(t time.Time) time.Time {
+	return startOfDayIST(t).Add(c.sessionClose)
+}
+
+// TradingDayOnOrBefore returns the latest trading day on or before the IST day containing t.
+// The result is midnight UTC of that calendar date, matching how price_date is stored.
+func (c *MarketCalendar) TradingDayOnOrBefore(t time.Time) time.Time {
+	day := startOfDayIST(t)
+	for !c.IsTradingDay(day) {
+		day = day.AddDate(0, 0, -1)
+	}
+	return calendarDate(day)
+}
+
+// TradeDate returns the trading day an execution at t belongs to: the IST day
+// of t if it is a trading day and before the close, otherwise the next trading
+// day. The result is midnight UTC of that calendar date.
+func (c *MarketCalendar) TradeDate(t time.Time) time.Time {
+	day := startOfDayIST(t)
+	if c.IsTradingDay(day) && t.Before(c.SessionClose(day)) {
+		return calendarDate(day)
+	}
+	return c.AddTradingDays(calendarDate(day), 1)
+}
+
+// AddTradingDays returns the calendar date n trading days after date, so a
+// trade on date settles on AddTradingDays(date, 1) under T+1
+func (c *MarketCalendar) AddTradingDays(date time.Time, n int) time.Time {
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, IST)
+	for n > 0 {
+		day = day.AddDate(0, 0, 1)
+		if c.IsTradingDay(day) {
+			n--
+		}
+	}
+	return calendarDate(day)
+}
+
+// LastSessionClose returns the most recent session close at or before t
+func (c *MarketCalendar) LastSessionClose(t time.Time) time.Time {
+	day := startOfDayIST(t)
+	if c.IsTradingDay(day) && !t.Before(c.SessionClose(day)) {
+		return c.SessionClose(day)
+	}
+	for {
+		day = day.AddDate(0, 0, -1)
+		if c.IsTradingDay(day) {
+			return c.SessionClose(day)
+		}
+	}
+}
+
+// PriceReferenceTime is the instant a price's age is measured against.
+// While the market is closed nothing trades, so the last close is as fresh as it gets.
+func (c *MarketCalendar) PriceReferenceTime(now time.Time) time.Time {
+	if c.IsSessionOpen(now) {
+		return now
+	}
+	return c.LastSessionClose(now)
+}
+
+func startOfDayIST(t time.Time) time.Time {
+	local := t.In(IST)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, IST)
+}
+
+func calendarDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
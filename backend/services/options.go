@@ -0,0 +1,129 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Options are the deployment settings the services read while serving.
+// config builds them and main installs them with Configure before any
+// request or background job runs.
+type Options struct {
+	Calendar     *MarketCalendar
+	Staleness    StalenessPolicy
+	PriceRefresh PriceRefreshOptions
+	Fees         FeeSchedule
+	RewardRules  RewardRules
+	Orders       OrderOptions
+	Depository   DepositoryOptions
+	Dividends    DividendOptions
+	Tax          TaxOptions
+}
+
+// DefaultOptions are the settings used when nothing is configured: an
+// exchange calendar without holidays and each setting's own default
+func DefaultOptions() Options {
+	return Options{
+		Calendar:     NewMarketCalendar(nil),
+		Staleness:    DefaultStalenessPolicy(),
+		PriceRefresh: DefaultPriceRefreshOptions(),
+		Fees:         DefaultFeeSchedule(),
+		RewardRules:  DefaultRewardRules(),
+		Orders:       DefaultOrderOptions(),
+		Depository:   DefaultDepositoryOptions(),
+		Dividends:    DefaultDividendOptions(),
+		Tax:          DefaultTaxOptions(),
+	}
+}
+
+// Validate checks every setting and reports all the problems found
+func (o Options) Validate() error {
+	var errs []error
+	if o.Calendar == nil {
+		errs = append(errs, errors.New("market calendar is required"))
+	}
+	if err := o.Staleness.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("staleness policy: %w", err))
+	}
+	if err := o.PriceRefresh.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("price refresh: %w", err))
+	}
+	if err := o.Fees.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("fee schedule: %w", err))
+	}
+	if err := o.RewardRules.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("reward rules: %w", err))
+	}
+	if err := o.Orders.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("orders: %w", err))
+	}
+	if err := o.Depository.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("depository: %w", err))
+	}
+	if err := o.Dividends.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("dividends: %w", err))
+	}
+	if err := o.Tax.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("tax: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// options are read without locking, which is why Configure may only run
+// before the server and jobs start
+var options = DefaultOptions()
+
+// Configure validates o and installs it for every service, before the server
+// and jobs start
+func Configure(o Options) error {
+	if err := o.Validate(); err != nil {
+		return err
+	}
+	options = o
+	return nil
+}
+
+// CurrentMarketCalendar returns the calendar in effect
+func CurrentMarketCalendar() *MarketCalendar {
+	return options.Calendar
+}
+
+// CurrentStalenessPolicy returns the policy in effect
+func CurrentStalenessPolicy() StalenessPolicy {
+	return options.Staleness
+}
+
+// CurrentPriceRefreshOptions returns the refresh options in effect
+func CurrentPriceRefreshOptions() PriceRefreshOptions {
+	return options.PriceRefresh
+}
+
+// CurrentFeeSchedule returns the schedule in effect
+func CurrentFeeSchedule() FeeSchedule {
+	return options.Fees
+}
+
+// CurrentRewardRules returns the rules in effect
+func CurrentRewardRules() RewardRules {
+	return options.RewardRules
+}
+
+// CurrentOrderOptions returns the options in effect
+func CurrentOrderOptions() OrderOptions {
+	return options.Orders
+}
+
+// CurrentDepositoryOptions returns the options in effect
+func CurrentDepositoryOptions() DepositoryOptions {
+	return options.Depository
+}
+
+// CurrentDividendOptions returns the options in effect
+func CurrentDividendOptions() DividendOptions {
+	return options.Dividends
+}
+
+// CurrentTaxOptions returns the options in effect
+func CurrentTaxOptions() TaxOptions {
+	return options.Tax
+}
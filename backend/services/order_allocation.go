@@ -0,0 +1,67 @@
+package services
+
+import "math"
+
+// Quantities are stored to 6 decimal places and INR amounts to 4
+const (
+	quantityPlaces = 6
+	amountPlaces   = 4
+)
+
+// allocateFill splits an aggregate order's fill across the rewards in it, in
+// proportion to the quantity each requested. Every share gets the order's
+// average price. Quantities and fees are rounded to their stored precision and
+// the last share absorbs the rounding, so the shares always sum to the fill.
+func allocateFill(requested []float64, fill OrderState) []OrderState {
+	shares := make([]OrderState, len(requested))
+
+	var total float64
+	for _, q := range requested {
+		total += q
+	}
+	if total <= 0 || fill.FilledQuantity <= 0 {
+		return shares
+	}
+
+	quantityLeft := fill.FilledQuantity
+	feesLeft := fill.Fees
+	for i, q := range requested {
+		share := OrderState{
+			BrokerOrderID: fill.BrokerOrderID,
+			Status:        fill.Status,
+			AveragePrice:  fill.AveragePrice,
+			Reason:        fill.Reason,
+		}
+
+		if i == len(requested)-1 {
+			share.FilledQuantity = roundTo(quantityLeft, quantityPlaces)
+			share.Fees = OrderFees{
+				Brokerage: roundTo(feesLeft.Brokerage, amountPlaces),
+				STT:       roundTo(feesLeft.STT, amountPlaces),
+				GST:       roundTo(feesLeft.GST, amountPlaces),
+			}
+		} else {
+			share.FilledQuantity = roundTo(fill.FilledQuantity*q/total, quantityPlaces)
+			ratio := share.FilledQuantity / fill.FilledQuantity
+			share.Fees = OrderFees{
+				Brokerage: roundTo(fill.Fees.Brokerage*ratio, amountPlaces),
+				STT:       roundTo(fill.Fees.STT*ratio, amountPlaces),
+				GST:       roundTo(fill.Fees.GST*ratio, amountPlaces),
+			}
+		}
+
+		quantityLeft -= share.FilledQuantity
+		feesLeft.Brokerage -= share.Fees.Brokerage
+		feesLeft.STT -= share.Fees.STT
+		feesLeft.GST -= share.Fees.GST
+		shares[i] = share
+	}
+
+	return shares
+}
+
+// roundTo rounds x half away from zero to places decimal places
+func roundTo(x float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(x*scale) / scale
+}
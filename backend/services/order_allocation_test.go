@@ -0,0 +1,76 @@
+package services
+
+import "testing"
+
+func TestAllocateFill(t *testing.T) {
+	tests := []struct {
+		name      string
+		requested []float64
+		fill      OrderState
+		want      []OrderState
+	}{
+		{
+			name:      "last share absorbs the rounding remainder",
+			requested: []float64{1, 1, 1},
+			fill:      OrderState{FilledQuantity: 1, AveragePrice: 100, Fees: OrderFees{Brokerage: 10, STT: 1, GST: 1.8}},
+			want: []OrderState{
+				{FilledQuantity: 0.333333, AveragePrice: 100, Fees: OrderFees{Brokerage: 3.3333, STT: 0.3333, GST: 0.6}},
+				{FilledQuantity: 0.333333, AveragePrice: 100, Fees: OrderFees{Brokerage: 3.3333, STT: 0.3333, GST: 0.6}},
+				{FilledQuantity: 0.333334, AveragePrice: 100, Fees: OrderFees{Brokerage: 3.3334, STT: 0.3334, GST: 0.6}},
+			},
+		},
+		{
+			name:      "partial fill is shared in proportion",
+			requested: []float64{2, 1},
+			fill:      OrderState{FilledQuantity: 1.5, AveragePrice: 250, Fees: OrderFees{Brokerage: 3}},
+			want: []OrderState{
+				{FilledQuantity: 1, AveragePrice: 250, Fees: OrderFees{Brokerage: 2}},
+				{FilledQuantity: 0.5, AveragePrice: 250, Fees: OrderFees{Brokerage: 1}},
+			},
+		},
+		{
+			name:      "single reward takes the whole fill",
+			requested: []float64{0.7},
+			fill:      OrderState{FilledQuantity: 0.7, AveragePrice: 3500, Fees: OrderFees{Brokerage: 20, STT: 2.45, GST: 3.6}},
+			want: []OrderState{
+				{FilledQuantity: 0.7, AveragePrice: 3500, Fees: OrderFees{Brokerage: 20, STT: 2.45, GST: 3.6}},
+			},
+		},
+		{
+			name:      "nothing filled",
+			requested: []float64{1, 2},
+			fill:      OrderState{FilledQuantity: 0},
+			want:      []OrderState{{}, {}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := allocateFill(tt.requested, tt.fill)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d shares, want %d", len(got), len(tt.want))
+			}
+
+			var quantity, brokerage, stt, gst float64
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("share %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+				quantity += got[i].FilledQuantity
+				brokerage += got[i].Fees.Brokerage
+				stt += got[i].Fees.STT
+				gst += got[i].Fees.GST
+			}
+
+			if roundTo(quantity, quantityPlaces) != roundTo(tt.fill.FilledQuantity, quantityPlaces) {
+				t.Errorf("shares sum to %v, fill was %v", quantity, tt.fill.FilledQuantity)
+			}
+			if tt.fill.FilledQuantity > 0 {
+				fees := tt.fill.Fees
+				if roundTo(brokerage, amountPlaces) != fees.Brokerage || roundTo(stt, amountPlaces) != fees.STT || roundTo(gst, amountPlaces) != fees.GST {
+					t.Errorf("fees sum to %v/%v/%v, fill had %+v", brokerage, stt, gst, fees)
+				}
+			}
+		})
+	}
+}
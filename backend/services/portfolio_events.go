@@ -0,0 +1,147 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PortfolioEventHub fans out "portfolio changed" notifications to stream subscribers.
+// Notifications carry no payload; subscribers re-read the portfolio when woken up.
+type PortfolioEventHub struct {
+	mu            sync.Mutex
+	epoch         string
+	globalVersion uint64
+	allVersion    uint64
+	userVersions  map[uuid.UUID]uint64
+	subscribers   map[uuid.UUID]map[*PortfolioSubscription]struct{}
+	done          chan struct{}
+	closeOnce     sync.Once
+}
+
+// PortfolioSubscription receives a signal on C whenever the user's portfolio may have changed
+type PortfolioSubscription struct {
+	UserID uuid.UUID
+	C      chan struct{}
+}
+
+var portfolioEvents = NewPortfolioEventHub()
+
+// PortfolioEvents returns the process-wide portfolio event hub
+func PortfolioEvents() *PortfolioEventHub {
+	return portfolioEvents
+}
+
+func NewPortfolioEventHub() *PortfolioEventHub {
+	return &PortfolioEventHub{
+		// The epoch lets us tell event IDs from a previous process apart from ours
+		epoch:        strconv.FormatInt(time.Now().UnixNano(), 36),
+		userVersions: make(map[uuid.UUID]uint64),
+		subscribers:  make(map[uuid.UUID]map[*PortfolioSubscription]struct{}),
+		done:         make(chan struct{}),
+	}
+}
+
+// Close tells every stream to finish, e.g. when the server is shutting down
+func (h *PortfolioEventHub) Close() {
+	h.closeOnce.Do(func() {
+		close(h.done)
+	})
+}
+
+// Done is closed once the hub has been closed
+func (h *PortfolioEventHub) Done() <-chan struct{} {
+	return h.done
+}
+
+// Subscribe registers a subscriber for a user's portfolio changes
+func (h *PortfolioEventHub) Subscribe(userID uuid.UUID) *PortfolioSubscription {
+	sub := &PortfolioSubscription{UserID: userID, C: make(chan struct{}, 1)}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = make(map[*PortfolioSubscription]struct{})
+	}
+	h.subscribers[userID][sub] = struct{}{}
+
+	return sub
+}
+
+// Unsubscribe removes a subscriber registered with Subscribe
+func (h *PortfolioEventHub) Unsubscribe(sub *PortfolioSubscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subscribers[sub.UserID], sub)
+	if len(h.subscribers[sub.UserID]) == 0 {
+		delete(h.subscribers, sub.UserID)
+	}
+}
+
+// PublishUser notifies subscribers of a single user, e.g. after a new reward
+func (h *PortfolioEventHub) PublishUser(userID uuid.UUID) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.globalVersion++
+	h.userVersions[userID] = h.globalVersion
+	for sub := range h.subscribers[userID] {
+		notify(sub)
+	}
+}
+
+// PublishAll notifies every subscriber, e.g. after prices have been refreshed
+func (h *PortfolioEventHub) PublishAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.globalVersion++
+	h.allVersion = h.globalVersion
+	// A global change supersedes every per-user version
+	h.userVersions = make(map[uuid.UUID]uint64)
+	for _, subs := range h.subscribers {
+		for sub := range subs {
+			notify(sub)
+		}
+	}
+}
+
+// EventID returns the ID of the latest change visible to a user
+func (h *PortfolioEventHub) EventID(userID uuid.UUID) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return fmt.Sprintf("%s-%d", h.epoch, h.versionFor(userID))
+}
+
+// IsCurrent reports whether a client's Last-Event-ID already reflects the latest change
+func (h *PortfolioEventHub) IsCurrent(userID uuid.UUID, lastEventID string) bool {
+	epoch, versionStr, found := strings.Cut(lastEventID, "-")
+	if !found {
+		return false
+	}
+	version, err := strconv.ParseUint(versionStr, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return epoch == h.epoch && version >= h.versionFor(userID)
+}
+
+func (h *PortfolioEventHub) versionFor(userID uuid.UUID) uint64 {
+	if v, ok := h.userVersions[userID]; ok {
+		return v
+	}
+	return h.allVersion
+}
+
+func notify(sub *PortfolioSubscription) {
+	// Non-blocking: one pending signal is enough since subscribers re-read state
+	select {
+	case sub.C <- struct{}{}:
+	default:
+	}
+}
@@ -1,14 +1,20 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
+	"sort"
 	"time"
 
 	"backend/database"
 	"backend/models"
+	"backend/telemetry"
 
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type PortfolioService struct {
@@ -22,14 +28,17 @@ func NewPortfolioService() *PortfolioService {
 }
 
 // GetHistoricalINR returns the INR value of user's portfolio for all past days
-func (s *PortfolioService) GetHistoricalINR(userID uuid.UUID) ([]map[string]interface{}, error) {
+func (s *PortfolioService) GetHistoricalINR(ctx context.Context, userID uuid.UUID) (results []map[string]interface{}, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "PortfolioService.GetHistoricalINR")
+	defer telemetry.EndSpan(span, &err)
+
 	// Get all unique dates from reward events
-	rows, err := database.DB.Query(`
+	rows, err := database.DB.QueryContext(ctx, `
 		SELECT DISTINCT CAST(reward_timestamp AS DATE) AS reward_date
 		FROM reward_events
 		WHERE user_id = @p1 
 			AND CAST(reward_timestamp AS DATE) < CAST(GETUTCDATE() AS DATE)
-			AND status = 'active'
+			AND status IN ('active', 'fulfilled', 'settled')
 			AND deleted_at IS NULL
 		ORDER BY reward_date DESC
 	`, userID)
@@ -47,11 +56,10 @@ func (s *PortfolioService) GetHistoricalINR(userID uuid.UUID) ([]map[string]inte
 		dates = append(dates, date)
 	}
 
-	var results []map[string]interface{}
 	for _, date := range dates {
-		portfolioValue, err := s.calculatePortfolioValueForDate(userID, date)
+		portfolioValue, err := s.calculatePortfolioValueForDate(ctx, userID, date)
 		if err != nil {
-			logrus.WithError(err).WithField("date", date).Error("Error calculating portfolio value")
+			logrus.WithContext(ctx).WithError(err).WithField("date", date).Error("Error calculating portfolio value")
 			continue
 		}
 
@@ -65,12 +73,15 @@ func (s *PortfolioService) GetHistoricalINR(userID uuid.UUID) ([]map[string]inte
 }
 
 // GetStats returns statistics for a user
-func (s *PortfolioService) GetStats(userID uuid.UUID) (map[string]interface{}, error) {
+func (s *PortfolioService) GetStats(ctx context.Context, userID uuid.UUID) (stats map[string]interface{}, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "PortfolioService.GetStats")
+	defer telemetry.EndSpan(span, &err)
+
 	// Get today's rewards grouped by stock
 	today := time.Now().UTC().Truncate(24 * time.Hour)
 	tomorrow := today.Add(24 * time.Hour)
 
-	rows, err := database.DB.Query(`
+	rows, err := database.DB.QueryContext(ctx, `
 		SELECT stock_symbol, SUM(quantity) AS total_quantity
 		FROM reward_events
 		WHERE user_id = @p1 
@@ -95,7 +106,7 @@ func (s *PortfolioService) GetStats(userID uuid.UUID) (map[string]interface{}, e
 	}
 
 	// Get current portfolio value
-	currentValue, err := s.GetCurrentPortfolioValue(userID)
+	currentValue, err := s.GetCurrentPortfolioValue(ctx, userID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting current portfolio value: %w", err)
 	}
@@ -106,49 +117,74 @@ func (s *PortfolioService) GetStats(userID uuid.UUID) (map[string]interface{}, e
 	}, nil
 }
 
-// GetPortfolio returns the user's current portfolio with holdings per stock
-func (s *PortfolioService) GetPortfolio(userID uuid.UUID) ([]models.PortfolioItem, error) {
-	rows, err := database.DB.Query(`
-		SELECT uh.stock_symbol, uh.quantity, 
-			ISNULL(sp.price, 0) AS price,
-			uh.quantity * ISNULL(sp.price, 0) AS current_value,
-			uh.last_updated
-		FROM user_holdings uh
-		LEFT JOIN stock_prices sp ON uh.stock_symbol = sp.stock_symbol AND sp.is_stale = 0
-		WHERE uh.user_id = @p1 AND uh.quantity > 0
-		ORDER BY current_value DESC
+// GetPortfolio returns the user's current portfolio with holdings per stock,
+// split into settled shares and shares still waiting for T+1 settlement, and
+// into vested shares and shares locked by vesting or a lock-in.
+// Holdings are valued at the last known price; old prices are flagged, never refreshed here.
+func (s *PortfolioService) GetPortfolio(ctx context.Context, userID uuid.UUID) (portfolio []models.PortfolioItem, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "PortfolioService.GetPortfolio")
+	defer telemetry.EndSpan(span, &err)
+
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT stock_symbol, quantity, settled_quantity, unvested_quantity, last_updated
+		FROM user_holdings
+		WHERE user_id = @p1 AND quantity > 0
 	`, userID)
 	if err != nil {
 		return nil, fmt.Errorf("error querying portfolio: %w", err)
 	}
 	defer rows.Close()
 
-	var portfolio []models.PortfolioItem
+	var unvested []float64
 	for rows.Next() {
 		var item models.PortfolioItem
-		if err := rows.Scan(&item.StockSymbol, &item.Quantity, &item.Price, &item.CurrentValue, &item.LastUpdated); err != nil {
+		var unvestedQuantity float64
+		if err := rows.Scan(&item.StockSymbol, &item.Quantity, &item.SettledQuantity, &unvestedQuantity, &item.LastUpdated); err != nil {
 			continue
 		}
+		item.UnsettledQuantity = roundTo(item.Quantity-item.SettledQuantity, quantityPlaces)
+		item.VestedQuantity = roundTo(item.Quantity-unvestedQuantity, quantityPlaces)
+		portfolio = append(portfolio, item)
+		unvested = append(unvested, unvestedQuantity)
+	}
+	rows.Close()
+
+	lockedIn, err := lockedInQuantities(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range portfolio {
+		item := &portfolio[i]
+		item.LockedQuantity = math.Min(item.Quantity, roundTo(unvested[i]+lockedIn[item.StockSymbol], quantityPlaces))
 
-		// If price is 0 or stale, fetch current price
-		if item.Price == 0 {
-			price, err := s.stockPriceService.GetPrice(item.StockSymbol)
-			if err == nil {
-				item.Price = price
-				item.CurrentValue = item.Quantity * price
-				s.stockPriceService.UpdatePrice(item.StockSymbol, price)
-			}
+		// Prices come from the shared cache rather than a join per read
+		price, err := s.stockPriceService.GetLastKnownPrice(ctx, item.StockSymbol)
+		if errors.Is(err, ErrPriceNotFound) {
+			// No price has ever been stored for this symbol
+			item.IsStale = true
+			continue
+		}
+		if err != nil {
+			return nil, err
 		}
 
-		portfolio = append(portfolio, item)
+		item.Price = price.Price
+		item.CurrentValue = item.Quantity * price.Price
+		item.PriceAsOf = &price.LastUpdated
+		item.IsStale = price.IsStale
 	}
 
+	sort.SliceStable(portfolio, func(i, j int) bool {
+		return portfolio[i].CurrentValue > portfolio[j].CurrentValue
+	})
+
 	return portfolio, nil
 }
 
 // GetCurrentPortfolioValue returns the total INR value of user's portfolio
-func (s *PortfolioService) GetCurrentPortfolioValue(userID uuid.UUID) (float64, error) {
-	portfolio, err := s.GetPortfolio(userID)
+func (s *PortfolioService) GetCurrentPortfolioValue(ctx context.Context, userID uuid.UUID) (float64, error) {
+	portfolio, err := s.GetPortfolio(ctx, userID)
 	if err != nil {
 		return 0, err
 	}
@@ -162,17 +198,22 @@ func (s *PortfolioService) GetCurrentPortfolioValue(userID uuid.UUID) (float64,
 }
 
 // calculatePortfolioValueForDate calculates portfolio value for a specific date
-func (s *PortfolioService) calculatePortfolioValueForDate(userID uuid.UUID, date time.Time) (float64, error) {
+func (s *PortfolioService) calculatePortfolioValueForDate(ctx context.Context, userID uuid.UUID, date time.Time) (totalValue float64, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "PortfolioService.calculatePortfolioValueForDate",
+		attribute.String("date", date.Format("2006-01-02")),
+	)
+	defer telemetry.EndSpan(span, &err)
+
 	dateOnly := date.Truncate(24 * time.Hour)
 
-	rows, err := database.DB.Query(`
+	rows, err := database.DB.QueryContext(ctx, `
 		SELECT 
 			re.stock_symbol,
 			SUM(re.quantity) AS total_quantity
 		FROM reward_events re
 		WHERE re.user_id = @p1
 			AND CAST(re.reward_timestamp AS DATE) <= @p2
-			AND re.status = 'active'
+			AND re.status IN ('active', 'fulfilled', 'settled')
 			AND re.deleted_at IS NULL
 		GROUP BY re.stock_symbol
 	`, userID, dateOnly)
@@ -181,7 +222,6 @@ func (s *PortfolioService) calculatePortfolioValueForDate(userID uuid.UUID, date
 	}
 	defer rows.Close()
 
-	var totalValue float64
 	for rows.Next() {
 		var symbol string
 		var quantity float64
@@ -189,15 +229,15 @@ func (s *PortfolioService) calculatePortfolioValueForDate(userID uuid.UUID, date
 			continue
 		}
 
-		// Get historical price for that date
-		price, err := s.stockPriceService.GetHistoricalPrice(symbol, dateOnly)
+		// Get historical price for that date, or the previous trading day's close
+		// when the date is a weekend or holiday
+		price, err := s.stockPriceService.GetHistoricalPrice(ctx, symbol, CurrentMarketCalendar().TradingDayOnOrBefore(dateOnly))
 		if err != nil {
-			logrus.WithError(err).WithFields(logrus.Fields{
+			logrus.WithContext(ctx).WithError(err).WithFields(logrus.Fields{
 				"symbol": symbol,
 				"date":   dateOnly,
-			}).Warn("Error getting historical price, using current price")
-			// Fallback to current price
-			price, _ = s.stockPriceService.GetPrice(symbol)
+			}).Warn("Error getting historical price, skipping symbol")
+			continue
 		}
 
 		totalValue += quantity * price
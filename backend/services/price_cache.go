@@ -0,0 +1,114 @@
+package services
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"backend/models"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// priceCache is a read-through cache of stored stock prices. Concurrent misses
+// for the same symbol share a single database lookup.
+type priceCache struct {
+	mu         sync.RWMutex
+	entries    map[string]priceCacheEntry
+	generation uint64
+	group      singleflight.Group
+	hits       atomic.Uint64
+	misses     atomic.Uint64
+}
+
+type priceCacheEntry struct {
+	price   models.StockPrice
+	expires time.Time
+}
+
+// PriceCacheStats is a point-in-time snapshot of cache counters
+type PriceCacheStats struct {
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+	Entries int    `json:"entries"`
+}
+
+var defaultPriceCache = newPriceCache()
+
+func newPriceCache() *priceCache {
+	return &priceCache{entries: make(map[string]priceCacheEntry)}
+}
+
+// GetPriceCacheStats returns hit/miss counters for the shared price cache
+func GetPriceCacheStats() PriceCacheStats {
+	return defaultPriceCache.stats()
+}
+
+// get returns the cached price for symbol, calling load on a miss. Errors are not cached.
+func (c *priceCache) get(symbol string, load func() (*models.StockPrice, error)) (*models.StockPrice, error) {
+	now := time.Now()
+
+	c.mu.RLock()
+	entry, ok := c.entries[symbol]
+	generation := c.generation
+	c.mu.RUnlock()
+
+	if ok && now.Before(entry.expires) {
+		c.hits.Add(1)
+		price := entry.price
+		return &price, nil
+	}
+	c.misses.Add(1)
+
+	v, err, _ := c.group.Do(symbol, func() (interface{}, error) {
+		price, err := load()
+		if err != nil {
+			return nil, err
+		}
+
+		// The TTL follows the staleness policy: past it the entry would be flagged stale anyway
+		ttl := CurrentStalenessPolicy().StaleAfter
+
+		c.mu.Lock()
+		// Skip the store if a write invalidated the cache while we were loading
+		if c.generation == generation {
+			c.entries[symbol] = priceCacheEntry{price: *price, expires: time.Now().Add(ttl)}
+		}
+		c.mu.Unlock()
+
+		return *price, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	price := v.(models.StockPrice)
+	return &price, nil
+}
+
+// invalidate drops cached prices for the given symbols after they were written
+func (c *priceCache) invalidate(symbols ...string) {
+	c.mu.Lock()
+	c.generation++
+	for _, symbol := range symbols {
+		delete(c.entries, symbol)
+	}
+	c.mu.Unlock()
+
+	// New lookups must not join a flight that started before the write
+	for _, symbol := range symbols {
+		c.group.Forget(symbol)
+	}
+}
+
+func (c *priceCache) stats() PriceCacheStats {
+	c.mu.RLock()
+	entries := len(c.entries)
+	c.mu.RUnlock()
+
+	return PriceCacheStats{
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+		Entries: entries,
+	}
+}
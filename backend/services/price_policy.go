@@ -0,0 +1,71 @@
+package services
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// StaleIssuanceRefuse rejects rewards while the stock price is too old
+	StaleIssuanceRefuse = "refuse"
+	// StaleIssuanceQueue records the reward and posts it once a fresh price arrives
+	StaleIssuanceQueue = "queue"
+)
+
+// StalenessPolicy decides how old a stored stock price may be for each use
+type StalenessPolicy struct {
+	// StaleAfter is the age after which a price is flagged stale in valuations
+	StaleAfter time.Duration
+	// MaxIssuanceAge is the oldest price a reward may be issued against
+	MaxIssuanceAge time.Duration
+	// StaleIssuance is what CreateReward does when the price is older than MaxIssuanceAge
+	StaleIssuance string
+	// FailReadiness takes instances out of rotation while the last price
+	// refresh is older than StaleAfter, instead of only warning. StaleAfter
+	// must then leave room for a refresh to run late.
+	FailReadiness bool
+}
+
+// DefaultStalenessPolicy matches the hourly price refresh
+func DefaultStalenessPolicy() StalenessPolicy {
+	return StalenessPolicy{
+		StaleAfter:     1 * time.Hour,
+		MaxIssuanceAge: 2 * time.Hour,
+		StaleIssuance:  StaleIssuanceQueue,
+	}
+}
+
+// Validate checks the policy for nonsensical values
+func (p StalenessPolicy) Validate() error {
+	if p.StaleAfter <= 0 {
+		return fmt.Errorf("stale_after must be positive, got %s", p.StaleAfter)
+	}
+	if p.MaxIssuanceAge <= 0 {
+		return fmt.Errorf("max_issuance_age must be positive, got %s", p.MaxIssuanceAge)
+	}
+	if p.StaleIssuance != StaleIssuanceRefuse && p.StaleIssuance != StaleIssuanceQueue {
+		return fmt.Errorf("stale_issuance must be %q or %q, got %q", StaleIssuanceRefuse, StaleIssuanceQueue, p.StaleIssuance)
+	}
+	return nil
+}
+
+// IsStale reports whether a price last updated at asOf should be flagged stale
+func (p StalenessPolicy) IsStale(asOf, now time.Time) bool {
+	return priceAge(asOf, now) > p.StaleAfter
+}
+
+// CanIssue reports whether a reward may be issued against a price last updated at asOf
+func (p StalenessPolicy) CanIssue(asOf, now time.Time) bool {
+	return priceAge(asOf, now) <= p.MaxIssuanceAge
+}
+
+// StaleCutoff returns the last_updated time below which prices are stale at now
+func (p StalenessPolicy) StaleCutoff(now time.Time) time.Time {
+	return CurrentMarketCalendar().PriceReferenceTime(now).Add(-p.StaleAfter)
+}
+
+// priceAge measures age in market time, so the last close doesn't go stale
+// over a weekend or holiday
+func priceAge(asOf, now time.Time) time.Duration {
+	return CurrentMarketCalendar().PriceReferenceTime(now).Sub(asOf)
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// PriceProvider is an upstream source of live stock prices
+type PriceProvider interface {
+	// Name identifies the provider for rate limiting and logging
+	Name() string
+	// FetchPrice returns the latest traded price for a symbol in INR, or
+	// ErrUnknownSymbol if the provider does not list it
+	FetchPrice(ctx context.Context, symbol string) (float64, error)
+}
+
+// simulatedPriceProvider is a hypothetical service that returns random prices
+type simulatedPriceProvider struct {
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+var defaultPriceProvider PriceProvider = &simulatedPriceProvider{
+	rnd: rand.New(rand.NewSource(time.Now().UnixNano())),
+}
+
+// Base prices for common Indian stocks (hypothetical)
+var simulatedBasePrices = map[string]float64{
+	"RELIANCE":   2500.0,
+	"TCS":        3500.0,
+	"INFY":       1500.0,
+	"HDFCBANK":   1700.0,
+	"ICICIBANK":  950.0,
+	"BHARTIARTL": 1200.0,
+	"SBIN":       600.0,
+	"BAJFINANCE": 7000.0,
+	"WIPRO":      450.0,
+	"HINDUNILVR": 2500.0,
+}
+
+func (p *simulatedPriceProvider) Name() string {
+	return "simulated"
+}
+
+func (p *simulatedPriceProvider) FetchPrice(ctx context.Context, symbol string) (float64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	basePrice, exists := simulatedBasePrices[symbol]
+	if !exists {
+		return 0, ErrUnknownSymbol
+	}
+
+	// Add random variation (±5%)
+	p.mu.Lock()
+	variation := (p.rnd.Float64() - 0.5) * 0.1 // -5% to +5%
+	p.mu.Unlock()
+	price := basePrice * (1 + variation)
+
+	// Round to 2 decimal places
+	return float64(int(price*100+0.5)) / 100, nil
+}
+
+var (
+	providerLimitersMu sync.Mutex
+	providerLimiters   = make(map[string]*rate.Limiter)
+)
+
+// providerLimiter returns the shared limiter for a provider, so concurrent
+// refresh runs and on-demand lookups together respect its quota
+func providerLimiter(name string) *rate.Limiter {
+	providerLimitersMu.Lock()
+	defer providerLimitersMu.Unlock()
+
+	limiter, ok := providerLimiters[name]
+	if !ok {
+		opts := CurrentPriceRefreshOptions()
+		limiter = rate.NewLimiter(rate.Limit(opts.RequestsPerSecond), opts.Burst)
+		providerLimiters[name] = limiter
+	}
+	return limiter
+}
@@ -0,0 +1,296 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/database"
+	"backend/metrics"
+	"backend/models"
+	"backend/telemetry"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// PriceRefreshOptions tunes UpdateAllPrices
+type PriceRefreshOptions struct {
+	// Workers is the number of concurrent provider lookups
+	Workers int
+	// RequestsPerSecond and Burst bound calls to each provider
+	RequestsPerSecond float64
+	Burst             int
+	// Timeout caps a whole refresh run; symbols not reached in time are skipped
+	Timeout time.Duration
+	// BatchSize is the number of prices written per upsert statement
+	BatchSize int
+}
+
+// SQL Server allows 2100 parameters per statement and each price row uses 2
+const maxPriceBatchSize = 500
+
+func DefaultPriceRefreshOptions() PriceRefreshOptions {
+	return PriceRefreshOptions{
+		Workers:           8,
+		RequestsPerSecond: 5,
+		Burst:             5,
+		Timeout:           5 * time.Minute,
+		BatchSize:         200,
+	}
+}
+
+// Validate checks the options for nonsensical values
+func (o PriceRefreshOptions) Validate() error {
+	if o.Workers < 1 {
+		return fmt.Errorf("workers must be at least 1, got %d", o.Workers)
+	}
+	if o.RequestsPerSecond <= 0 {
+		return fmt.Errorf("requests_per_second must be positive, got %v", o.RequestsPerSecond)
+	}
+	if o.Burst < 1 {
+		return fmt.Errorf("burst must be at least 1, got %d", o.Burst)
+	}
+	if o.Timeout <= 0 {
+		return fmt.Errorf("timeout must be positive, got %s", o.Timeout)
+	}
+	if o.BatchSize < 1 || o.BatchSize > maxPriceBatchSize {
+		return fmt.Errorf("batch_size must be between 1 and %d, got %d", maxPriceBatchSize, o.BatchSize)
+	}
+	return nil
+}
+
+type fetchedPrice struct {
+	symbol string
+	price  float64
+}
+
+// UpdateAllPrices fetches and stores prices for every symbol users currently hold
+// or are waiting on, using a bounded, rate-limited worker pool. The run summary
+// is persisted to price_refresh_runs and returned.
+func (s *StockPriceService) UpdateAllPrices(ctx context.Context) (run *models.PriceRefreshRun, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "StockPriceService.UpdateAllPrices", attribute.String("provider", s.provider.Name()))
+	defer telemetry.EndSpan(span, &err)
+
+	// Bookkeeping writes must still happen after the run's own deadline has passed
+	writeCtx := context.WithoutCancel(ctx)
+
+	opts := CurrentPriceRefreshOptions()
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	timer := prometheus.NewTimer(metrics.PriceRefreshDuration)
+	defer timer.ObserveDuration()
+
+	run = &models.PriceRefreshRun{
+		ID:        uuid.New(),
+		Provider:  s.provider.Name(),
+		StartedAt: time.Now().UTC(),
+		Status:    models.PriceRefreshRunning,
+	}
+	if err := s.startRefreshRun(writeCtx, run); err != nil {
+		return nil, err
+	}
+
+	symbols, err := s.refreshSymbols(ctx)
+	if err != nil {
+		s.finishRefreshRun(writeCtx, run, err)
+		return run, err
+	}
+	run.SymbolsTotal = len(symbols)
+
+	prices := s.fetchPrices(ctx, symbols, opts, run)
+
+	// Write without the run timeout so a run that hit it still saves what it fetched
+	if err := s.upsertPrices(writeCtx, prices, opts.BatchSize); err != nil {
+		run.Failed += run.Fetched
+		run.Fetched = 0
+		s.finishRefreshRun(writeCtx, run, err)
+		return run, err
+	}
+
+	s.finishRefreshRun(writeCtx, run, nil)
+	span.SetAttributes(
+		attribute.Int("symbols_total", run.SymbolsTotal),
+		attribute.Int("fetched", run.Fetched),
+		attribute.Int("failed", run.Failed),
+		attribute.Int("skipped", run.Skipped),
+	)
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"run_id":  run.ID,
+		"total":   run.SymbolsTotal,
+		"fetched": run.Fetched,
+		"failed":  run.Failed,
+		"skipped": run.Skipped,
+	}).Info("Updated all stock prices")
+
+	PortfolioEvents().PublishAll()
+	return run, nil
+}
+
+// refreshSymbols returns symbols with open holdings or rewards queued on a price
+func (s *StockPriceService) refreshSymbols(ctx context.Context) ([]string, error) {
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT DISTINCT stock_symbol FROM user_holdings WHERE quantity > 0
+		UNION
+		SELECT DISTINCT stock_symbol FROM reward_events WHERE status = @p1 AND deleted_at IS NULL
+	`, models.RewardStatusQueued)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching stock symbols: %w", err)
+	}
+	defer rows.Close()
+
+	var symbols []string
+	for rows.Next() {
+		var symbol string
+		if err := rows.Scan(&symbol); err != nil {
+			continue
+		}
+		symbols = append(symbols, symbol)
+	}
+
+	return symbols, rows.Err()
+}
+
+// fetchPrices looks up symbols concurrently and tallies the outcome on run
+func (s *StockPriceService) fetchPrices(ctx context.Context, symbols []string, opts PriceRefreshOptions, run *models.PriceRefreshRun) []fetchedPrice {
+	limiter := providerLimiter(s.provider.Name())
+	jobs := make(chan string)
+
+	var mu sync.Mutex
+	var prices []fetchedPrice
+
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for symbol := range jobs {
+				if err := limiter.Wait(ctx); err != nil {
+					mu.Lock()
+					run.Skipped++
+					mu.Unlock()
+					continue
+				}
+
+				price, err := s.provider.FetchPrice(ctx, symbol)
+
+				mu.Lock()
+				switch {
+				case err == nil:
+					run.Fetched++
+					prices = append(prices, fetchedPrice{symbol: symbol, price: price})
+				case ctx.Err() != nil:
+					run.Skipped++
+				default:
+					run.Failed++
+					logrus.WithContext(ctx).WithError(err).WithField("symbol", symbol).Error("Error fetching price")
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for i, symbol := range symbols {
+		select {
+		case jobs <- symbol:
+		case <-ctx.Done():
+			// Out of time: nothing else gets dispatched
+			mu.Lock()
+			run.Skipped += len(symbols) - i
+			mu.Unlock()
+			close(jobs)
+			wg.Wait()
+			return prices
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return prices
+}
+
+// upsertPrices writes prices in batches, one MERGE statement per batch
+func (s *StockPriceService) upsertPrices(ctx context.Context, prices []fetchedPrice, batchSize int) error {
+	now := time.Now().UTC()
+
+	for start := 0; start < len(prices); start += batchSize {
+		end := start + batchSize
+		if end > len(prices) {
+			end = len(prices)
+		}
+		batch := prices[start:end]
+
+		values := make([]string, 0, len(batch))
+		symbols := make([]string, 0, len(batch))
+		args := make([]interface{}, 0, len(batch)*2+1)
+		args = append(args, now)
+		for i, p := range batch {
+			values = append(values, fmt.Sprintf("(@p%d, @p%d)", i*2+2, i*2+3))
+			symbols = append(symbols, p.symbol)
+			args = append(args, p.symbol, p.price)
+		}
+
+		_, err := database.DB.ExecContext(ctx, `
+			MERGE stock_prices AS target
+			USING (VALUES `+strings.Join(values, ", ")+`) AS source (stock_symbol, price)
+			ON target.stock_symbol = source.stock_symbol
+			WHEN MATCHED THEN
+				UPDATE SET price = source.price, last_updated = @p1, is_stale = 0, updated_at = GETUTCDATE()
+			WHEN NOT MATCHED THEN
+				INSERT (stock_symbol, price, last_updated, is_stale)
+				VALUES (source.stock_symbol, source.price, @p1, 0);
+		`, args...)
+		if err != nil {
+			return fmt.Errorf("error upserting stock prices: %w", err)
+		}
+		s.cache.invalidate(symbols...)
+	}
+
+	return nil
+}
+
+func (s *StockPriceService) startRefreshRun(ctx context.Context, run *models.PriceRefreshRun) error {
+	_, err := database.DB.ExecContext(ctx, `
+		INSERT INTO price_refresh_runs (id, provider, started_at, status)
+		VALUES (@p1, @p2, @p3, @p4)
+	`, run.ID, run.Provider, run.StartedAt, run.Status)
+	if err != nil {
+		return fmt.Errorf("error recording price refresh run: %w", err)
+	}
+	return nil
+}
+
+// finishRefreshRun sets the final status on run and persists the summary
+func (s *StockPriceService) finishRefreshRun(ctx context.Context, run *models.PriceRefreshRun, runErr error) {
+	run.FinishedAt.Time, run.FinishedAt.Valid = time.Now().UTC(), true
+
+	switch {
+	case runErr != nil:
+		run.Status = models.PriceRefreshFailed
+		run.ErrorMessage.String, run.ErrorMessage.Valid = runErr.Error(), true
+	case run.Failed > 0 || run.Skipped > 0:
+		run.Status = models.PriceRefreshPartial
+	default:
+		run.Status = models.PriceRefreshSucceeded
+	}
+
+	metrics.PriceRefreshRunsTotal.WithLabelValues(run.Status).Inc()
+	metrics.PriceRefreshSymbolFailuresTotal.Add(float64(run.Failed))
+
+	_, err := database.DB.ExecContext(ctx, `
+		UPDATE price_refresh_runs
+		SET finished_at = @p1, symbols_total = @p2, fetched = @p3, failed = @p4, skipped = @p5,
+			status = @p6, error_message = @p7
+		WHERE id = @p8
+	`, run.FinishedAt, run.SymbolsTotal, run.Fetched, run.Failed, run.Skipped,
+		run.Status, run.ErrorMessage, run.ID)
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).WithField("run_id", run.ID).Error("Error saving price refresh run summary")
+	}
+}
@@ -0,0 +1,583 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"backend/auth"
+	"backend/database"
+	"backend/metrics"
+	"backend/models"
+	"backend/telemetry"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// RedemptionService sells shares from users' holdings for cash in their wallets
+type RedemptionService struct {
+	stockPriceService *StockPriceService
+	broker            Broker
+}
+
+func NewRedemptionService() *RedemptionService {
+	return &RedemptionService{
+		stockPriceService: NewStockPriceService(),
+		broker:            defaultBroker,
+	}
+}
+
+// Redeem sells quantity shares of a holding through a market sell order.
+// The stored price must not be stale. Only shares that have settled, vested
+// and passed any lock-in can be sold. The shares leave the holding at once,
+// so nothing else can take them while the order is open, and the sale is
+// booked from the fill: sell-side fees come out of the proceeds, the rest is
+// credited to the user's wallet, and the shares' cost leaves stock
+// inventory. An order that does not fill straight away leaves the redemption
+// pending for ProcessPendingRedemptions.
+func (s *RedemptionService) Redeem(ctx context.Context, req models.RedemptionRequest) (redemption *models.Redemption, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "RedemptionService.Redeem", attribute.String("stock_symbol", req.StockSymbol))
+	defer telemetry.EndSpan(span, &err)
+
+	userID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid user_id: %v", ErrInvalidRequest, err)
+	}
+	if roundTo(req.Quantity, quantityPlaces) != req.Quantity {
+		return nil, fmt.Errorf("%w: quantity has more than %d decimal places", ErrInvalidRequest, quantityPlaces)
+	}
+
+	var userExists bool
+	err = database.DB.QueryRowContext(ctx,
+		"SELECT CASE WHEN EXISTS(SELECT 1 FROM users WHERE id = @p1 AND deleted_at IS NULL) THEN 1 ELSE 0 END",
+		userID,
+	).Scan(&userExists)
+	if err != nil {
+		return nil, fmt.Errorf("error checking user existence: %w", err)
+	}
+	if !userExists {
+		return nil, ErrUserNotFound
+	}
+
+	// A stale price means the market data is unreliable, so no sale is placed
+	price, err := s.stockPriceService.GetLastKnownPrice(ctx, req.StockSymbol)
+	if errors.Is(err, ErrPriceNotFound) {
+		return nil, fmt.Errorf("%w: no stored price for %s", ErrPriceUnavailable, req.StockSymbol)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if price.IsStale {
+		return nil, ErrStalePrice
+	}
+
+	lockedIn, err := lockedInQuantities(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the holding so concurrent redemptions and withdrawals can't both take the same shares
+	h, err := lockHolding(ctx, tx, userID, req.StockSymbol)
+	if err != nil {
+		return nil, err
+	}
+	if free := h.free(lockedIn[req.StockSymbol]); req.Quantity > free {
+		return nil, fmt.Errorf("%w: %v %s requested, %v redeemable", ErrInsufficientShares, req.Quantity, req.StockSymbol, free)
+	}
+
+	costValue, err := h.inventoryCost(ctx, tx, req.Quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	orderID := uuid.New()
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO broker_orders (id, broker, stock_symbol, side, quantity, status)
+		VALUES (@p1, @p2, @p3, @p4, @p5, @p6)
+	`, orderID, s.broker.Name(), req.StockSymbol, models.OrderSideSell, req.Quantity, models.OrderStatusNew)
+	if err != nil {
+		return nil, fmt.Errorf("error recording sell order: %w", err)
+	}
+
+	r := &models.Redemption{
+		ID:          uuid.New(),
+		UserID:      userID,
+		StockSymbol: req.StockSymbol,
+		Quantity:    req.Quantity,
+		Status:      models.RedemptionStatusPending,
+		OrderID:     &orderID,
+		Price:       price.Price,
+		PriceAsOf:   price.LastUpdated,
+	}
+	createdBy := auth.ActorFrom(ctx).ID
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO redemptions (id, user_id, stock_symbol, quantity, status, order_id, price, price_as_of, gross_value, brokerage, stt, gst,
+			net_proceeds, cost_value, realized_pnl, created_by)
+		VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8, 0, 0, 0, 0, 0, 0, 0, @p9)
+	`, r.ID, userID, r.StockSymbol, r.Quantity, r.Status, orderID, r.Price, r.PriceAsOf, createdBy)
+	if err != nil {
+		return nil, fmt.Errorf("error creating redemption: %w", err)
+	}
+
+	// The shares' cost waits in stock_pending_sale until the order is final
+	transactionID, err := postSaleReservation(ctx, tx, r, "stock_pending_sale", "stock_inventory", r.Quantity, costValue,
+		fmt.Sprintf("Stock reserved for sale: %s x %.6f", r.StockSymbol, r.Quantity))
+	if err != nil {
+		return nil, err
+	}
+
+	before, after, err := h.take(ctx, tx, req.Quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordAudit(ctx, tx, models.AuditHoldingRedeem, models.AuditEntityHolding, holdingEntityID(userID, req.StockSymbol),
+		map[string]interface{}{"quantity": before},
+		map[string]interface{}{"quantity": after, "redemption_id": r.ID, "transaction_id": transactionID},
+	)
+	if err != nil {
+		return nil, err
+	}
+	err = recordAudit(ctx, tx, models.AuditRedemptionCreate, models.AuditEntityRedemption, r.ID.String(), nil, map[string]interface{}{
+		"user_id":      userID,
+		"stock_symbol": r.StockSymbol,
+		"quantity":     r.Quantity,
+		"status":       r.Status,
+		"order_id":     orderID,
+		"price":        r.Price,
+		"price_as_of":  r.PriceAsOf,
+		"created_by":   createdBy,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"user_id":       userID,
+		"redemption_id": r.ID,
+		"order_id":      orderID,
+		"stock_symbol":  r.StockSymbol,
+		"quantity":      r.Quantity,
+	}).Info("Shares reserved for redemption")
+
+	PortfolioEvents().PublishUser(userID)
+
+	// The shares are already reserved, so a broker error leaves the sale for
+	// ProcessPendingRedemptions to retry rather than failing the request
+	if err := s.advanceSale(ctx, r.ID); err != nil {
+		logrus.WithContext(ctx).WithError(err).WithField("redemption_id", r.ID).Warn("Sell order not completed, will retry")
+	}
+
+	redemption, err = getRedemption(ctx, r.ID)
+	if err != nil {
+		return nil, err
+	}
+	if redemption.Status == models.RedemptionStatusFailed {
+		reason := ""
+		if redemption.FailureReason != nil {
+			reason = *redemption.FailureReason
+		}
+		return nil, fmt.Errorf("%w: %s", ErrSaleFailed, reason)
+	}
+	return redemption, nil
+}
+
+// ProcessPendingRedemptions follows the sell orders of pending redemptions
+// until they are final and books each one. It returns the number of
+// redemptions completed or failed.
+func (s *RedemptionService) ProcessPendingRedemptions(ctx context.Context) (finished int, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "RedemptionService.ProcessPendingRedemptions")
+	defer telemetry.EndSpan(span, &err)
+
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT id FROM redemptions WHERE status = @p1 ORDER BY created_at
+	`, models.RedemptionStatusPending)
+	if err != nil {
+		return 0, fmt.Errorf("error querying pending redemptions: %w", err)
+	}
+
+	var pending []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("error scanning pending redemption: %w", err)
+		}
+		pending = append(pending, id)
+	}
+	rows.Close()
+
+	for _, redemptionID := range pending {
+		if err := s.advanceSale(ctx, redemptionID); err != nil {
+			logrus.WithContext(ctx).WithError(err).WithField("redemption_id", redemptionID).Error("Error advancing sell order")
+			continue
+		}
+		r, err := getRedemption(ctx, redemptionID)
+		if err != nil {
+			return finished, err
+		}
+		if r.Status != models.RedemptionStatusPending {
+			finished++
+		}
+	}
+
+	if finished > 0 {
+		logrus.WithContext(ctx).WithField("count", finished).Info("Finished pending redemptions")
+	}
+	return finished, nil
+}
+
+// advanceSale takes one step on a pending redemption's sell order: it places
+// the order if needed, cancels it once it has been open too long, and books
+// the sale when it is final
+func (s *RedemptionService) advanceSale(ctx context.Context, redemptionID uuid.UUID) (err error) {
+	ctx, span := telemetry.StartSpan(ctx, "RedemptionService.advanceSale",
+		attribute.String("redemption_id", redemptionID.String()),
+		attribute.String("broker", s.broker.Name()),
+	)
+	defer telemetry.EndSpan(span, &err)
+
+	order := &models.BrokerOrder{}
+	err = database.DB.QueryRowContext(ctx, `
+		SELECT o.id, o.broker_order_id, o.stock_symbol, o.side, o.quantity, o.status, o.placed_at
+		FROM redemptions r
+		JOIN broker_orders o ON o.id = r.order_id
+		WHERE r.id = @p1 AND r.status = @p2
+	`, redemptionID, models.RedemptionStatusPending).Scan(&order.ID, &order.BrokerOrderID, &order.StockSymbol, &order.Side, &order.Quantity, &order.Status, &order.PlacedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error loading sell order: %w", err)
+	}
+	if order.Status != models.OrderStatusNew && order.Status != models.OrderStatusOpen {
+		return nil
+	}
+
+	var state OrderState
+	if order.BrokerOrderID == nil {
+		// The order row's ID is the client order ID, so a retry after a lost
+		// response finds the order already placed instead of selling twice
+		state, err = s.broker.PlaceOrder(ctx, OrderRequest{
+			ClientOrderID: order.ID.String(),
+			Symbol:        order.StockSymbol,
+			Side:          models.OrderSideSell,
+			Quantity:      order.Quantity,
+		})
+		if err != nil {
+			return fmt.Errorf("error placing sell order with %s: %w", s.broker.Name(), err)
+		}
+		now := time.Now().UTC()
+		order.PlacedAt = &now
+		_, err = database.DB.ExecContext(ctx, `
+			UPDATE broker_orders SET broker_order_id = @p1, status = @p2, placed_at = @p3, updated_at = GETUTCDATE()
+			WHERE id = @p4
+		`, state.BrokerOrderID, models.OrderStatusOpen, now, order.ID)
+		if err != nil {
+			return fmt.Errorf("error recording placed sell order: %w", err)
+		}
+		metrics.BrokerOrdersTotal.WithLabelValues(s.broker.Name(), models.OrderStatusOpen).Inc()
+	} else {
+		state, err = queryOrder(ctx, s.broker, order)
+		if err != nil {
+			return fmt.Errorf("error querying sell order with %s: %w", s.broker.Name(), err)
+		}
+	}
+
+	if !state.Final() && order.PlacedAt != nil && time.Since(*order.PlacedAt) > CurrentOrderOptions().FillTimeout {
+		state, err = s.broker.CancelOrder(ctx, state.BrokerOrderID)
+		if err != nil {
+			return fmt.Errorf("error cancelling sell order with %s: %w", s.broker.Name(), err)
+		}
+	}
+
+	if !state.Final() {
+		return nil
+	}
+
+	metrics.BrokerOrdersTotal.WithLabelValues(s.broker.Name(), state.Status).Inc()
+	return settleSale(ctx, redemptionID, order.ID, state)
+}
+
+// settleSale books a redemption whose sell order is final. The filled shares
+// are sold at the fill price less the broker's fees, with their cost and
+// realized P&L taken from the tax lots they leave; shares the order did not
+// sell go back to the holding. A redemption that sold nothing fails.
+func settleSale(ctx context.Context, redemptionID, orderID uuid.UUID, state OrderState) error {
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Guard on the order status so two workers can't book the same fill
+	settled, err := finishOrder(ctx, tx, orderID, state)
+	if err != nil || !settled {
+		return err
+	}
+
+	r := &models.Redemption{}
+	err = tx.QueryRowContext(ctx, `
+		SELECT `+redemptionColumnList+` FROM redemptions WITH (UPDLOCK, ROWLOCK) WHERE id = @p1
+	`, redemptionID).Scan(redemptionFields(r)...)
+	if err != nil {
+		return fmt.Errorf("error loading redemption: %w", err)
+	}
+	if r.Status != models.RedemptionStatusPending {
+		return nil
+	}
+	var reserved float64
+	err = tx.QueryRowContext(ctx, `
+		SELECT ISNULL(SUM(debit_amount - credit_amount), 0) FROM ledger_entries
+		WHERE account_type = 'stock_pending_sale' AND reference_id = @p1
+	`, redemptionID.String()).Scan(&reserved)
+	if err != nil {
+		return fmt.Errorf("error reading reserved stock cost: %w", err)
+	}
+
+	requested := r.Quantity
+	sold := math.Min(roundTo(state.FilledQuantity, quantityPlaces), requested)
+	unsold := roundTo(requested-sold, quantityPlaces)
+	soldCost := reserved
+	if unsold > 0 {
+		soldCost = roundTo(reserved*sold/requested, amountPlaces)
+	}
+
+	before := map[string]interface{}{"status": models.RedemptionStatusPending, "quantity": requested}
+	action := models.AuditRedemptionFail
+	now := time.Now().UTC()
+	if sold > 0 {
+		fees := OrderFees{
+			Brokerage: roundTo(state.Fees.Brokerage, amountPlaces),
+			STT:       roundTo(state.Fees.STT, amountPlaces),
+			GST:       roundTo(state.Fees.GST, amountPlaces),
+		}
+		r.Status = models.RedemptionStatusCompleted
+		r.Quantity = sold
+		r.Price = state.AveragePrice
+		r.PriceAsOf = now
+		r.GrossValue = roundTo(state.AveragePrice*sold, amountPlaces)
+		r.Brokerage, r.STT, r.GST = fees.Brokerage, fees.STT, fees.GST
+		r.NetProceeds = roundTo(r.GrossValue-fees.Total(), amountPlaces)
+
+		// Brokerage and GST are expenses of the transfer; STT is not deductible
+		lots, err := consumeLots(ctx, tx, r.UserID, r.StockSymbol, sold, models.DisposalRedemption, r.ID,
+			&lotSale{Value: r.GrossValue, Expenses: roundTo(r.Brokerage+r.GST, amountPlaces)})
+		if err != nil {
+			return err
+		}
+		// The P&L is the capital gain, so it matches the disposals and the
+		// tax statement: STT is not deducted and grandfathered lots are
+		// stepped up
+		r.CostValue = lots.Cost
+		r.RealizedPnL = lots.Gain
+
+		if _, err := postRedemption(ctx, tx, r, soldCost); err != nil {
+			return err
+		}
+		action = models.AuditRedemptionComplete
+	} else {
+		r.Status = models.RedemptionStatusFailed
+		reason := state.Reason
+		if reason == "" {
+			reason = "sell order " + state.Status + " without a fill"
+		}
+		r.FailureReason = &reason
+	}
+
+	if unsold > 0 {
+		// Unsold shares and their cost go back where they came from
+		transactionID, err := postSaleReservation(ctx, tx, r, "stock_inventory", "stock_pending_sale", unsold, roundTo(reserved-soldCost, amountPlaces),
+			fmt.Sprintf("Stock not sold: %s x %.6f", r.StockSymbol, unsold))
+		if err != nil {
+			return err
+		}
+		var holdingBefore, holdingAfter float64
+		err = tx.QueryRowContext(ctx, `
+			UPDATE user_holdings
+			SET quantity = quantity + @p1, settled_quantity = settled_quantity + @p1, updated_at = GETUTCDATE(), last_updated = GETUTCDATE()
+			OUTPUT deleted.quantity, inserted.quantity
+			WHERE user_id = @p2 AND stock_symbol = @p3
+		`, unsold, r.UserID, r.StockSymbol).Scan(&holdingBefore, &holdingAfter)
+		if err != nil {
+			return fmt.Errorf("error restoring holding for unsold shares: %w", err)
+		}
+		err = recordAudit(ctx, tx, models.AuditHoldingRestore, models.AuditEntityHolding, holdingEntityID(r.UserID, r.StockSymbol),
+			map[string]interface{}{"quantity": holdingBefore},
+			map[string]interface{}{"quantity": holdingAfter, "redemption_id": r.ID, "transaction_id": transactionID},
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE redemptions
+		SET status = @p1, quantity = @p2, price = @p3, price_as_of = @p4, gross_value = @p5, brokerage = @p6, stt = @p7, gst = @p8,
+			net_proceeds = @p9, cost_value = @p10, realized_pnl = @p11, failure_reason = @p12, updated_at = GETUTCDATE()
+		WHERE id = @p13
+	`, r.Status, r.Quantity, r.Price, r.PriceAsOf, r.GrossValue, r.Brokerage, r.STT, r.GST,
+		r.NetProceeds, r.CostValue, r.RealizedPnL, r.FailureReason, r.ID)
+	if err != nil {
+		return fmt.Errorf("error updating redemption: %w", err)
+	}
+
+	err = recordAudit(ctx, tx, action, models.AuditEntityRedemption, r.ID.String(), before, map[string]interface{}{
+		"status":          r.Status,
+		"quantity":        r.Quantity,
+		"broker_order_id": state.BrokerOrderID,
+		"order_status":    state.Status,
+		"price":           r.Price,
+		"gross_value":     r.GrossValue,
+		"fees":            roundTo(r.Brokerage+r.STT+r.GST, amountPlaces),
+		"net_proceeds":    r.NetProceeds,
+		"cost_value":      r.CostValue,
+		"realized_pnl":    r.RealizedPnL,
+		"reason":          state.Reason,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"user_id":         r.UserID,
+		"redemption_id":   r.ID,
+		"broker_order_id": state.BrokerOrderID,
+		"status":          r.Status,
+		"quantity":        r.Quantity,
+		"net_proceeds":    r.NetProceeds,
+	}).Info("Redemption settled")
+
+	PortfolioEvents().PublishUser(r.UserID)
+	return nil
+}
+
+// postSaleReservation writes a balanced pair of entries moving the cost of
+// quantity shares of a redemption from one stock account to another and
+// returns their transaction ID
+func postSaleReservation(ctx context.Context, tx *sql.Tx, r *models.Redemption, debitAccount, creditAccount string, quantity, cost float64, description string) (uuid.UUID, error) {
+	transactionID := uuid.New()
+	entries := []struct {
+		account       string
+		debit, credit float64
+	}{
+		{debitAccount, cost, 0},
+		{creditAccount, 0, cost},
+	}
+	for _, e := range entries {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO ledger_entries (transaction_id, user_id, account_type, account_symbol, debit_amount, credit_amount, stock_quantity, description, reference_id)
+			VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8, @p9)
+		`, transactionID, r.UserID, e.account, r.StockSymbol, e.debit, e.credit, quantity, description, r.ID.String())
+		if err != nil {
+			return uuid.Nil, fmt.Errorf("error creating redemption ledger entry: %w", err)
+		}
+	}
+	return transactionID, nil
+}
+
+// postRedemption writes a completed redemption's ledger entries and returns
+// their transaction ID. The sale brings in cash, which pays the fees and is
+// owed to the user through their wallet; the sold shares' cost moves from
+// stock pending sale to redeemed stock.
+func postRedemption(ctx context.Context, tx *sql.Tx, r *models.Redemption, cost float64) (uuid.UUID, error) {
+	transactionID := uuid.New()
+	fees := roundTo(r.GrossValue-r.NetProceeds, amountPlaces)
+	entries := []struct {
+		account, symbol string
+		debit, credit   float64
+		quantity        float64
+		description     string
+	}{
+		{"cash", "", r.GrossValue, 0, 0, fmt.Sprintf("Sale proceeds: %s x %.6f", r.StockSymbol, r.Quantity)},
+		{"cash", "", 0, fees, 0, fmt.Sprintf("Brokerage, STT, GST on sale of %s", r.StockSymbol)},
+		{"user_wallet", "", 0, r.NetProceeds, 0, fmt.Sprintf("Redemption of %s x %.6f", r.StockSymbol, r.Quantity)},
+		{"redeemed_stock", r.StockSymbol, cost, 0, r.Quantity, fmt.Sprintf("Cost of %s x %.6f redeemed", r.StockSymbol, r.Quantity)},
+		{"stock_pending_sale", r.StockSymbol, 0, cost, r.Quantity, fmt.Sprintf("Stock sold: %s x %.6f", r.StockSymbol, r.Quantity)},
+	}
+	for _, e := range entries {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO ledger_entries (transaction_id, user_id, account_type, account_symbol, debit_amount, credit_amount, stock_quantity, description, reference_id)
+			VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8, @p9)
+		`, transactionID, r.UserID, e.account, e.symbol, e.debit, e.credit, e.quantity, e.description, r.ID.String())
+		if err != nil {
+			return uuid.Nil, fmt.Errorf("error creating redemption ledger entry: %w", err)
+		}
+	}
+	return transactionID, checkBalanced(ctx, tx, transactionID)
+}
+
+// ListRedemptions returns a user's redemptions, newest first
+func (s *RedemptionService) ListRedemptions(ctx context.Context, userID uuid.UUID) (redemptions []models.Redemption, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "RedemptionService.ListRedemptions")
+	defer telemetry.EndSpan(span, &err)
+
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT `+redemptionColumnList+`
+		FROM redemptions
+		WHERE user_id = @p1
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying redemptions: %w", err)
+	}
+	defer rows.Close()
+
+	redemptions = []models.Redemption{}
+	for rows.Next() {
+		var r models.Redemption
+		if err := rows.Scan(redemptionFields(&r)...); err != nil {
+			return nil, fmt.Errorf("error scanning redemption: %w", err)
+		}
+		redemptions = append(redemptions, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading redemptions: %w", err)
+	}
+
+	return redemptions, nil
+}
+
+// redemptionColumnList selects a redemptions row, scanned with redemptionFields
+const redemptionColumnList = `id, user_id, stock_symbol, quantity, status, order_id, price, price_as_of, gross_value, brokerage, stt, gst,
+	net_proceeds, cost_value, realized_pnl, failure_reason, created_by, created_at, updated_at`
+
+// redemptionFields returns scan destinations matching redemptionColumnList
+func redemptionFields(r *models.Redemption) []interface{} {
+	return []interface{}{
+		&r.ID, &r.UserID, &r.StockSymbol, &r.Quantity, &r.Status, &r.OrderID, &r.Price, &r.PriceAsOf, &r.GrossValue, &r.Brokerage, &r.STT, &r.GST,
+		&r.NetProceeds, &r.CostValue, &r.RealizedPnL, &r.FailureReason, &r.CreatedBy, &r.CreatedAt, &r.UpdatedAt,
+	}
+}
+
+// getRedemption loads a redemption by ID
+func getRedemption(ctx context.Context, redemptionID uuid.UUID) (*models.Redemption, error) {
+	var r models.Redemption
+	err := database.DB.QueryRowContext(ctx,
+		"SELECT "+redemptionColumnList+" FROM redemptions WHERE id = @p1", redemptionID,
+	).Scan(redemptionFields(&r)...)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching redemption: %w", err)
+	}
+	return &r, nil
+}
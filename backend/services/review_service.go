@@ -0,0 +1,249 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"backend/auth"
+	"backend/database"
+	"backend/models"
+	"backend/telemetry"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	defaultReviewListLimit = 100
+	maxReviewListLimit     = 500
+)
+
+type ReviewService struct {
+	rewardService *RewardService
+}
+
+func NewReviewService() *ReviewService {
+	return &ReviewService{
+		rewardService: NewRewardService(),
+	}
+}
+
+// createReview queues a flagged reward for review in the reward's transaction
+func createReview(ctx context.Context, tx *sql.Tx, rewardID uuid.UUID, decision ruleDecision) error {
+	reviewID := uuid.New()
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO reward_reviews (id, reward_id, reason, details, status)
+		VALUES (@p1, @p2, @p3, @p4, @p5)
+	`, reviewID, rewardID, decision.reviewReason, nullString(decision.reviewDetails), models.ReviewStatusPending)
+	if err != nil {
+		return fmt.Errorf("error creating reward review: %w", err)
+	}
+
+	return recordAudit(ctx, tx, models.AuditReviewCreate, models.AuditEntityRewardReview, reviewID.String(), nil,
+		map[string]interface{}{"reward_id": rewardID, "reason": decision.reviewReason, "status": models.ReviewStatusPending},
+	)
+}
+
+// ListReviews returns reviews with the given status (all when empty), oldest first
+func (s *ReviewService) ListReviews(ctx context.Context, status string, limit int) (reviews []models.RewardReview, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "ReviewService.ListReviews", attribute.String("status", status))
+	defer telemetry.EndSpan(span, &err)
+
+	if limit <= 0 {
+		limit = defaultReviewListLimit
+	}
+	if limit > maxReviewListLimit {
+		return nil, fmt.Errorf("%w: limit must be at most %d", ErrInvalidRequest, maxReviewListLimit)
+	}
+	switch status {
+	case "", models.ReviewStatusPending, models.ReviewStatusApproved, models.ReviewStatusRejected:
+	default:
+		return nil, fmt.Errorf("%w: unknown review status %q", ErrInvalidRequest, status)
+	}
+
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT TOP (@p1)
+			rr.id, rr.reward_id, rr.reason, rr.details, rr.status, rr.decided_by, rr.decision_note, rr.decided_at, rr.created_at,
+			re.user_id, re.stock_symbol, re.quantity, re.reward_timestamp, re.event_type, re.reference_id, re.status, re.inr_value, re.created_by, re.created_at, re.updated_at
+		FROM reward_reviews rr
+		JOIN reward_events re ON re.id = rr.reward_id
+		WHERE @p2 = '' OR rr.status = @p2
+		ORDER BY rr.created_at
+	`, limit, status)
+	if err != nil {
+		return nil, fmt.Errorf("error querying reward reviews: %w", err)
+	}
+	defer rows.Close()
+
+	reviews = []models.RewardReview{}
+	for rows.Next() {
+		review := models.RewardReview{Reward: &models.RewardEvent{}}
+		err := rows.Scan(
+			&review.ID, &review.RewardID, &review.Reason, &review.Details, &review.Status,
+			&review.DecidedBy, &review.DecisionNote, &review.DecidedAt, &review.CreatedAt,
+			&review.Reward.UserID, &review.Reward.StockSymbol, &review.Reward.Quantity, &review.Reward.RewardTimestamp,
+			&review.Reward.EventType, &review.Reward.ReferenceID, &review.Reward.Status, &review.Reward.InrValue,
+			&review.Reward.CreatedBy, &review.Reward.CreatedAt, &review.Reward.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning reward review: %w", err)
+		}
+		review.Reward.ID = review.RewardID
+		reviews = append(reviews, review)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading reward reviews: %w", err)
+	}
+
+	return reviews, nil
+}
+
+// ApproveReview releases a flagged reward. Its shares are bought if the
+// price is fresh enough, and it is queued for the next price refresh otherwise.
+// Reviewers may not decide on rewards they created.
+func (s *ReviewService) ApproveReview(ctx context.Context, reviewID uuid.UUID, note string) (review *models.RewardReview, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "ReviewService.ApproveReview")
+	defer telemetry.EndSpan(span, &err)
+
+	return s.decide(ctx, reviewID, models.ReviewStatusApproved, note)
+}
+
+// RejectReview turns a flagged reward down; it is never posted
+func (s *ReviewService) RejectReview(ctx context.Context, reviewID uuid.UUID, note string) (review *models.RewardReview, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "ReviewService.RejectReview")
+	defer telemetry.EndSpan(span, &err)
+
+	return s.decide(ctx, reviewID, models.ReviewStatusRejected, note)
+}
+
+func (s *ReviewService) decide(ctx context.Context, reviewID uuid.UUID, decision, note string) (*models.RewardReview, error) {
+	reward, err := s.reviewedReward(ctx, reviewID)
+	if err != nil {
+		return nil, err
+	}
+	actor := auth.ActorFrom(ctx)
+	if err := checkNotCreator(reward, actor, CurrentRewardRules().enteredByHand(reward.EventType)); err != nil {
+		return nil, err
+	}
+
+	// Check the price before taking locks; approval of a reward whose
+	// price has gone stale queues it like any other
+	rewardStatus := models.RewardStatusRejected
+	if decision == models.ReviewStatusApproved {
+		_, fresh, err := s.rewardService.getCurrentStockPrice(ctx, reward.StockSymbol)
+		if err != nil {
+			return nil, fmt.Errorf("error getting stock price: %w", err)
+		}
+		rewardStatus = models.RewardStatusPending
+		if !fresh {
+			rewardStatus = models.RewardStatusQueued
+		}
+	}
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Guard on the status so two reviewers can't both decide
+	result, err := tx.ExecContext(ctx, `
+		UPDATE reward_reviews
+		SET status = @p1, decided_by = @p2, decision_note = @p3, decided_at = GETUTCDATE()
+		WHERE id = @p4 AND status = @p5
+	`, decision, actor.ID, nullString(note), reviewID, models.ReviewStatusPending)
+	if err != nil {
+		return nil, fmt.Errorf("error updating reward review: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return nil, ErrReviewDecided
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE reward_events SET status = @p1, updated_at = GETUTCDATE()
+		WHERE id = @p2 AND status = @p3
+	`, rewardStatus, reward.ID, models.RewardStatusUnderReview)
+	if err != nil {
+		return nil, fmt.Errorf("error updating reviewed reward: %w", err)
+	}
+
+	action := models.AuditReviewApprove
+	if decision == models.ReviewStatusRejected {
+		action = models.AuditReviewReject
+	}
+	err = recordAudit(ctx, tx, action, models.AuditEntityRewardReview, reviewID.String(),
+		map[string]interface{}{"status": models.ReviewStatusPending},
+		map[string]interface{}{"status": decision, "note": note},
+	)
+	if err != nil {
+		return nil, err
+	}
+	err = recordAudit(ctx, tx, models.AuditRewardReviewed, models.AuditEntityRewardEvent, reward.ID.String(),
+		map[string]interface{}{"status": models.RewardStatusUnderReview},
+		map[string]interface{}{"status": rewardStatus, "review_id": reviewID},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"review_id":     reviewID,
+		"reward_id":     reward.ID,
+		"decision":      decision,
+		"reward_status": rewardStatus,
+	}).Info("Reward review decided")
+
+	if rewardStatus == models.RewardStatusPending {
+		s.rewardService.startFulfilment(ctx, reward.ID)
+	}
+
+	return s.getReview(ctx, reviewID)
+}
+
+// reviewedReward loads the reward a pending review is about
+func (s *ReviewService) reviewedReward(ctx context.Context, reviewID uuid.UUID) (*models.RewardEvent, error) {
+	reward := &models.RewardEvent{}
+	var reviewStatus string
+	err := database.DB.QueryRowContext(ctx, `
+		SELECT rr.status, re.id, re.user_id, re.stock_symbol, re.quantity, re.event_type, re.reference_id, re.created_by
+		FROM reward_reviews rr
+		JOIN reward_events re ON re.id = rr.reward_id
+		WHERE rr.id = @p1
+	`, reviewID).Scan(&reviewStatus, &reward.ID, &reward.UserID, &reward.StockSymbol, &reward.Quantity, &reward.EventType, &reward.ReferenceID, &reward.CreatedBy)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrReviewNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading reward review: %w", err)
+	}
+	if reviewStatus != models.ReviewStatusPending {
+		return nil, ErrReviewDecided
+	}
+	return reward, nil
+}
+
+// getReview reads one review by ID
+func (s *ReviewService) getReview(ctx context.Context, reviewID uuid.UUID) (*models.RewardReview, error) {
+	review := &models.RewardReview{}
+	err := database.DB.QueryRowContext(ctx, `
+		SELECT id, reward_id, reason, details, status, decided_by, decision_note, decided_at, created_at
+		FROM reward_reviews WHERE id = @p1
+	`, reviewID).Scan(
+		&review.ID, &review.RewardID, &review.Reason, &review.Details, &review.Status,
+		&review.DecidedBy, &review.DecisionNote, &review.DecidedAt, &review.CreatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrReviewNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading reward review: %w", err)
+	}
+	return review, nil
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"backend/auth"
+	"backend/database"
+	"backend/models"
+	"backend/telemetry"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ApproveReward is the checker's half of maker-checker: it buys the shares for
+// a reward waiting for approval, or queues it if the price is too old.
+// The approver must not be the actor who created the reward.
+func (s *RewardService) ApproveReward(ctx context.Context, rewardID uuid.UUID, note string) (reward *models.RewardEvent, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "RewardService.ApproveReward", attribute.String("reward_id", rewardID.String()))
+	defer telemetry.EndSpan(span, &err)
+
+	return s.decideApproval(ctx, rewardID, true, note)
+}
+
+// RejectReward turns down a reward waiting for approval; it is never posted.
+// Like approval, it must come from someone other than the creator.
+func (s *RewardService) RejectReward(ctx context.Context, rewardID uuid.UUID, note string) (reward *models.RewardEvent, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "RewardService.RejectReward", attribute.String("reward_id", rewardID.String()))
+	defer telemetry.EndSpan(span, &err)
+
+	return s.decideApproval(ctx, rewardID, false, note)
+}
+
+func (s *RewardService) decideApproval(ctx context.Context, rewardID uuid.UUID, approve bool, note string) (*models.RewardEvent, error) {
+	reward, err := getReward(ctx, rewardID)
+	if err != nil {
+		return nil, err
+	}
+	if reward.Status != models.RewardStatusPendingApproval {
+		return nil, ErrRewardNotPendingApproval
+	}
+	actor := auth.ActorFrom(ctx)
+	if err := checkNotCreator(reward, actor, true); err != nil {
+		return nil, err
+	}
+
+	status := models.RewardStatusRejected
+	action := models.AuditRewardReject
+	if approve {
+		_, fresh, err := s.getCurrentStockPrice(ctx, reward.StockSymbol)
+		if err != nil {
+			return nil, fmt.Errorf("error getting stock price: %w", err)
+		}
+		status = models.RewardStatusPending
+		if !fresh {
+			status = models.RewardStatusQueued
+		}
+		action = models.AuditRewardApprove
+	}
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Guard on the status so two approvers can't both decide
+	result, err := tx.ExecContext(ctx, `
+		UPDATE reward_events SET status = @p1, updated_at = GETUTCDATE()
+		WHERE id = @p2 AND status = @p3
+	`, status, rewardID, models.RewardStatusPendingApproval)
+	if err != nil {
+		return nil, fmt.Errorf("error updating reward status: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return nil, ErrRewardNotPendingApproval
+	}
+
+	err = recordAudit(ctx, tx, action, models.AuditEntityRewardEvent, rewardID.String(),
+		map[string]interface{}{"status": models.RewardStatusPendingApproval},
+		map[string]interface{}{"status": status, "note": note},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"reward_id": rewardID,
+		"approved":  approve,
+		"status":    status,
+	}).Info("Reward approval decided")
+
+	if status == models.RewardStatusPending {
+		s.startFulfilment(ctx, rewardID)
+	}
+
+	return getReward(ctx, rewardID)
+}
+
+// checkNotCreator refuses a decision on reward by the actor who created it.
+// With requireMaker it also refuses rewards whose creator is unknown or
+// anonymous, since anyone could then be their creator.
+func checkNotCreator(reward *models.RewardEvent, actor auth.Actor, requireMaker bool) error {
+	if requireMaker && (reward.CreatedBy == nil || *reward.CreatedBy == auth.Anonymous.ID) {
+		return ErrUnknownMaker
+	}
+	if reward.CreatedBy != nil && *reward.CreatedBy == actor.ID && actor != auth.Anonymous {
+		return ErrSelfApproval
+	}
+	return nil
+}
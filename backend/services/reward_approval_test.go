@@ -0,0 +1,43 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"backend/auth"
+	"backend/models"
+)
+
+func TestCheckNotCreator(t *testing.T) {
+	maker := "ops-alice"
+	anonymous := auth.Anonymous.ID
+	checker := auth.Actor{ID: "ops-bob"}
+
+	tests := []struct {
+		name         string
+		createdBy    *string
+		actor        auth.Actor
+		requireMaker bool
+		want         error
+	}{
+		{"another actor", &maker, checker, false, nil},
+		{"another actor, maker required", &maker, checker, true, nil},
+		{"the creator", &maker, auth.Actor{ID: maker}, false, ErrSelfApproval},
+		{"the creator, maker required", &maker, auth.Actor{ID: maker}, true, ErrSelfApproval},
+		{"unknown creator", nil, checker, false, nil},
+		{"unknown creator, maker required", nil, checker, true, ErrUnknownMaker},
+		{"anonymous creator", &anonymous, checker, false, nil},
+		{"anonymous creator, maker required", &anonymous, checker, true, ErrUnknownMaker},
+		{"anonymous creator and actor", &anonymous, auth.Anonymous, false, nil},
+		{"anonymous creator and actor, maker required", &anonymous, auth.Anonymous, true, ErrUnknownMaker},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reward := &models.RewardEvent{CreatedBy: tt.createdBy}
+			if err := checkNotCreator(reward, tt.actor, tt.requireMaker); !errors.Is(err, tt.want) {
+				t.Errorf("checkNotCreator = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,513 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"backend/database"
+	"backend/metrics"
+	"backend/models"
+	"backend/telemetry"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ProcessPendingRewards moves pending rewards towards a fill. Rewards not yet
+// in an order are batched into one order per symbol once the oldest has
+// waited the aggregation window; orders not yet placed are placed, open ones
+// are checked, and final ones are allocated back to their rewards. Buy orders
+// for reinvested dividends are left to ProcessPendingReinvestments. It
+// returns the number of rewards fulfilled.
+func (s *RewardService) ProcessPendingRewards(ctx context.Context) (fulfilled int, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "RewardService.ProcessPendingRewards")
+	defer telemetry.EndSpan(span, &err)
+
+	if err := s.batchPendingRewards(ctx, time.Now().UTC()); err != nil {
+		return 0, err
+	}
+
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT id FROM broker_orders o
+		WHERE side = @p1 AND status IN (@p2, @p3)
+			AND NOT EXISTS (SELECT 1 FROM dividend_payments p WHERE p.order_id = o.id)
+		ORDER BY created_at
+	`, models.OrderSideBuy, models.OrderStatusNew, models.OrderStatusOpen)
+	if err != nil {
+		return 0, fmt.Errorf("error querying open orders: %w", err)
+	}
+
+	var open []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("error scanning open order: %w", err)
+		}
+		open = append(open, id)
+	}
+	rows.Close()
+
+	for _, orderID := range open {
+		n, err := s.advanceOrder(ctx, orderID)
+		if err != nil {
+			logrus.WithContext(ctx).WithError(err).WithField("order_id", orderID).Error("Error advancing reward order")
+			continue
+		}
+		fulfilled += n
+	}
+
+	if fulfilled > 0 {
+		logrus.WithContext(ctx).WithField("count", fulfilled).Info("Fulfilled pending rewards")
+	}
+
+	return fulfilled, nil
+}
+
+// startFulfilment places the buy order for a reward that just became pending.
+// With an aggregation window the reward instead waits for
+// ProcessPendingRewards to batch it. Failures are only logged: the reward
+// stays pending and ProcessPendingRewards retries it.
+func (s *RewardService) startFulfilment(ctx context.Context, rewardID uuid.UUID) {
+	if CurrentOrderOptions().AggregationWindow > 0 {
+		return
+	}
+
+	log := logrus.WithContext(ctx).WithField("reward_id", rewardID)
+	reward, err := getReward(ctx, rewardID)
+	if err != nil {
+		log.WithError(err).Warn("Reward order not placed, will retry")
+		return
+	}
+	orderID, err := s.createOrder(ctx, reward.StockSymbol, []models.RewardEvent{*reward})
+	if err != nil {
+		log.WithError(err).Warn("Reward order not placed, will retry")
+		return
+	}
+	if _, err := s.advanceOrder(ctx, orderID); err != nil {
+		log.WithError(err).WithField("order_id", orderID).Warn("Reward order not completed, will retry")
+	}
+}
+
+// batchPendingRewards puts pending rewards that are in no order yet into
+// orders: one per reward without an aggregation window, otherwise one per
+// symbol once that symbol's oldest reward has waited the whole window
+func (s *RewardService) batchPendingRewards(ctx context.Context, now time.Time) error {
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT re.id, re.stock_symbol, re.quantity, re.created_at
+		FROM reward_events re
+		WHERE re.status = @p1 AND re.deleted_at IS NULL
+			AND NOT EXISTS (SELECT 1 FROM broker_order_allocations a WHERE a.reward_id = re.id)
+		ORDER BY re.stock_symbol, re.created_at
+	`, models.RewardStatusPending)
+	if err != nil {
+		return fmt.Errorf("error querying unordered rewards: %w", err)
+	}
+
+	var symbols []string
+	bySymbol := make(map[string][]models.RewardEvent)
+	for rows.Next() {
+		var reward models.RewardEvent
+		if err := rows.Scan(&reward.ID, &reward.StockSymbol, &reward.Quantity, &reward.CreatedAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning unordered reward: %w", err)
+		}
+		if _, ok := bySymbol[reward.StockSymbol]; !ok {
+			symbols = append(symbols, reward.StockSymbol)
+		}
+		bySymbol[reward.StockSymbol] = append(bySymbol[reward.StockSymbol], reward)
+	}
+	rows.Close()
+
+	window := CurrentOrderOptions().AggregationWindow
+	for _, symbol := range symbols {
+		rewards := bySymbol[symbol]
+
+		var batches [][]models.RewardEvent
+		switch {
+		case window <= 0:
+			for _, reward := range rewards {
+				batches = append(batches, []models.RewardEvent{reward})
+			}
+		case now.Sub(rewards[0].CreatedAt) >= window:
+			batches = append(batches, rewards)
+		}
+
+		for _, batch := range batches {
+			orderID, err := s.createOrder(ctx, symbol, batch)
+			if err != nil {
+				logrus.WithContext(ctx).WithError(err).WithField("stock_symbol", symbol).Error("Error creating reward order")
+				continue
+			}
+			logrus.WithContext(ctx).WithFields(logrus.Fields{
+				"order_id":     orderID,
+				"stock_symbol": symbol,
+				"rewards":      len(batch),
+			}).Info("Created reward order")
+		}
+	}
+
+	return nil
+}
+
+// createOrder records one buy order for rewards of the same symbol, with an
+// allocation of each reward's requested quantity. The unique allocation per
+// reward keeps a reward from being bought twice.
+func (s *RewardService) createOrder(ctx context.Context, symbol string, rewards []models.RewardEvent) (orderID uuid.UUID, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "RewardService.createOrder",
+		attribute.String("stock_symbol", symbol),
+		attribute.Int("rewards", len(rewards)),
+	)
+	defer telemetry.EndSpan(span, &err)
+
+	var quantity float64
+	for _, reward := range rewards {
+		quantity += reward.Quantity
+	}
+
+	// Only an order for a single reward records it on the order itself
+	var rewardID uuid.NullUUID
+	if len(rewards) == 1 {
+		rewardID = uuid.NullUUID{UUID: rewards[0].ID, Valid: true}
+	}
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	orderID = uuid.New()
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO broker_orders (id, reward_id, broker, stock_symbol, side, quantity, status)
+		VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7)
+	`, orderID, rewardID, s.broker.Name(), symbol, models.OrderSideBuy, roundTo(quantity, quantityPlaces), models.OrderStatusNew)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("error recording reward order: %w", err)
+	}
+
+	for _, reward := range rewards {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO broker_order_allocations (order_id, reward_id, quantity)
+			VALUES (@p1, @p2, @p3)
+		`, orderID, reward.ID, reward.Quantity)
+		if err != nil {
+			return uuid.Nil, fmt.Errorf("error allocating reward %s to order: %w", reward.ID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return uuid.Nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return orderID, nil
+}
+
+// advanceOrder takes one step on a buy order: it places the order if needed,
+// cancels it once it has been open too long, and settles it when it is final.
+// It returns the number of rewards fulfilled.
+func (s *RewardService) advanceOrder(ctx context.Context, orderID uuid.UUID) (fulfilled int, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "RewardService.advanceOrder",
+		attribute.String("order_id", orderID.String()),
+		attribute.String("broker", s.broker.Name()),
+	)
+	defer telemetry.EndSpan(span, &err)
+
+	order := &models.BrokerOrder{}
+	err = database.DB.QueryRowContext(ctx, `
+		SELECT id, broker_order_id, stock_symbol, side, quantity, status, placed_at
+		FROM broker_orders WHERE id = @p1
+	`, orderID).Scan(&order.ID, &order.BrokerOrderID, &order.StockSymbol, &order.Side, &order.Quantity, &order.Status, &order.PlacedAt)
+	if err != nil {
+		return 0, fmt.Errorf("error loading reward order: %w", err)
+	}
+	if order.Status != models.OrderStatusNew && order.Status != models.OrderStatusOpen {
+		return 0, nil
+	}
+
+	var state OrderState
+	if order.BrokerOrderID == nil {
+		// The order row's ID is the client order ID, so a retry after a lost
+		// response finds the order already placed instead of buying twice
+		state, err = s.broker.PlaceOrder(ctx, OrderRequest{
+			ClientOrderID: order.ID.String(),
+			Symbol:        order.StockSymbol,
+			Side:          models.OrderSideBuy,
+			Quantity:      order.Quantity,
+		})
+		if err != nil {
+			return 0, fmt.Errorf("error placing order with %s: %w", s.broker.Name(), err)
+		}
+		now := time.Now().UTC()
+		order.PlacedAt = &now
+		_, err = database.DB.ExecContext(ctx, `
+			UPDATE broker_orders SET broker_order_id = @p1, status = @p2, placed_at = @p3, updated_at = GETUTCDATE()
+			WHERE id = @p4
+		`, state.BrokerOrderID, models.OrderStatusOpen, now, order.ID)
+		if err != nil {
+			return 0, fmt.Errorf("error recording placed order: %w", err)
+		}
+		metrics.BrokerOrdersTotal.WithLabelValues(s.broker.Name(), models.OrderStatusOpen).Inc()
+	} else {
+		state, err = queryOrder(ctx, s.broker, order)
+		if err != nil {
+			return 0, fmt.Errorf("error querying order with %s: %w", s.broker.Name(), err)
+		}
+	}
+
+	if !state.Final() && order.PlacedAt != nil && time.Since(*order.PlacedAt) > CurrentOrderOptions().FillTimeout {
+		state, err = s.broker.CancelOrder(ctx, state.BrokerOrderID)
+		if err != nil {
+			return 0, fmt.Errorf("error cancelling order with %s: %w", s.broker.Name(), err)
+		}
+	}
+
+	if !state.Final() {
+		return 0, nil
+	}
+
+	metrics.BrokerOrdersTotal.WithLabelValues(s.broker.Name(), state.Status).Inc()
+	return s.settleOrder(ctx, order.ID, state)
+}
+
+// settleOrder splits a final order's fill and fees across its rewards in
+// proportion to what each requested, and posts each reward's share to the
+// ledger and holdings. A cancelled order keeps whatever part of it filled;
+// rewards left with no share fail. It returns the number of rewards fulfilled.
+func (s *RewardService) settleOrder(ctx context.Context, orderID uuid.UUID, state OrderState) (int, error) {
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Guard on the order status so two workers can't settle the same fill
+	settled, err := finishOrder(ctx, tx, orderID, state)
+	if err != nil || !settled {
+		return 0, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT re.id, re.user_id, re.stock_symbol, re.reference_id, re.status, re.reward_timestamp,
+			`+vestingColumnList+`, a.quantity
+		FROM broker_order_allocations a
+		JOIN reward_events re ON re.id = a.reward_id
+		WHERE a.order_id = @p1
+		ORDER BY a.created_at, a.id
+	`, orderID)
+	if err != nil {
+		return 0, fmt.Errorf("error loading order allocations: %w", err)
+	}
+	var rewards []models.RewardEvent
+	var requested []float64
+	for rows.Next() {
+		var reward models.RewardEvent
+		var vesting vestingColumns
+		err := rows.Scan(&reward.ID, &reward.UserID, &reward.StockSymbol, &reward.ReferenceID, &reward.Status, &reward.RewardTimestamp,
+			&vesting.cliff, &vesting.duration, &vesting.interval, &vesting.lockIn, &reward.Quantity)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("error scanning order allocation: %w", err)
+		}
+		reward.Vesting = vesting.schedule()
+		rewards = append(rewards, reward)
+		requested = append(requested, reward.Quantity)
+	}
+	rows.Close()
+
+	shares := allocateFill(requested, state)
+
+	var fulfilledUsers []uuid.UUID
+	failed := 0
+	for i, reward := range rewards {
+		share := shares[i]
+		var fillPrice sql.NullFloat64
+		if share.FilledQuantity > 0 {
+			fillPrice = sql.NullFloat64{Float64: share.AveragePrice, Valid: true}
+		}
+		_, err := tx.ExecContext(ctx, `
+			UPDATE broker_order_allocations
+			SET filled_quantity = @p1, fill_price = @p2, brokerage = @p3, stt = @p4, gst = @p5
+			WHERE order_id = @p6 AND reward_id = @p7
+		`, share.FilledQuantity, fillPrice, share.Fees.Brokerage, share.Fees.STT, share.Fees.GST, orderID, reward.ID)
+		if err != nil {
+			return 0, fmt.Errorf("error recording allocation for reward %s: %w", reward.ID, err)
+		}
+
+		// A reward deleted while its order was open keeps its share unposted
+		if reward.Status != models.RewardStatusPending {
+			continue
+		}
+
+		if share.FilledQuantity > 0 {
+			if err := fulfilFromShare(ctx, tx, reward, orderID, share); err != nil {
+				return 0, err
+			}
+			fulfilledUsers = append(fulfilledUsers, reward.UserID)
+		} else {
+			if err := failFromOrder(ctx, tx, reward, orderID, state); err != nil {
+				return 0, err
+			}
+			failed++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"order_id":        orderID,
+		"broker_order_id": state.BrokerOrderID,
+		"order_status":    state.Status,
+		"filled_quantity": state.FilledQuantity,
+		"fill_price":      state.AveragePrice,
+		"fulfilled":       len(fulfilledUsers),
+		"failed":          failed,
+	}).Info("Reward order settled")
+
+	for _, userID := range fulfilledUsers {
+		PortfolioEvents().PublishUser(userID)
+	}
+	return len(fulfilledUsers), nil
+}
+
+// fulfilFromShare marks a reward fulfilled and posts its share of an order's
+// fill. The shares count as unsettled until SettleRewards runs on the
+// settlement date.
+func fulfilFromShare(ctx context.Context, tx *sql.Tx, reward models.RewardEvent, orderID uuid.UUID, share OrderState) error {
+	tradeDate, settlementDate := settlementDates(time.Now())
+	_, err := tx.ExecContext(ctx, `
+		UPDATE reward_events SET status = @p1, trade_date = @p2, settlement_date = @p3, updated_at = GETUTCDATE()
+		WHERE id = @p4 AND status = @p5
+	`, models.RewardStatusFulfilled, tradeDate, settlementDate, reward.ID, models.RewardStatusPending)
+	if err != nil {
+		return fmt.Errorf("error fulfilling reward: %w", err)
+	}
+
+	err = recordAudit(ctx, tx, models.AuditRewardPost, models.AuditEntityRewardEvent, reward.ID.String(),
+		map[string]interface{}{"status": models.RewardStatusPending},
+		map[string]interface{}{
+			"status":          models.RewardStatusFulfilled,
+			"order_id":        orderID,
+			"broker_order_id": share.BrokerOrderID,
+			"filled_quantity": share.FilledQuantity,
+			"fill_price":      share.AveragePrice,
+			"fees":            share.Fees.Total(),
+			"trade_date":      tradeDate.Format("2006-01-02"),
+			"settlement_date": settlementDate.Format("2006-01-02"),
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	// Shares that vest over time stay in unvested stock until each tranche
+	// vests; the others are acquired now, at the fair market value on the
+	// grant date they are taxed at as a perquisite
+	if reward.Vesting == nil {
+		if err := postReward(ctx, tx, reward.UserID, reward.StockSymbol, reward.ReferenceID, share, "stock_inventory"); err != nil {
+			return err
+		}
+		cost, err := perquisiteFMV(ctx, tx, reward.ID, reward.StockSymbol, reward.RewardTimestamp.In(IST), share.AveragePrice)
+		if err != nil {
+			return err
+		}
+		return createLot(ctx, tx, models.TaxLot{
+			UserID:       reward.UserID,
+			StockSymbol:  reward.StockSymbol,
+			Source:       models.LotSourceReward,
+			SourceID:     reward.ID,
+			AcquiredOn:   tradeDate,
+			Quantity:     share.FilledQuantity,
+			CostPerShare: cost,
+		})
+	}
+	if err := postReward(ctx, tx, reward.UserID, reward.StockSymbol, reward.ReferenceID, share, "unvested_stock"); err != nil {
+		return err
+	}
+	return createTranches(ctx, tx, reward, share.FilledQuantity, share.AveragePrice)
+}
+
+// failFromOrder marks a reward failed after its order ended without filling any of its share
+func failFromOrder(ctx context.Context, tx *sql.Tx, reward models.RewardEvent, orderID uuid.UUID, state OrderState) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE reward_events SET status = @p1, updated_at = GETUTCDATE()
+		WHERE id = @p2 AND status = @p3
+	`, models.RewardStatusFailed, reward.ID, models.RewardStatusPending)
+	if err != nil {
+		return fmt.Errorf("error failing reward: %w", err)
+	}
+
+	return recordAudit(ctx, tx, models.AuditRewardFail, models.AuditEntityRewardEvent, reward.ID.String(),
+		map[string]interface{}{"status": models.RewardStatusPending},
+		map[string]interface{}{
+			"status":          models.RewardStatusFailed,
+			"order_id":        orderID,
+			"broker_order_id": state.BrokerOrderID,
+			"order_status":    state.Status,
+			"reason":          state.Reason,
+		},
+	)
+}
+
+// queryOrder returns the broker's state of a placed order. An order the broker
+// has lost, such as the simulated broker's orders after a restart, is placed
+// again under its own ID as the client order ID: a broker that still knows it
+// by that ID returns it unchanged, and one that does not places it afresh.
+// The order keeps its original placed_at, so the fill timeout still runs from
+// the first placement.
+func queryOrder(ctx context.Context, broker Broker, order *models.BrokerOrder) (OrderState, error) {
+	state, err := broker.QueryOrder(ctx, *order.BrokerOrderID)
+	if !errors.Is(err, ErrUnknownOrder) {
+		return state, err
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"order_id":        order.ID,
+		"broker_order_id": *order.BrokerOrderID,
+	}).Warn("Broker has no record of the order, placing it again")
+	state, err = broker.PlaceOrder(ctx, OrderRequest{
+		ClientOrderID: order.ID.String(),
+		Symbol:        order.StockSymbol,
+		Side:          order.Side,
+		Quantity:      order.Quantity,
+	})
+	if err != nil {
+		return OrderState{}, fmt.Errorf("error placing lost order again: %w", err)
+	}
+	_, err = database.DB.ExecContext(ctx, `
+		UPDATE broker_orders SET broker_order_id = @p1, updated_at = GETUTCDATE()
+		WHERE id = @p2 AND status IN (@p3, @p4)
+	`, state.BrokerOrderID, order.ID, models.OrderStatusNew, models.OrderStatusOpen)
+	if err != nil {
+		return OrderState{}, fmt.Errorf("error recording placed order: %w", err)
+	}
+	return state, nil
+}
+
+// finishOrder stores the final state of an order that is still new or open.
+// It reports false when another worker has already settled the order.
+func finishOrder(ctx context.Context, tx *sql.Tx, orderID uuid.UUID, state OrderState) (bool, error) {
+	var fillPrice sql.NullFloat64
+	var filledAt sql.NullTime
+	if state.FilledQuantity > 0 {
+		fillPrice = sql.NullFloat64{Float64: state.AveragePrice, Valid: true}
+		filledAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+	}
+	result, err := tx.ExecContext(ctx, `
+		UPDATE broker_orders
+		SET status = @p1, filled_quantity = @p2, fill_price = @p3, brokerage = @p4, stt = @p5, gst = @p6,
+			error_message = @p7, filled_at = @p8, updated_at = GETUTCDATE()
+		WHERE id = @p9 AND status IN (@p10, @p11)
+	`, state.Status, state.FilledQuantity, fillPrice, state.Fees.Brokerage, state.Fees.STT, state.Fees.GST,
+		nullString(state.Reason), filledAt, orderID, models.OrderStatusNew, models.OrderStatusOpen)
+	if err != nil {
+		return false, fmt.Errorf("error updating broker order: %w", err)
+	}
+	affected, _ := result.RowsAffected()
+	return affected > 0, nil
+}
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"backend/models"
+	"backend/ratelimit"
+
+	"github.com/google/uuid"
+)
+
+// Rule names, reported in RuleViolation and reward_reviews.reason
+const (
+	RuleMaxQuantity       = "max_quantity"
+	RuleUserDailyINRCap   = "user_daily_inr_cap"
+	RuleEventTypeDailyCap = "event_type_daily_inr_cap"
+	RuleReferenceVelocity = "reference_velocity"
+	RuleRewardRateAnomaly = "reward_rate_anomaly"
+)
+
+// referenceSourceSeparator splits a reference_id into its source and the
+// event within it, e.g. "campaign-42:user-7" has source "campaign-42"
+const referenceSourceSeparator = ":"
+
+// RewardRules are the checks run on every reward before it is issued.
+// A zero value disables the corresponding rule.
+type RewardRules struct {
+	// MaxQuantity is the most shares a single reward may grant
+	MaxQuantity float64
+	// UserDailyINRCap is the most INR value a user may be rewarded per IST day
+	UserDailyINRCap float64
+	// EventTypeDailyINRCaps caps the INR value per user per IST day for each event type
+	EventTypeDailyINRCaps map[string]float64
+	// ReferenceVelocity limits how many rewards one reference source may create per period
+	ReferenceVelocity ratelimit.Limit
+	// AnomalyRewardsPerMinute sends a reward to review when the user already
+	// received this many in the last minute
+	AnomalyRewardsPerMinute int
+	// ApprovalEventTypes are event types entered by hand, e.g. manual grants and
+	// adjustments. Rewards of these types worth at least ApprovalINRThreshold
+	// wait for a second person to approve them.
+	ApprovalEventTypes   []string
+	ApprovalINRThreshold float64
+}
+
+// DefaultRewardRules are deliberately loose; deployments tighten them per campaign
+func DefaultRewardRules() RewardRules {
+	return RewardRules{
+		MaxQuantity:             1000,
+		UserDailyINRCap:         500000,
+		EventTypeDailyINRCaps:   map[string]float64{},
+		ReferenceVelocity:       ratelimit.Limit{Requests: 100, Period: time.Hour},
+		AnomalyRewardsPerMinute: 5,
+		ApprovalEventTypes:      []string{"manual", "adjustment"},
+		ApprovalINRThreshold:    10000,
+	}
+}
+
+// Validate checks the rules for negative limits
+func (r RewardRules) Validate() error {
+	if r.MaxQuantity < 0 {
+		return fmt.Errorf("max_quantity must not be negative, got %v", r.MaxQuantity)
+	}
+	if r.UserDailyINRCap < 0 {
+		return fmt.Errorf("user_daily_inr_cap must not be negative, got %v", r.UserDailyINRCap)
+	}
+	for eventType, limit := range r.EventTypeDailyINRCaps {
+		if limit < 0 {
+			return fmt.Errorf("daily INR cap for event type %q must not be negative, got %v", eventType, limit)
+		}
+	}
+	if r.AnomalyRewardsPerMinute < 0 {
+		return fmt.Errorf("anomaly_rewards_per_minute must not be negative, got %d", r.AnomalyRewardsPerMinute)
+	}
+	if r.ApprovalINRThreshold < 0 {
+		return fmt.Errorf("approval_inr_threshold must not be negative, got %v", r.ApprovalINRThreshold)
+	}
+	return nil
+}
+
+// RuleViolation is returned when a reward breaks a hard limit.
+// It matches ErrRewardLimitExceeded with errors.Is.
+type RuleViolation struct {
+	Rule  string
+	Field string
+	Limit float64
+}
+
+func (v *RuleViolation) Error() string {
+	return fmt.Sprintf("%s: %s limit %v", ErrRewardLimitExceeded, v.Rule, v.Limit)
+}
+
+func (v *RuleViolation) Unwrap() error {
+	return ErrRewardLimitExceeded
+}
+
+// rewardCandidate is a reward about to be issued
+type rewardCandidate struct {
+	userID      uuid.UUID
+	eventType   string
+	referenceID string
+	quantity    float64
+	inrValue    float64
+}
+
+// ruleDecision is the outcome of the rules for an allowed reward. A non-empty
+// reviewReason means it must be held for review instead of issued.
+type ruleDecision struct {
+	reviewReason  string
+	reviewDetails string
+}
+
+// lockUserRewards serialises reward issuance per user for the rest of tx, so
+// concurrent rewards cannot each pass a cap the pair of them breaks
+func lockUserRewards(ctx context.Context, tx *sql.Tx, userID uuid.UUID) error {
+	if err := lockRewards(ctx, tx, "reward:user:"+userID.String()); err != nil {
+		return fmt.Errorf("error locking user rewards: %w", err)
+	}
+	return nil
+}
+
+// lockSourceRewards serialises reward issuance per reference_id source for the
+// rest of tx, so two users' rewards from the same source can't both pass the
+// velocity limit. It is always taken after lockUserRewards.
+func lockSourceRewards(ctx context.Context, tx *sql.Tx, source string) error {
+	if err := lockRewards(ctx, tx, "reward:source:"+source); err != nil {
+		return fmt.Errorf("error locking reference source rewards: %w", err)
+	}
+	return nil
+}
+
+// lockRewards takes an exclusive application lock on resource, held until tx ends
+func lockRewards(ctx context.Context, tx *sql.Tx, resource string) error {
+	var result int
+	err := tx.QueryRowContext(ctx, `
+		DECLARE @result INT;
+		EXEC @result = sp_getapplock @Resource = @p1, @LockMode = 'Exclusive', @LockOwner = 'Transaction', @LockTimeout = 10000;
+		SELECT @result;
+	`, resource).Scan(&result)
+	if err != nil {
+		return err
+	}
+	if result < 0 {
+		return fmt.Errorf("sp_getapplock returned %d", result)
+	}
+	return nil
+}
+
+// evaluate checks a candidate against every rule. Hard limits return a
+// *RuleViolation; anomalies return a decision with a review reason.
+// It must run in the transaction that inserts the reward, after lockUserRewards.
+func (r RewardRules) evaluate(ctx context.Context, tx *sql.Tx, c rewardCandidate, now time.Time) (ruleDecision, error) {
+	if r.MaxQuantity > 0 && c.quantity > r.MaxQuantity {
+		return ruleDecision{}, &RuleViolation{Rule: RuleMaxQuantity, Field: "quantity", Limit: r.MaxQuantity}
+	}
+
+	// Caps count every reward that was not turned down or failed to buy
+	dayStart := istDayStart(now)
+
+	if r.UserDailyINRCap > 0 {
+		var issued float64
+		err := tx.QueryRowContext(ctx, `
+			SELECT ISNULL(SUM(inr_value), 0) FROM reward_events
+			WHERE user_id = @p1 AND created_at >= @p2 AND status NOT IN (@p3, @p4) AND deleted_at IS NULL
+		`, c.userID, dayStart, models.RewardStatusRejected, models.RewardStatusFailed).Scan(&issued)
+		if err != nil {
+			return ruleDecision{}, fmt.Errorf("error summing user rewards: %w", err)
+		}
+		if issued+c.inrValue > r.UserDailyINRCap {
+			return ruleDecision{}, &RuleViolation{Rule: RuleUserDailyINRCap, Field: "user_id", Limit: r.UserDailyINRCap}
+		}
+	}
+
+	if limit, ok := r.EventTypeDailyINRCaps[c.eventType]; ok && limit > 0 {
+		var issued float64
+		err := tx.QueryRowContext(ctx, `
+			SELECT ISNULL(SUM(inr_value), 0) FROM reward_events
+			WHERE user_id = @p1 AND event_type = @p2 AND created_at >= @p3 AND status NOT IN (@p4, @p5) AND deleted_at IS NULL
+		`, c.userID, c.eventType, dayStart, models.RewardStatusRejected, models.RewardStatusFailed).Scan(&issued)
+		if err != nil {
+			return ruleDecision{}, fmt.Errorf("error summing event type rewards: %w", err)
+		}
+		if issued+c.inrValue > limit {
+			return ruleDecision{}, &RuleViolation{Rule: RuleEventTypeDailyCap, Field: "event_type", Limit: limit}
+		}
+	}
+
+	if source, ok := referenceSource(c.referenceID); ok && r.ReferenceVelocity.Enabled() {
+		if err := lockSourceRewards(ctx, tx, source); err != nil {
+			return ruleDecision{}, err
+		}
+		var count int
+		err := tx.QueryRowContext(ctx, `
+			SELECT COUNT(*) FROM reward_events
+			WHERE reference_id LIKE @p1 ESCAPE '\' AND created_at >= @p2 AND deleted_at IS NULL
+		`, escapeLike(source+referenceSourceSeparator)+"%", now.Add(-r.ReferenceVelocity.Period)).Scan(&count)
+		if err != nil {
+			return ruleDecision{}, fmt.Errorf("error counting reference source rewards: %w", err)
+		}
+		if count >= r.ReferenceVelocity.Requests {
+			return ruleDecision{}, &RuleViolation{Rule: RuleReferenceVelocity, Field: "reference_id", Limit: float64(r.ReferenceVelocity.Requests)}
+		}
+	}
+
+	if r.AnomalyRewardsPerMinute > 0 {
+		var count int
+		err := tx.QueryRowContext(ctx, `
+			SELECT COUNT(*) FROM reward_events
+			WHERE user_id = @p1 AND created_at >= @p2 AND deleted_at IS NULL
+		`, c.userID, now.Add(-time.Minute)).Scan(&count)
+		if err != nil {
+			return ruleDecision{}, fmt.Errorf("error counting recent user rewards: %w", err)
+		}
+		if count >= r.AnomalyRewardsPerMinute {
+			return ruleDecision{
+				reviewReason:  RuleRewardRateAnomaly,
+				reviewDetails: fmt.Sprintf("user received %d rewards in the last minute (threshold %d)", count, r.AnomalyRewardsPerMinute),
+			}, nil
+		}
+	}
+
+	return ruleDecision{}, nil
+}
+
+// requiresApproval reports whether c must be approved by someone other than its creator
+func (r RewardRules) requiresApproval(c rewardCandidate) bool {
+	return r.enteredByHand(c.eventType) && c.inrValue >= r.ApprovalINRThreshold
+}
+
+// enteredByHand reports whether eventType is one of ApprovalEventTypes.
+// Such rewards need a known maker, whatever their value.
+func (r RewardRules) enteredByHand(eventType string) bool {
+	for _, t := range r.ApprovalEventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// referenceSource returns the part of a reference_id before the last separator
+func referenceSource(referenceID string) (string, bool) {
+	i := strings.LastIndex(referenceID, referenceSourceSeparator)
+	if i <= 0 {
+		return "", false
+	}
+	return referenceID[:i], true
+}
+
+// escapeLike escapes LIKE wildcards so s matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`, `[`, `\[`).Replace(s)
+}
+
+// istDayStart returns midnight IST of the day containing t, in UTC
+func istDayStart(t time.Time) time.Time {
+	local := t.In(IST)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, IST).UTC()
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"backend/ratelimit"
+)
+
+func TestRewardRulesValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(r *RewardRules)
+		wantErr bool
+	}{
+		{"defaults", func(r *RewardRules) {}, false},
+		{"zero disables every rule", func(r *RewardRules) { *r = RewardRules{} }, false},
+		{"negative max quantity", func(r *RewardRules) { r.MaxQuantity = -1 }, true},
+		{"negative user daily cap", func(r *RewardRules) { r.UserDailyINRCap = -1 }, true},
+		{"negative event type cap", func(r *RewardRules) { r.EventTypeDailyINRCaps = map[string]float64{"referral": 100, "onboarding": -1} }, true},
+		{"negative anomaly threshold", func(r *RewardRules) { r.AnomalyRewardsPerMinute = -1 }, true},
+		{"negative approval threshold", func(r *RewardRules) { r.ApprovalINRThreshold = -1 }, true},
+		{"velocity off", func(r *RewardRules) { r.ReferenceVelocity = ratelimit.Limit{} }, false},
+		{"velocity set", func(r *RewardRules) { r.ReferenceVelocity = ratelimit.Limit{Requests: 1, Period: time.Minute} }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := DefaultRewardRules()
+			tt.modify(&r)
+			if err := r.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReferenceSource(t *testing.T) {
+	tests := []struct {
+		referenceID string
+		want        string
+		wantOK      bool
+	}{
+		{"campaign-42:user-7", "campaign-42", true},
+		{"partner:campaign-42:user-7", "partner:campaign-42", true},
+		{"campaign-42:", "campaign-42", true},
+		{"no-separator", "", false},
+		{":user-7", "", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.referenceID, func(t *testing.T) {
+			got, ok := referenceSource(tt.referenceID)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("referenceSource(%q) = %q, %v, want %q, %v", tt.referenceID, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"campaign-42", "campaign-42"},
+		{"50%_off", `50\%\_off`},
+		{"[promo]", `\[promo]`},
+		{`back\slash`, `back\\slash`},
+		{`\%`, `\\\%`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := escapeLike(tt.in); got != tt.want {
+				t.Errorf("escapeLike(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,144 +1,196 @@
 package services
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"time"
 
+	"backend/auth"
 	"backend/database"
+	"backend/metrics"
 	"backend/models"
+	"backend/telemetry"
 
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-type RewardService struct{}
+type RewardService struct {
+	broker Broker
+}
 
 func NewRewardService() *RewardService {
-	return &RewardService{}
+	return &RewardService{
+		broker: defaultBroker,
+	}
 }
 
 // CreateReward creates a reward event and updates ledger with double-entry accounting
-func (s *RewardService) CreateReward(req models.RewardRequest) (*models.RewardEvent, error) {
-	userID, err := uuid.Parse(req.UserID)
+func (s *RewardService) CreateReward(ctx context.Context, req models.RewardRequest) (reward *models.RewardEvent, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "RewardService.CreateReward",
+		attribute.String("stock_symbol", req.StockSymbol),
+		attribute.String("event_type", req.EventType),
+		attribute.String("reference_id", req.ReferenceID),
+	)
+	defer telemetry.EndSpan(span, &err)
+
+	reward, err = s.createReward(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("invalid user_id: %w", err)
+		metrics.RewardFailuresTotal.WithLabelValues(rewardFailureReason(err)).Inc()
+		return nil, err
 	}
 
-	// Check if user exists
-	var userExists bool
-	err = database.DB.QueryRow(
-		"SELECT CASE WHEN EXISTS(SELECT 1 FROM users WHERE id = @p1 AND deleted_at IS NULL) THEN 1 ELSE 0 END",
-		userID,
-	).Scan(&userExists)
+	// The symbol was priced to record the reward, so the provider lists it
+	metrics.RewardsCreatedTotal.WithLabelValues(metrics.EventTypeLabel(reward.EventType), metrics.SymbolLabel(reward.StockSymbol), reward.Status).Inc()
+	return reward, nil
+}
+
+// rewardFailureReason buckets CreateReward errors into a small set of metric labels
+func rewardFailureReason(err error) string {
+	switch {
+	case errors.Is(err, ErrUserNotFound):
+		return "user_not_found"
+	case errors.Is(err, ErrDuplicateReference):
+		return "duplicate_reference"
+	case errors.Is(err, ErrUnknownSymbol):
+		return "unknown_symbol"
+	case errors.Is(err, ErrStalePrice):
+		return "stale_price"
+	case errors.Is(err, ErrPriceUnavailable):
+		return "price_unavailable"
+	case errors.Is(err, ErrRewardLimitExceeded):
+		return "limit_exceeded"
+	case errors.Is(err, ErrInvalidRequest):
+		return "invalid_request"
+	case errors.Is(err, auth.ErrUnauthenticated):
+		return "unauthenticated"
+	default:
+		return "internal"
+	}
+}
+
+func (s *RewardService) createReward(ctx context.Context, req models.RewardRequest) (*models.RewardEvent, error) {
+	userID, err := uuid.Parse(req.UserID)
 	if err != nil {
-		return nil, fmt.Errorf("error checking user existence: %w", err)
+		return nil, fmt.Errorf("%w: invalid user_id: %v", ErrInvalidRequest, err)
 	}
-	if !userExists {
-		return nil, errors.New("user not found")
+
+	if req.Vesting != nil {
+		if err := validateVesting(req.Vesting); err != nil {
+			return nil, err
+		}
 	}
 
-	// Check for duplicate reference_id
-	var existingID uuid.UUID
-	err = database.DB.QueryRow(
-		"SELECT id FROM reward_events WHERE reference_id = @p1 AND deleted_at IS NULL",
-		req.ReferenceID,
-	).Scan(&existingID)
+	// Maker-checker compares the approver with the maker, so rewards entered
+	// by hand need a maker who can be told apart from everyone else
+	rules := CurrentRewardRules()
+	if rules.enteredByHand(req.EventType) && auth.ActorFrom(ctx) == auth.Anonymous {
+		return nil, auth.ErrUnauthenticated
+	}
 
-	if err == nil {
-		return nil, errors.New("duplicate reward event: reference_id already exists")
-	} else if err != sql.ErrNoRows {
-		return nil, fmt.Errorf("error checking duplicate: %w", err)
+	// Check if user exists
+	if err := s.checkUserExists(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	// Check for duplicate reference_id
+	if err := s.checkDuplicateReference(ctx, req.ReferenceID); err != nil {
+		return nil, err
 	}
 
 	// Get current stock price
-	stockPrice, err := s.getCurrentStockPrice(req.StockSymbol)
+	stockPrice, fresh, err := s.getCurrentStockPrice(ctx, req.StockSymbol)
 	if err != nil {
 		return nil, fmt.Errorf("error getting stock price: %w", err)
 	}
 
-	// Calculate fees (brokerage, STT, GST, etc.)
-	// Assuming 0.1% brokerage, 0.025% STT, 18% GST on brokerage
-	brokerage := stockPrice * req.Quantity * 0.001
-	stt := stockPrice * req.Quantity * 0.00025
-	gst := brokerage * 0.18
-	totalFees := brokerage + stt + gst
-	totalCost := stockPrice*req.Quantity + totalFees
+	// The price only values the reward for the limits; the ledger gets the broker's fill
+	status := models.RewardStatusPending
+	if !fresh {
+		if CurrentStalenessPolicy().StaleIssuance == StaleIssuanceRefuse {
+			return nil, ErrStalePrice
+		}
+		status = models.RewardStatusQueued
+	}
 
 	// Start transaction
-	tx, err := database.DB.Begin()
+	tx, err := database.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error starting transaction: %w", err)
 	}
 	defer tx.Rollback()
 
-	transactionID := uuid.New()
-	rewardID := uuid.New()
-
-	// Create reward event
-	_, err = tx.Exec(`
-		INSERT INTO reward_events (id, user_id, stock_symbol, quantity, reward_timestamp, event_type, reference_id, status)
-		VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8)
-	`, rewardID, userID, req.StockSymbol, req.Quantity, req.RewardTimestamp, req.EventType, req.ReferenceID, "active")
-	if err != nil {
-		return nil, fmt.Errorf("error creating reward event: %w", err)
+	// Apply reward limits and anomaly checks
+	if err := lockUserRewards(ctx, tx, userID); err != nil {
+		return nil, err
 	}
-
-	// Double-entry ledger: Debit Stock Inventory, Credit Cash
-	// Entry 1: Debit Stock Inventory (Asset)
-	_, err = tx.Exec(`
-		INSERT INTO ledger_entries (transaction_id, account_type, account_symbol, debit_amount, credit_amount, stock_quantity, description, reference_id)
-		VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8)
-	`, transactionID, "stock_inventory", req.StockSymbol, stockPrice*req.Quantity, 0, req.Quantity,
-		fmt.Sprintf("Stock reward: %s x %.6f", req.StockSymbol, req.Quantity), req.ReferenceID)
+	inrValue := stockPrice * req.Quantity
+	candidate := rewardCandidate{
+		userID:      userID,
+		eventType:   req.EventType,
+		referenceID: req.ReferenceID,
+		quantity:    req.Quantity,
+		inrValue:    inrValue,
+	}
+	decision, err := rules.evaluate(ctx, tx, candidate, time.Now().UTC())
 	if err != nil {
-		return nil, fmt.Errorf("error creating ledger entry 1: %w", err)
+		return nil, err
+	}
+	// A reviewer must differ from the creator too, so review covers approval
+	if decision.reviewReason != "" {
+		status = models.RewardStatusUnderReview
+	} else if rules.requiresApproval(candidate) {
+		status = models.RewardStatusPendingApproval
 	}
 
-	// Entry 2: Credit Cash (Asset)
-	_, err = tx.Exec(`
-		INSERT INTO ledger_entries (transaction_id, account_type, account_symbol, debit_amount, credit_amount, stock_quantity, description, reference_id)
-		VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8)
-	`, transactionID, "cash", "", totalCost, 0, 0,
-		fmt.Sprintf("Cash outflow for stock purchase: %s", req.StockSymbol), req.ReferenceID)
-	if err != nil {
-		return nil, fmt.Errorf("error creating ledger entry 2: %w", err)
+	rewardID := uuid.New()
+	createdBy := auth.ActorFrom(ctx).ID
+	var cliffMonths, durationMonths, intervalMonths sql.NullInt32
+	var lockInUntil sql.NullTime
+	if v := req.Vesting; v != nil {
+		cliffMonths = sql.NullInt32{Int32: int32(v.CliffMonths), Valid: true}
+		durationMonths = sql.NullInt32{Int32: int32(v.DurationMonths), Valid: true}
+		intervalMonths = sql.NullInt32{Int32: int32(v.IntervalMonths), Valid: true}
+		if v.LockInUntil != nil {
+			lockInUntil = sql.NullTime{Time: calendarDate(startOfDayIST(*v.LockInUntil)), Valid: true}
+		}
 	}
 
-	// Entry 3: Debit Fees Expense
-	_, err = tx.Exec(`
-		INSERT INTO ledger_entries (transaction_id, account_type, account_symbol, debit_amount, credit_amount, stock_quantity, description, reference_id)
-		VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8)
-	`, transactionID, "fees_expense", "", totalFees, 0, 0,
-		fmt.Sprintf("Brokerage, STT, GST for %s", req.StockSymbol), req.ReferenceID)
+	// Create reward event
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO reward_events (id, user_id, stock_symbol, quantity, reward_timestamp, event_type, reference_id, status, inr_value, created_by,
+			vesting_cliff_months, vesting_duration_months, vesting_interval_months, lock_in_until)
+		VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8, @p9, @p10, @p11, @p12, @p13, @p14)
+	`, rewardID, userID, req.StockSymbol, req.Quantity, req.RewardTimestamp, req.EventType, req.ReferenceID, status, inrValue, createdBy,
+		cliffMonths, durationMonths, intervalMonths, lockInUntil)
 	if err != nil {
-		return nil, fmt.Errorf("error creating ledger entry 3: %w", err)
+		return nil, fmt.Errorf("error creating reward event: %w", err)
 	}
 
-	// Entry 4: Credit Cash (for fees)
-	_, err = tx.Exec(`
-		INSERT INTO ledger_entries (transaction_id, account_type, account_symbol, debit_amount, credit_amount, stock_quantity, description, reference_id)
-		VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8)
-	`, transactionID, "cash", "", 0, totalFees, 0,
-		fmt.Sprintf("Cash outflow for fees: %s", req.StockSymbol), req.ReferenceID)
+	err = recordAudit(ctx, tx, models.AuditRewardCreate, models.AuditEntityRewardEvent, rewardID.String(), nil, map[string]interface{}{
+		"user_id":          userID,
+		"stock_symbol":     req.StockSymbol,
+		"quantity":         req.Quantity,
+		"reward_timestamp": req.RewardTimestamp,
+		"event_type":       req.EventType,
+		"reference_id":     req.ReferenceID,
+		"status":           status,
+		"inr_value":        inrValue,
+		"created_by":       createdBy,
+		"vesting":          req.Vesting,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("error creating ledger entry 4: %w", err)
+		return nil, err
 	}
 
-	// Update or insert user holdings
-	_, err = tx.Exec(`
-		MERGE user_holdings AS target
-		USING (SELECT @p1 AS user_id, @p2 AS stock_symbol, @p3 AS quantity) AS source
-		ON target.user_id = source.user_id AND target.stock_symbol = source.stock_symbol
-		WHEN MATCHED THEN
-			UPDATE SET quantity = target.quantity + source.quantity, updated_at = GETUTCDATE(), last_updated = GETUTCDATE()
-		WHEN NOT MATCHED THEN
-			INSERT (user_id, stock_symbol, quantity, last_updated)
-			VALUES (source.user_id, source.stock_symbol, source.quantity, GETUTCDATE());
-	`, userID, req.StockSymbol, req.Quantity)
-	if err != nil {
-		return nil, fmt.Errorf("error updating user holdings: %w", err)
+	// Rewards flagged by the anomaly rules wait in reward_reviews
+	if status == models.RewardStatusUnderReview {
+		if err := createReview(ctx, tx, rewardID, decision); err != nil {
+			return nil, err
+		}
 	}
 
 	// Commit transaction
@@ -146,36 +198,106 @@ func (s *RewardService) CreateReward(req models.RewardRequest) (*models.RewardEv
 		return nil, fmt.Errorf("error committing transaction: %w", err)
 	}
 
+	// Buy the shares outside the transaction. Queued rewards are released by
+	// ProcessQueuedRewards once the price is fresh, and held ones on approval.
+	if status == models.RewardStatusPending {
+		s.startFulfilment(ctx, rewardID)
+	}
+
 	// Fetch and return the created reward event
-	reward := &models.RewardEvent{}
-	err = database.DB.QueryRow(`
-		SELECT id, user_id, stock_symbol, quantity, reward_timestamp, event_type, reference_id, status, created_at, updated_at
-		FROM reward_events WHERE id = @p1
-	`, rewardID).Scan(
-		&reward.ID, &reward.UserID, &reward.StockSymbol, &reward.Quantity,
-		&reward.RewardTimestamp, &reward.EventType, &reward.ReferenceID,
-		&reward.Status, &reward.CreatedAt, &reward.UpdatedAt,
-	)
+	reward, err := getReward(ctx, rewardID)
 	if err != nil {
 		return nil, fmt.Errorf("error fetching created reward: %w", err)
 	}
 
-	logrus.WithFields(logrus.Fields{
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
 		"user_id":      userID,
 		"stock_symbol": req.StockSymbol,
 		"quantity":     req.Quantity,
 		"reference_id": req.ReferenceID,
+		"status":       reward.Status,
 	}).Info("Reward created successfully")
 
+	PortfolioEvents().PublishUser(userID)
+
 	return reward, nil
 }
 
+// getReward reads one reward by ID
+func getReward(ctx context.Context, rewardID uuid.UUID) (*models.RewardEvent, error) {
+	reward := &models.RewardEvent{}
+	var vesting vestingColumns
+	err := database.DB.QueryRowContext(ctx, `
+		SELECT id, user_id, stock_symbol, quantity, reward_timestamp, event_type, reference_id, status, inr_value, created_by,
+			trade_date, settlement_date, settled_at, `+vestingColumnList+`, created_at, updated_at
+		FROM reward_events WHERE id = @p1 AND deleted_at IS NULL
+	`, rewardID).Scan(
+		&reward.ID, &reward.UserID, &reward.StockSymbol, &reward.Quantity,
+		&reward.RewardTimestamp, &reward.EventType, &reward.ReferenceID,
+		&reward.Status, &reward.InrValue, &reward.CreatedBy,
+		&reward.TradeDate, &reward.SettlementDate, &reward.SettledAt,
+		&vesting.cliff, &vesting.duration, &vesting.interval, &vesting.lockIn,
+		&reward.CreatedAt, &reward.UpdatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRewardNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	reward.Vesting = vesting.schedule()
+	return reward, nil
+}
+
+// checkUserExists returns an error unless the user exists and is not deleted
+func (s *RewardService) checkUserExists(ctx context.Context, userID uuid.UUID) (err error) {
+	ctx, span := telemetry.StartSpan(ctx, "RewardService.checkUserExists")
+	defer telemetry.EndSpan(span, &err)
+
+	var userExists bool
+	err = database.DB.QueryRowContext(ctx,
+		"SELECT CASE WHEN EXISTS(SELECT 1 FROM users WHERE id = @p1 AND deleted_at IS NULL) THEN 1 ELSE 0 END",
+		userID,
+	).Scan(&userExists)
+	if err != nil {
+		return fmt.Errorf("error checking user existence: %w", err)
+	}
+	if !userExists {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// checkDuplicateReference returns an error if a reward already uses referenceID
+func (s *RewardService) checkDuplicateReference(ctx context.Context, referenceID string) (err error) {
+	ctx, span := telemetry.StartSpan(ctx, "RewardService.checkDuplicateReference")
+	defer telemetry.EndSpan(span, &err)
+
+	var existingID uuid.UUID
+	err = database.DB.QueryRowContext(ctx,
+		"SELECT id FROM reward_events WHERE reference_id = @p1 AND deleted_at IS NULL",
+		referenceID,
+	).Scan(&existingID)
+
+	if err == nil {
+		return ErrDuplicateReference
+	} else if err != sql.ErrNoRows {
+		return fmt.Errorf("error checking duplicate: %w", err)
+	}
+
+	return nil
+}
+
 // GetTodayStocks returns all stock rewards for a user for today
-func (s *RewardService) GetTodayStocks(userID uuid.UUID) ([]models.RewardEvent, error) {
+func (s *RewardService) GetTodayStocks(ctx context.Context, userID uuid.UUID) (rewards []models.RewardEvent, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "RewardService.GetTodayStocks")
+	defer telemetry.EndSpan(span, &err)
+
 	today := time.Now().UTC().Truncate(24 * time.Hour)
 	tomorrow := today.Add(24 * time.Hour)
 
-	rows, err := database.DB.Query(`
+	rows, err := database.DB.QueryContext(ctx, `
 		SELECT id, user_id, stock_symbol, quantity, reward_timestamp, event_type, reference_id, status, created_at, updated_at
 		FROM reward_events
 		WHERE user_id = @p1 
@@ -189,7 +311,6 @@ func (s *RewardService) GetTodayStocks(userID uuid.UUID) ([]models.RewardEvent,
 	}
 	defer rows.Close()
 
-	var rewards []models.RewardEvent
 	for rows.Next() {
 		var reward models.RewardEvent
 		err := rows.Scan(
@@ -206,27 +327,226 @@ func (s *RewardService) GetTodayStocks(userID uuid.UUID) ([]models.RewardEvent,
 	return rewards, nil
 }
 
-func (s *RewardService) getCurrentStockPrice(symbol string) (float64, error) {
-	var price float64
-	err := database.DB.QueryRow(`
-		SELECT price FROM stock_prices WHERE stock_symbol = @p1 AND is_stale = 0
-	`, symbol).Scan(&price)
+// ProcessQueuedRewards releases rewards that were queued because of a stale
+// price to the broker, now that the price job may have refreshed it. It
+// returns the number released.
+func (s *RewardService) ProcessQueuedRewards(ctx context.Context) (released int, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "RewardService.ProcessQueuedRewards")
+	defer telemetry.EndSpan(span, &err)
+
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT id, user_id, stock_symbol, quantity, reference_id
+		FROM reward_events
+		WHERE status = @p1 AND deleted_at IS NULL
+		ORDER BY created_at
+	`, models.RewardStatusQueued)
+	if err != nil {
+		return 0, fmt.Errorf("error querying queued rewards: %w", err)
+	}
+
+	var queued []models.RewardEvent
+	for rows.Next() {
+		var reward models.RewardEvent
+		if err := rows.Scan(&reward.ID, &reward.UserID, &reward.StockSymbol, &reward.Quantity, &reward.ReferenceID); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("error scanning queued reward: %w", err)
+		}
+		queued = append(queued, reward)
+	}
+	rows.Close()
+
+	for _, reward := range queued {
+		ok, err := s.releaseQueuedReward(ctx, reward)
+		if err != nil {
+			logrus.WithContext(ctx).WithError(err).WithField("reward_id", reward.ID).Error("Error releasing queued reward")
+			continue
+		}
+		if ok {
+			released++
+			s.startFulfilment(ctx, reward.ID)
+		}
+	}
+
+	if released > 0 {
+		logrus.WithContext(ctx).WithField("count", released).Info("Released queued rewards")
+	}
+
+	return released, nil
+}
+
+// releaseQueuedReward moves a single queued reward to pending if its price is fresh enough
+func (s *RewardService) releaseQueuedReward(ctx context.Context, reward models.RewardEvent) (bool, error) {
+	stockPrice, fresh, err := s.getCurrentStockPrice(ctx, reward.StockSymbol)
+	if err != nil {
+		return false, err
+	}
+	if !fresh {
+		return false, nil
+	}
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Guard on the status so two workers can't release the same reward
+	result, err := tx.ExecContext(ctx, `
+		UPDATE reward_events SET status = @p1, updated_at = GETUTCDATE()
+		WHERE id = @p2 AND status = @p3
+	`, models.RewardStatusPending, reward.ID, models.RewardStatusQueued)
+	if err != nil {
+		return false, fmt.Errorf("error releasing queued reward: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return false, nil
+	}
+
+	err = recordAudit(ctx, tx, models.AuditRewardRelease, models.AuditEntityRewardEvent, reward.ID.String(),
+		map[string]interface{}{"status": models.RewardStatusQueued},
+		map[string]interface{}{"status": models.RewardStatusPending, "stock_price": stockPrice},
+	)
+	if err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return true, nil
+}
+
+// postReward writes the double-entry ledger postings and holding update for a
+// reward's fill, at the price, quantity and fees the broker reported. The
+// shares are debited to inventoryAccount: stock_inventory, or unvested_stock
+// for rewards that vest over time.
+func postReward(ctx context.Context, tx *sql.Tx, userID uuid.UUID, symbol string, referenceID string, fill OrderState, inventoryAccount string) (err error) {
+	ctx, span := telemetry.StartSpan(ctx, "postReward", attribute.String("stock_symbol", symbol))
+	defer telemetry.EndSpan(span, &err)
+
+	quantity := fill.FilledQuantity
+	grossValue := fill.AveragePrice * quantity
+	totalFees := fill.Fees.Total()
+
+	transactionID := uuid.New()
+
+	// Double-entry ledger: Debit Stock Inventory, Credit Cash
+	// Entry 1: Debit Stock Inventory (Asset)
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO ledger_entries (transaction_id, user_id, account_type, account_symbol, debit_amount, credit_amount, stock_quantity, description, reference_id)
+		VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8, @p9)
+	`, transactionID, userID, inventoryAccount, symbol, grossValue, 0, quantity,
+		fmt.Sprintf("Stock reward: %s x %.6f", symbol, quantity), referenceID)
+	if err != nil {
+		return fmt.Errorf("error creating ledger entry 1: %w", err)
+	}
+
+	// Entry 2: Credit Cash (Asset)
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO ledger_entries (transaction_id, user_id, account_type, account_symbol, debit_amount, credit_amount, stock_quantity, description, reference_id)
+		VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8, @p9)
+	`, transactionID, userID, "cash", "", 0, grossValue, 0,
+		fmt.Sprintf("Cash outflow for stock purchase: %s", symbol), referenceID)
+	if err != nil {
+		return fmt.Errorf("error creating ledger entry 2: %w", err)
+	}
+
+	// Entry 3: Debit Fees Expense
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO ledger_entries (transaction_id, user_id, account_type, account_symbol, debit_amount, credit_amount, stock_quantity, description, reference_id)
+		VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8, @p9)
+	`, transactionID, userID, "fees_expense", "", totalFees, 0, 0,
+		fmt.Sprintf("Brokerage, STT, GST for %s", symbol), referenceID)
+	if err != nil {
+		return fmt.Errorf("error creating ledger entry 3: %w", err)
+	}
+
+	// Entry 4: Credit Cash (for fees)
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO ledger_entries (transaction_id, user_id, account_type, account_symbol, debit_amount, credit_amount, stock_quantity, description, reference_id)
+		VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8, @p9)
+	`, transactionID, userID, "cash", "", 0, totalFees, 0,
+		fmt.Sprintf("Cash outflow for fees: %s", symbol), referenceID)
+	if err != nil {
+		return fmt.Errorf("error creating ledger entry 4: %w", err)
+	}
+	if err := checkBalanced(ctx, tx, transactionID); err != nil {
+		return err
+	}
 
-	if err == sql.ErrNoRows {
+	// Update or insert user holdings, capturing the quantity before and after for the audit log
+	var before sql.NullFloat64
+	var after float64
+	err = tx.QueryRowContext(ctx, `
+		MERGE user_holdings AS target
+		USING (SELECT @p1 AS user_id, @p2 AS stock_symbol, @p3 AS quantity) AS source
+		ON target.user_id = source.user_id AND target.stock_symbol = source.stock_symbol
+		WHEN MATCHED THEN
+			UPDATE SET quantity = target.quantity + source.quantity, updated_at = GETUTCDATE(), last_updated = GETUTCDATE()
+		WHEN NOT MATCHED THEN
+			INSERT (user_id, stock_symbol, quantity, last_updated)
+			VALUES (source.user_id, source.stock_symbol, source.quantity, GETUTCDATE())
+		OUTPUT deleted.quantity, inserted.quantity;
+	`, userID, symbol, quantity).Scan(&before, &after)
+	if err != nil {
+		return fmt.Errorf("error updating user holdings: %w", err)
+	}
+
+	return recordAudit(ctx, tx, models.AuditHoldingAdd, models.AuditEntityHolding, holdingEntityID(userID, symbol),
+		map[string]interface{}{"quantity": before.Float64},
+		map[string]interface{}{"quantity": after, "reference_id": referenceID, "transaction_id": transactionID},
+	)
+}
+
+// checkBalanced fails if the ledger entries of a transaction do not have
+// equal debits and credits, so an unbalanced posting rolls back
+func checkBalanced(ctx context.Context, tx *sql.Tx, transactionID uuid.UUID) error {
+	var debits, credits float64
+	err := tx.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(debit_amount), 0), COALESCE(SUM(credit_amount), 0)
+		FROM ledger_entries
+		WHERE transaction_id = @p1
+	`, transactionID).Scan(&debits, &credits)
+	if err != nil {
+		return fmt.Errorf("error checking ledger balance: %w", err)
+	}
+	if roundTo(debits, amountPlaces) != roundTo(credits, amountPlaces) {
+		return fmt.Errorf("ledger transaction %s is unbalanced: debits %.4f, credits %.4f", transactionID, debits, credits)
+	}
+	return nil
+}
+
+// holdingEntityID identifies a user's holding of one stock in the audit log
+func holdingEntityID(userID uuid.UUID, symbol string) string {
+	return userID.String() + "/" + symbol
+}
+
+// getCurrentStockPrice returns the stored price for a symbol and whether it is
+// fresh enough to issue a reward against under the staleness policy
+func (s *RewardService) getCurrentStockPrice(ctx context.Context, symbol string) (price float64, fresh bool, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "RewardService.getCurrentStockPrice", attribute.String("stock_symbol", symbol))
+	defer telemetry.EndSpan(span, &err)
+
+	priceService := NewStockPriceService()
+
+	lastKnown, err := priceService.GetLastKnownPrice(ctx, symbol)
+	if errors.Is(err, ErrPriceNotFound) {
 		// If no price exists, fetch from price service
-		priceService := NewStockPriceService()
-		price, err = priceService.GetPrice(symbol)
+		price, err := priceService.GetPrice(ctx, symbol)
 		if err != nil {
-			return 0, err
+			return 0, false, err
 		}
 		// Store the price
-		priceService.UpdatePrice(symbol, price)
-		return price, nil
+		if err := priceService.UpdatePrice(ctx, symbol, price); err != nil {
+			return 0, false, err
+		}
+		return price, true, nil
 	}
-
 	if err != nil {
-		return 0, fmt.Errorf("error getting stock price: %w", err)
+		return 0, false, err
 	}
 
-	return price, nil
+	fresh = CurrentStalenessPolicy().CanIssue(lastKnown.LastUpdated, time.Now().UTC())
+	return lastKnown.Price, fresh, nil
 }
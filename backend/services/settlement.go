@@ -0,0 +1,245 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"backend/database"
+	"backend/models"
+	"backend/telemetry"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// settlementCycle is how many trading days after the trade date shares settle (T+1)
+const settlementCycle = 1
+
+// settlementDates returns the trade date of a fill at t and the day it settles
+func settlementDates(t time.Time) (tradeDate, settlementDate time.Time) {
+	calendar := CurrentMarketCalendar()
+	tradeDate = calendar.TradeDate(t)
+	return tradeDate, calendar.AddTradingDays(tradeDate, settlementCycle)
+}
+
+// SettleRewards settles every fulfilled reward whose settlement date has
+// arrived: the reward becomes settled and its shares move to the settled part
+// of the user's holding, where they can be withdrawn. It returns the number of
+// rewards settled.
+func (s *RewardService) SettleRewards(ctx context.Context) (settled int, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "RewardService.SettleRewards")
+	defer telemetry.EndSpan(span, &err)
+
+	today := calendarDate(startOfDayIST(time.Now()))
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT re.id, re.user_id, re.stock_symbol, re.settlement_date, a.filled_quantity
+		FROM reward_events re
+		JOIN broker_order_allocations a ON a.reward_id = re.id
+		WHERE re.status = @p1 AND re.settlement_date <= @p2 AND re.deleted_at IS NULL
+		ORDER BY re.settlement_date, re.created_at
+	`, models.RewardStatusFulfilled, today)
+	if err != nil {
+		return 0, fmt.Errorf("error querying rewards due to settle: %w", err)
+	}
+
+	type dueReward struct {
+		reward   models.RewardEvent
+		quantity float64
+	}
+	var due []dueReward
+	for rows.Next() {
+		var d dueReward
+		if err := rows.Scan(&d.reward.ID, &d.reward.UserID, &d.reward.StockSymbol, &d.reward.SettlementDate, &d.quantity); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("error scanning reward due to settle: %w", err)
+		}
+		due = append(due, d)
+	}
+	rows.Close()
+
+	for _, d := range due {
+		ok, err := settleReward(ctx, d.reward, d.quantity)
+		if err != nil {
+			logrus.WithContext(ctx).WithError(err).WithField("reward_id", d.reward.ID).Error("Error settling reward")
+			continue
+		}
+		if ok {
+			settled++
+			PortfolioEvents().PublishUser(d.reward.UserID)
+		}
+	}
+
+	if settled > 0 {
+		logrus.WithContext(ctx).WithField("count", settled).Info("Settled rewards")
+	}
+
+	return settled, nil
+}
+
+// settleReward moves one fulfilled reward's posted quantity to the settled
+// part of the holding. It reports false if the reward was already settled.
+func settleReward(ctx context.Context, reward models.RewardEvent, quantity float64) (ok bool, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "settleReward", attribute.String("reward_id", reward.ID.String()))
+	defer telemetry.EndSpan(span, &err)
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Guard on the status so a reward's shares settle only once
+	result, err := tx.ExecContext(ctx, `
+		UPDATE reward_events SET status = @p1, settled_at = GETUTCDATE(), updated_at = GETUTCDATE()
+		WHERE id = @p2 AND status = @p3
+	`, models.RewardStatusSettled, reward.ID, models.RewardStatusFulfilled)
+	if err != nil {
+		return false, fmt.Errorf("error settling reward: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return false, nil
+	}
+
+	if err := settleHolding(ctx, tx, reward.UserID, reward.StockSymbol, quantity, "reward_id", reward.ID); err != nil {
+		return false, err
+	}
+
+	err = recordAudit(ctx, tx, models.AuditRewardSettle, models.AuditEntityRewardEvent, reward.ID.String(),
+		map[string]interface{}{"status": models.RewardStatusFulfilled},
+		map[string]interface{}{
+			"status":           models.RewardStatusSettled,
+			"settlement_date":  reward.SettlementDate.Format("2006-01-02"),
+			"settled_quantity": quantity,
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return true, nil
+}
+
+// settleHolding adds quantity to the settled part of a holding, never beyond the
+// shares actually held. The audit names the source of the shares under sourceKey.
+func settleHolding(ctx context.Context, tx *sql.Tx, userID uuid.UUID, symbol string, quantity float64, sourceKey string, sourceID uuid.UUID) error {
+	var before, after float64
+	err := tx.QueryRowContext(ctx, `
+		UPDATE user_holdings
+		SET settled_quantity = CASE WHEN settled_quantity + @p1 > quantity THEN quantity ELSE settled_quantity + @p1 END,
+			updated_at = GETUTCDATE()
+		OUTPUT deleted.settled_quantity, inserted.settled_quantity
+		WHERE user_id = @p2 AND stock_symbol = @p3
+	`, quantity, userID, symbol).Scan(&before, &after)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no holding of %s to settle for user %s", symbol, userID)
+	}
+	if err != nil {
+		return fmt.Errorf("error settling holding: %w", err)
+	}
+
+	return recordAudit(ctx, tx, models.AuditHoldingSettle, models.AuditEntityHolding, holdingEntityID(userID, symbol),
+		map[string]interface{}{"settled_quantity": before},
+		map[string]interface{}{"settled_quantity": after, sourceKey: sourceID},
+	)
+}
+
+// SettleReinvestments settles every reinvested dividend payment whose
+// settlement date has arrived, moving the bought shares to the settled part of
+// the user's holding. It returns the number of payments settled.
+func (s *DividendService) SettleReinvestments(ctx context.Context) (settled int, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "DividendService.SettleReinvestments")
+	defer telemetry.EndSpan(span, &err)
+
+	today := calendarDate(startOfDayIST(time.Now()))
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT id, dividend_id, user_id, stock_symbol, reinvested_quantity, settlement_date
+		FROM dividend_payments
+		WHERE mode = @p1 AND settled_at IS NULL AND settlement_date <= @p2
+		ORDER BY settlement_date, created_at
+	`, models.DividendModeReinvest, today)
+	if err != nil {
+		return 0, fmt.Errorf("error querying reinvestments due to settle: %w", err)
+	}
+
+	var due []models.DividendPayment
+	for rows.Next() {
+		var p models.DividendPayment
+		if err := rows.Scan(&p.ID, &p.DividendID, &p.UserID, &p.StockSymbol, &p.ReinvestedQuantity, &p.SettlementDate); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("error scanning reinvestment due to settle: %w", err)
+		}
+		due = append(due, p)
+	}
+	rows.Close()
+
+	for _, p := range due {
+		ok, err := settleReinvestment(ctx, p)
+		if err != nil {
+			logrus.WithContext(ctx).WithError(err).WithField("dividend_payment_id", p.ID).Error("Error settling reinvestment")
+			continue
+		}
+		if ok {
+			settled++
+			PortfolioEvents().PublishUser(p.UserID)
+		}
+	}
+
+	if settled > 0 {
+		logrus.WithContext(ctx).WithField("count", settled).Info("Settled dividend reinvestments")
+	}
+
+	return settled, nil
+}
+
+// settleReinvestment moves one payment's reinvested shares to the settled part
+// of the holding. It reports false if the payment was already settled.
+func settleReinvestment(ctx context.Context, p models.DividendPayment) (ok bool, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "settleReinvestment", attribute.String("dividend_payment_id", p.ID.String()))
+	defer telemetry.EndSpan(span, &err)
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Guard on settled_at so a payment's shares settle only once
+	result, err := tx.ExecContext(ctx, `
+		UPDATE dividend_payments SET settled_at = GETUTCDATE()
+		WHERE id = @p1 AND settled_at IS NULL
+	`, p.ID)
+	if err != nil {
+		return false, fmt.Errorf("error settling reinvestment: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return false, nil
+	}
+
+	if err := settleHolding(ctx, tx, p.UserID, p.StockSymbol, *p.ReinvestedQuantity, "dividend_payment_id", p.ID); err != nil {
+		return false, err
+	}
+
+	err = recordAudit(ctx, tx, models.AuditDividendSettle, models.AuditEntityDividend, p.DividendID.String(), nil,
+		map[string]interface{}{
+			"dividend_payment_id": p.ID,
+			"user_id":             p.UserID,
+			"settlement_date":     p.SettlementDate.Format("2006-01-02"),
+			"settled_quantity":    *p.ReinvestedQuantity,
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return true, nil
+}
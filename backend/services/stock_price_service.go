@@ -1,57 +1,55 @@
 package services
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"math/rand"
 	"time"
 
 	"backend/database"
+	"backend/metrics"
+	"backend/models"
+	"backend/telemetry"
 
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-type StockPriceService struct{}
+type StockPriceService struct {
+	provider PriceProvider
+	cache    *priceCache
+}
 
 func NewStockPriceService() *StockPriceService {
-	return &StockPriceService{}
+	return &StockPriceService{
+		provider: defaultPriceProvider,
+		cache:    defaultPriceCache,
+	}
 }
 
-// GetPrice returns the current price for a stock symbol
-// For now, this is a hypothetical service that returns random prices
-func (s *StockPriceService) GetPrice(symbol string) (float64, error) {
-	// Hypothetical price generation based on stock symbol
-	// In production, this would call an external API
-	rand.Seed(time.Now().UnixNano())
-
-	// Base prices for common Indian stocks (hypothetical)
-	basePrices := map[string]float64{
-		"RELIANCE":   2500.0,
-		"TCS":        3500.0,
-		"INFY":       1500.0,
-		"HDFCBANK":   1700.0,
-		"ICICIBANK":  950.0,
-		"BHARTIARTL": 1200.0,
-		"SBIN":       600.0,
-		"BAJFINANCE": 7000.0,
-		"WIPRO":      450.0,
-		"HINDUNILVR": 2500.0,
+// GetPrice returns the current price for a stock symbol from the live provider.
+// Lookups share the provider's rate limit with UpdateAllPrices.
+func (s *StockPriceService) GetPrice(ctx context.Context, symbol string) (price float64, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "StockPriceService.GetPrice",
+		attribute.String("stock_symbol", symbol),
+		attribute.String("provider", s.provider.Name()),
+	)
+	defer telemetry.EndSpan(span, &err)
+
+	if err := providerLimiter(s.provider.Name()).Wait(ctx); err != nil {
+		return 0, fmt.Errorf("%w: error waiting for price provider: %v", ErrPriceUnavailable, err)
 	}
 
-	basePrice, exists := basePrices[symbol]
-	if !exists {
-		// Default base price for unknown stocks
-		basePrice = 1000.0
+	price, err = s.provider.FetchPrice(ctx, symbol)
+	if errors.Is(err, ErrUnknownSymbol) {
+		return 0, err
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%w: error fetching price from %s: %v", ErrPriceUnavailable, s.provider.Name(), err)
 	}
 
-	// Add random variation (±5%)
-	variation := (rand.Float64() - 0.5) * 0.1 // -5% to +5%
-	price := basePrice * (1 + variation)
-
-	// Round to 2 decimal places
-	price = float64(int(price*100+0.5)) / 100
-
-	logrus.WithFields(logrus.Fields{
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
 		"symbol": symbol,
 		"price":  price,
 	}).Info("Fetched stock price")
@@ -60,8 +58,11 @@ func (s *StockPriceService) GetPrice(symbol string) (float64, error) {
 }
 
 // UpdatePrice updates the stock price in the database
-func (s *StockPriceService) UpdatePrice(symbol string, price float64) error {
-	_, err := database.DB.Exec(`
+func (s *StockPriceService) UpdatePrice(ctx context.Context, symbol string, price float64) (err error) {
+	ctx, span := telemetry.StartSpan(ctx, "StockPriceService.UpdatePrice", attribute.String("stock_symbol", symbol))
+	defer telemetry.EndSpan(span, &err)
+
+	_, err = database.DB.ExecContext(ctx, `
 		MERGE stock_prices AS target
 		USING (SELECT @p1 AS stock_symbol, @p2 AS price, @p3 AS last_updated) AS source
 		ON target.stock_symbol = source.stock_symbol
@@ -76,76 +77,98 @@ func (s *StockPriceService) UpdatePrice(symbol string, price float64) error {
 		return fmt.Errorf("error updating stock price: %w", err)
 	}
 
+	s.cache.invalidate(symbol)
 	return nil
 }
 
-// UpdateAllPrices fetches and updates prices for all stocks in the system
-func (s *StockPriceService) UpdateAllPrices() error {
-	rows, err := database.DB.Query(`
-		SELECT DISTINCT stock_symbol FROM reward_events WHERE deleted_at IS NULL
-		UNION
-		SELECT stock_symbol FROM stock_prices
-	`)
+// GetLastKnownPrice returns the stored price for a symbol regardless of its age.
+// It never fetches or writes; callers decide what to do with an old price.
+// Lookups go through the shared price cache.
+func (s *StockPriceService) GetLastKnownPrice(ctx context.Context, symbol string) (price *models.StockPrice, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "StockPriceService.GetLastKnownPrice", attribute.String("stock_symbol", symbol))
+	defer telemetry.EndSpan(span, &err)
+
+	price, err = s.cache.get(symbol, func() (*models.StockPrice, error) {
+		// The lookup is shared with concurrent callers, so one caller's
+		// cancellation must not fail it for the others
+		return s.loadStoredPrice(context.WithoutCancel(ctx), symbol)
+	})
 	if err != nil {
-		return fmt.Errorf("error fetching stock symbols: %w", err)
+		return nil, err
 	}
-	defer rows.Close()
 
-	var symbols []string
-	for rows.Next() {
-		var symbol string
-		if err := rows.Scan(&symbol); err != nil {
-			continue
-		}
-		symbols = append(symbols, symbol)
-	}
+	price.IsStale = CurrentStalenessPolicy().IsStale(price.LastUpdated, time.Now().UTC())
+	return price, nil
+}
 
-	for _, symbol := range symbols {
-		price, err := s.GetPrice(symbol)
-		if err != nil {
-			logrus.WithError(err).WithField("symbol", symbol).Error("Error fetching price")
-			continue
-		}
+// loadStoredPrice reads a symbol's row from stock_prices
+func (s *StockPriceService) loadStoredPrice(ctx context.Context, symbol string) (*models.StockPrice, error) {
+	price := &models.StockPrice{}
+	err := database.DB.QueryRowContext(ctx, `
+		SELECT id, stock_symbol, price, last_updated, is_stale, created_at, updated_at
+		FROM stock_prices WHERE stock_symbol = @p1
+	`, symbol).Scan(
+		&price.ID, &price.StockSymbol, &price.Price, &price.LastUpdated,
+		&price.IsStale, &price.CreatedAt, &price.UpdatedAt,
+	)
 
-		if err := s.UpdatePrice(symbol, price); err != nil {
-			logrus.WithError(err).WithField("symbol", symbol).Error("Error updating price")
-			continue
-		}
+	if err == sql.ErrNoRows {
+		return nil, ErrPriceNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting stock price: %w", err)
 	}
 
-	logrus.Info("Updated all stock prices")
-	return nil
+	return price, nil
 }
 
-// MarkStalePrices marks prices older than 1 hour as stale
-func (s *StockPriceService) MarkStalePrices() error {
-	oneHourAgo := time.Now().UTC().Add(-1 * time.Hour)
-	_, err := database.DB.Exec(`
+// MarkStalePrices flags prices older than the staleness policy allows
+func (s *StockPriceService) MarkStalePrices(ctx context.Context) (err error) {
+	ctx, span := telemetry.StartSpan(ctx, "StockPriceService.MarkStalePrices")
+	defer telemetry.EndSpan(span, &err)
+
+	cutoff := CurrentStalenessPolicy().StaleCutoff(time.Now().UTC())
+	_, err = database.DB.ExecContext(ctx, `
 		UPDATE stock_prices 
 		SET is_stale = 1 
-		WHERE last_updated < @p1
-	`, oneHourAgo)
+		WHERE last_updated < @p1 AND is_stale = 0
+	`, cutoff)
 
 	if err != nil {
 		return fmt.Errorf("error marking stale prices: %w", err)
 	}
 
+	var staleCount int
+	err = database.DB.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM stock_prices WHERE last_updated < @p1
+	`, cutoff).Scan(&staleCount)
+	if err != nil {
+		return fmt.Errorf("error counting stale prices: %w", err)
+	}
+	metrics.StalePrices.Set(float64(staleCount))
+
 	return nil
 }
 
 // GetHistoricalPrice returns the price for a stock on a specific date
-func (s *StockPriceService) GetHistoricalPrice(symbol string, date time.Time) (float64, error) {
+func (s *StockPriceService) GetHistoricalPrice(ctx context.Context, symbol string, date time.Time) (price float64, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "StockPriceService.GetHistoricalPrice", attribute.String("stock_symbol", symbol))
+	defer telemetry.EndSpan(span, &err)
+
 	dateOnly := date.Truncate(24 * time.Hour)
 
-	var price float64
-	err := database.DB.QueryRow(`
+	err = database.DB.QueryRowContext(ctx, `
 		SELECT price FROM stock_price_history 
 		WHERE stock_symbol = @p1 AND price_date = @p2
 	`, symbol, dateOnly).Scan(&price)
 
 	if err == sql.ErrNoRows {
-		// If no historical price, use current price
-		return s.GetPrice(symbol)
+		// If no historical price, use the last known price
+		lastKnown, err := s.GetLastKnownPrice(ctx, symbol)
+		if err != nil {
+			return 0, err
+		}
+		return lastKnown.Price, nil
 	}
 
 	if err != nil {
@@ -155,11 +178,41 @@ func (s *StockPriceService) GetHistoricalPrice(symbol string, date time.Time) (f
 	return price, nil
 }
 
+// SnapshotClosingPrices copies the current price of every symbol into
+// stock_price_history as the close for the given trading day
+func (s *StockPriceService) SnapshotClosingPrices(ctx context.Context, tradingDay time.Time) (err error) {
+	ctx, span := telemetry.StartSpan(ctx, "StockPriceService.SnapshotClosingPrices")
+	defer telemetry.EndSpan(span, &err)
+
+	dateOnly := tradingDay.Truncate(24 * time.Hour)
+
+	_, err = database.DB.ExecContext(ctx, `
+		MERGE stock_price_history AS target
+		USING (SELECT stock_symbol, price FROM stock_prices) AS source
+		ON target.stock_symbol = source.stock_symbol AND target.price_date = @p1
+		WHEN MATCHED THEN
+			UPDATE SET price = source.price
+		WHEN NOT MATCHED THEN
+			INSERT (stock_symbol, price, price_date)
+			VALUES (source.stock_symbol, source.price, @p1);
+	`, dateOnly)
+
+	if err != nil {
+		return fmt.Errorf("error snapshotting closing prices: %w", err)
+	}
+
+	logrus.WithContext(ctx).WithField("date", dateOnly.Format("2006-01-02")).Info("Saved end-of-day price snapshot")
+	return nil
+}
+
 // SaveHistoricalPrice saves a price for a specific date
-func (s *StockPriceService) SaveHistoricalPrice(symbol string, date time.Time, price float64) error {
+func (s *StockPriceService) SaveHistoricalPrice(ctx context.Context, symbol string, date time.Time, price float64) (err error) {
+	ctx, span := telemetry.StartSpan(ctx, "StockPriceService.SaveHistoricalPrice", attribute.String("stock_symbol", symbol))
+	defer telemetry.EndSpan(span, &err)
+
 	dateOnly := date.Truncate(24 * time.Hour)
 
-	_, err := database.DB.Exec(`
+	_, err = database.DB.ExecContext(ctx, `
 		MERGE stock_price_history AS target
 		USING (SELECT @p1 AS stock_symbol, @p2 AS price_date, @p3 AS price) AS source
 		ON target.stock_symbol = source.stock_symbol AND target.price_date = source.price_date
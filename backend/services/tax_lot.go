@@ -0,0 +1,308 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"backend/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// TaxOptions control how gains on redeemed shares are classified
+type TaxOptions struct {
+	// LongTermMonths is how long shares must be held before a sale is a
+	// long-term gain; a sale after exactly that long is still short-term
+	LongTermMonths int
+	// GrandfatherDate is the date (YYYY-MM-DD) whose closing price steps up
+	// the cost of shares acquired on or before it, when sold long-term
+	// (section 112A). Empty turns grandfathering off.
+	GrandfatherDate string
+}
+
+// DefaultTaxOptions treat listed shares held over 12 months as long-term and
+// grandfather gains accrued up to 31 January 2018
+func DefaultTaxOptions() TaxOptions {
+	return TaxOptions{LongTermMonths: 12, GrandfatherDate: "2018-01-31"}
+}
+
+// Validate checks the holding period and that the grandfathering date parses
+func (o TaxOptions) Validate() error {
+	if o.LongTermMonths <= 0 {
+		return fmt.Errorf("long_term_months must be positive, got %d", o.LongTermMonths)
+	}
+	if o.GrandfatherDate != "" {
+		if _, err := time.Parse("2006-01-02", o.GrandfatherDate); err != nil {
+			return fmt.Errorf("invalid grandfather_date %q: %w", o.GrandfatherDate, err)
+		}
+	}
+	return nil
+}
+
+// term returns whether shares acquired on one date and sold on another give
+// a short- or long-term gain
+func (o TaxOptions) term(acquiredOn, disposedOn time.Time) string {
+	if disposedOn.After(addMonths(acquiredOn, o.LongTermMonths)) {
+		return models.GainLongTerm
+	}
+	return models.GainShortTerm
+}
+
+// grandfathered reports whether shares acquired on a date have their cost
+// stepped up when sold long-term
+func (o TaxOptions) grandfathered(acquiredOn time.Time) bool {
+	if o.GrandfatherDate == "" {
+		return false
+	}
+	date, _ := time.Parse("2006-01-02", o.GrandfatherDate)
+	return !acquiredOn.After(date)
+}
+
+// issuancePrice returns the price per share a reward was issued at, its INR
+// value over its quantity. Rewards issued without a value use fallback.
+func issuancePrice(ctx context.Context, tx *sql.Tx, rewardID uuid.UUID, fallback float64) (float64, error) {
+	var price sql.NullFloat64
+	err := tx.QueryRowContext(ctx,
+		"SELECT inr_value / NULLIF(quantity, 0) FROM reward_events WHERE id = @p1", rewardID,
+	).Scan(&price)
+	if err != nil {
+		return 0, fmt.Errorf("error reading reward issuance price: %w", err)
+	}
+	if !price.Valid {
+		return fallback, nil
+	}
+	return roundTo(price.Float64, amountPlaces), nil
+}
+
+// perquisiteFMV returns the fair market value per share that a reward's shares
+// are taxed at as a perquisite when they become the user's on date (IST): the
+// closing price on that date, or the last close before it, falling back to
+// the reward's issuance price. Their tax lot costs the same, so the value
+// taxed as salary is not taxed again as a gain (s.49(2AA)).
+func perquisiteFMV(ctx context.Context, tx *sql.Tx, rewardID uuid.UUID, symbol string, date time.Time, fallback float64) (float64, error) {
+	var price float64
+	err := tx.QueryRowContext(ctx, `
+		SELECT TOP 1 price FROM stock_price_history
+		WHERE stock_symbol = @p1 AND price_date <= @p2
+		ORDER BY price_date DESC
+	`, symbol, calendarDate(date)).Scan(&price)
+	if errors.Is(err, sql.ErrNoRows) {
+		return issuancePrice(ctx, tx, rewardID, fallback)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error reading fair market value: %w", err)
+	}
+	return roundTo(price, amountPlaces), nil
+}
+
+// createLot opens a tax lot for shares that came into a user's stock inventory
+func createLot(ctx context.Context, tx *sql.Tx, lot models.TaxLot) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO tax_lots (user_id, stock_symbol, source, source_id, acquired_on, quantity, remaining_quantity, cost_per_share)
+		VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p6, @p7)
+	`, lot.UserID, lot.StockSymbol, lot.Source, lot.SourceID, lot.AcquiredOn, lot.Quantity, lot.CostPerShare)
+	if err != nil {
+		return fmt.Errorf("error creating tax lot: %w", err)
+	}
+	return nil
+}
+
+// lotSale is the sale shares are disposed of in. Value is the full sale
+// consideration; Expenses are the costs of the transfer that reduce the gain
+// (brokerage and GST, but not STT).
+type lotSale struct {
+	Value    float64
+	Expenses float64
+}
+
+// openLot is a tax lot with shares left, as read by consumeLots
+type openLot struct {
+	id           uuid.UUID
+	acquiredOn   time.Time
+	remaining    float64
+	costPerShare float64
+}
+
+// lotsTaken totals the disposals recorded by consumeLots
+type lotsTaken struct {
+	// Cost is the disposals' cost basis, after any grandfathering
+	Cost float64
+	// Gain is the disposals' capital gain; it is 0 without a sale
+	Gain float64
+}
+
+// consumeLots takes quantity shares out of a user's open lots of a symbol,
+// oldest first, and records a disposal against each lot used. Sales split
+// their value and expenses across the lots by quantity and record each
+// lot's gain and term; withdrawals pass a nil sale.
+func consumeLots(ctx context.Context, tx *sql.Tx, userID uuid.UUID, symbol string, quantity float64, kind string, referenceID uuid.UUID, sale *lotSale) (taken lotsTaken, err error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, acquired_on, remaining_quantity, cost_per_share
+		FROM tax_lots WITH (UPDLOCK, ROWLOCK)
+		WHERE user_id = @p1 AND stock_symbol = @p2 AND remaining_quantity > 0
+		ORDER BY acquired_on, created_at, id
+	`, userID, symbol)
+	if err != nil {
+		return lotsTaken{}, fmt.Errorf("error querying tax lots: %w", err)
+	}
+	var lots []openLot
+	for rows.Next() {
+		var l openLot
+		if err := rows.Scan(&l.id, &l.acquiredOn, &l.remaining, &l.costPerShare); err != nil {
+			rows.Close()
+			return lotsTaken{}, fmt.Errorf("error scanning tax lot: %w", err)
+		}
+		lots = append(lots, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return lotsTaken{}, fmt.Errorf("error reading tax lots: %w", err)
+	}
+
+	opts := CurrentTaxOptions()
+	disposedOn := calendarDate(startOfDayIST(time.Now()))
+	fmv, fmvRead := 0.0, false
+	left := quantity
+	var allocatedValue, allocatedExpenses float64
+	for _, l := range lots {
+		if left <= 0 {
+			break
+		}
+		used := math.Min(l.remaining, left)
+		left = roundTo(left-used, quantityPlaces)
+
+		d := models.LotDisposal{
+			ID:         uuid.New(),
+			LotID:      l.id,
+			Quantity:   used,
+			AcquiredOn: l.acquiredOn,
+			CostBasis:  roundTo(used*l.costPerShare, amountPlaces),
+		}
+		if sale != nil {
+			// The last lot takes what rounding left over
+			value := roundTo(sale.Value*used/quantity, amountPlaces)
+			expenses := roundTo(sale.Expenses*used/quantity, amountPlaces)
+			if left <= 0 {
+				value = roundTo(sale.Value-allocatedValue, amountPlaces)
+				expenses = roundTo(sale.Expenses-allocatedExpenses, amountPlaces)
+			}
+			allocatedValue += value
+			allocatedExpenses += expenses
+
+			term := opts.term(l.acquiredOn, disposedOn)
+			if term == models.GainLongTerm && opts.grandfathered(l.acquiredOn) {
+				if !fmvRead {
+					if fmv, err = grandfatherPrice(ctx, tx, symbol, opts.GrandfatherDate); err != nil {
+						return lotsTaken{}, err
+					}
+					fmvRead = true
+				}
+				// Cost is the higher of the actual cost and the lower of the
+				// grandfathering date's value and the sale value
+				if stepped := math.Min(roundTo(used*fmv, amountPlaces), value); stepped > d.CostBasis {
+					d.CostBasis = stepped
+					d.Grandfathered = true
+				}
+			}
+			proceeds := roundTo(value-expenses, amountPlaces)
+			gain := roundTo(proceeds-d.CostBasis, amountPlaces)
+			d.Proceeds, d.Gain, d.Term = &proceeds, &gain, &term
+			taken.Gain += gain
+		}
+		taken.Cost += d.CostBasis
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE tax_lots SET remaining_quantity = remaining_quantity - @p1, updated_at = GETUTCDATE()
+			WHERE id = @p2
+		`, used, l.id)
+		if err != nil {
+			return lotsTaken{}, fmt.Errorf("error taking shares from tax lot: %w", err)
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO tax_lot_disposals (id, lot_id, user_id, stock_symbol, kind, reference_id, quantity, acquired_on, disposed_on,
+				cost_basis, proceeds, gain, term, grandfathered)
+			VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8, @p9, @p10, @p11, @p12, @p13, @p14)
+		`, d.ID, d.LotID, userID, symbol, kind, referenceID, d.Quantity, d.AcquiredOn, disposedOn,
+			d.CostBasis, d.Proceeds, d.Gain, d.Term, d.Grandfathered)
+		if err != nil {
+			return lotsTaken{}, fmt.Errorf("error recording tax lot disposal: %w", err)
+		}
+	}
+
+	// Lots are opened for every share coming into stock inventory, so they
+	// only fall short if the two have drifted apart
+	if left > 0 {
+		logrus.WithContext(ctx).WithFields(logrus.Fields{
+			"user_id":      userID,
+			"stock_symbol": symbol,
+			"kind":         kind,
+			"reference_id": referenceID,
+			"uncovered":    left,
+		}).Warn("Tax lots do not cover disposed shares")
+	}
+	taken.Cost = roundTo(taken.Cost, amountPlaces)
+	taken.Gain = roundTo(taken.Gain, amountPlaces)
+	return taken, nil
+}
+
+// grandfatherPrice returns a symbol's closing price on the last trading day
+// on or before the grandfathering date. A price from any earlier day is not
+// that date's value, so without one the stored cost is used and it returns 0.
+func grandfatherPrice(ctx context.Context, tx *sql.Tx, symbol, date string) (float64, error) {
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return 0, fmt.Errorf("invalid grandfather_date %q: %w", date, err)
+	}
+
+	var price float64
+	err = tx.QueryRowContext(ctx, `
+		SELECT price FROM stock_price_history
+		WHERE stock_symbol = @p1 AND price_date = @p2
+	`, symbol, CurrentMarketCalendar().TradingDayOnOrBefore(day)).Scan(&price)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error reading grandfathered price: %w", err)
+	}
+	return price, nil
+}
+
+// restoreLots puts the shares a disposal took back into their lots and marks
+// its disposals reversed. It returns the quantity restored.
+func restoreLots(ctx context.Context, tx *sql.Tx, kind string, referenceID uuid.UUID) (float64, error) {
+	var restored float64
+	err := tx.QueryRowContext(ctx, `
+		SELECT ISNULL(SUM(quantity), 0) FROM tax_lot_disposals
+		WHERE kind = @p1 AND reference_id = @p2 AND reversed_at IS NULL
+	`, kind, referenceID).Scan(&restored)
+	if err != nil {
+		return 0, fmt.Errorf("error reading tax lot disposals: %w", err)
+	}
+	if restored == 0 {
+		return 0, nil
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE l SET remaining_quantity = l.remaining_quantity + d.quantity, updated_at = GETUTCDATE()
+		FROM tax_lots l
+		JOIN tax_lot_disposals d ON d.lot_id = l.id
+		WHERE d.kind = @p1 AND d.reference_id = @p2 AND d.reversed_at IS NULL
+	`, kind, referenceID)
+	if err != nil {
+		return 0, fmt.Errorf("error restoring tax lots: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE tax_lot_disposals SET reversed_at = GETUTCDATE()
+		WHERE kind = @p1 AND reference_id = @p2 AND reversed_at IS NULL
+	`, kind, referenceID)
+	if err != nil {
+		return 0, fmt.Errorf("error reversing tax lot disposals: %w", err)
+	}
+	return roundTo(restored, quantityPlaces), nil
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"backend/models"
+)
+
+func TestTaxOptionsTerm(t *testing.T) {
+	o := TaxOptions{LongTermMonths: 12}
+
+	tests := []struct {
+		name       string
+		acquiredOn time.Time
+		disposedOn time.Time
+		want       string
+	}{
+		{"same day", date(2023, time.June, 15), date(2023, time.June, 15), models.GainShortTerm},
+		{"a day short of 12 months", date(2023, time.June, 15), date(2024, time.June, 14), models.GainShortTerm},
+		{"exactly 12 months is still short-term", date(2023, time.June, 15), date(2024, time.June, 15), models.GainShortTerm},
+		{"a day over 12 months", date(2023, time.June, 15), date(2024, time.June, 16), models.GainLongTerm},
+		{"Feb 29 acquisition ends on Feb 28", date(2024, time.February, 29), date(2025, time.February, 28), models.GainShortTerm},
+		{"Feb 29 acquisition goes long on Mar 1", date(2024, time.February, 29), date(2025, time.March, 1), models.GainLongTerm},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := o.term(tt.acquiredOn, tt.disposedOn); got != tt.want {
+				t.Errorf("term(%s, %s) = %s, want %s", tt.acquiredOn.Format("2006-01-02"), tt.disposedOn.Format("2006-01-02"), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTaxOptionsGrandfathered(t *testing.T) {
+	tests := []struct {
+		name       string
+		options    TaxOptions
+		acquiredOn time.Time
+		want       bool
+	}{
+		{"before the date", DefaultTaxOptions(), date(2017, time.December, 1), true},
+		{"on the date", DefaultTaxOptions(), date(2018, time.January, 31), true},
+		{"after the date", DefaultTaxOptions(), date(2018, time.February, 1), false},
+		{"turned off", TaxOptions{LongTermMonths: 12}, date(2017, time.December, 1), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.options.grandfathered(tt.acquiredOn); got != tt.want {
+				t.Errorf("grandfathered(%s) = %v, want %v", tt.acquiredOn.Format("2006-01-02"), got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,314 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"backend/database"
+	"backend/models"
+	"backend/telemetry"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// TaxService reports users' tax lots, the capital gains realized on them and
+// their annual tax statements
+type TaxService struct{}
+
+func NewTaxService() *TaxService {
+	return &TaxService{}
+}
+
+// ListTaxLots returns a user's tax lots, oldest first, including lots whose
+// shares have all been redeemed or withdrawn
+func (s *TaxService) ListTaxLots(ctx context.Context, userID uuid.UUID) (lots []models.TaxLot, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "TaxService.ListTaxLots")
+	defer telemetry.EndSpan(span, &err)
+
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT `+taxLotColumnList+`
+		FROM tax_lots
+		WHERE user_id = @p1
+		ORDER BY stock_symbol, acquired_on, created_at, id
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying tax lots: %w", err)
+	}
+	defer rows.Close()
+
+	lots = []models.TaxLot{}
+	for rows.Next() {
+		var l models.TaxLot
+		if err := rows.Scan(taxLotFields(&l)...); err != nil {
+			return nil, fmt.Errorf("error scanning tax lot: %w", err)
+		}
+		lots = append(lots, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading tax lots: %w", err)
+	}
+
+	return lots, nil
+}
+
+// GetCapitalGains returns the gains a user realized by redeeming shares,
+// lot by lot, newest first, with short- and long-term totals
+func (s *TaxService) GetCapitalGains(ctx context.Context, userID uuid.UUID) (gains *models.CapitalGains, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "TaxService.GetCapitalGains")
+	defer telemetry.EndSpan(span, &err)
+
+	realized, err := realizedGains(ctx, userID, sql.NullTime{}, sql.NullTime{})
+	if err != nil {
+		return nil, err
+	}
+	return &models.CapitalGains{
+		UserID:        userID,
+		ShortTermGain: realized.ShortTermGain,
+		LongTermGain:  realized.LongTermGain,
+		Disposals:     realized.Disposals,
+	}, nil
+}
+
+// GetTaxStatement returns a user's tax statement for a financial year given
+// as "2024-25": rewards granted in the year at their fair market value,
+// dividends paid, capital gains realized and TDS withheld
+func (s *TaxService) GetTaxStatement(ctx context.Context, userID uuid.UUID, financialYear string) (statement *models.TaxStatement, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "TaxService.GetTaxStatement", attribute.String("financial_year", financialYear))
+	defer telemetry.EndSpan(span, &err)
+
+	from, err := parseFinancialYear(financialYear)
+	if err != nil {
+		return nil, err
+	}
+	to := from.AddDate(1, 0, 0)
+
+	var userExists bool
+	err = database.DB.QueryRowContext(ctx,
+		"SELECT CASE WHEN EXISTS(SELECT 1 FROM users WHERE id = @p1) THEN 1 ELSE 0 END",
+		userID,
+	).Scan(&userExists)
+	if err != nil {
+		return nil, fmt.Errorf("error checking user existence: %w", err)
+	}
+	if !userExists {
+		return nil, ErrUserNotFound
+	}
+
+	statement = &models.TaxStatement{
+		UserID:        userID,
+		FinancialYear: financialYear,
+		From:          from,
+		To:            to.AddDate(0, 0, -1),
+		GeneratedAt:   time.Now().UTC(),
+	}
+
+	if statement.Rewards, err = perquisiteRewards(ctx, userID, from, to); err != nil {
+		return nil, err
+	}
+	for _, r := range statement.Rewards {
+		statement.PerquisiteValue += r.PerquisiteValue
+	}
+	statement.PerquisiteValue = roundTo(statement.PerquisiteValue, amountPlaces)
+
+	if statement.Dividends, err = statementDividends(ctx, userID, from, to); err != nil {
+		return nil, err
+	}
+	for _, d := range statement.Dividends {
+		statement.DividendIncome += d.GrossAmount
+		statement.TDSDeducted += d.TDSAmount
+	}
+	statement.DividendIncome = roundTo(statement.DividendIncome, amountPlaces)
+	statement.TDSDeducted = roundTo(statement.TDSDeducted, amountPlaces)
+
+	statement.CapitalGains, err = realizedGains(ctx, userID,
+		sql.NullTime{Time: from, Valid: true}, sql.NullTime{Time: to, Valid: true})
+	if err != nil {
+		return nil, err
+	}
+
+	return statement, nil
+}
+
+// perquisiteRewards returns the shares that became a user's between two dates
+// (IST), in date order. A reward without vesting is a perquisite on its grant
+// date, for the quantity bought for it, and each vested tranche of a reward
+// that vests is one on its vest date. The fair market value is the closing
+// price on that date, or the last close before it, which is also what the
+// shares' tax lot costs; a tranche uses the value recorded when it vested.
+func perquisiteRewards(ctx context.Context, userID uuid.UUID, from, to time.Time) ([]models.PerquisiteReward, error) {
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT p.reward_id, p.tranche_id, p.stock_symbol, p.event_type, p.grant_date, p.vest_date, p.quantity,
+			p.issuance, p.price, p.price_date
+		FROM (
+			SELECT re.id AS reward_id, CAST(NULL AS UNIQUEIDENTIFIER) AS tranche_id, re.stock_symbol, re.event_type,
+				re.reward_timestamp, CAST(DATEADD(minute, 330, re.reward_timestamp) AS DATE) AS grant_date,
+				CAST(NULL AS DATE) AS vest_date, CAST(DATEADD(minute, 330, re.reward_timestamp) AS DATE) AS perquisite_date,
+				COALESCE((SELECT SUM(a.filled_quantity) FROM broker_order_allocations a WHERE a.reward_id = re.id), re.quantity) AS quantity,
+				re.inr_value / NULLIF(re.quantity, 0) AS issuance, fmv.price, fmv.price_date
+			FROM reward_events re
+			OUTER APPLY (
+				SELECT TOP 1 h.price, h.price_date FROM stock_price_history h
+				WHERE h.stock_symbol = re.stock_symbol AND h.price_date <= CAST(DATEADD(minute, 330, re.reward_timestamp) AS DATE)
+				ORDER BY h.price_date DESC
+			) fmv
+			WHERE re.user_id = @p1 AND re.deleted_at IS NULL AND re.status IN (@p5, @p6, @p7)
+				AND re.vesting_duration_months IS NULL
+				AND CAST(DATEADD(minute, 330, re.reward_timestamp) AS DATE) >= @p2
+				AND CAST(DATEADD(minute, 330, re.reward_timestamp) AS DATE) < @p3
+
+			UNION ALL
+
+			SELECT re.id, t.id, re.stock_symbol, re.event_type,
+				re.reward_timestamp, CAST(DATEADD(minute, 330, re.reward_timestamp) AS DATE),
+				t.vest_date, t.vest_date,
+				t.quantity,
+				re.inr_value / NULLIF(re.quantity, 0), COALESCE(t.fair_market_value, fmv.price), fmv.price_date
+			FROM vesting_tranches t
+			JOIN reward_events re ON re.id = t.reward_id
+			OUTER APPLY (
+				SELECT TOP 1 h.price, h.price_date FROM stock_price_history h
+				WHERE h.stock_symbol = t.stock_symbol AND h.price_date <= t.vest_date
+				ORDER BY h.price_date DESC
+			) fmv
+			WHERE t.user_id = @p1 AND t.status = @p4 AND re.deleted_at IS NULL
+				AND t.vest_date >= @p2 AND t.vest_date < @p3
+		) p
+		ORDER BY p.perquisite_date, p.reward_timestamp, p.reward_id, p.vest_date
+	`, userID, from, to,
+		models.TrancheStatusVested, models.RewardStatusActive, models.RewardStatusFulfilled, models.RewardStatusSettled)
+	if err != nil {
+		return nil, fmt.Errorf("error querying rewarded shares: %w", err)
+	}
+	defer rows.Close()
+
+	rewards := []models.PerquisiteReward{}
+	for rows.Next() {
+		var r models.PerquisiteReward
+		var trancheID uuid.NullUUID
+		var vestDate, priceDate sql.NullTime
+		var issuance, price sql.NullFloat64
+		err := rows.Scan(&r.RewardID, &trancheID, &r.StockSymbol, &r.EventType, &r.GrantDate, &vestDate, &r.Quantity,
+			&issuance, &price, &priceDate)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning rewarded shares: %w", err)
+		}
+		if r.Quantity = roundTo(r.Quantity, quantityPlaces); r.Quantity <= 0 {
+			continue
+		}
+		if trancheID.Valid {
+			r.TrancheID = &trancheID.UUID
+			r.VestDate = &vestDate.Time
+		}
+		if price.Valid {
+			r.FairMarketValue = roundTo(price.Float64, amountPlaces)
+			if priceDate.Valid {
+				r.FMVDate = &priceDate.Time
+			}
+		} else {
+			r.FairMarketValue = roundTo(issuance.Float64, amountPlaces)
+		}
+		r.PerquisiteValue = roundTo(r.Quantity*r.FairMarketValue, amountPlaces)
+		rewards = append(rewards, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading rewarded shares: %w", err)
+	}
+	return rewards, nil
+}
+
+// statementDividends returns the dividends paid to a user with pay dates
+// between two dates, in pay date order
+func statementDividends(ctx context.Context, userID uuid.UUID, from, to time.Time) ([]models.StatementDividend, error) {
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT p.id, p.dividend_id, p.stock_symbol, d.pay_date, p.entitled_quantity, d.amount_per_share,
+			p.gross_amount, p.tds_amount, p.net_amount, p.mode
+		FROM dividend_payments p
+		JOIN dividends d ON d.id = p.dividend_id
+		WHERE p.user_id = @p1 AND d.pay_date >= @p2 AND d.pay_date < @p3
+		ORDER BY d.pay_date, p.stock_symbol
+	`, userID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("error querying dividend payments: %w", err)
+	}
+	defer rows.Close()
+
+	dividends := []models.StatementDividend{}
+	for rows.Next() {
+		var d models.StatementDividend
+		err := rows.Scan(&d.PaymentID, &d.DividendID, &d.StockSymbol, &d.PayDate, &d.EntitledQuantity, &d.AmountPerShare,
+			&d.GrossAmount, &d.TDSAmount, &d.NetAmount, &d.Mode)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning dividend payment: %w", err)
+		}
+		dividends = append(dividends, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading dividend payments: %w", err)
+	}
+	return dividends, nil
+}
+
+// realizedGains returns a user's redemption disposals, newest first, with
+// short- and long-term totals. Null bounds leave the disposal dates open.
+func realizedGains(ctx context.Context, userID uuid.UUID, from, to sql.NullTime) (models.StatementCapitalGains, error) {
+	gains := models.StatementCapitalGains{Disposals: []models.LotDisposal{}}
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT `+lotDisposalColumnList+`
+		FROM tax_lot_disposals
+		WHERE user_id = @p1 AND kind = @p2 AND reversed_at IS NULL
+			AND (@p3 IS NULL OR disposed_on >= @p3) AND (@p4 IS NULL OR disposed_on < @p4)
+		ORDER BY disposed_on DESC, created_at DESC, acquired_on
+	`, userID, models.DisposalRedemption, from, to)
+	if err != nil {
+		return gains, fmt.Errorf("error querying capital gains: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d models.LotDisposal
+		if err := rows.Scan(lotDisposalFields(&d)...); err != nil {
+			return gains, fmt.Errorf("error scanning capital gain: %w", err)
+		}
+		if d.Term != nil && d.Gain != nil {
+			if *d.Term == models.GainLongTerm {
+				gains.LongTermGain += *d.Gain
+			} else {
+				gains.ShortTermGain += *d.Gain
+			}
+		}
+		gains.Disposals = append(gains.Disposals, d)
+	}
+	if err := rows.Err(); err != nil {
+		return gains, fmt.Errorf("error reading capital gains: %w", err)
+	}
+	gains.ShortTermGain = roundTo(gains.ShortTermGain, amountPlaces)
+	gains.LongTermGain = roundTo(gains.LongTermGain, amountPlaces)
+	return gains, nil
+}
+
+// taxLotColumnList selects a tax_lots row, scanned with taxLotFields
+const taxLotColumnList = `id, user_id, stock_symbol, source, source_id, acquired_on, quantity, remaining_quantity, cost_per_share,
+	created_at, updated_at`
+
+// taxLotFields returns scan destinations matching taxLotColumnList
+func taxLotFields(l *models.TaxLot) []interface{} {
+	return []interface{}{
+		&l.ID, &l.UserID, &l.StockSymbol, &l.Source, &l.SourceID, &l.AcquiredOn, &l.Quantity, &l.RemainingQuantity, &l.CostPerShare,
+		&l.CreatedAt, &l.UpdatedAt,
+	}
+}
+
+// lotDisposalColumnList selects a tax_lot_disposals row, scanned with lotDisposalFields
+const lotDisposalColumnList = `id, lot_id, user_id, stock_symbol, kind, reference_id, quantity, acquired_on, disposed_on,
+	cost_basis, proceeds, gain, term, grandfathered, reversed_at, created_at`
+
+// lotDisposalFields returns scan destinations matching lotDisposalColumnList
+func lotDisposalFields(d *models.LotDisposal) []interface{} {
+	return []interface{}{
+		&d.ID, &d.LotID, &d.UserID, &d.StockSymbol, &d.Kind, &d.ReferenceID, &d.Quantity, &d.AcquiredOn, &d.DisposedOn,
+		&d.CostBasis, &d.Proceeds, &d.Gain, &d.Term, &d.Grandfathered, &d.ReversedAt, &d.CreatedAt,
+	}
+}
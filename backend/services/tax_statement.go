@@ -0,0 +1,99 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"backend/models"
+)
+
+// Financial years are written as the year they start and the last two digits
+// of the year they end, e.g. 2024-25
+var financialYearPattern = regexp.MustCompile(`^([0-9]{4})-([0-9]{2})$`)
+
+// parseFinancialYear returns 1 April of a financial year written as "2024-25"
+func parseFinancialYear(fy string) (time.Time, error) {
+	m := financialYearPattern.FindStringSubmatch(fy)
+	if m == nil {
+		return time.Time{}, fmt.Errorf("%w: financial year must be written as 2024-25", ErrInvalidRequest)
+	}
+	start, _ := strconv.Atoi(m[1])
+	end, _ := strconv.Atoi(m[2])
+	if end != (start+1)%100 {
+		return time.Time{}, fmt.Errorf("%w: financial year %s does not span consecutive years", ErrInvalidRequest, fy)
+	}
+	return time.Date(start, time.April, 1, 0, 0, 0, 0, time.UTC), nil
+}
+
+// taxStatementHeader is the header of a tax statement CSV. Every row has a
+// section: perquisite, dividend, capital_gain, or total for the summary rows.
+var taxStatementHeader = []string{
+	"section", "date", "acquired_on", "stock_symbol", "reference_id", "description",
+	"quantity", "price", "proceeds", "cost", "amount", "tds",
+}
+
+// TaxStatementCSV writes a tax statement as CSV: a row per reward, dividend
+// and lot sold, then the totals
+func TaxStatementCSV(st *models.TaxStatement) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(taxStatementHeader); err != nil {
+		return nil, fmt.Errorf("error writing tax statement header: %w", err)
+	}
+
+	var records [][]string
+	for _, r := range st.Rewards {
+		// A vested tranche is a perquisite on its vest date
+		date := r.GrantDate
+		if r.VestDate != nil {
+			date = *r.VestDate
+		}
+		records = append(records, []string{
+			"perquisite", date.Format("2006-01-02"), "", r.StockSymbol, r.RewardID.String(), r.EventType,
+			formatNumber(r.Quantity), formatNumber(r.FairMarketValue), "", "", formatNumber(r.PerquisiteValue), "",
+		})
+	}
+	for _, d := range st.Dividends {
+		records = append(records, []string{
+			"dividend", d.PayDate.Format("2006-01-02"), "", d.StockSymbol, d.PaymentID.String(), d.Mode,
+			formatNumber(d.EntitledQuantity), formatNumber(d.AmountPerShare), "", "", formatNumber(d.GrossAmount), formatNumber(d.TDSAmount),
+		})
+	}
+	for _, d := range st.CapitalGains.Disposals {
+		description := *d.Term
+		if d.Grandfathered {
+			description += " grandfathered"
+		}
+		records = append(records, []string{
+			"capital_gain", d.DisposedOn.Format("2006-01-02"), d.AcquiredOn.Format("2006-01-02"), d.StockSymbol, d.ReferenceID.String(), description,
+			formatNumber(d.Quantity), "", formatNumber(*d.Proceeds), formatNumber(d.CostBasis), formatNumber(*d.Gain), "",
+		})
+	}
+	totals := []struct {
+		name   string
+		amount float64
+	}{
+		{"perquisite_value", st.PerquisiteValue},
+		{"dividend_income", st.DividendIncome},
+		{"short_term_gain", st.CapitalGains.ShortTermGain},
+		{"long_term_gain", st.CapitalGains.LongTermGain},
+		{"tds_deducted", st.TDSDeducted},
+	}
+	for _, t := range totals {
+		records = append(records, []string{"total", "", "", "", "", t.name, "", "", "", "", formatNumber(t.amount), ""})
+	}
+
+	if err := w.WriteAll(records); err != nil {
+		return nil, fmt.Errorf("error writing tax statement: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// formatNumber writes a quantity or amount with as many decimals as it has
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseFinancialYear(t *testing.T) {
+	tests := []struct {
+		fy      string
+		want    time.Time
+		wantErr bool
+	}{
+		{fy: "2024-25", want: date(2024, time.April, 1)},
+		{fy: "1999-00", want: date(1999, time.April, 1)},
+		{fy: "2099-00", want: date(2099, time.April, 1)},
+		{fy: "2024-26", wantErr: true},
+		{fy: "2024-24", wantErr: true},
+		{fy: "1999-2000", wantErr: true},
+		{fy: "2024", wantErr: true},
+		{fy: "FY24-25", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fy, func(t *testing.T) {
+			got, err := parseFinancialYear(tt.fy)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidRequest) {
+					t.Errorf("parseFinancialYear(%q) error = %v, want ErrInvalidRequest", tt.fy, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseFinancialYear(%q) error = %v", tt.fy, err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parseFinancialYear(%q) = %s, want %s", tt.fy, got.Format("2006-01-02"), tt.want.Format("2006-01-02"))
+			}
+		})
+	}
+}
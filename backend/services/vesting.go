@@ -0,0 +1,450 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"backend/database"
+	"backend/models"
+	"backend/telemetry"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// VestingService vests reward tranches as their dates arrive and forfeits
+// those of users who leave first
+type VestingService struct{}
+
+func NewVestingService() *VestingService {
+	return &VestingService{}
+}
+
+// validateVesting checks a reward's vesting schedule. Tranches must divide
+// the vesting period evenly, and a schedule must vest over time or lock in.
+func validateVesting(v *models.VestingSchedule) error {
+	switch {
+	case v.DurationMonths == 0 && (v.IntervalMonths != 0 || v.CliffMonths != 0):
+		return fmt.Errorf("%w: vesting needs duration_months for a cliff or tranches", ErrInvalidRequest)
+	case v.DurationMonths == 0 && v.LockInUntil == nil:
+		return fmt.Errorf("%w: vesting needs duration_months or lock_in_until", ErrInvalidRequest)
+	case v.DurationMonths > 0 && v.IntervalMonths == 0:
+		return fmt.Errorf("%w: vesting needs interval_months", ErrInvalidRequest)
+	case v.DurationMonths > 0 && v.DurationMonths%v.IntervalMonths != 0:
+		return fmt.Errorf("%w: interval_months must divide duration_months", ErrInvalidRequest)
+	case v.CliffMonths > v.DurationMonths:
+		return fmt.Errorf("%w: cliff_months must not exceed duration_months", ErrInvalidRequest)
+	}
+	return nil
+}
+
+// trancheSplit is one tranche of a vesting schedule before it is stored
+type trancheSplit struct {
+	vestDate time.Time
+	quantity float64
+}
+
+// vestingTranches splits quantity into the tranches of a schedule starting on
+// the IST day of start. Tranches falling before the cliff vest together on
+// the cliff date. Quantities are rounded to the stored precision and the last
+// tranche absorbs the rounding.
+func vestingTranches(v *models.VestingSchedule, start time.Time, quantity float64) []trancheSplit {
+	startDate := calendarDate(startOfDayIST(start))
+	if v.DurationMonths == 0 {
+		return []trancheSplit{{vestDate: startDate, quantity: quantity}}
+	}
+
+	cliff := addMonths(startDate, v.CliffMonths)
+	count := v.DurationMonths / v.IntervalMonths
+	var tranches []trancheSplit
+	left := quantity
+	for i := 1; i <= count; i++ {
+		date := addMonths(startDate, i*v.IntervalMonths)
+		if date.Before(cliff) {
+			date = cliff
+		}
+		part := roundTo(quantity/float64(count), quantityPlaces)
+		if i == count {
+			part = roundTo(left, quantityPlaces)
+		}
+		left -= part
+
+		if n := len(tranches); n > 0 && tranches[n-1].vestDate.Equal(date) {
+			tranches[n-1].quantity = roundTo(tranches[n-1].quantity+part, quantityPlaces)
+			continue
+		}
+		tranches = append(tranches, trancheSplit{vestDate: date, quantity: part})
+	}
+	return tranches
+}
+
+// addMonths adds months to a date, clamping to the end of shorter months so
+// Jan 31 plus one month is Feb 28 or 29 rather than early March
+func addMonths(date time.Time, months int) time.Time {
+	first := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, date.Location()).AddDate(0, months, 0)
+	lastDay := first.AddDate(0, 1, -1).Day()
+	day := date.Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return time.Date(first.Year(), first.Month(), day, 0, 0, 0, 0, date.Location())
+}
+
+// createTranches records the vesting tranches for a reward's filled quantity
+// and marks them unvested on the holding
+func createTranches(ctx context.Context, tx *sql.Tx, reward models.RewardEvent, filled, costPrice float64) error {
+	for _, t := range vestingTranches(reward.Vesting, reward.RewardTimestamp, filled) {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO vesting_tranches (reward_id, user_id, stock_symbol, vest_date, quantity, cost_price, status)
+			VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7)
+		`, reward.ID, reward.UserID, reward.StockSymbol, t.vestDate, t.quantity, costPrice, models.TrancheStatusScheduled)
+		if err != nil {
+			return fmt.Errorf("error creating vesting tranche: %w", err)
+		}
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		UPDATE user_holdings SET unvested_quantity = unvested_quantity + @p1, updated_at = GETUTCDATE()
+		WHERE user_id = @p2 AND stock_symbol = @p3
+	`, filled, reward.UserID, reward.StockSymbol)
+	if err != nil {
+		return fmt.Errorf("error recording unvested quantity: %w", err)
+	}
+	return nil
+}
+
+// VestDueTranches vests every scheduled tranche whose vest date has arrived,
+// after first forfeiting the unvested tranches of users who have left. It
+// returns the number of tranches vested.
+func (s *VestingService) VestDueTranches(ctx context.Context) (vested int, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "VestingService.VestDueTranches")
+	defer telemetry.EndSpan(span, &err)
+
+	if err := s.forfeitDeparted(ctx); err != nil {
+		return 0, err
+	}
+
+	today := calendarDate(startOfDayIST(time.Now()))
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT vt.id, vt.reward_id, vt.user_id, vt.stock_symbol, vt.vest_date, vt.quantity, vt.cost_price, re.reference_id
+		FROM vesting_tranches vt
+		JOIN reward_events re ON re.id = vt.reward_id
+		WHERE vt.status = @p1 AND vt.vest_date <= @p2
+		ORDER BY vt.vest_date, vt.created_at
+	`, models.TrancheStatusScheduled, today)
+	if err != nil {
+		return 0, fmt.Errorf("error querying due tranches: %w", err)
+	}
+
+	type dueTranche struct {
+		tranche     models.VestingTranche
+		referenceID string
+	}
+	var due []dueTranche
+	for rows.Next() {
+		var d dueTranche
+		t := &d.tranche
+		if err := rows.Scan(&t.ID, &t.RewardID, &t.UserID, &t.StockSymbol, &t.VestDate, &t.Quantity, &t.CostPrice, &d.referenceID); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("error scanning due tranche: %w", err)
+		}
+		due = append(due, d)
+	}
+	rows.Close()
+
+	for _, d := range due {
+		ok, err := endTranche(ctx, d.tranche, d.referenceID, models.TrancheStatusVested, "")
+		if err != nil {
+			logrus.WithContext(ctx).WithError(err).WithField("tranche_id", d.tranche.ID).Error("Error vesting tranche")
+			continue
+		}
+		if ok {
+			vested++
+			PortfolioEvents().PublishUser(d.tranche.UserID)
+		}
+	}
+
+	if vested > 0 {
+		logrus.WithContext(ctx).WithField("count", vested).Info("Vested reward tranches")
+	}
+
+	return vested, nil
+}
+
+// ForfeitUnvested forfeits every tranche a user has not vested yet, for when
+// the user leaves before vesting. It returns the number of tranches forfeited.
+func (s *VestingService) ForfeitUnvested(ctx context.Context, userID uuid.UUID, reason string) (forfeited int, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "VestingService.ForfeitUnvested", attribute.String("user_id", userID.String()))
+	defer telemetry.EndSpan(span, &err)
+
+	var exists bool
+	err = database.DB.QueryRowContext(ctx,
+		"SELECT CASE WHEN EXISTS(SELECT 1 FROM users WHERE id = @p1) THEN 1 ELSE 0 END", userID,
+	).Scan(&exists)
+	if err != nil {
+		return 0, fmt.Errorf("error checking user existence: %w", err)
+	}
+	if !exists {
+		return 0, ErrUserNotFound
+	}
+
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT vt.id, vt.reward_id, vt.user_id, vt.stock_symbol, vt.vest_date, vt.quantity, vt.cost_price, re.reference_id
+		FROM vesting_tranches vt
+		JOIN reward_events re ON re.id = vt.reward_id
+		WHERE vt.user_id = @p1 AND vt.status = @p2
+		ORDER BY vt.vest_date
+	`, userID, models.TrancheStatusScheduled)
+	if err != nil {
+		return 0, fmt.Errorf("error querying unvested tranches: %w", err)
+	}
+
+	var tranches []models.VestingTranche
+	var references []string
+	for rows.Next() {
+		var t models.VestingTranche
+		var referenceID string
+		if err := rows.Scan(&t.ID, &t.RewardID, &t.UserID, &t.StockSymbol, &t.VestDate, &t.Quantity, &t.CostPrice, &referenceID); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("error scanning unvested tranche: %w", err)
+		}
+		tranches = append(tranches, t)
+		references = append(references, referenceID)
+	}
+	rows.Close()
+
+	for i, t := range tranches {
+		ok, err := endTranche(ctx, t, references[i], models.TrancheStatusForfeited, reason)
+		if err != nil {
+			return forfeited, err
+		}
+		if ok {
+			forfeited++
+		}
+	}
+
+	if forfeited > 0 {
+		logrus.WithContext(ctx).WithFields(logrus.Fields{
+			"user_id": userID,
+			"count":   forfeited,
+			"reason":  reason,
+		}).Info("Forfeited unvested tranches")
+		PortfolioEvents().PublishUser(userID)
+	}
+
+	return forfeited, nil
+}
+
+// forfeitDeparted forfeits the unvested tranches of deleted users
+func (s *VestingService) forfeitDeparted(ctx context.Context) error {
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT DISTINCT vt.user_id
+		FROM vesting_tranches vt
+		JOIN users u ON u.id = vt.user_id
+		WHERE vt.status = @p1 AND u.deleted_at IS NOT NULL
+	`, models.TrancheStatusScheduled)
+	if err != nil {
+		return fmt.Errorf("error querying departed users: %w", err)
+	}
+
+	var departed []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning departed user: %w", err)
+		}
+		departed = append(departed, id)
+	}
+	rows.Close()
+
+	for _, userID := range departed {
+		if _, err := s.ForfeitUnvested(ctx, userID, "user left before vesting"); err != nil {
+			logrus.WithContext(ctx).WithError(err).WithField("user_id", userID).Error("Error forfeiting unvested tranches")
+		}
+	}
+	return nil
+}
+
+// endTranche vests or forfeits a scheduled tranche and posts the ledger
+// entries that move its cost out of unvested stock. It reports false if the
+// tranche was no longer scheduled.
+func endTranche(ctx context.Context, t models.VestingTranche, referenceID, status, reason string) (ok bool, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "endTranche",
+		attribute.String("tranche_id", t.ID.String()),
+		attribute.String("status", status),
+	)
+	defer telemetry.EndSpan(span, &err)
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Guard on the status so a tranche vests or is forfeited only once
+	timeColumn := "vested_at"
+	if status == models.TrancheStatusForfeited {
+		timeColumn = "forfeited_at"
+	}
+	result, err := tx.ExecContext(ctx, `
+		UPDATE vesting_tranches SET status = @p1, `+timeColumn+` = GETUTCDATE()
+		WHERE id = @p2 AND status = @p3
+	`, status, t.ID, models.TrancheStatusScheduled)
+	if err != nil {
+		return false, fmt.Errorf("error updating vesting tranche: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return false, nil
+	}
+
+	// Vested shares become the user's stock; forfeited ones go back to the company
+	account, description, action := "stock_inventory", "Vested", models.AuditTrancheVest
+	holdingUpdate := `unvested_quantity = unvested_quantity - @p1`
+	if status == models.TrancheStatusForfeited {
+		account, description, action = "forfeited_stock", "Forfeited", models.AuditTrancheForfeit
+		holdingUpdate = `unvested_quantity = unvested_quantity - @p1, quantity = quantity - @p1,
+			settled_quantity = CASE WHEN settled_quantity > quantity - @p1 THEN quantity - @p1 ELSE settled_quantity END`
+	}
+
+	value := roundTo(t.Quantity*t.CostPrice, amountPlaces)
+	transactionID := uuid.New()
+	entries := []struct {
+		account       string
+		debit, credit float64
+	}{
+		{account, value, 0},
+		{"unvested_stock", 0, value},
+	}
+	for _, e := range entries {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO ledger_entries (transaction_id, user_id, account_type, account_symbol, debit_amount, credit_amount, stock_quantity, description, reference_id)
+			VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8, @p9)
+		`, transactionID, t.UserID, e.account, t.StockSymbol, e.debit, e.credit, t.Quantity,
+			fmt.Sprintf("%s reward tranche: %s x %.6f", description, t.StockSymbol, t.Quantity), referenceID)
+		if err != nil {
+			return false, fmt.Errorf("error creating vesting ledger entry: %w", err)
+		}
+	}
+
+	var before, after float64
+	err = tx.QueryRowContext(ctx, `
+		UPDATE user_holdings SET `+holdingUpdate+`, updated_at = GETUTCDATE(), last_updated = GETUTCDATE()
+		OUTPUT deleted.quantity, inserted.quantity
+		WHERE user_id = @p2 AND stock_symbol = @p3
+	`, t.Quantity, t.UserID, t.StockSymbol).Scan(&before, &after)
+	if err != nil {
+		return false, fmt.Errorf("error updating holding for tranche: %w", err)
+	}
+
+	err = recordAudit(ctx, tx, action, models.AuditEntityTranche, t.ID.String(),
+		map[string]interface{}{"status": models.TrancheStatusScheduled},
+		map[string]interface{}{
+			"status":         status,
+			"reward_id":      t.RewardID,
+			"quantity":       t.Quantity,
+			"vest_date":      t.VestDate.Format("2006-01-02"),
+			"reason":         reason,
+			"transaction_id": transactionID,
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+	// Vested shares are acquired on the vest date, at the fair market value
+	// they are taxed at as a perquisite on that date
+	if status == models.TrancheStatusVested {
+		cost, err := perquisiteFMV(ctx, tx, t.RewardID, t.StockSymbol, t.VestDate, t.CostPrice)
+		if err != nil {
+			return false, err
+		}
+		_, err = tx.ExecContext(ctx,
+			"UPDATE vesting_tranches SET fair_market_value = @p1 WHERE id = @p2", cost, t.ID,
+		)
+		if err != nil {
+			return false, fmt.Errorf("error recording tranche fair market value: %w", err)
+		}
+		err = createLot(ctx, tx, models.TaxLot{
+			UserID:       t.UserID,
+			StockSymbol:  t.StockSymbol,
+			Source:       models.LotSourceTranche,
+			SourceID:     t.ID,
+			AcquiredOn:   t.VestDate,
+			Quantity:     t.Quantity,
+			CostPerShare: cost,
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+	if status == models.TrancheStatusForfeited {
+		err = recordAudit(ctx, tx, models.AuditHoldingForfeit, models.AuditEntityHolding, holdingEntityID(t.UserID, t.StockSymbol),
+			map[string]interface{}{"quantity": before},
+			map[string]interface{}{"quantity": after, "tranche_id": t.ID},
+		)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return true, nil
+}
+
+// vestingColumnList selects a reward's vesting schedule, scanned into vestingColumns
+const vestingColumnList = "vesting_cliff_months, vesting_duration_months, vesting_interval_months, lock_in_until"
+
+// vestingColumns holds the nullable vesting columns of a reward_events row
+type vestingColumns struct {
+	cliff, duration, interval sql.NullInt32
+	lockIn                    sql.NullTime
+}
+
+// schedule returns the reward's vesting schedule, or nil if it has none
+func (c vestingColumns) schedule() *models.VestingSchedule {
+	if !c.duration.Valid {
+		return nil
+	}
+	v := &models.VestingSchedule{
+		CliffMonths:    int(c.cliff.Int32),
+		DurationMonths: int(c.duration.Int32),
+		IntervalMonths: int(c.interval.Int32),
+	}
+	if c.lockIn.Valid {
+		v.LockInUntil = &c.lockIn.Time
+	}
+	return v
+}
+
+// lockedInQuantities returns, per symbol, a user's vested shares still under
+// a reward's lock-in
+func lockedInQuantities(ctx context.Context, userID uuid.UUID) (map[string]float64, error) {
+	today := calendarDate(startOfDayIST(time.Now()))
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT vt.stock_symbol, SUM(vt.quantity)
+		FROM vesting_tranches vt
+		JOIN reward_events re ON re.id = vt.reward_id
+		WHERE vt.user_id = @p1 AND vt.status = @p2 AND re.lock_in_until > @p3
+		GROUP BY vt.stock_symbol
+	`, userID, models.TrancheStatusVested, today)
+	if err != nil {
+		return nil, fmt.Errorf("error querying locked-in shares: %w", err)
+	}
+	defer rows.Close()
+
+	locked := make(map[string]float64)
+	for rows.Next() {
+		var symbol string
+		var quantity float64
+		if err := rows.Scan(&symbol, &quantity); err != nil {
+			return nil, fmt.Errorf("error scanning locked-in shares: %w", err)
+		}
+		locked[symbol] = quantity
+	}
+	return locked, rows.Err()
+}
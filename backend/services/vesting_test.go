@@ -0,0 +1,133 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"backend/models"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestAddMonths(t *testing.T) {
+	tests := []struct {
+		name   string
+		date   time.Time
+		months int
+		want   time.Time
+	}{
+		{"Jan 31 to leap February", date(2024, time.January, 31), 1, date(2024, time.February, 29)},
+		{"Jan 31 to February", date(2023, time.January, 31), 1, date(2023, time.February, 28)},
+		{"Jan 31 to March keeps the day", date(2024, time.January, 31), 2, date(2024, time.March, 31)},
+		{"Aug 31 to September", date(2024, time.August, 31), 1, date(2024, time.September, 30)},
+		{"across the year end", date(2024, time.December, 15), 1, date(2025, time.January, 15)},
+		{"Feb 29 plus a year", date(2024, time.February, 29), 12, date(2025, time.February, 28)},
+		{"backwards", date(2024, time.March, 31), -1, date(2024, time.February, 29)},
+		{"zero months", date(2024, time.May, 17), 0, date(2024, time.May, 17)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := addMonths(tt.date, tt.months); !got.Equal(tt.want) {
+				t.Errorf("addMonths(%s, %d) = %s, want %s", tt.date.Format("2006-01-02"), tt.months, got.Format("2006-01-02"), tt.want.Format("2006-01-02"))
+			}
+		})
+	}
+}
+
+func TestVestingTranches(t *testing.T) {
+	// 01:30 on 31 January in IST, still 30 January in UTC
+	start := time.Date(2024, time.January, 30, 20, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		schedule models.VestingSchedule
+		quantity float64
+		want     []trancheSplit
+	}{
+		{
+			name:     "no vesting",
+			schedule: models.VestingSchedule{},
+			quantity: 2.5,
+			want:     []trancheSplit{{date(2024, time.January, 31), 2.5}},
+		},
+		{
+			name:     "monthly from Jan 31 clamps to month ends",
+			schedule: models.VestingSchedule{DurationMonths: 3, IntervalMonths: 1},
+			quantity: 1,
+			want: []trancheSplit{
+				{date(2024, time.February, 29), 0.333333},
+				{date(2024, time.March, 31), 0.333333},
+				{date(2024, time.April, 30), 0.333334},
+			},
+		},
+		{
+			name:     "tranches before the cliff vest on it together",
+			schedule: models.VestingSchedule{CliffMonths: 12, DurationMonths: 24, IntervalMonths: 6},
+			quantity: 100,
+			want: []trancheSplit{
+				{date(2025, time.January, 31), 50},
+				{date(2025, time.July, 31), 25},
+				{date(2026, time.January, 31), 25},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := vestingTranches(&tt.schedule, start, tt.quantity)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d tranches %+v, want %d", len(got), got, len(tt.want))
+			}
+			var total float64
+			for i := range got {
+				if !got[i].vestDate.Equal(tt.want[i].vestDate) || got[i].quantity != tt.want[i].quantity {
+					t.Errorf("tranche %d = %s %v, want %s %v", i,
+						got[i].vestDate.Format("2006-01-02"), got[i].quantity,
+						tt.want[i].vestDate.Format("2006-01-02"), tt.want[i].quantity)
+				}
+				total += got[i].quantity
+			}
+			if roundTo(total, quantityPlaces) != tt.quantity {
+				t.Errorf("tranches sum to %v, want %v", total, tt.quantity)
+			}
+		})
+	}
+}
+
+func TestValidateVesting(t *testing.T) {
+	lockIn := date(2025, time.June, 30)
+
+	tests := []struct {
+		name     string
+		schedule models.VestingSchedule
+		wantErr  bool
+	}{
+		{"tranches", models.VestingSchedule{DurationMonths: 12, IntervalMonths: 3}, false},
+		{"tranches with a cliff", models.VestingSchedule{DurationMonths: 48, IntervalMonths: 1, CliffMonths: 12}, false},
+		{"cliff vesting everything at the end", models.VestingSchedule{DurationMonths: 12, IntervalMonths: 12, CliffMonths: 12}, false},
+		{"lock-in only", models.VestingSchedule{LockInUntil: &lockIn}, false},
+		{"tranches and a lock-in", models.VestingSchedule{DurationMonths: 12, IntervalMonths: 6, LockInUntil: &lockIn}, false},
+		{"empty", models.VestingSchedule{}, true},
+		{"cliff without a duration", models.VestingSchedule{CliffMonths: 6, LockInUntil: &lockIn}, true},
+		{"interval without a duration", models.VestingSchedule{IntervalMonths: 3, LockInUntil: &lockIn}, true},
+		{"duration without an interval", models.VestingSchedule{DurationMonths: 12}, true},
+		{"interval not dividing the duration", models.VestingSchedule{DurationMonths: 12, IntervalMonths: 5}, true},
+		{"cliff past the duration", models.VestingSchedule{DurationMonths: 12, IntervalMonths: 3, CliffMonths: 13}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateVesting(&tt.schedule)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateVesting() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidRequest) {
+				t.Errorf("validateVesting() error = %v, want ErrInvalidRequest", err)
+			}
+		})
+	}
+}
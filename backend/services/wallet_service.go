@@ -0,0 +1,457 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"backend/auth"
+	"backend/database"
+	"backend/models"
+	"backend/telemetry"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// payoutPlaces is the precision of payouts; banks transfer whole paise
+	payoutPlaces = 2
+
+	defaultWalletHistoryLimit = 50
+	maxWalletHistoryLimit     = 500
+)
+
+// WalletService keeps users' INR wallets and pays them out to bank accounts
+type WalletService struct {
+	bank Bank
+}
+
+func NewWalletService() *WalletService {
+	return &WalletService{bank: defaultBank}
+}
+
+// GetWallet returns a user's balance, the amount in payouts not yet settled,
+// and the wallet's postings newest first, limit at a time from offset
+func (s *WalletService) GetWallet(ctx context.Context, userID uuid.UUID, limit, offset int) (wallet *models.Wallet, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "WalletService.GetWallet")
+	defer telemetry.EndSpan(span, &err)
+
+	if limit <= 0 {
+		limit = defaultWalletHistoryLimit
+	}
+	if limit > maxWalletHistoryLimit {
+		return nil, fmt.Errorf("%w: limit must be at most %d", ErrInvalidRequest, maxWalletHistoryLimit)
+	}
+	if offset < 0 {
+		return nil, fmt.Errorf("%w: offset must not be negative", ErrInvalidRequest)
+	}
+
+	var userExists bool
+	wallet = &models.Wallet{UserID: userID, Transactions: []models.WalletTransaction{}}
+	err = database.DB.QueryRowContext(ctx, `
+		SELECT
+			CASE WHEN EXISTS(SELECT 1 FROM users WHERE id = @p1) THEN 1 ELSE 0 END,
+			ISNULL((SELECT SUM(credit_amount - debit_amount) FROM ledger_entries WHERE user_id = @p1 AND account_type = @p2), 0),
+			ISNULL((SELECT SUM(amount) FROM payouts WHERE user_id = @p1 AND status = @p3), 0)
+	`, userID, "user_wallet", models.PayoutStatusPending).Scan(&userExists, &wallet.Balance, &wallet.PendingPayouts)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching wallet balance: %w", err)
+	}
+	if !userExists {
+		return nil, ErrUserNotFound
+	}
+	wallet.Balance = roundTo(wallet.Balance, amountPlaces)
+
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT transaction_id, credit_amount - debit_amount, description, reference_id, created_at
+		FROM ledger_entries
+		WHERE user_id = @p1 AND account_type = @p2
+		ORDER BY created_at DESC, id
+		OFFSET @p3 ROWS FETCH NEXT @p4 ROWS ONLY
+	`, userID, "user_wallet", offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying wallet transactions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t models.WalletTransaction
+		var description, referenceID sql.NullString
+		if err := rows.Scan(&t.TransactionID, &t.Amount, &description, &referenceID, &t.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning wallet transaction: %w", err)
+		}
+		t.Description = description.String
+		t.ReferenceID = referenceID.String
+		wallet.Transactions = append(wallet.Transactions, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading wallet transactions: %w", err)
+	}
+
+	return wallet, nil
+}
+
+// RequestPayout takes an amount out of a user's wallet and sends it to one of
+// their verified bank accounts. The amount moves to pending payouts in the ledger until the
+// bank settles the transfer, or comes back to the wallet if the bank refuses it.
+func (s *WalletService) RequestPayout(ctx context.Context, req models.PayoutRequest) (payout *models.Payout, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "WalletService.RequestPayout", attribute.String("bank", s.bank.Name()))
+	defer telemetry.EndSpan(span, &err)
+
+	userID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid user_id: %v", ErrInvalidRequest, err)
+	}
+	accountID, err := uuid.Parse(req.BankAccountID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid bank_account_id: %v", ErrInvalidRequest, err)
+	}
+	if roundTo(req.Amount, payoutPlaces) != req.Amount {
+		return nil, fmt.Errorf("%w: amount has more than %d decimal places", ErrInvalidRequest, payoutPlaces)
+	}
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the user so concurrent payouts can't both spend the same balance
+	var lockedID uuid.UUID
+	err = tx.QueryRowContext(ctx,
+		"SELECT id FROM users WITH (UPDLOCK, ROWLOCK) WHERE id = @p1 AND deleted_at IS NULL", userID,
+	).Scan(&lockedID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error locking user: %w", err)
+	}
+
+	// Money only goes to an account the user owns and that has been checked
+	// with the bank
+	account, err := getBankAccount(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if account.UserID != userID {
+		return nil, ErrBankAccountNotFound
+	}
+	if account.VerificationStatus != models.BankAccountStatusVerified {
+		return nil, ErrBankAccountNotVerified
+	}
+
+	var balance float64
+	err = tx.QueryRowContext(ctx, `
+		SELECT ISNULL(SUM(credit_amount - debit_amount), 0) FROM ledger_entries
+		WHERE user_id = @p1 AND account_type = @p2
+	`, userID, "user_wallet").Scan(&balance)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching wallet balance: %w", err)
+	}
+	if balance = roundTo(balance, amountPlaces); req.Amount > balance {
+		return nil, fmt.Errorf("%w: %.2f requested, %.4f available", ErrInsufficientBalance, req.Amount, balance)
+	}
+
+	payoutID := uuid.New()
+	createdBy := auth.ActorFrom(ctx).ID
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO payouts (id, user_id, amount, bank_account_id, account_number, ifsc, status, bank, created_by)
+		VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8, @p9)
+	`, payoutID, userID, req.Amount, account.ID, account.AccountNumber, account.IFSC, models.PayoutStatusPending, s.bank.Name(), createdBy)
+	if err != nil {
+		return nil, fmt.Errorf("error creating payout: %w", err)
+	}
+
+	transactionID, err := postPayout(ctx, tx, payoutID, userID, req.Amount,
+		"user_wallet", "payouts_pending", "Payout to bank account")
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordAudit(ctx, tx, models.AuditPayoutRequest, models.AuditEntityPayout, payoutID.String(), nil, map[string]interface{}{
+		"user_id":         userID,
+		"amount":          req.Amount,
+		"bank_account_id": account.ID,
+		"ifsc":            account.IFSC,
+		"status":          models.PayoutStatusPending,
+		"balance_before":  balance,
+		"transaction_id":  transactionID,
+		"created_by":      createdBy,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"user_id":   userID,
+		"payout_id": payoutID,
+		"amount":    req.Amount,
+	}).Info("Payout requested")
+
+	// Send it to the bank straight away; ProcessPayouts retries if this fails
+	if err := s.advancePayout(ctx, payoutID); err != nil {
+		logrus.WithContext(ctx).WithError(err).WithField("payout_id", payoutID).Warn("Payout not sent to the bank, will retry")
+	}
+
+	return getPayout(ctx, payoutID)
+}
+
+// ListPayouts returns a user's payouts, newest first
+func (s *WalletService) ListPayouts(ctx context.Context, userID uuid.UUID) (payouts []models.Payout, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "WalletService.ListPayouts")
+	defer telemetry.EndSpan(span, &err)
+
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT `+payoutColumnList+`
+		FROM payouts
+		WHERE user_id = @p1
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying payouts: %w", err)
+	}
+	defer rows.Close()
+
+	payouts = []models.Payout{}
+	for rows.Next() {
+		p, err := scanPayout(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning payout: %w", err)
+		}
+		payouts = append(payouts, *p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading payouts: %w", err)
+	}
+
+	return payouts, nil
+}
+
+// ProcessPayouts moves pending payouts towards settlement: payouts not yet
+// sent are sent to the bank and sent ones are checked. It returns the number
+// of payouts that settled or failed.
+func (s *WalletService) ProcessPayouts(ctx context.Context) (finished int, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "WalletService.ProcessPayouts")
+	defer telemetry.EndSpan(span, &err)
+
+	rows, err := database.DB.QueryContext(ctx,
+		"SELECT id FROM payouts WHERE status = @p1 ORDER BY created_at", models.PayoutStatusPending,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error querying pending payouts: %w", err)
+	}
+
+	var pending []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("error scanning pending payout: %w", err)
+		}
+		pending = append(pending, id)
+	}
+	rows.Close()
+
+	for _, payoutID := range pending {
+		if err := s.advancePayout(ctx, payoutID); err != nil {
+			logrus.WithContext(ctx).WithError(err).WithField("payout_id", payoutID).Error("Error advancing payout")
+			continue
+		}
+		payout, err := getPayout(ctx, payoutID)
+		if err == nil && payout.Status != models.PayoutStatusPending {
+			finished++
+		}
+	}
+
+	if finished > 0 {
+		logrus.WithContext(ctx).WithField("count", finished).Info("Finished pending payouts")
+	}
+
+	return finished, nil
+}
+
+// unknownPayoutTimeout is how long a sent payout the bank has no record of is
+// retried before it is failed
+const unknownPayoutTimeout = 24 * time.Hour
+
+// advancePayout sends a pending payout to the bank, or checks on it if it was
+// already sent, and finishes it once the bank's answer is final
+func (s *WalletService) advancePayout(ctx context.Context, payoutID uuid.UUID) (err error) {
+	ctx, span := telemetry.StartSpan(ctx, "WalletService.advancePayout",
+		attribute.String("payout_id", payoutID.String()),
+		attribute.String("bank", s.bank.Name()),
+	)
+	defer telemetry.EndSpan(span, &err)
+
+	payout, err := getPayout(ctx, payoutID)
+	if err != nil {
+		return err
+	}
+	if payout.Status != models.PayoutStatusPending {
+		return nil
+	}
+
+	var state TransferState
+	if payout.BankReference == nil {
+		// The payout ID is the client reference, so a retry after a lost
+		// response finds the transfer already sent instead of paying twice
+		state, err = s.bank.Transfer(ctx, TransferRequest{
+			ClientReference: payout.ID.String(),
+			AccountNumber:   payout.AccountNumber,
+			IFSC:            payout.IFSC,
+			Amount:          payout.Amount,
+		})
+		if err != nil {
+			return fmt.Errorf("error sending payout to %s: %w", s.bank.Name(), err)
+		}
+		_, err = database.DB.ExecContext(ctx, `
+			UPDATE payouts SET bank_reference = @p1, sent_at = GETUTCDATE(), updated_at = GETUTCDATE()
+			WHERE id = @p2
+		`, state.BankReference, payout.ID)
+		if err != nil {
+			return fmt.Errorf("error recording sent payout: %w", err)
+		}
+	} else {
+		state, err = s.bank.QueryTransfer(ctx, *payout.BankReference)
+		if errors.Is(err, ErrUnknownTransfer) && payout.SentAt != nil && time.Since(*payout.SentAt) > unknownPayoutTimeout {
+			// The bank never took the transfer, so the money goes back to the wallet
+			state = TransferState{
+				BankReference: *payout.BankReference,
+				Status:        models.PayoutStatusFailed,
+				Reason:        "bank has no record of the transfer",
+			}
+		} else if err != nil {
+			return fmt.Errorf("error querying payout with %s: %w", s.bank.Name(), err)
+		}
+	}
+
+	if !state.Final() {
+		return nil
+	}
+	return finishPayout(ctx, payout, state)
+}
+
+// finishPayout records the bank's final answer on a pending payout. A settled
+// payout's amount leaves the company's cash; a failed one goes back to the
+// user's wallet.
+func finishPayout(ctx context.Context, payout *models.Payout, state TransferState) error {
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	action, stampColumn := models.AuditPayoutSettle, "settled_at"
+	if state.Status == models.PayoutStatusFailed {
+		action, stampColumn = models.AuditPayoutFail, "failed_at"
+	}
+
+	// Guard on the status so a payout is finished only once
+	result, err := tx.ExecContext(ctx, `
+		UPDATE payouts
+		SET status = @p1, failure_reason = @p2, `+stampColumn+` = GETUTCDATE(), updated_at = GETUTCDATE()
+		WHERE id = @p3 AND status = @p4
+	`, state.Status, nullString(state.Reason), payout.ID, models.PayoutStatusPending)
+	if err != nil {
+		return fmt.Errorf("error updating payout: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return nil
+	}
+
+	var transactionID uuid.UUID
+	if state.Status == models.PayoutStatusSettled {
+		transactionID, err = postPayout(ctx, tx, payout.ID, payout.UserID, payout.Amount,
+			"payouts_pending", "cash", "Payout settled by bank")
+	} else {
+		transactionID, err = postPayout(ctx, tx, payout.ID, payout.UserID, payout.Amount,
+			"payouts_pending", "user_wallet", "Payout returned: "+state.Reason)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = recordAudit(ctx, tx, action, models.AuditEntityPayout, payout.ID.String(),
+		map[string]interface{}{"status": models.PayoutStatusPending},
+		map[string]interface{}{
+			"status":         state.Status,
+			"bank_reference": state.BankReference,
+			"reason":         state.Reason,
+			"transaction_id": transactionID,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"payout_id": payout.ID,
+		"status":    state.Status,
+	}).Info("Payout finished")
+
+	return nil
+}
+
+// postPayout writes a balanced pair of ledger entries moving a payout's amount
+// from one account to another and returns their transaction ID
+func postPayout(ctx context.Context, tx *sql.Tx, payoutID, userID uuid.UUID, amount float64, debitAccount, creditAccount, description string) (uuid.UUID, error) {
+	transactionID := uuid.New()
+	entries := []struct {
+		account       string
+		debit, credit float64
+	}{
+		{debitAccount, amount, 0},
+		{creditAccount, 0, amount},
+	}
+	for _, e := range entries {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO ledger_entries (transaction_id, user_id, account_type, account_symbol, debit_amount, credit_amount, stock_quantity, description, reference_id)
+			VALUES (@p1, @p2, @p3, '', @p4, @p5, 0, @p6, @p7)
+		`, transactionID, userID, e.account, e.debit, e.credit, description, payoutID.String())
+		if err != nil {
+			return uuid.Nil, fmt.Errorf("error creating payout ledger entry: %w", err)
+		}
+	}
+	return transactionID, nil
+}
+
+// payoutColumnList selects a payouts row for scanPayout
+const payoutColumnList = `id, user_id, amount, bank_account_id, account_number, ifsc, status, bank, bank_reference, failure_reason,
+	sent_at, settled_at, failed_at, created_by, created_at, updated_at`
+
+// scanPayout reads a row selected with payoutColumnList and masks its account
+// number
+func scanPayout(row interface{ Scan(...interface{}) error }) (*models.Payout, error) {
+	var p models.Payout
+	err := row.Scan(&p.ID, &p.UserID, &p.Amount, &p.BankAccountID, &p.AccountNumber, &p.IFSC, &p.Status, &p.Bank,
+		&p.BankReference, &p.FailureReason, &p.SentAt, &p.SettledAt, &p.FailedAt, &p.CreatedBy, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	p.MaskedAccountNumber = models.MaskAccountNumber(p.AccountNumber)
+	return &p, nil
+}
+
+// getPayout loads a payout by ID
+func getPayout(ctx context.Context, payoutID uuid.UUID) (*models.Payout, error) {
+	p, err := scanPayout(database.DB.QueryRowContext(ctx,
+		"SELECT "+payoutColumnList+" FROM payouts WHERE id = @p1", payoutID,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching payout: %w", err)
+	}
+	return p, nil
+}
@@ -0,0 +1,475 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+
+	"backend/auth"
+	"backend/database"
+	"backend/models"
+	"backend/telemetry"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// WithdrawalService transfers shares out of users' holdings to their own
+// demat accounts. A withdrawal leaves the holding when it is requested, is
+// submitted to the depository in an instruction file, and then completes or
+// fails; a failed withdrawal puts the shares back.
+type WithdrawalService struct{}
+
+func NewWithdrawalService() *WithdrawalService {
+	return &WithdrawalService{}
+}
+
+// RequestWithdrawal takes shares out of a holding for transfer to one of the
+// user's verified demat accounts. Only whole shares that have settled, vested
+// and passed any lock-in can be withdrawn; without a quantity all of them are.
+func (s *WithdrawalService) RequestWithdrawal(ctx context.Context, req models.WithdrawalRequest) (withdrawal *models.Withdrawal, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "WithdrawalService.RequestWithdrawal", attribute.String("stock_symbol", req.StockSymbol))
+	defer telemetry.EndSpan(span, &err)
+
+	userID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid user_id: %v", ErrInvalidRequest, err)
+	}
+	accountID, err := uuid.Parse(req.DematAccountID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid demat_account_id: %v", ErrInvalidRequest, err)
+	}
+	// Demat accounts hold whole shares only
+	if req.Quantity != nil && *req.Quantity != math.Trunc(*req.Quantity) {
+		return nil, fmt.Errorf("%w: quantity must be a whole number of shares", ErrInvalidRequest)
+	}
+
+	var userExists bool
+	err = database.DB.QueryRowContext(ctx,
+		"SELECT CASE WHEN EXISTS(SELECT 1 FROM users WHERE id = @p1 AND deleted_at IS NULL) THEN 1 ELSE 0 END",
+		userID,
+	).Scan(&userExists)
+	if err != nil {
+		return nil, fmt.Errorf("error checking user existence: %w", err)
+	}
+	if !userExists {
+		return nil, ErrUserNotFound
+	}
+
+	account, err := getDematAccount(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if account.UserID != userID {
+		return nil, ErrDematAccountNotFound
+	}
+	if account.VerificationStatus != models.DematStatusVerified {
+		return nil, ErrDematAccountNotVerified
+	}
+
+	lockedIn, err := lockedInQuantities(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the holding so concurrent withdrawals can't both take the same shares
+	h, err := lockHolding(ctx, tx, userID, req.StockSymbol)
+	if err != nil {
+		return nil, err
+	}
+
+	withdrawable := math.Floor(h.free(lockedIn[req.StockSymbol]))
+	quantity := withdrawable
+	if req.Quantity != nil {
+		quantity = *req.Quantity
+	}
+	if quantity <= 0 || quantity > withdrawable {
+		return nil, fmt.Errorf("%w: %v %s requested, %v withdrawable", ErrInsufficientShares, quantity, req.StockSymbol, withdrawable)
+	}
+
+	costValue, err := h.inventoryCost(ctx, tx, quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	withdrawalID := uuid.New()
+	createdBy := auth.ActorFrom(ctx).ID
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO withdrawals (id, user_id, demat_account_id, stock_symbol, quantity, cost_value, status, created_by)
+		VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8)
+	`, withdrawalID, userID, accountID, req.StockSymbol, quantity, costValue, models.WithdrawalStatusRequested, createdBy)
+	if err != nil {
+		return nil, fmt.Errorf("error creating withdrawal: %w", err)
+	}
+
+	w := models.Withdrawal{ID: withdrawalID, UserID: userID, StockSymbol: req.StockSymbol, Quantity: quantity, CostValue: costValue}
+	transactionID, err := postWithdrawal(ctx, tx, w, "stock_in_transit", "stock_inventory", "Withdrawal to demat")
+	if err != nil {
+		return nil, err
+	}
+
+	before, after, err := h.take(ctx, tx, quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := consumeLots(ctx, tx, userID, req.StockSymbol, quantity, models.DisposalWithdrawal, withdrawalID, nil); err != nil {
+		return nil, err
+	}
+
+	err = recordAudit(ctx, tx, models.AuditHoldingWithdraw, models.AuditEntityHolding, holdingEntityID(userID, req.StockSymbol),
+		map[string]interface{}{"quantity": before},
+		map[string]interface{}{"quantity": after, "withdrawal_id": withdrawalID, "transaction_id": transactionID},
+	)
+	if err != nil {
+		return nil, err
+	}
+	err = recordAudit(ctx, tx, models.AuditWithdrawalRequest, models.AuditEntityWithdrawal, withdrawalID.String(), nil, map[string]interface{}{
+		"user_id":          userID,
+		"demat_account_id": accountID,
+		"stock_symbol":     req.StockSymbol,
+		"quantity":         quantity,
+		"cost_value":       costValue,
+		"status":           models.WithdrawalStatusRequested,
+		"created_by":       createdBy,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"user_id":       userID,
+		"withdrawal_id": withdrawalID,
+		"stock_symbol":  req.StockSymbol,
+		"quantity":      quantity,
+	}).Info("Withdrawal requested")
+
+	PortfolioEvents().PublishUser(userID)
+
+	return getWithdrawal(ctx, withdrawalID)
+}
+
+// ListWithdrawals returns a user's withdrawals, newest first
+func (s *WithdrawalService) ListWithdrawals(ctx context.Context, userID uuid.UUID) (withdrawals []models.Withdrawal, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "WithdrawalService.ListWithdrawals")
+	defer telemetry.EndSpan(span, &err)
+
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT `+withdrawalColumnList+`
+		FROM withdrawals w
+		WHERE w.user_id = @p1
+		ORDER BY w.created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying withdrawals: %w", err)
+	}
+	defer rows.Close()
+
+	withdrawals = []models.Withdrawal{}
+	for rows.Next() {
+		var w models.Withdrawal
+		if err := rows.Scan(withdrawalFields(&w)...); err != nil {
+			return nil, fmt.Errorf("error scanning withdrawal: %w", err)
+		}
+		withdrawals = append(withdrawals, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading withdrawals: %w", err)
+	}
+
+	return withdrawals, nil
+}
+
+// SubmitWithdrawals puts every requested withdrawal into a new batch, marks
+// them submitted and returns the batch's instruction file for the depository.
+// The file is nil when nothing was waiting.
+func (s *WithdrawalService) SubmitWithdrawals(ctx context.Context) (file *InstructionFile, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "WithdrawalService.SubmitWithdrawals")
+	defer telemetry.EndSpan(span, &err)
+
+	if !CurrentDepositoryOptions().configured() {
+		return nil, errors.New("depository pool account is not configured")
+	}
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	batchID := uuid.New()
+	rows, err := tx.QueryContext(ctx, `
+		UPDATE withdrawals
+		SET status = @p1, batch_id = @p2, submitted_at = GETUTCDATE(), updated_at = GETUTCDATE()
+		OUTPUT inserted.id
+		WHERE status = @p3
+	`, models.WithdrawalStatusSubmitted, batchID, models.WithdrawalStatusRequested)
+	if err != nil {
+		return nil, fmt.Errorf("error submitting withdrawals: %w", err)
+	}
+	var submitted []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning submitted withdrawal: %w", err)
+		}
+		submitted = append(submitted, id)
+	}
+	rows.Close()
+	if len(submitted) == 0 {
+		return nil, nil
+	}
+
+	for _, id := range submitted {
+		err = recordAudit(ctx, tx, models.AuditWithdrawalSubmit, models.AuditEntityWithdrawal, id.String(),
+			map[string]interface{}{"status": models.WithdrawalStatusRequested},
+			map[string]interface{}{"status": models.WithdrawalStatusSubmitted, "batch_id": batchID},
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"batch_id": batchID,
+		"count":    len(submitted),
+	}).Info("Withdrawals submitted to depository")
+
+	return s.InstructionFile(ctx, batchID)
+}
+
+// InstructionFile rebuilds the instruction file of a submitted batch
+func (s *WithdrawalService) InstructionFile(ctx context.Context, batchID uuid.UUID) (file *InstructionFile, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "WithdrawalService.InstructionFile", attribute.String("batch_id", batchID.String()))
+	defer telemetry.EndSpan(span, &err)
+
+	pool := CurrentDepositoryOptions()
+	if !pool.configured() {
+		return nil, errors.New("depository pool account is not configured")
+	}
+
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT `+withdrawalColumnList+`, d.depository, d.dp_id, d.client_id
+		FROM withdrawals w
+		JOIN demat_accounts d ON d.id = w.demat_account_id
+		WHERE w.batch_id = @p1
+		ORDER BY w.created_at, w.id
+	`, batchID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying withdrawal batch: %w", err)
+	}
+	defer rows.Close()
+
+	var lines []instructionLine
+	for rows.Next() {
+		var line instructionLine
+		fields := append(withdrawalFields(&line.withdrawal), &line.account.Depository, &line.account.DPID, &line.account.ClientID)
+		if err := rows.Scan(fields...); err != nil {
+			return nil, fmt.Errorf("error scanning withdrawal batch: %w", err)
+		}
+		lines = append(lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading withdrawal batch: %w", err)
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("%w: no withdrawals in batch %s", ErrWithdrawalNotFound, batchID)
+	}
+
+	// Instructions execute on the trading day the batch was submitted for
+	executionDate := CurrentMarketCalendar().TradeDate(*lines[0].withdrawal.SubmittedAt)
+	return buildInstructionFile(batchID, executionDate, pool, lines)
+}
+
+// CompleteWithdrawal records that the depository executed a submitted
+// withdrawal and the shares are in the user's demat account
+func (s *WithdrawalService) CompleteWithdrawal(ctx context.Context, withdrawalID uuid.UUID) (withdrawal *models.Withdrawal, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "WithdrawalService.CompleteWithdrawal")
+	defer telemetry.EndSpan(span, &err)
+
+	return s.finish(ctx, withdrawalID, models.WithdrawalStatusCompleted, "")
+}
+
+// FailWithdrawal records that the depository refused a submitted withdrawal
+// and puts its shares back in the user's holding
+func (s *WithdrawalService) FailWithdrawal(ctx context.Context, withdrawalID uuid.UUID, reason string) (withdrawal *models.Withdrawal, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "WithdrawalService.FailWithdrawal")
+	defer telemetry.EndSpan(span, &err)
+
+	return s.finish(ctx, withdrawalID, models.WithdrawalStatusFailed, reason)
+}
+
+func (s *WithdrawalService) finish(ctx context.Context, withdrawalID uuid.UUID, status, reason string) (*models.Withdrawal, error) {
+	w, err := getWithdrawal(ctx, withdrawalID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Guard on the status so a withdrawal completes or fails only once
+	timeColumn := "completed_at"
+	if status == models.WithdrawalStatusFailed {
+		timeColumn = "failed_at"
+	}
+	result, err := tx.ExecContext(ctx, `
+		UPDATE withdrawals SET status = @p1, failure_reason = @p2, `+timeColumn+` = GETUTCDATE(), updated_at = GETUTCDATE()
+		WHERE id = @p3 AND status = @p4
+	`, status, nullString(reason), withdrawalID, models.WithdrawalStatusSubmitted)
+	if err != nil {
+		return nil, fmt.Errorf("error updating withdrawal: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return nil, fmt.Errorf("%w: withdrawal is %s, not %s", ErrWithdrawalStatus, w.Status, models.WithdrawalStatusSubmitted)
+	}
+
+	// Completed shares leave the books; failed ones go back into stock inventory
+	debitAccount, description, action := "stock_withdrawn", "Withdrawal completed", models.AuditWithdrawalComplete
+	if status == models.WithdrawalStatusFailed {
+		debitAccount, description, action = "stock_inventory", "Withdrawal failed", models.AuditWithdrawalFail
+	}
+	transactionID, err := postWithdrawal(ctx, tx, *w, debitAccount, "stock_in_transit", description)
+	if err != nil {
+		return nil, err
+	}
+
+	if status == models.WithdrawalStatusFailed {
+		var before, after float64
+		err = tx.QueryRowContext(ctx, `
+			UPDATE user_holdings
+			SET quantity = quantity + @p1, settled_quantity = settled_quantity + @p1, updated_at = GETUTCDATE(), last_updated = GETUTCDATE()
+			OUTPUT deleted.quantity, inserted.quantity
+			WHERE user_id = @p2 AND stock_symbol = @p3
+		`, w.Quantity, w.UserID, w.StockSymbol).Scan(&before, &after)
+		if err != nil {
+			return nil, fmt.Errorf("error restoring holding for failed withdrawal: %w", err)
+		}
+
+		// The shares go back into the lots they came from. Withdrawals
+		// requested before lots were tracked took none, so their shares
+		// reopen as a lot acquired on the withdrawal date.
+		restored, err := restoreLots(ctx, tx, models.DisposalWithdrawal, withdrawalID)
+		if err != nil {
+			return nil, err
+		}
+		if missing := roundTo(w.Quantity-restored, quantityPlaces); missing > 0 {
+			err = createLot(ctx, tx, models.TaxLot{
+				UserID:       w.UserID,
+				StockSymbol:  w.StockSymbol,
+				Source:       models.LotSourceOpening,
+				SourceID:     withdrawalID,
+				AcquiredOn:   calendarDate(startOfDayIST(w.CreatedAt)),
+				Quantity:     missing,
+				CostPerShare: roundTo(w.CostValue/w.Quantity, amountPlaces),
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		err = recordAudit(ctx, tx, models.AuditHoldingRestore, models.AuditEntityHolding, holdingEntityID(w.UserID, w.StockSymbol),
+			map[string]interface{}{"quantity": before},
+			map[string]interface{}{"quantity": after, "withdrawal_id": withdrawalID, "transaction_id": transactionID},
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = recordAudit(ctx, tx, action, models.AuditEntityWithdrawal, withdrawalID.String(),
+		map[string]interface{}{"status": models.WithdrawalStatusSubmitted},
+		map[string]interface{}{"status": status, "reason": reason, "transaction_id": transactionID},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"withdrawal_id": withdrawalID,
+		"status":        status,
+		"reason":        reason,
+	}).Info("Withdrawal finished")
+
+	if status == models.WithdrawalStatusFailed {
+		PortfolioEvents().PublishUser(w.UserID)
+	}
+
+	return getWithdrawal(ctx, withdrawalID)
+}
+
+// postWithdrawal moves a withdrawal's shares between two stock accounts at
+// their cost and returns the ledger transaction ID
+func postWithdrawal(ctx context.Context, tx *sql.Tx, w models.Withdrawal, debitAccount, creditAccount, description string) (uuid.UUID, error) {
+	transactionID := uuid.New()
+	entries := []struct {
+		account       string
+		debit, credit float64
+	}{
+		{debitAccount, w.CostValue, 0},
+		{creditAccount, 0, w.CostValue},
+	}
+	for _, e := range entries {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO ledger_entries (transaction_id, user_id, account_type, account_symbol, debit_amount, credit_amount, stock_quantity, description, reference_id)
+			VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8, @p9)
+		`, transactionID, w.UserID, e.account, w.StockSymbol, e.debit, e.credit, w.Quantity,
+			fmt.Sprintf("%s: %s x %.0f", description, w.StockSymbol, w.Quantity), w.ID.String())
+		if err != nil {
+			return uuid.Nil, fmt.Errorf("error creating withdrawal ledger entry: %w", err)
+		}
+	}
+	return transactionID, nil
+}
+
+// withdrawalColumnList selects a withdrawals row aliased w, scanned with withdrawalFields
+const withdrawalColumnList = `w.id, w.user_id, w.demat_account_id, w.stock_symbol, w.quantity, w.cost_value, w.status, w.batch_id,
+	w.failure_reason, w.submitted_at, w.completed_at, w.failed_at, w.created_by, w.created_at, w.updated_at`
+
+// withdrawalFields returns scan destinations matching withdrawalColumnList
+func withdrawalFields(w *models.Withdrawal) []interface{} {
+	return []interface{}{
+		&w.ID, &w.UserID, &w.DematAccountID, &w.StockSymbol, &w.Quantity, &w.CostValue, &w.Status, &w.BatchID,
+		&w.FailureReason, &w.SubmittedAt, &w.CompletedAt, &w.FailedAt, &w.CreatedBy, &w.CreatedAt, &w.UpdatedAt,
+	}
+}
+
+// getWithdrawal loads a withdrawal by ID
+func getWithdrawal(ctx context.Context, withdrawalID uuid.UUID) (*models.Withdrawal, error) {
+	var w models.Withdrawal
+	err := database.DB.QueryRowContext(ctx,
+		"SELECT "+withdrawalColumnList+" FROM withdrawals w WHERE w.id = @p1", withdrawalID,
+	).Scan(withdrawalFields(&w)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrWithdrawalNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching withdrawal: %w", err)
+	}
+	return &w, nil
+}
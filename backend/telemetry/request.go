@@ -0,0 +1,55 @@
+package telemetry
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// HeaderRequestID carries the request ID in requests and responses
+const HeaderRequestID = "X-Request-ID"
+
+// maxRequestIDLength bounds caller-supplied request IDs
+const maxRequestIDLength = 100
+
+// RequestInfo identifies a request for logs and the audit log
+type RequestInfo struct {
+	ID       string
+	SourceIP string
+}
+
+type requestKey struct{}
+
+// WithRequest returns a context carrying info
+func WithRequest(ctx context.Context, info RequestInfo) context.Context {
+	return context.WithValue(ctx, requestKey{}, info)
+}
+
+// RequestFrom returns the request info in ctx, if any
+func RequestFrom(ctx context.Context) (RequestInfo, bool) {
+	info, ok := ctx.Value(requestKey{}).(RequestInfo)
+	return info, ok
+}
+
+// NewJobRequest returns a context for one run of a background job, with its
+// own request ID so its changes can be grouped in the audit log
+func NewJobRequest(ctx context.Context) context.Context {
+	return WithRequest(ctx, RequestInfo{ID: uuid.NewString()})
+}
+
+// RequestMiddleware assigns each request an ID, reusing the caller's
+// X-Request-ID when present, and echoes it in the response
+func RequestMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(HeaderRequestID)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = uuid.NewString()
+		}
+		c.Header(HeaderRequestID, id)
+
+		info := RequestInfo{ID: id, SourceIP: c.ClientIP()}
+		c.Request = c.Request.WithContext(WithRequest(c.Request.Context(), info))
+		c.Next()
+	}
+}
@@ -0,0 +1,116 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName identifies this process in traces
+const ServiceName = "stocky-backend"
+
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterNone   = "none"
+)
+
+var tracer = otel.Tracer("backend")
+
+// Init installs the global tracer provider and W3C trace context propagation.
+// exporter is one of "otlp", "stdout" or "none"; the OTLP exporter reads the
+// standard OTEL_EXPORTER_OTLP_* environment variables for its endpoint.
+// Spans are still created with "none" so trace IDs appear in logs.
+// The returned function flushes and stops the provider.
+func Init(ctx context.Context, exporter string) (func(context.Context) error, error) {
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(ServiceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("error building trace resource: %w", err)
+	}
+
+	opts := []sdktrace.TracerProviderOption{sdktrace.WithResource(res)}
+
+	switch exporter {
+	case ExporterOTLP:
+		exp, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error creating OTLP trace exporter: %w", err)
+		}
+		opts = append(opts, sdktrace.WithBatcher(exp))
+	case ExporterStdout:
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return nil, fmt.Errorf("error creating stdout trace exporter: %w", err)
+		}
+		opts = append(opts, sdktrace.WithBatcher(exp))
+	case ExporterNone, "":
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", exporter)
+	}
+
+	provider := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	logrus.AddHook(traceHook{})
+
+	return provider.Shutdown, nil
+}
+
+// StartSpan starts a child span of whatever span ctx carries
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// EndSpan records *errp on the span, if set, and ends it. Use with a named error result:
+//
+//	ctx, span := telemetry.StartSpan(ctx, "Service.Method")
+//	defer telemetry.EndSpan(span, &err)
+func EndSpan(span trace.Span, errp *error) {
+	if errp != nil && *errp != nil {
+		span.RecordError(*errp)
+		span.SetStatus(codes.Error, (*errp).Error())
+	}
+	span.End()
+}
+
+// traceHook adds request, trace and span IDs to log entries created with logrus.WithContext
+type traceHook struct{}
+
+func (traceHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (traceHook) Fire(entry *logrus.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+	if info, ok := RequestFrom(entry.Context); ok {
+		entry.Data["request_id"] = info.ID
+	}
+	spanCtx := trace.SpanContextFromContext(entry.Context)
+	if !spanCtx.IsValid() {
+		return nil
+	}
+	entry.Data["trace_id"] = spanCtx.TraceID().String()
+	entry.Data["span_id"] = spanCtx.SpanID().String()
+	return nil
+}